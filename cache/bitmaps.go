@@ -0,0 +1,655 @@
+package cache
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// commands needed to be implemented:
+// SETBIT, GETBIT			--> Done
+// BITCOUNT					--> Done
+// BITPOS					--> Done
+// BITOP					--> Done
+// BITFIELD, BITFIELD_RO	--> Done
+
+// bitmaps are not a data type of their own, they are string entries whose bytes are read as a row of bits
+// bit 0 is the most significant bit of the first byte, so SETBIT key 7 1 on a missing key gives "\x01"
+// GET/SET/APPEND see exactly the same bytes, and bits past the end of the string read as 0
+
+// parseBitOffset reads the offset argument of SETBIT/GETBIT, it has to point inside a string of at most proto-max-bulk-len bytes
+func(r *RedisCache) parseBitOffset(arg []byte) (int64, error) {
+	offset, ok := parseInteger(arg)
+	if !ok || offset < 0 || offset >= r.Config.ProtoMaxBulkLen*8 {
+		return 0, ErrBitOffset
+	}
+	return offset, nil
+}
+
+func(r *RedisCache) SETBIT(key string, offset int64, bit int) (int, error) {
+	// command syntax: SETBIT key offset value --> returns the bit that was stored at offset before
+	// the string grows (zero-padded) as far as needed to hold offset
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		entry = &Entry{Type: "string", Value: []byte{}}
+		r.setEntry(key, entry)
+	} else if _, isString := stringBytes(entry.Value); !isString {
+		return 0, ErrWrongType
+	}
+
+	value := stringForWrite(entry, int(offset>>3)+1)
+
+	mask := byte(0x80) >> (offset & 7)
+	previous := 0
+	if value[offset>>3]&mask != 0 {
+		previous = 1
+	}
+
+	if bit == 1 {
+		value[offset>>3] |= mask
+	} else {
+		value[offset>>3] &^= mask
+	}
+
+	return previous, nil
+}
+
+func(r *RedisCache) GETBIT(key string, offset int64) (int, error) {
+	// command syntax: GETBIT key offset --> 0 for a missing key or an offset past the end of the string
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return 0, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return 0, ErrWrongType
+	}
+
+	if offset>>3 >= int64(len(value)) || value[offset>>3]&(byte(0x80)>>(offset&7)) == 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// BitRange is the optional "start end [BYTE | BIT]" part of BITCOUNT and BITPOS
+// negative offsets count from the end, like in GETRANGE
+type BitRange struct {
+	Start 		int64
+	End 		int64
+	HasStart 	bool
+	HasEnd 		bool
+	Bit 		bool // the offsets are bits instead of bytes
+}
+
+// parseBitRange reads [start [end [BYTE | BIT]]], BITCOUNT needs both start and end or neither, BITPOS may leave out end
+func parseBitRange(args [][]byte, startOnly bool) (BitRange, error) {
+	var rng BitRange
+
+	if len(args) > 3 || (len(args) == 1 && !startOnly) {
+		return rng, ErrSyntax
+	}
+
+	if len(args) >= 1 {
+		start, ok := parseInteger(args[0])
+		if !ok {
+			return rng, ErrNotInteger
+		}
+		rng.Start, rng.HasStart = start, true
+	}
+
+	if len(args) >= 2 {
+		end, ok := parseInteger(args[1])
+		if !ok {
+			return rng, ErrNotInteger
+		}
+		rng.End, rng.HasEnd = end, true
+	}
+
+	if len(args) == 3 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BYTE":
+		case "BIT":
+			rng.Bit = true
+		default:
+			return rng, ErrSyntax
+		}
+	}
+
+	return rng, nil
+}
+
+// bits converts the range into absolute, inclusive bit offsets inside a string of length bytes
+// ok is false if the range is empty
+func(rng BitRange) bits(length int64) (startBit int64, endBit int64, ok bool) {
+	total := length
+	if rng.Bit {
+		total = length * 8
+	}
+
+	start, end := int64(0), total-1
+	if rng.HasStart {
+		start = rng.Start
+	}
+	if rng.HasEnd {
+		end = rng.End
+	}
+
+	if start < 0 && end < 0 && start > end {
+		return 0, 0, false
+	}
+
+	if start < 0 {
+		start = total + start
+	}
+	if end < 0 {
+		end = total + end
+	}
+	start = max(start, 0)
+	end = max(end, 0)
+	end = min(end, total-1)
+
+	if start > end {
+		return 0, 0, false
+	}
+
+	if rng.Bit {
+		return start, end, true
+	}
+	return start * 8, end*8 + 7, true
+}
+
+func(r *RedisCache) BITCOUNT(key string, rng BitRange) (int64, error) {
+	// command syntax: BITCOUNT key [start end [BYTE | BIT]] --> the number of bits set to 1
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return 0, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return 0, ErrWrongType
+	}
+
+	startBit, endBit, ok := rng.bits(int64(len(value)))
+	if !ok {
+		return 0, nil
+	}
+
+	firstByte, lastByte := startBit>>3, endBit>>3
+
+	// the first and last byte may only be partly inside the range
+	if firstByte == lastByte {
+		return int64(bits.OnesCount8(value[firstByte] & firstByteMask(startBit) & lastByteMask(endBit))), nil
+	}
+	count := bits.OnesCount8(value[firstByte]&firstByteMask(startBit)) + bits.OnesCount8(value[lastByte]&lastByteMask(endBit))
+
+	// everything in between is counted 8 bytes at a time
+	middle := value[firstByte+1 : lastByte]
+	for len(middle) >= 8 {
+		count += bits.OnesCount64(binary.BigEndian.Uint64(middle))
+		middle = middle[8:]
+	}
+	for _, b := range middle {
+		count += bits.OnesCount8(b)
+	}
+
+	return int64(count), nil
+}
+
+// firstByteMask keeps the bits of a byte at or after bit, lastByteMask the ones at or before it
+func firstByteMask(bit int64) byte {
+	return 0xff >> (bit & 7)
+}
+
+func lastByteMask(bit int64) byte {
+	return 0xff << (7 - bit&7)
+}
+
+func(r *RedisCache) BITPOS(key string, bit int, rng BitRange) (int64, error) {
+	// command syntax: BITPOS key bit [start [end [BYTE | BIT]]] --> the offset of the first bit set to bit, or -1
+	// without an explicit end the string counts as padded with zeros on the right,
+	// so looking for a 0 in "\xff\xff" finds bit 16 instead of failing
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		if bit == 1 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return 0, ErrWrongType
+	}
+
+	startBit, endBit, ok := rng.bits(int64(len(value)))
+	if !ok {
+		return -1, nil
+	}
+
+	// a byte that is all 0s (when looking for a 1) or all 1s (when looking for a 0) can be skipped as a whole
+	skip := byte(0x00)
+	if bit == 0 {
+		skip = 0xff
+	}
+
+	for pos := startBit; pos <= endBit; {
+		b := value[pos>>3]
+		if pos&7 == 0 && pos+7 <= endBit && b == skip {
+			pos += 8
+			continue
+		}
+
+		if int((b>>(7-pos&7))&1) == bit {
+			return pos, nil
+		}
+		pos++
+	}
+
+	if bit == 0 && !rng.HasEnd {
+		return endBit + 1, nil
+	}
+	return -1, nil
+}
+
+func(r *RedisCache) BITOP(operation string, destination string, keys []string) (int, error) {
+	// command syntax: BITOP AND | OR | XOR | NOT destkey key [key ...] --> the length of the string stored in destkey
+	// shorter strings and missing keys count as padded with zero bytes, an empty result deletes destkey
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sources := make([][]byte, len(keys))
+	length := 0
+	for i, key := range keys {
+		entry, exists := r.lookup(key)
+		if !exists {
+			continue
+		}
+
+		value, isString := stringBytes(entry.Value)
+		if !isString {
+			return 0, ErrWrongType
+		}
+		sources[i] = value
+		length = max(length, len(value))
+	}
+
+	if length == 0 {
+		r.deleteEntry(destination)
+		return 0, nil
+	}
+
+	// a fresh slice: destkey may be one of the sources
+	result := make([]byte, length)
+	switch operation {
+	case "NOT":
+		for i := range result {
+			if i < len(sources[0]) {
+				result[i] = ^sources[0][i]
+			} else {
+				result[i] = 0xff
+			}
+		}
+
+	case "AND":
+		for i := range result {
+			b := byte(0xff)
+			for _, source := range sources {
+				if i >= len(source) {
+					b = 0
+					break
+				}
+				b &= source[i]
+			}
+			result[i] = b
+		}
+
+	case "OR", "XOR":
+		copy(result, sources[0])
+		for _, source := range sources[1:] {
+			for i, b := range source {
+				if operation == "OR" {
+					result[i] |= b
+				} else {
+					result[i] ^= b
+				}
+			}
+		}
+	}
+
+	// like SET, the result replaces whatever destkey held, TTL included
+	r.setEntry(destination, &Entry{Type: "string", Value: result})
+	return length, nil
+}
+
+// BITFIELD works on integers of any width from 1 to 64 bits at arbitrary bit offsets
+// "i8" is a signed 8 bit integer, "u4" an unsigned 4 bit one; u64 is not supported because the reply is a signed 64 bit integer
+
+const (
+	BitfieldGet = iota
+	BitfieldSet
+	BitfieldIncrBy
+)
+
+// what happens when SET or INCRBY does not fit into the integer type, chosen with OVERFLOW WRAP | SAT | FAIL
+const (
+	OverflowWrap = iota // wrap around, like integer arithmetic in C (the default)
+	OverflowSat // saturate at the minimum or maximum value
+	OverflowFail // do nothing and reply with nil for this operation
+)
+
+type BitfieldOp struct {
+	Kind 		int // BitfieldGet, BitfieldSet or BitfieldIncrBy
+	Signed 		bool
+	Width 		uint
+	Offset 		int64 // in bits
+	Value 		int64 // the value for SET, the increment for INCRBY
+	Overflow 	int // the OVERFLOW mode in effect for this operation
+}
+
+// BitfieldResult is the reply to one operation, Failed is set when OVERFLOW FAIL kept it from writing
+type BitfieldResult struct {
+	Value 	int64
+	Failed 	bool
+}
+
+// parseBitfieldOps reads the operations after "BITFIELD key", BITFIELD_RO only allows GET
+func(r *RedisCache) parseBitfieldOps(args [][]byte, readOnly bool) ([]BitfieldOp, error) {
+	ops := []BitfieldOp{}
+	overflow := OverflowWrap
+
+	for i := 0; i < len(args); {
+		subcommand := strings.ToUpper(string(args[i]))
+
+		if subcommand == "OVERFLOW" {
+			if i+1 == len(args) {
+				return nil, ErrSyntax
+			}
+
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = OverflowWrap
+			case "SAT":
+				overflow = OverflowSat
+			case "FAIL":
+				overflow = OverflowFail
+			default:
+				return nil, ErrInvalidOverflow
+			}
+			i += 2
+			continue
+		}
+
+		op := BitfieldOp{Overflow: overflow}
+		arity := 3
+		switch subcommand {
+		case "GET":
+			op.Kind = BitfieldGet
+		case "SET":
+			op.Kind = BitfieldSet
+			arity = 4
+		case "INCRBY":
+			op.Kind = BitfieldIncrBy
+			arity = 4
+		default:
+			return nil, ErrSyntax
+		}
+
+		if i+arity > len(args) {
+			return nil, ErrSyntax
+		}
+
+		signed, width, ok := parseBitfieldType(args[i+1])
+		if !ok {
+			return nil, ErrBitfieldType
+		}
+		op.Signed, op.Width = signed, width
+
+		offset, err := r.parseBitfieldOffset(args[i+2], width)
+		if err != nil {
+			return nil, err
+		}
+		op.Offset = offset
+
+		if arity == 4 {
+			value, ok := parseInteger(args[i+3])
+			if !ok {
+				return nil, ErrNotInteger
+			}
+			op.Value = value
+		}
+
+		if readOnly && op.Kind != BitfieldGet {
+			return nil, ErrBitfieldReadOnly
+		}
+
+		ops = append(ops, op)
+		i += arity
+	}
+
+	return ops, nil
+}
+
+// parseBitfieldType reads "i1" to "i64" and "u1" to "u63"
+func parseBitfieldType(arg []byte) (bool, uint, bool) {
+	if len(arg) < 2 || (arg[0] != 'i' && arg[0] != 'I' && arg[0] != 'u' && arg[0] != 'U') {
+		return false, 0, false
+	}
+
+	signed := arg[0] == 'i' || arg[0] == 'I'
+	width, ok := parseInteger(arg[1:])
+	if !ok || width < 1 || (signed && width > 64) || (!signed && width > 63) {
+		return false, 0, false
+	}
+
+	return signed, uint(width), true
+}
+
+// parseBitfieldOffset reads a bit offset, "#N" means the N-th integer of this width (N * width)
+func(r *RedisCache) parseBitfieldOffset(arg []byte, width uint) (int64, error) {
+	multiply := len(arg) > 0 && arg[0] == '#'
+	if multiply {
+		arg = arg[1:]
+	}
+
+	offset, ok := parseInteger(arg)
+	if !ok || offset < 0 {
+		return 0, ErrBitOffset
+	}
+
+	if multiply {
+		if offset > math.MaxInt64/int64(width) {
+			return 0, ErrBitOffset
+		}
+		offset *= int64(width)
+	}
+
+	if offset >= r.Config.ProtoMaxBulkLen*8 {
+		return 0, ErrBitOffset
+	}
+	return offset, nil
+}
+
+func(r *RedisCache) BITFIELD(key string, ops []BitfieldOp) ([]BitfieldResult, error) {
+	// command syntax: BITFIELD key [GET encoding offset | [OVERFLOW WRAP | SAT | FAIL] SET encoding offset value | INCRBY encoding offset increment ...]
+	// every operation gets one reply: GET the value, SET the old value, INCRBY the new value
+	// all of them run under one lock, so a BITFIELD is atomic no matter how many operations it has
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the string is grown once, to cover the furthest bit any SET or INCRBY touches
+	length := 0
+	for _, op := range ops {
+		if op.Kind != BitfieldGet {
+			length = max(length, int((op.Offset+int64(op.Width)-1)>>3)+1)
+		}
+	}
+
+	entry, exists := r.lookup(key)
+	var value []byte
+	if exists {
+		var isString bool
+		value, isString = stringBytes(entry.Value)
+		if !isString {
+			return nil, ErrWrongType
+		}
+	}
+
+	if length > 0 {
+		if !exists {
+			entry = &Entry{Type: "string", Value: []byte{}}
+			r.setEntry(key, entry)
+		}
+		value = stringForWrite(entry, length)
+	}
+
+	results := make([]BitfieldResult, len(ops))
+	for i, op := range ops {
+		raw := getBitfield(value, op.Offset, op.Width)
+		current := int64(raw)
+		if op.Signed {
+			current = signExtend(raw, op.Width)
+		}
+
+		if op.Kind == BitfieldGet {
+			results[i].Value = current
+			continue
+		}
+
+		var updated int64
+		var ok bool
+		if op.Kind == BitfieldSet {
+			// SET is an INCRBY of 0 on top of the new value, so the same overflow rules apply to it
+			updated, ok = bitfieldOverflow(op, op.Value, 0)
+			results[i].Value = current
+		} else {
+			updated, ok = bitfieldOverflow(op, current, op.Value)
+			results[i].Value = updated
+		}
+
+		if !ok {
+			results[i] = BitfieldResult{Failed: true}
+			continue
+		}
+
+		setBitfield(value, op.Offset, op.Width, uint64(updated))
+	}
+
+	return results, nil
+}
+
+// bitfieldOverflow computes value + increment for the integer type of op, following its OVERFLOW mode
+// ok is false when the result does not fit and the mode is FAIL
+func bitfieldOverflow(op BitfieldOp, value int64, increment int64) (int64, bool) {
+	if op.Signed {
+		maxValue := int64(math.MaxInt64)
+		if op.Width < 64 {
+			maxValue = int64(1)<<(op.Width-1) - 1
+		}
+		minValue := -maxValue - 1
+
+		// maxValue-value and minValue-value are only computed when they cannot overflow an int64 themselves:
+		// value is inside the type's range, and for i64 the increment can only overflow in the direction of value's sign
+		overflow := value > maxValue || (increment > 0 && value >= minValue && (value >= 0 || op.Width < 64) && increment > maxValue-value)
+		underflow := value < minValue || (increment < 0 && value <= maxValue && (value < 0 || op.Width < 64) && increment < minValue-value)
+
+		if !overflow && !underflow {
+			return value + increment, true
+		}
+
+		switch op.Overflow {
+		case OverflowSat:
+			if overflow {
+				return maxValue, true
+			}
+			return minValue, true
+		case OverflowFail:
+			return 0, false
+		}
+		return signExtend(uint64(value)+uint64(increment), op.Width), true
+	}
+
+	maxValue := uint64(1)<<op.Width - 1
+	current := uint64(value)
+
+	// a negative SET value is a huge unsigned one, so it overflows rather than underflows
+	overflow := current > maxValue || (increment > 0 && uint64(increment) > maxValue-current)
+	underflow := !overflow && increment < 0 && uint64(-increment) > current
+
+	if !overflow && !underflow {
+		return int64(current + uint64(increment)), true
+	}
+
+	switch op.Overflow {
+	case OverflowSat:
+		if overflow {
+			return int64(maxValue), true
+		}
+		return 0, true
+	case OverflowFail:
+		return 0, false
+	}
+	return int64((current + uint64(increment)) & maxValue), true
+}
+
+// getBitfield reads width bits starting at offset as an unsigned integer, bits past the end of value are 0
+func getBitfield(value []byte, offset int64, width uint) uint64 {
+	var result uint64
+	for i := int64(0); i < int64(width); i++ {
+		pos := offset + i
+		bit := uint64(0)
+		if pos>>3 < int64(len(value)) {
+			bit = uint64(value[pos>>3]>>(7-pos&7)) & 1
+		}
+		result = result<<1 | bit
+	}
+	return result
+}
+
+// setBitfield writes the lowest width bits of n starting at offset, value must be long enough already
+func setBitfield(value []byte, offset int64, width uint, n uint64) {
+	for i := int64(0); i < int64(width); i++ {
+		pos := offset + i
+		mask := byte(0x80) >> (pos & 7)
+		if n&(uint64(1)<<(int64(width)-1-i)) != 0 {
+			value[pos>>3] |= mask
+		} else {
+			value[pos>>3] &^= mask
+		}
+	}
+}
+
+// signExtend interprets the lowest width bits of n as a two's complement number
+func signExtend(n uint64, width uint) int64 {
+	if width == 64 {
+		return int64(n)
+	}
+	n &= uint64(1)<<width - 1
+	if n&(uint64(1)<<(width-1)) != 0 {
+		n |= math.MaxUint64 << width
+	}
+	return int64(n)
+}
+
+// parseBit reads the 0 or 1 argument of SETBIT and BITPOS
+func parseBit(arg []byte) (int, bool) {
+	n, ok := parseInteger(arg)
+	if !ok || (n != 0 && n != 1) {
+		return 0, false
+	}
+	return int(n), true
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestSetBitAndGetBit(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SETBIT", "k", "7", "1"}, ":0\r\n"},
+		{[]string{"SETBIT", "k", "7", "1"}, ":1\r\n"},
+		{[]string{"GETBIT", "k", "0"}, ":0\r\n"},
+		{[]string{"GETBIT", "k", "7"}, ":1\r\n"},
+		{[]string{"GETBIT", "k", "100"}, ":0\r\n"},
+		{[]string{"GET", "k"}, "$1\r\n\x01\r\n"},
+
+		// the string grows with zero bytes, and it is a normal string for every other command
+		{[]string{"SETBIT", "k", "23", "1"}, ":0\r\n"},
+		{[]string{"GET", "k"}, "$3\r\n\x01\x00\x01\r\n"},
+		{[]string{"SETBIT", "k", "7", "0"}, ":1\r\n"},
+		{[]string{"STRLEN", "k"}, ":3\r\n"},
+
+		// bits of a SET value, "1" is 0x31 and stored with the integer encoding
+		{[]string{"SET", "n", "1"}, "+OK\r\n"},
+		{[]string{"GETBIT", "n", "2"}, ":1\r\n"},
+		{[]string{"SETBIT", "n", "6", "1"}, ":0\r\n"},
+		{[]string{"GET", "n"}, "$1\r\n3\r\n"},
+
+		{[]string{"SETBIT", "k", "-1", "1"}, "-ERR bit offset is not an integer or out of range\r\n"},
+		{[]string{"SETBIT", "k", "4294967296", "1"}, "-ERR bit offset is not an integer or out of range\r\n"},
+		{[]string{"SETBIT", "k", "1", "2"}, "-ERR bit is not an integer or out of range\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"SETBIT", "list", "1", "1"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"GETBIT", "list", "1"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestBitCount(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SET", "k", "foobar"}, "+OK\r\n"},
+		{[]string{"BITCOUNT", "k"}, ":26\r\n"},
+		{[]string{"BITCOUNT", "k", "0", "0"}, ":4\r\n"},
+		{[]string{"BITCOUNT", "k", "1", "1"}, ":6\r\n"},
+		{[]string{"BITCOUNT", "k", "1", "1", "BYTE"}, ":6\r\n"},
+		{[]string{"BITCOUNT", "k", "5", "30", "BIT"}, ":17\r\n"},
+		{[]string{"BITCOUNT", "k", "-2", "-1"}, ":7\r\n"},
+		{[]string{"BITCOUNT", "k", "-1", "-2"}, ":0\r\n"},
+		{[]string{"BITCOUNT", "k", "0", "100"}, ":26\r\n"},
+		{[]string{"BITCOUNT", "missing"}, ":0\r\n"},
+		{[]string{"BITCOUNT", "k", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"BITCOUNT", "k", "0", "1", "WORD"}, "-ERR syntax error\r\n"},
+		{[]string{"BITCOUNT", "k", "a", "1"}, "-ERR value is not an integer or out of range\r\n"},
+	});
+
+	// long enough for the 8-bytes-at-a-time loop
+	long := make([]byte, 100);
+	for i := range long {
+		long[i] = 0xff;
+	};
+	cache.SET("long", long, SetOptions{});
+	runSteps(t, cache, []step{
+		{[]string{"BITCOUNT", "long"}, ":800\r\n"},
+		{[]string{"BITCOUNT", "long", "3", "794", "BIT"}, ":792\r\n"},
+	});
+}
+
+func TestBitPos(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SET", "k", "\xff\xf0\x00"}, "+OK\r\n"},
+		{[]string{"BITPOS", "k", "0"}, ":12\r\n"},
+
+		{[]string{"SET", "k", "\x00\xff\xf0"}, "+OK\r\n"},
+		{[]string{"BITPOS", "k", "1", "0"}, ":8\r\n"},
+		{[]string{"BITPOS", "k", "1", "2"}, ":16\r\n"},
+		{[]string{"BITPOS", "k", "1", "2", "-1", "BYTE"}, ":16\r\n"},
+		{[]string{"BITPOS", "k", "1", "7", "15", "BIT"}, ":8\r\n"},
+		{[]string{"BITPOS", "k", "1", "7", "-3", "BIT"}, ":8\r\n"},
+
+		{[]string{"SET", "k", "\x00\x00\x00"}, "+OK\r\n"},
+		{[]string{"BITPOS", "k", "1"}, ":-1\r\n"},
+
+		// looking for a 0 in a string of 1s: past the end, unless the range was given explicitly
+		{[]string{"SET", "k", "\xff\xff"}, "+OK\r\n"},
+		{[]string{"BITPOS", "k", "0"}, ":16\r\n"},
+		{[]string{"BITPOS", "k", "0", "1"}, ":16\r\n"},
+		{[]string{"BITPOS", "k", "0", "0", "-1"}, ":-1\r\n"},
+
+		{[]string{"BITPOS", "missing", "1"}, ":-1\r\n"},
+		{[]string{"BITPOS", "missing", "0"}, ":0\r\n"},
+		{[]string{"BITPOS", "k", "2"}, "-ERR The bit argument must be 1 or 0.\r\n"},
+	});
+}
+
+func TestBitOp(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SET", "a", "foobar"}, "+OK\r\n"},
+		{[]string{"SET", "b", "abcdef"}, "+OK\r\n"},
+		{[]string{"BITOP", "AND", "dest", "a", "b"}, ":6\r\n"},
+		{[]string{"GET", "dest"}, "$6\r\n`bc`ab\r\n"},
+		{[]string{"BITOP", "OR", "dest", "a", "b"}, ":6\r\n"},
+		{[]string{"GET", "dest"}, "$6\r\ngoofev\r\n"},
+
+		// missing keys and shorter strings are padded with zero bytes
+		{[]string{"SET", "short", "\xff"}, "+OK\r\n"},
+		{[]string{"SET", "long", "\x0f\xff"}, "+OK\r\n"},
+		{[]string{"BITOP", "XOR", "dest", "short", "long", "missing"}, ":2\r\n"},
+		{[]string{"GET", "dest"}, "$2\r\n\xf0\xff\r\n"},
+		{[]string{"BITOP", "AND", "dest", "short", "long"}, ":2\r\n"},
+		{[]string{"GET", "dest"}, "$2\r\n\x0f\x00\r\n"},
+		{[]string{"BITOP", "NOT", "dest", "long"}, ":2\r\n"},
+		{[]string{"GET", "dest"}, "$2\r\n\xf0\x00\r\n"},
+
+		// the destination can be one of the sources, and an empty result deletes it
+		{[]string{"BITOP", "NOT", "short", "short"}, ":1\r\n"},
+		{[]string{"GET", "short"}, "$1\r\n\x00\r\n"},
+		{[]string{"BITOP", "OR", "dest", "missing"}, ":0\r\n"},
+		{[]string{"GET", "dest"}, "$-1\r\n"},
+
+		{[]string{"BITOP", "NOT", "dest", "a", "b"}, "-ERR BITOP NOT must be called with a single source key.\r\n"},
+		{[]string{"BITOP", "NAND", "dest", "a", "b"}, "-ERR syntax error\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"BITOP", "OR", "dest", "a", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestBitField(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"BITFIELD", "k", "INCRBY", "i5", "100", "1", "GET", "u4", "0"}, "*2\r\n:1\r\n:0\r\n"},
+
+		// unsigned saturation and failure, from the Redis documentation
+		{[]string{"BITFIELD", "c", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:1\r\n:1\r\n"},
+		{[]string{"BITFIELD", "c", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:2\r\n:2\r\n"},
+		{[]string{"BITFIELD", "c", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:3\r\n:3\r\n"},
+		{[]string{"BITFIELD", "c", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, "*2\r\n:0\r\n:3\r\n"},
+		{[]string{"BITFIELD", "c", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1"}, "*1\r\n$-1\r\n"},
+		{[]string{"BITFIELD", "c", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "-3", "INCRBY", "u2", "102", "-1"}, "*2\r\n:0\r\n$-1\r\n"},
+
+		// signed wrap around and saturation
+		{[]string{"BITFIELD", "s", "SET", "i8", "0", "127", "INCRBY", "i8", "0", "1"}, "*2\r\n:0\r\n:-128\r\n"},
+		{[]string{"BITFIELD", "s", "OVERFLOW", "SAT", "INCRBY", "i8", "0", "-1"}, "*1\r\n:-128\r\n"},
+		{[]string{"BITFIELD", "s", "OVERFLOW", "SAT", "SET", "i8", "0", "-9223372036854775808", "GET", "i8", "0"}, "*2\r\n:-128\r\n:-128\r\n"},
+		{[]string{"BITFIELD", "s", "SET", "i8", "0", "300", "GET", "i8", "0"}, "*2\r\n:-128\r\n:44\r\n"},
+		{[]string{"BITFIELD", "s", "SET", "i64", "8", "9223372036854775807", "INCRBY", "i64", "8", "1"}, "*2\r\n:0\r\n:-9223372036854775808\r\n"},
+		{[]string{"BITFIELD", "s", "OVERFLOW", "SAT", "INCRBY", "i64", "8", "-1"}, "*1\r\n:-9223372036854775808\r\n"},
+		{[]string{"BITFIELD", "s", "SET", "u8", "0", "-1", "GET", "u8", "0"}, "*2\r\n:44\r\n:255\r\n"},
+
+		// #N offsets count in units of the type's width, and the bytes are a plain string
+		{[]string{"BITFIELD", "b", "SET", "u8", "#0", "104", "SET", "u8", "#1", "105"}, "*2\r\n:0\r\n:0\r\n"},
+		{[]string{"GET", "b"}, "$2\r\nhi\r\n"},
+		{[]string{"BITFIELD_RO", "b", "GET", "u4", "0", "GET", "i8", "#1"}, "*2\r\n:6\r\n:105\r\n"},
+
+		// reading a missing key does not create it
+		{[]string{"BITFIELD", "missing", "GET", "u8", "0"}, "*1\r\n:0\r\n"},
+		{[]string{"GET", "missing"}, "$-1\r\n"},
+
+		{[]string{"BITFIELD_RO", "b", "SET", "u8", "0", "1"}, "-ERR BITFIELD_RO only supports the GET subcommand\r\n"},
+		{[]string{"BITFIELD", "b", "GET", "u64", "0"}, "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n"},
+		{[]string{"BITFIELD", "b", "GET", "i65", "0"}, "-ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.\r\n"},
+		{[]string{"BITFIELD", "b", "GET", "u8", "-1"}, "-ERR bit offset is not an integer or out of range\r\n"},
+		{[]string{"BITFIELD", "b", "OVERFLOW", "SOMETIMES"}, "-ERR Invalid OVERFLOW type specified\r\n"},
+		{[]string{"BITFIELD", "b", "SET", "u8", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"BITFIELD", "b", "SET", "u8", "0", "x"}, "-ERR value is not an integer or out of range\r\n"},
+	});
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// blocking commands (XREAD BLOCK, BLPOP, ...) park the client's connection goroutine until one of their keys gets new data
+// every waiting client registers a waiter for the keys it waits on, commands that add data to a key signal it
+// waiters are kept per key in the order they started waiting, so the client that waits the longest is served first
+//
+// there are two kinds of waiters:
+// 1. readers (XREAD, XREADGROUP) only get woken up, they simply run their command again,
+//    if someone else was faster they go back to waiting
+// 2. poppers (BLPOP, BLMOVE, ...) are served by the command that pushed the data, while it still holds r.mu,
+//    that way nobody can take the element between the push and the pop and the oldest popper really gets it
+// the wake channel has room for one signal, so a write that happens between registering and waiting is never missed
+
+type waiter struct {
+	wake 	chan struct{}
+	serve 	func(key string) bool // pops for a blocked popper, runs with r.mu held, nil for readers
+	served 	bool // serve already succeeded, the client is about to reply and must not get anything else
+}
+
+// watchKeys registers a waiter for keys, the caller must hold r.mu
+func(r *RedisCache) watchKeys(keys []string, serve func(key string) bool) *waiter {
+	w := &waiter{wake: make(chan struct{}, 1), serve: serve}
+	for _, key := range keys {
+		// the same key given twice only needs one place in the queue
+		if !containsWaiter(r.waiters[key], w) {
+			r.waiters[key] = append(r.waiters[key], w)
+		}
+	}
+	return w
+}
+
+// unwatchKeys removes the waiter from every queue it is in, the caller must hold r.mu
+func(r *RedisCache) unwatchKeys(keys []string, w *waiter) {
+	for _, key := range keys {
+		queue := r.waiters[key]
+		for i, other := range queue {
+			if other == w {
+				queue = append(queue[:i:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(r.waiters, key)
+		} else {
+			r.waiters[key] = queue
+		}
+	}
+}
+
+func containsWaiter(queue []*waiter, w *waiter) bool {
+	for _, other := range queue {
+		if other == w {
+			return true
+		}
+	}
+	return false
+}
+
+// signalKey tells the clients waiting on key that it got new data, the caller must hold r.mu
+// poppers are served in the order they started waiting until the data runs out, readers are all woken up
+func(r *RedisCache) signalKey(key string) {
+	// serving a popper may change the queue (BLMOVE signals its destination), so walking a copy
+	queue := append([]*waiter(nil), r.waiters[key]...)
+	for _, w := range queue {
+		if w.served {
+			continue
+		}
+		if w.serve != nil {
+			if !w.serve(key) {
+				continue
+			}
+			w.served = true
+		}
+
+		select {
+		case w.wake <- struct{}{}:
+		default:
+			// a signal is already pending, the client will look at the key anyway
+		}
+	}
+}
+
+// blockOn calls try until it reports that it is done, waiting for a write to one of keys before every retry
+// a timeout of 0 waits forever, it returns false when the timeout ran out first or the client went away
+// inside MULTI/EXEC nothing may block, so there try only gets its first chance
+func(r *RedisCache) blockOn(client *Client, keys []string, timeout time.Duration, try func() bool) bool {
+	r.mu.Lock()
+	w := r.watchKeys(keys, nil)
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.unwatchKeys(keys, w)
+		r.mu.Unlock()
+	}()
+
+	if try() {
+		return true
+	}
+	if client.inExec {
+		return false
+	}
+
+	deadline, gone, stop := r.startWaiting(client, timeout)
+	defer stop()
+
+	for {
+		select {
+		case <-w.wake:
+			if try() {
+				return true
+			}
+		case <-deadline:
+			return false
+		case <-gone:
+			return false
+		}
+	}
+}
+
+// blockPop is blockOn for the commands that take data out of a key: serve is given every key in turn
+// and reports whether it popped something (or failed for good, e.g. WRONGTYPE), it always runs with r.mu held
+// when nothing can be popped right away the client joins the queues of keys and gets served by the next push
+// it returns false when the timeout ran out first, inside MULTI/EXEC or when the client went away
+func(r *RedisCache) blockPop(client *Client, keys []string, timeout time.Duration, serve func(key string) bool) bool {
+	r.mu.Lock()
+	for _, key := range keys {
+		if serve(key) {
+			r.mu.Unlock()
+			return true
+		}
+	}
+	if client.inExec {
+		r.mu.Unlock()
+		return false
+	}
+	w := r.watchKeys(keys, serve)
+	r.mu.Unlock()
+
+	deadline, gone, stop := r.startWaiting(client, timeout)
+	defer stop()
+
+	select {
+	case <-w.wake:
+	case <-deadline:
+	case <-gone:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// a push may have served the client right as the timeout ran out, the popped data must not get lost then
+	r.unwatchKeys(keys, w)
+	return w.served
+}
+
+// startWaiting flushes the replies the client is still owed and returns a channel for the timeout
+// (nil waits forever) and one that is closed once the client disconnects, stop has to be called when done waiting
+func(r *RedisCache) startWaiting(client *Client, timeout time.Duration) (<-chan time.Time, <-chan struct{}, func()) {
+	var deadline <-chan time.Time
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.NewTimer(timeout)
+		deadline = timer.C
+	}
+
+	// the replies to commands pipelined before this one should not wait for it
+	if client.Conn != nil {
+		client.flush()
+	}
+
+	gone, stopWatching := watchDisconnect(client)
+	return deadline, gone, func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		stopWatching()
+	}
+}
+
+// watchDisconnect returns a channel that is closed when the client's connection fails while it is blocked
+// a blocked client that disconnects must leave the queues right away, otherwise the next push would hand it
+// an element nobody is going to read; the next command the client pipelines stops the watching,
+// just like Redis it only gets read once the blocked command has replied
+func watchDisconnect(client *Client) (<-chan struct{}, func()) {
+	gone := make(chan struct{})
+	if client.Conn == nil || client.reader == nil {
+		return gone, func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := client.reader.WaitInput()
+
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			close(gone)
+		}
+	}()
+
+	return gone, func() {
+		// an expired read deadline gets the watcher out of its read, the reader forgets that error
+		// so the connection keeps working normally afterwards
+		client.Conn.SetReadDeadline(time.Now())
+		<-done
+		client.Conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -2,18 +2,25 @@
 package cache
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"redis-clone/parser"
+	"redis-clone/resp"
 )
 
 // covalent to interfaces/types in typescript
 // explains the structure of value corresponding to any key in the hash map
+// Value depends on Type, and every one of them is binary safe:
+// "string" --> []byte (or int64 for integers, see newStringValue), "list" --> *quicklist, "set" --> *redisSet, "hash" --> *redisHash,
+// "zset" --> *sortedSet, "stream" --> *stream
+// (Go strings are immutable byte sequences, they can hold \r\n, NULs and invalid UTF-8 just fine)
 type Entry struct {
 	Type 		string			`json:"type"`
 	Value 		interface{}		`json:"value"`
@@ -21,13 +28,21 @@ type Entry struct {
 }
 
 type Client struct {
+	ID		int64 // unique per connection, reported by HELLO
+	Name	string // set with HELLO ... SETNAME
 	Conn 	net.Conn
 	InTransaction 	bool
-	Transactions 	[][]interface{}
+	Transactions 	[][][]byte
+	inExec			bool // EXEC is running the queued commands, blocking commands must not block then
 	inSubscription	bool
 	Subscriptions	[]string
+	writer			*resp.Writer // buffers replies for Conn, in RESP2 or RESP3 depending on HELLO
+	reader			*parser.Reader // reads commands from Conn, blocked commands use it to notice a disconnect
 }
 
+// client IDs only ever go up, the first connection gets 1
+var lastClientID atomic.Int64
+
 // example format:
 // ChannelA [ClientA, ClientB]
 // ChannelB [ClientC, ClientD, ClientE]
@@ -39,12 +54,18 @@ type PubSub struct {
 type RedisCache struct {
 	mu 		sync.Mutex
 	store 	map[string]*Entry // actual structure of a hash map
+	keys 	*scanIndex // the keys of store ordered for SCAN, see scanindex.go
 	pubsubs	*PubSub
+	waiters	map[string][]*waiter // clients blocked on a key, oldest first, see blocking.go
+	Config	Config
 }
 
 func NewRedisServer() *RedisCache {
 	return &RedisCache{
+		Config: DefaultConfig(),
 		store: make(map[string]*Entry),
+		keys: newScanIndex(),
+		waiters: make(map[string][]*waiter),
 		pubsubs: &PubSub{
 			channels: make(map[string][]*Client),
 		},
@@ -53,9 +74,25 @@ func NewRedisServer() *RedisCache {
 
 func NewClient(Conn net.Conn) *Client {
 	return &Client{
+		ID: lastClientID.Add(1),
 		Conn: Conn,
 		InTransaction: false,
-		Transactions: make([][]interface{}, 0),
+		Transactions: make([][][]byte, 0),
+		writer: resp.NewWriter(Conn),
+	}
+}
+
+// reply queues a single RESP value for the client, it goes out with the next flush
+func(c *Client) reply(v resp.Value) {
+	if err := c.writer.Buffer(v); err != nil {
+		fmt.Println("Error writing reply to client: ", err)
+	}
+}
+
+// flush sends every queued reply to the client in one write
+func(c *Client) flush() {
+	if err := c.writer.Flush(); err != nil {
+		fmt.Println("Error writing reply to client: ", err)
 	}
 }
 
@@ -69,7 +106,12 @@ func(r *RedisCache) StartExpiryCleaner(interval time.Duration) {
 			r.mu.Lock()
 			for key, entry := range r.store {
 				if !entry.ExpiryTime.IsZero() && time.Now().After(entry.ExpiryTime) {
-					delete(r.store, key)
+					r.deleteEntry(key)
+					continue
+				}
+				// hash fields can expire on their own, a hash that loses all of them goes away too
+				if hash, isHash := entry.Value.(*redisHash); isHash {
+					r.expireHashFields(key, hash, time.Now())
 				}
 			}
 			r.mu.Unlock()
@@ -77,53 +119,102 @@ func(r *RedisCache) StartExpiryCleaner(interval time.Duration) {
 	}()
 }
 
-func(r *RedisCache) SET(key string, value interface{}, ttl int) (string, bool) {
-	// Atomic SET with expiration: Only the SET command has built-in options to set expiration atomically!
-	// command example: SET hello "world" EX 10 or SET hello "world" PX 10000 (both expire in 10 seconds)
-	// the above ATOMIC EXPIRATION needs to be implemented!
+// lookup returns the entry stored under key, unless it has expired
+// expired keys are deleted on the spot (lazy expiry), so nothing ever sees a value past its TTL
+// even if the background cleaner has not come around yet; the caller must hold r.mu
+func(r *RedisCache) lookup(key string) (*Entry, bool) {
+	entry, exists := r.store[key]
+	if !exists {
+		return nil, false
+	}
+
+	if !entry.ExpiryTime.IsZero() && time.Now().After(entry.ExpiryTime) {
+		r.deleteEntry(key)
+		return nil, false
+	}
+
+	// the same goes for hash fields with a TTL, and for a hash that has none left
+	if hash, isHash := entry.Value.(*redisHash); isHash && !r.expireHashFields(key, hash, time.Now()) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// setEntry stores entry under key, a new key goes into the SCAN index as well; the caller must hold r.mu
+func(r *RedisCache) setEntry(key string, entry *Entry) {
+	if _, exists := r.store[key]; !exists {
+		r.keys.insert(key)
+	}
+	r.store[key] = entry
+}
+
+// deleteEntry removes key from the store and from the SCAN index; the caller must hold r.mu
+func(r *RedisCache) deleteEntry(key string) {
+	if _, exists := r.store[key]; exists {
+		delete(r.store, key)
+		r.keys.remove(key)
+	}
+}
+
+func(r *RedisCache) SET(key string, value []byte, opts SetOptions) (old []byte, hadOld bool, written bool, err error) {
+	// command syntax: SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+	// Atomic SET with expiration: the value and its expiry time are written under the same lock,
+	// so no other client can ever see the key without its TTL
+	// old/hadOld --> the previous value, only looked up when opts.Get is set
+	// written --> false when NX or XX kept the value from being set
 
 	r.mu.Lock();
 	defer r.mu.Unlock();
 
-	_, exists := r.store[key];
-	if exists {
-		return "Key with a value already exists", false;
+	entry, exists := r.lookup(key);
+
+	if opts.Get && exists {
+		// SET ... GET can only hand back a string, anything else is an error and nothing gets written
+		old, hadOld = stringBytes(entry.Value);
+		if !hadOld {
+			return nil, false, false, ErrWrongType;
+		};
 	};
 
-	// creating a new Entryy struct in the map and initialises it's value with value field
-	// also providing a expiry time as ttl to the expiryTime field of the Entryy struct
-	entry := &Entry{Type: "string", Value: value}
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return old, hadOld, false, nil;
+	};
 
-	if ttl > 0 {
-		entry.ExpiryTime = time.Now().Add(time.Duration(ttl) * time.Millisecond);
-		fmt.Printf("expiry time is %v/n", entry.ExpiryTime.Format("January 2, 2006 at 3:04PM"))
+	// a SET replaces whatever was stored under the key, including its type and (unless KEEPTTL) its TTL
+	newEntry := &Entry{Type: "string", Value: newStringValue(value), ExpiryTime: opts.ExpiryTime};
+	if opts.KeepTTL && exists {
+		newEntry.ExpiryTime = entry.ExpiryTime;
 	};
 
-	r.store[key] = entry;
-	// fmt.Println("Value successfully set to the given key");
-	fmt.Println("Value successfully set to the given key");
-	return "Value successfully set to the given key", true;
+	// EXAT/PXAT in the past: the key is set and expires right away, which is the same as deleting it
+	if !newEntry.ExpiryTime.IsZero() && !newEntry.ExpiryTime.After(time.Now()) {
+		r.deleteEntry(key);
+		return old, hadOld, true, nil;
+	};
+
+	r.setEntry(key, newEntry);
+	return old, hadOld, true, nil;
 }
 
-func(r *RedisCache) GET(key string) (interface{}, bool) {
+func(r *RedisCache) GET(key string) ([]byte, bool, error) {
 	r.mu.Lock();
 	defer r.mu.Unlock();
 
-	entry, exists := r.store[key];
+	entry, exists := r.lookup(key);
 	if !exists {
-		// Key does not exist, signalling this as 'false' boolean
-		return nil, false
+		// Key does not exist or has expired, signalling this as 'false' boolean
+		return nil, false, nil
 	}
 
-	if !entry.ExpiryTime.IsZero() && time.Now().After(entry.ExpiryTime) {
-		// Key has expired, signalling this as 'false' boolean
-		delete(r.store, key);
-		return nil, false;
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return nil, false, ErrWrongType
 	}
-	
-	fmt.Println("Value successfully obtained for the given key");
+
 	// Key exists and is valid, signalling this as 'true' boolean
-	return entry.Value, true
+	// the caller gets its own copy, the stored bytes may be changed in place (SETBIT, SETRANGE, ...) once the lock is released
+	return bytes.Clone(value), true, nil
 }
 
 func(r *RedisCache) DELETE(key string) bool {
@@ -136,7 +227,7 @@ func(r *RedisCache) DELETE(key string) bool {
 		return false
 	}
 
-	delete(r.store, key);
+	r.deleteEntry(key);
 	fmt.Println("Deleted the given key successfully", key);
 	return true;
 }
@@ -144,131 +235,56 @@ func(r *RedisCache) DELETE(key string) bool {
 func (r *RedisCache) HandleConnection (client *Client) {
 	defer client.Conn.Close()
 
-	reader := bufio.NewReader(client.Conn);
+	reader := parser.NewReader(client.Conn);
+	reader.MaxBulkLen = r.Config.ProtoMaxBulkLen;
+	reader.MaxMultibulkLen = r.Config.MaxMultibulkLen;
+	client.reader = reader;
+
+	// pipelining: a client may send many commands before reading any reply
+	// as long as the reader still holds bytes that arrived, replies just pile up in the output buffer,
+	// they are sent in one write right before the reader blocks on the socket, even in the middle of a command
+	reader.BeforeRead = client.flush;
+
 	for {
 		// let the command coming from the client to the redis server
-		// pass through the resp parser
-
+		// pass through the resp parser, both "*3\r\n$3\r\nSET..." and inline "SET hello world\r\n" are accepted
 
 		// for the example command: SET hello world from client
-		// parsedCmd: []interface{"SET", "hello", "world"}
-		parsedCmd, err := parser.HandleRESP(reader);
+		// commandArray: [][]byte{"SET", "hello", "world"}
+		commandArray, err := reader.ReadCommand();
 		if err != nil {
-			if err.Error() == "EOF" {
-				fmt.Printf("Client disconnected");
-				return;
+			// a malformed request leaves the connection in an unknown state, there is no way to find the start of the
+			// next command, so just like Redis the error is reported and the connection is closed
+			var protocolErr parser.ProtocolError
+			if errors.As(err, &protocolErr) {
+				fmt.Println("Protocol error from client: ", err);
+				client.reply(resp.Errorf("ERR %s", err.Error()));
+				client.flush();
+				return
 			};
 
-			fmt.Println("Error reading command: ", err);
-			client.Conn.Write([]byte(fmt.Sprintf("-ERR %s\r\n", err.Error())));
-			return
+			// a client that only closed its sending side still gets the replies to what it did send
+			client.flush();
+			fmt.Printf("Client disconnected");
+			return;
 		};
 
-		// commandArray = ["SET", "hello", "world"]
-		commandArray, ok := parsedCmd.([]any);
-		if !ok {
-			fmt.Printf("-ERR command is not a bulk string array\r\n");
-			continue
-		};
-
-		if len(commandArray) == 0 {
-			client.Conn.Write([]byte("-ERR empty command\r\n"))
-		}
-
 		// commandStr = "SET"
-		commandStr, ok := commandArray[0].(string);
-		if !ok {
-			fmt.Printf("-ERR command name is not a string\r\n");
-			continue
-		};
+		commandStr := string(commandArray[0]);
 
 		command := strings.ToUpper(commandStr);
 		// args = ["hello", "world"]
 		args := commandArray[1:];
 
-		// validating the command and the arguments
-		fmt.Printf("the command is %v\r\n", commandStr)
-		fmt.Printf("the arguments are %v\r\n", args)
-
 		// commands when client is in subscription mode
-		if client.inSubscription {
-			switch command {
-			case "PUBLISH":
-				// command syntax: PUBLISH channel message
-				if len(args) < 2 {
-					client.Conn.Write([]byte("-ERR wrong number of arguments for 'PUBLISH' command\r\n"))
-					continue
-				}
-
-				channel, ok1 := args[0].(string)
-				message, ok2 := args[1].(string)
-				if !ok1 || !ok2 {
-					client.Conn.Write([]byte("-ERR args must be strings\r\n"))
-					continue
-				}
-
-				result, ok := r.Publish(channel, message)
-				if !ok {
-					client.Conn.Write([]byte("-ERR channel does not exist or no active subscribers left to send message\r\n"))
-					continue
-				}
-
-				fmt.Fprintf(client.Conn, ":%d\r\n", result)
-				continue
-
-			case "UNSUBSCRIBE":
-				// command syntax: UNSUBSCRIBE channel [channel...] or UNSUBSCRIBE
-				channels := []string{}
-				if len(args) > 0 {
-					for _, arg := range args {
-						chnl := arg.(string)
-						channels = append(channels, chnl)
-					}
-				}
-
-				result, ok := r.Unsubscribe(client, channels)
-				if !ok {
-					client.Conn.Write([]byte("-ERR something went wrong while unsubscribing\r\n"))
-					continue
-				}
-
-				fmt.Println(result)
-				client.Conn.Write([]byte(result))
-				if len(client.Subscriptions) == 0 {
-					client.inSubscription = false
-				}
-				continue
-
-			case "SUBSCRIBE":
-			// command syntax: SUBSCRIBE channel [channel...]
-			if len(args) < 1 {
-				client.Conn.Write([]byte("-ERR wrong number of arguments for 'SUBSCRIBE' command\r\n"))
+		// RESP3 clients can keep running regular commands because pub/sub messages arrive as push replies
+		if client.inSubscription && client.writer.Protocol() == resp.RESP2 {
+			if r.pubsubCommand(client, command, args) {
 				continue
 			}
 
-			channels := []string{}
-			for _, arg := range args {
-				chnl := arg.(string)
-				channels = append(channels, chnl)
-			}
-
-			result, ok := r.Subscribe(client, channels)
-			if !ok {
-				continue
-			}
-
-			var response string
-			for _, channel := range channels {
-				response += fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, result)
-			}
-
-			client.Conn.Write([]byte(response))
+			client.reply(resp.Errorf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(commandStr)))
 			continue
-
-			default:
-				fmt.Fprintf(client.Conn, "-ERR unknown command\r\n")
-				continue
-			}
 		}
 
 		// commands for implementing transaction in redis --> MULTI & EXEC
@@ -276,69 +292,46 @@ func (r *RedisCache) HandleConnection (client *Client) {
 		case "MULTI":
 			// length of arguments shall be 0
 			if len(args) > 0 {
-				client.Conn.Write([]byte("-ERR wrong number of arguments for 'MULTI' command\r\n"))
+				client.reply(resp.Error("ERR wrong number of arguments for 'MULTI' command"))
 				continue
 			}
 
 			if client.InTransaction {
-				client.Conn.Write([]byte("-ERR MULTI calls cannot be nested\r\n"))
+				client.reply(resp.Error("ERR MULTI calls cannot be nested"))
 				continue
 			}
 
 			client.InTransaction = true
-			client.Transactions = make([][]interface{}, 0)
-			client.Conn.Write([]byte("+OK\r\n"))
+			client.Transactions = make([][][]byte, 0)
+			client.reply(resp.OK)
 
 		case "EXEC":
 			if len(args) > 0 {
-				client.Conn.Write([]byte("-ERR wrong number of arguments for 'EXEC' command\r\n"))
+				client.reply(resp.Error("ERR wrong number of arguments for 'EXEC' command"))
 				continue
 			}
 
 			if !client.InTransaction {
-				client.Conn.Write([]byte("-ERR EXEC without MULTI\r\n"))
+				client.reply(resp.Error("ERR EXEC without MULTI"))
 				continue
 			}
 
 			client.InTransaction = false
-			results := []string{}
+			results := []resp.Value{}
 
+			client.inExec = true
 			for _, v := range client.Transactions {
 				result := r.ExecuteCommands(client, v)
 				results = append(results, result)
 			}
+			client.inExec = false
 
 			client.Transactions = nil
-			fmt.Fprintf(client.Conn, "*%d\r\n", len(results))
-			for _, res := range results {
-				client.Conn.Write([]byte(res))
-			}
+			client.reply(resp.Array(results...))
 
-		case "SUBSCRIBE":
-			// command syntax: SUBSCRIBE channel [channel...]
-			if len(args) < 1 {
-				client.Conn.Write([]byte("-ERR wrong number of arguments for 'SUBSCRIBE' command\r\n"))
-				continue
-			}
-
-			channels := []string{}
-			for _, arg := range args {
-				chnl := arg.(string)
-				channels = append(channels, chnl)
-			}
-
-			result, ok := r.Subscribe(client, channels)
-			if !ok {
-				continue
-			}
-
-			var response string
-			for _, channel := range channels {
-				response += fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, result)
-			}
-
-			client.Conn.Write([]byte(response))
-			continue
+		case "SUBSCRIBE", "UNSUBSCRIBE", "PUBLISH":
+			// a RESP3 client that subscribed still ends up here, it has to be able to unsubscribe again
+			r.pubsubCommand(client, command, args)
 
 		default:
 			// in case the client is in InTransaction mode, then all the commands instead of executing normally will go through this code block
@@ -346,16 +339,16 @@ func (r *RedisCache) HandleConnection (client *Client) {
 			if client.InTransaction && command != "EXEC" && command != "MULTI" {
 				ok := r.queueCommands(client, commandArray)
 				if !ok {
-					client.Conn.Write([]byte("-ERR error while queueing commands\r\n"))
+					client.reply(resp.Error("ERR error while queueing commands"))
 					continue
 				}
 
-				client.Conn.Write([]byte("+Queued\r\n"))
+				client.reply(resp.SimpleString("QUEUED"))
 				continue
 			} else {
 				// for all commands when the client is not in transaction mode
 				result := r.ExecuteCommands(client, commandArray)
-				client.Conn.Write([]byte(result))
+				client.reply(result)
 			}
 		}
 	}
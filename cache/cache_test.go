@@ -1,9 +1,15 @@
 package cache
 
 import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
 	"sync"
 	"testing"
 	"time"
+
+	"redis-clone/resp"
 )
 
 // testing basic SET and GET operations
@@ -11,14 +17,14 @@ func TestSetAndGet(t *testing.T) {
 	cache := NewRedisServer();
 
 	// testing a simple SET command
-	cache.SET("hello", "world", 0);
+	cache.SET("hello", []byte("world"), SetOptions{});
 
-	val, ok := cache.GET("hello");
+	val, ok, _ := cache.GET("hello");
 	if !ok {
 		t.Fatalf("GET failed for key1: expected to find key, but it was not found");
 	}
 
-	if val != "world" {
+	if string(val) != "world" {
 		t.Errorf("GET failed value for key1: expected value 'value1', but got '%s'", val);
 	}
 }
@@ -26,7 +32,7 @@ func TestSetAndGet(t *testing.T) {
 // testing GET method for getting a value for a key that doesn't exist
 func TestGetNotExistentKey(t *testing.T) {
 	cache := NewRedisServer();
-	_, ok := cache.GET("nonexistent");
+	_, ok, _ := cache.GET("nonexistent");
 
 	if ok {
 		t.Fatal("GET succeeded for a non-existent key, but it should have failed");
@@ -38,10 +44,10 @@ func TestKeyExpiry(t *testing.T) {
 	cache := NewRedisServer();
 
 	// setting a key with a very short TTL of 1 second
-	cache.SET("hello", "world", 1);
+	cache.SET("hello", []byte("world"), SetOptions{ExpiryTime: time.Now().Add(time.Second)});
 
 	// then immediately checking whether the key exists
-	_, ok := cache.GET("hello");
+	_, ok, _ := cache.GET("hello");
 	if !ok {
 		t.Fatal("GET failed for 'short-lived' immediately after setting, but it should exist");
 	};
@@ -50,7 +56,7 @@ func TestKeyExpiry(t *testing.T) {
 	time.Sleep(1100 * time.Millisecond);
 
 	// the key shall be gone
-	_, okk := cache.GET("hello");
+	_, okk, _ := cache.GET("hello");
 	if okk {
 		t.Fatal("GET succeeded for 'short-lived' after TTL expired, but it should have been deleted");
 	}
@@ -60,9 +66,9 @@ func TestKeyExpiry(t *testing.T) {
 func TestDelete(t *testing.T) {
 	cache := NewRedisServer();
 
-	cache.SET("hello", "world", 0);
+	cache.SET("hello", []byte("world"), SetOptions{});
 
-	_, ok := cache.GET("hello");
+	_, ok, _ := cache.GET("hello");
 	if !ok {
 		t.Fatal("Setup for TestDelete failed: key 'hello' was not set correctly");
 	};
@@ -72,7 +78,7 @@ func TestDelete(t *testing.T) {
 		t.Fatal("DELETE operation returned false, expected true");
 	};
 
-	_, okk := cache.GET("hello");
+	_, okk, _ := cache.GET("hello");
 	if okk {
 		t.Fatal("Key 'hello' still exists after being deleted");
 	};
@@ -99,7 +105,7 @@ func TestConcurrency(t *testing.T) {
 			value := "concurrent_value"
 
 			// Mix of writes and reads
-			cache.SET(key, value, 0);
+			cache.SET(key, []byte(value), SetOptions{});
 			cache.GET(key);
 		}(i);
 	};
@@ -107,8 +113,272 @@ func TestConcurrency(t *testing.T) {
 	// wait for all goroutines to finish
 	wg.Wait()
 
-	val, ok := cache.GET("concurrent_key")
-	if !ok || val != "concurrent_value" {
+	val, ok, _ := cache.GET("concurrent_key")
+	if !ok || string(val) != "concurrent_value" {
 		t.Errorf("Final check after concurrent access failed. Got val: '%s', ok : %t", val, ok);
 	}
-} 
\ No newline at end of file
+} 
+// testing that commands reply with the right RESP types
+func TestExecuteCommandsReplies(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	run := func(args ...string) string {
+		return string(resp.Encode(cache.ExecuteCommands(client, command(args...)), resp.RESP2));
+	};
+
+	cache.HSET("user", []HashField{{"name", "alice"}});
+	cache.RPUSH("letters", []string{"a", "b", "a"});
+
+	testCases := []struct {
+		name string
+		cmd []string
+		expected string
+	}{
+		{"HGET replies with a bulk string", []string{"HGET", "user", "name"}, "$5\r\nalice\r\n"},
+		{"HGET on a missing field is null", []string{"HGET", "user", "age"}, "$-1\r\n"},
+		{"HGETALL includes field names", []string{"HGETALL", "user"}, "*2\r\n$4\r\nname\r\n$5\r\nalice\r\n"},
+		{"LREM replies with an integer", []string{"LREM", "letters", "0", "a"}, ":2\r\n"},
+		{"GET on a missing key is null", []string{"GET", "missing"}, "$-1\r\n"},
+		{"Unknown command is an error", []string{"NOPE"}, "-ERR unknown command\r\n"},
+		{"PING", []string{"PING"}, "+PONG\r\n"},
+		{"PING with a message", []string{"ping", "hi"}, "$2\r\nhi\r\n"},
+	};
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := run(tc.cmd...);
+			if got != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, got);
+			};
+		});
+	};
+}
+
+// testing protocol negotiation with HELLO
+func TestHello(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	// the connection starts out in RESP2, where HGETALL is a flat array
+	cache.HSET("user", []HashField{{"name", "alice"}});
+	reply := cache.ExecuteCommands(client, command("HGETALL", "user"));
+	if got := string(resp.Encode(reply, client.writer.Protocol())); got != "*2\r\n$4\r\nname\r\n$5\r\nalice\r\n" {
+		t.Fatalf("Expected HGETALL to be an array in RESP2, but got %q", got);
+	};
+
+	reply = cache.ExecuteCommands(client, command("HELLO", "3", "AUTH", "default", "secret", "SETNAME", "worker-1"));
+	if reply.Kind != resp.KindMap {
+		t.Fatalf("Expected HELLO to reply with a map, but got %#v", reply);
+	};
+	if client.writer.Protocol() != resp.RESP3 || client.Name != "worker-1" {
+		t.Fatalf("Expected RESP3 and name 'worker-1', but got protocol %d and name '%s'", client.writer.Protocol(), client.Name);
+	};
+
+	// and after HELLO 3 it is a real map
+	reply = cache.ExecuteCommands(client, command("HGETALL", "user"));
+	if got := string(resp.Encode(reply, client.writer.Protocol())); got != "%1\r\n$4\r\nname\r\n$5\r\nalice\r\n" {
+		t.Fatalf("Expected HGETALL to be a map in RESP3, but got %q", got);
+	};
+
+	errorCases := [][]string{
+		{"HELLO", "4"},
+		{"HELLO", "three"},
+		{"HELLO", "3", "AUTH", "admin", "secret"},
+		{"HELLO", "3", "SETNAME", "has space"},
+		{"HELLO", "3", "BOGUS"},
+	};
+	for _, cmd := range errorCases {
+		if reply := cache.ExecuteCommands(client, command(cmd...)); !reply.IsError() {
+			t.Errorf("Expected %v to fail, but got %#v", cmd, reply);
+		};
+	};
+
+	// a failed HELLO must not change the protocol
+	if client.writer.Protocol() != resp.RESP3 {
+		t.Errorf("Expected the protocol to stay RESP3 after failed HELLOs");
+	};
+}
+
+// a RESP3 subscriber keeps running regular commands, and UNSUBSCRIBE still takes it out of subscription mode
+func TestRESP3SubscribeAndUnsubscribe(t *testing.T) {
+	cache := NewRedisServer();
+
+	server, conn := net.Pipe();
+	defer conn.Close();
+	client := NewClient(server);
+	client.writer.SetProtocol(resp.RESP3); // what HELLO 3 does
+	go cache.HandleConnection(client);
+	reader := bufio.NewReader(conn);
+
+	go conn.Write([]byte("SUBSCRIBE news\r\nGET missing\r\nUNSUBSCRIBE news\r\nGET missing\r\n"));
+	expected := ">3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n" +
+		"_\r\n" +
+		">3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:0\r\n" +
+		"_\r\n";
+	got := make([]byte, len(expected));
+	conn.SetReadDeadline(time.Now().Add(time.Second));
+	if _, err := io.ReadFull(reader, got); err != nil || string(got) != expected {
+		t.Fatalf("Expected %q, but got %q (%v)", expected, got, err);
+	};
+
+	cache.pubsubs.mu.RLock();
+	defer cache.pubsubs.mu.RUnlock();
+	if len(cache.pubsubs.channels) != 0 {
+		t.Errorf("Expected no channels left, but got %v", cache.pubsubs.channels);
+	};
+}
+
+// every reply that pairs things up (member and score, field and value, stream and entries) is nested under RESP3,
+// checked in the protocol the client negotiated, the way HandleConnection writes it
+func TestRESP3PairReplies(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+	cache.ExecuteCommands(client, command("HELLO", "3"));
+
+	setup := [][]string{
+		{"ZADD", "z", "1", "a", "2", "b"},
+		{"ZADD", "one", "3", "c"},
+		{"HSET", "h", "f", "v"},
+		{"XADD", "s", "1-0", "f", "v"},
+		{"XGROUP", "CREATE", "s", "g", "0"},
+	};
+	for _, cmd := range setup {
+		cache.ExecuteCommands(client, command(cmd...));
+	};
+
+	pairs := "*2\r\n*2\r\n$1\r\na\r\n,1\r\n*2\r\n$1\r\nb\r\n,2\r\n";
+	entries := "%1\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n";
+	tests := []struct {
+		command []string
+		expected string
+	}{
+		{[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, pairs},
+		{[]string{"ZRANGEBYSCORE", "z", "-inf", "+inf", "WITHSCORES"}, pairs},
+		{[]string{"ZREVRANGE", "z", "1", "1", "WITHSCORES"}, "*1\r\n*2\r\n$1\r\na\r\n,1\r\n"},
+		{[]string{"ZUNION", "1", "z", "WITHSCORES"}, pairs},
+		{[]string{"ZDIFF", "1", "z", "WITHSCORES"}, pairs},
+		{[]string{"ZRANDMEMBER", "one", "-2", "WITHSCORES"}, "*2\r\n*2\r\n$1\r\nc\r\n,3\r\n*2\r\n$1\r\nc\r\n,3\r\n"},
+		{[]string{"HRANDFIELD", "h", "1", "WITHVALUES"}, "*1\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"XREAD", "STREAMS", "s", "0"}, entries},
+		{[]string{"XREADGROUP", "GROUP", "g", "c", "STREAMS", "s", ">"}, entries},
+		{[]string{"ZPOPMIN", "z", "2"}, pairs},
+	};
+
+	for _, test := range tests {
+		reply := cache.ExecuteCommands(client, command(test.command...));
+		got := string(resp.Encode(reply, client.writer.Protocol()));
+		if got != test.expected {
+			t.Errorf("%v: expected %q, but got %q", test.command, test.expected, got);
+		};
+	};
+}
+
+// command builds the arguments of a command the way the connection reader hands them to ExecuteCommands
+func command(args ...string) [][]byte {
+	cmd := make([][]byte, len(args));
+	for i, arg := range args {
+		cmd[i] = []byte(arg);
+	};
+	return cmd;
+}
+
+// step is one command of a scripted test together with the RESP2 reply it must produce
+type step struct {
+	cmd []string
+	expected string
+}
+
+// runSteps executes the steps in order on a single client, later steps see what earlier ones did
+func runSteps(t *testing.T, cache *RedisCache, steps []step) {
+	t.Helper();
+	client := NewClient(nil);
+
+	for i, s := range steps {
+		got := string(resp.Encode(cache.ExecuteCommands(client, command(s.cmd...)), resp.RESP2));
+		if got != s.expected {
+			t.Errorf("step %d %q: expected %q, but got %q", i, s.cmd, s.expected, got);
+		};
+	};
+}
+
+// a pipeline that ends in the middle of a command still gets the replies to the complete ones before the server
+// waits for the rest, the client may not send it before reading them
+func TestPipelineEndingInPartialCommand(t *testing.T) {
+	cache := NewRedisServer();
+	cache.SET("greeting", []byte("hello"), SetOptions{});
+
+	server, conn := net.Pipe();
+	defer conn.Close();
+	go cache.HandleConnection(NewClient(server));
+
+	read := func(expected string) {
+		t.Helper();
+		got := make([]byte, len(expected));
+		conn.SetReadDeadline(time.Now().Add(time.Second));
+		if _, err := io.ReadFull(conn, got); err != nil || string(got) != expected {
+			t.Fatalf("Expected %q, but got %q (%v)", expected, got, err);
+		};
+	};
+
+	conn.Write([]byte("PING\r\n*2\r\n$3\r\nGET\r\n$8\r\ngree"));
+	read("+PONG\r\n");
+	conn.Write([]byte("ting\r\n"));
+	read("$5\r\nhello\r\n");
+}
+
+// measures a client pipelining 10k commands (sent in one go, replies read back in one go) over a real TCP connection
+// go test ./cache -run '^$' -bench Pipeline
+func BenchmarkPipeline10k(b *testing.B) {
+	const commands = 10000;
+
+	cache := NewRedisServer();
+	cache.SET("greeting", []byte("hello"), SetOptions{});
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0");
+	if err != nil {
+		b.Fatal(err);
+	};
+	defer ln.Close();
+
+	go func() {
+		for {
+			conn, err := ln.Accept();
+			if err != nil {
+				return;
+			};
+			go cache.HandleConnection(NewClient(conn));
+		};
+	}();
+
+	conn, err := net.Dial("tcp", ln.Addr().String());
+	if err != nil {
+		b.Fatal(err);
+	};
+	defer conn.Close();
+
+	// half GETs, half PINGs, so the size of all replies is known up front
+	var request, reply []byte;
+	for i := 0; i < commands/2; i++ {
+		request = append(request, "*2\r\n$3\r\nGET\r\n$8\r\ngreeting\r\n*1\r\n$4\r\nPING\r\n"...);
+		reply = append(reply, "$5\r\nhello\r\n+PONG\r\n"...);
+	};
+	replies := make([]byte, len(reply));
+
+	b.SetBytes(int64(len(request)));
+	b.ResetTimer();
+	for i := 0; i < b.N; i++ {
+		// writing from a separate goroutine: the server starts replying before the whole pipeline is sent
+		go conn.Write(request);
+
+		if _, err := io.ReadFull(conn, replies); err != nil {
+			b.Fatal(err);
+		};
+	};
+	b.StopTimer();
+
+	if !bytes.Equal(replies, reply) {
+		b.Fatal("unexpected replies");
+	};
+	b.ReportMetric(float64(commands*b.N)/b.Elapsed().Seconds(), "commands/s");
+}
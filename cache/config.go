@@ -0,0 +1,45 @@
+package cache
+
+import "redis-clone/parser"
+
+// Config holds the tunables that live in redis.conf in real Redis
+// NewRedisServer starts out with the same defaults Redis ships with
+type Config struct {
+	// proto-max-bulk-len: the largest single argument a client may send, in bytes
+	ProtoMaxBulkLen int64
+	// the largest number of arguments a single command may have
+	MaxMultibulkLen int64
+	// hll-sparse-max-bytes: a HyperLogLog whose sparse encoding would grow past this is switched to the dense one
+	HLLSparseMaxBytes int
+	// list-max-listpack-size: how big a single node of a list may get, a positive value counts entries,
+	// -1 to -5 mean 4, 8, 16, 32 or 64 KB (see quicklist.go)
+	ListMaxListpackSize int
+	// set-max-intset-entries: a set of integers only stays an intset up to this many members
+	SetMaxIntsetEntries int
+	// set-max-listpack-entries, set-max-listpack-value: any other set stays a listpack up to this many members,
+	// none of them longer than the value limit in bytes
+	SetMaxListpackEntries int
+	SetMaxListpackValue int
+	// hash-max-listpack-entries, hash-max-listpack-value: the same for the fields and values of a hash
+	HashMaxListpackEntries int
+	HashMaxListpackValue int
+	// zset-max-listpack-entries, zset-max-listpack-value: the same for the members of a sorted set
+	ZSetMaxListpackEntries int
+	ZSetMaxListpackValue int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ProtoMaxBulkLen: parser.DefaultMaxBulkLen,
+		MaxMultibulkLen: parser.DefaultMaxMultibulkLen,
+		HLLSparseMaxBytes: 3000,
+		ListMaxListpackSize: -2,
+		SetMaxIntsetEntries: 512,
+		SetMaxListpackEntries: 128,
+		SetMaxListpackValue: 64,
+		HashMaxListpackEntries: 128,
+		HashMaxListpackValue: 64,
+		ZSetMaxListpackEntries: 128,
+		ZSetMaxListpackValue: 64,
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+
+	"redis-clone/resp"
+)
+
+// the Redis version this server identifies itself as in HELLO and INFO
+// client libraries look at it to decide which commands they can use
+const serverVersion = "7.2.0"
+
+func(r *RedisCache) HELLO(client *Client, args []string) resp.Value {
+	// command syntax: HELLO [protover [AUTH username password] [SETNAME clientname]]
+	// HELLO without arguments just returns the connection info in the protocol already in use
+	// HELLO 3 switches the connection to RESP3, HELLO 2 switches it back
+	protocol := client.writer.Protocol()
+
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return resp.Error("ERR Protocol version is not an integer or out of range")
+		}
+
+		if version != resp.RESP2 && version != resp.RESP3 {
+			return resp.Error("NOPROTO unsupported protocol version")
+		}
+		protocol = version
+	}
+
+	name, hasName := "", false
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return resp.Errorf("ERR Syntax error in HELLO option '%s'", args[i])
+			}
+
+			// there is no ACL system yet, the only user is "default" and it has no password set
+			// so just like Redis with a password-less default user, any password is accepted for it
+			if args[i+1] != "default" {
+				return resp.Error("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			i += 2
+
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return resp.Errorf("ERR Syntax error in HELLO option '%s'", args[i])
+			}
+
+			if !validClientName(args[i+1]) {
+				return resp.Error("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+			name, hasName = args[i+1], true
+			i++
+
+		default:
+			return resp.Errorf("ERR Syntax error in HELLO option '%s'", args[i])
+		}
+	}
+
+	// everything is validated at this point, so the changes are applied all at once
+	client.writer.SetProtocol(protocol)
+	if hasName {
+		client.Name = name
+	}
+
+	return resp.Map(
+		resp.BulkString("server"), resp.BulkString("redis"),
+		resp.BulkString("version"), resp.BulkString(serverVersion),
+		resp.BulkString("proto"), resp.Integer(int64(protocol)),
+		resp.BulkString("id"), resp.Integer(client.ID),
+		resp.BulkString("mode"), resp.BulkString("standalone"),
+		resp.BulkString("role"), resp.BulkString("master"),
+		resp.BulkString("modules"), resp.Array(),
+	)
+}
+
+// client names show up in space separated listings, so only printable characters without spaces are allowed
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
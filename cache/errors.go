@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"redis-clone/resp"
+)
+
+// errors returned by the cache methods, their text is exactly what Redis replies with
+// so ExecuteCommands can send them to the client as they are
+var (
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrSyntax = errors.New("ERR syntax error")
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+	ErrNotFloat = errors.New("ERR value is not a valid float")
+	ErrHashNotInteger = errors.New("ERR hash value is not an integer")
+	ErrHashNotFloat = errors.New("ERR hash value is not a float")
+	ErrFieldsMissing = errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	ErrNumFieldsNotPositive = errors.New("ERR Parameter `numFields` should be greater than 0")
+	ErrNumFieldsMismatch = errors.New("ERR The `numfields` parameter must match the number of arguments")
+	ErrNegativeExpireTime = errors.New("ERR invalid expire time, must be >= 0")
+	ErrInvalidCursor = errors.New("ERR invalid cursor")
+	ErrOverflow = errors.New("ERR increment or decrement would overflow")
+	ErrNaNOrInfinity = errors.New("ERR increment would produce NaN or Infinity")
+	ErrOffsetOutOfRange = errors.New("ERR offset is out of range")
+	ErrStringTooLong = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	ErrBitOffset = errors.New("ERR bit offset is not an integer or out of range")
+	ErrBitValue = errors.New("ERR bit is not an integer or out of range")
+	ErrBitArgument = errors.New("ERR The bit argument must be 1 or 0.")
+	ErrBitfieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	ErrBitfieldReadOnly = errors.New("ERR BITFIELD_RO only supports the GET subcommand")
+	ErrInvalidOverflow = errors.New("ERR Invalid OVERFLOW type specified")
+	ErrMinMaxNotFloat = errors.New("ERR min or max is not a float")
+	ErrLexRange = errors.New("ERR min or max not valid string range item")
+	ErrIncrSinglePair = errors.New("ERR INCR option supports a single increment-element pair")
+	ErrZAddXXAndNX = errors.New("ERR XX and NX options at the same time are not compatible")
+	ErrZAddGTLTAndNX = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	ErrScoreNaN = errors.New("ERR resulting score is not a number (NaN)")
+	ErrLimitWithoutBy = errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	ErrWithScoresByLex = errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	ErrWeightNotFloat = errors.New("ERR weight value is not a float")
+	ErrNumKeys = errors.New("ERR numkeys should be greater than 0")
+	ErrCountNotPositive = errors.New("ERR count should be greater than 0")
+	ErrLimitNegative = errors.New("ERR LIMIT can't be negative")
+	ErrNotPositive = errors.New("ERR value is out of range, must be positive")
+	ErrOutOfRange = errors.New("ERR value is out of range")
+	ErrInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+	ErrInvalidStartID = errors.New("ERR invalid start ID for the interval")
+	ErrInvalidEndID = errors.New("ERR invalid end ID for the interval")
+	ErrXAddIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrXAddIDZero = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamExhausted = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+	ErrMaxLenNegative = errors.New("ERR The MAXLEN argument must be >= 0.")
+	ErrLimitArgumentNegative = errors.New("ERR The LIMIT argument must be >= 0.")
+	ErrMaxLenAndMinID = errors.New("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+	ErrTrimLimitWithoutApprox = errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	ErrTimeoutNegative = errors.New("ERR timeout is negative")
+	ErrTimeoutNotInteger = errors.New("ERR timeout is not an integer or out of range")
+	ErrTimeoutNotFloat = errors.New("ERR timeout is not a float or out of range")
+	ErrTimeoutOutOfRange = errors.New("ERR timeout is out of range")
+	ErrRankZero = errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+	ErrLPosCountNegative = errors.New("ERR COUNT can't be negative")
+	ErrMaxLenNegativeLPos = errors.New("ERR MAXLEN can't be negative")
+	ErrMissingGroup = errors.New("ERR Missing GROUP option for XREADGROUP")
+	ErrNewIDWithoutGroup = errors.New("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+	ErrDollarInGroup = errors.New("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+	ErrXGroupKeyMissing = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	ErrBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrEntriesRead = errors.New("ERR value for ENTRIESREAD must be positive or -1")
+	ErrNoSuchKey = errors.New("ERR no such key")
+	ErrCountMustBePositive = errors.New("ERR COUNT must be > 0")
+	ErrNotHLL = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrInvalidHLL = errors.New("INVALIDOBJ Corrupted HLL object detected")
+	ErrHLLNotSparse = errors.New("ERR HLL encoding is not sparse")
+	ErrKeyDoesNotExist = errors.New("ERR The specified key does not exist")
+	ErrGeoUnit = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+	ErrNeedNumericRadius = errors.New("ERR need numeric radius")
+	ErrNeedNumericWidth = errors.New("ERR need numeric width")
+	ErrNeedNumericHeight = errors.New("ERR need numeric height")
+	ErrRadiusNegative = errors.New("ERR radius cannot be negative")
+	ErrBoxNegative = errors.New("ERR height or width cannot be negative")
+	ErrGeoMemberNotFound = errors.New("ERR could not decode requested zset member")
+)
+
+// errInvalidExpireTime is the error for a TTL that is zero, negative or too large, Redis names the command in it
+func errInvalidExpireTime(command string) error {
+	return fmt.Errorf("ERR invalid expire time in '%s' command", command)
+}
+
+// errAtLeastOneKey is the error for a numkeys of 0 or less, Redis names the command in it
+func errAtLeastOneKey(command string) error {
+	return fmt.Errorf("ERR at least 1 input key is needed for '%s' command", command)
+}
+
+// errWrongNumberOfArgs is the arity error, for commands whose arguments only turn out to be wrong while parsing them
+func errWrongNumberOfArgs(command string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", command)
+}
+
+// errUnbalancedStreams is the error for an XREAD whose STREAMS are not followed by one ID per key
+func errUnbalancedStreams(command string) error {
+	return fmt.Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", command)
+}
+
+// errNoGroup is the error of XPENDING, XCLAIM and XAUTOCLAIM for a missing stream or group
+func errNoGroup(key string, group string) error {
+	return fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, group)
+}
+
+func errNoGroupReadGroup(key string, group string) error {
+	return fmt.Errorf("%w in XREADGROUP with GROUP option", errNoGroup(key, group))
+}
+
+// errNoGroupForKey is the error of XGROUP and XINFO for a group missing from an existing stream
+func errNoGroupForKey(key string, group string) error {
+	return fmt.Errorf("NOGROUP No such consumer group '%s' for key name '%s'", group, key)
+}
+
+func errInvalidClaimArgument(argument string, command string) error {
+	return fmt.Errorf("ERR Invalid %s argument for %s", argument, command)
+}
+
+func errUnrecognizedXClaimOption(option string) error {
+	return fmt.Errorf("ERR Unrecognized XCLAIM option '%s'", option)
+}
+
+func errInvalidLongLat(longitude float64, latitude float64) error {
+	return fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude)
+}
+
+// errGeoExactlyOneFrom and errGeoExactlyOneBy are the errors of GEOSEARCH for a missing or repeated center or shape
+func errGeoExactlyOneFrom(command string) error {
+	return fmt.Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", strings.ToLower(command))
+}
+
+func errGeoExactlyOneBy(command string) error {
+	return fmt.Errorf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", strings.ToLower(command))
+}
+
+// errorReply turns an error from one of the cache methods into an error reply
+func errorReply(err error) resp.Value {
+	return resp.Error(err.Error())
+}
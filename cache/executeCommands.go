@@ -1,726 +1,3194 @@
 package cache
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+
+	"redis-clone/resp"
 )
 
-func(r *RedisCache) ExecuteCommands(client *Client, cmdArray []any) string {
-	if len(cmdArray) == 0 {
-		return "-ERR empty command\r\n"
-	}
+// the reply every command sends when the key holds a different data type than the command works on
+var wrongTypeReply = errorReply(ErrWrongType)
 
-	mainCommand, ok := cmdArray[0].(string)
-	if !ok {
-		return "-ERR command must be string\r\n"
+func(r *RedisCache) ExecuteCommands(client *Client, cmdArray [][]byte) resp.Value {
+	if len(cmdArray) == 0 {
+		return resp.Error("ERR empty command")
 	}
 
+	// arguments are binary safe byte slices, they are only valid until the next command is read
+	// string(arg) copies them, so nothing stored in the cache points into the reader's buffer
 	args := cmdArray[1:]
-	command := strings.ToUpper(mainCommand)
+	command := strings.ToUpper(string(cmdArray[0]))
 
 	switch command {
-		case "SET":
-			if len(args) != 2 {
-				return "-ERR wrong number of arguments for 'set' command\r\n"
+		case "PING":
+			// command syntax: PING [message]
+			// health checks usually send this as an inline command: "PING\r\n"
+			if len(args) > 1 {
+				return resp.Error("ERR wrong number of arguments for 'ping' command")
 			}
 
-			key, keyOk := args[0].(string);
-			value, valueOk := args[1].(string);
+			if len(args) == 0 {
+				return resp.SimpleString("PONG")
+			}
 
-			if !valueOk || !keyOk {
-				return "-ERR arguments must be string\r\n"
-			};
+			message := string(args[0])
 
-			// ttl -> time to expiry for the key is set to 10 seconds
-			r.SET(key, value, 10000);
-			return "+OK\r\n"
+			return resp.BulkString(message)
 
-		case "GET":
+		case "ECHO":
+			// command syntax: ECHO message
 			if len(args) != 1 {
-				return "-ERR wrong number of arguments for 'get' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'echo' command")
 			}
 
-			key, keyOk := args[0].(string);
-			if !keyOk {
-				return "-ERR argument must be string\r\n"
-			};
+			message := string(args[0])
 
-			value, ok := r.GET(key);
-			if !ok {
-				return "$-1\r\n"
-			}
+			return resp.BulkString(message)
 
-			stringValue, isString := value.(string);
-			if !isString {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+		case "SET":
+			// command syntax: SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'set' command")
 			}
 
-			response := fmt.Sprintf("$%d\r\n%s\r\n", len(stringValue), stringValue); // RESP representation of string
-			return response
+			key := string(args[0])
+			// the argument lives in the connection's read buffer, the cache needs its own copy
+			value := bytes.Clone(args[1])
 
-		case "DELETE":
-			if len(args) != 1 {
-				return "-ERR wrong number of arguments for 'delete' command\r\n"
+			opts, err := parseSetOptions(args[2:])
+			if err != nil {
+				return errorReply(err)
 			}
 
-			key, keyOk := args[0].(string);
-			if !keyOk {
-				return "-ERR argument must be string\r\n"
-			};
+			return r.setReply(key, value, opts)
 
-			ok := r.DELETE(key);
-			if !ok {
-				return "-ERR Error while performing deletion operation\r\n"
+		case "SETNX":
+			// command syntax: SETNX key value --> same as SET key value NX, but replies 1 or 0
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'setnx' command")
 			}
 
-			return fmt.Sprintf(":%d\r\n", 1)
+			key := string(args[0])
+			value := bytes.Clone(args[1])
 
-		case "LPUSH":
-			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'LPUSH' command\r\n"
+			_, _, written, err := r.SET(key, value, SetOptions{NX: true})
+			if err != nil {
+				return errorReply(err)
+			}
+			if !written {
+				return resp.Integer(0)
 			}
 
-			key, keyOk := args[0].(string)
-			if !keyOk {
-				return "-ERR key must be string\r\n"
+			return resp.Integer(1)
+
+		case "SETEX", "PSETEX":
+			// command syntax: SETEX key seconds value --> same as SET key value EX seconds
+			// command syntax: PSETEX key milliseconds value --> same as SET key value PX milliseconds
+			if len(args) != 3 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			// remaining arguments in the commandArray are values corresponding to the key
-			values := []string{}
-			for _, arg := range args[1:] {
-				val, ok := arg.(string)
-				if !ok {
-					return "-ERR all values must be strings\r\n"
-				}
+			key := string(args[0])
+			value := bytes.Clone(args[2])
 
-				values = append(values, val)
+			option := "EX"
+			if command == "PSETEX" {
+				option = "PX"
 			}
 
-			// calling the LPUSH implementation
-			listLength, ok := r.LPUSH(key, values...)
-			if !ok {
-				fmt.Println("something went wrong while processing lists")
+			expiryTime, err := parseExpiry(option, args[1], strings.ToLower(command))
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%d\r\n", listLength)
+			return r.setReply(key, value, SetOptions{ExpiryTime: expiryTime})
 
-		case "RPUSH":
-			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'LPUSH' command\r\n"
+		case "GETSET":
+			// command syntax: GETSET key value --> same as SET key value GET
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'getset' command")
 			}
 
-			key, ok := args[0].(string)
-			if !ok {
-				return "-ERR key must be string\r\n"
-			}
+			key := string(args[0])
+			value := bytes.Clone(args[1])
 
-			values := []string{}
-			for _, arg := range args[1:] {
-				val, ok := arg.(string)
-				if !ok {
-					return "-ERR all values must be strings\r\n"
-				}
+			return r.setReply(key, value, SetOptions{Get: true})
 
-				values = append(values, val)
+		case "GET":
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'get' command")
 			}
 
-			listLength, ok := r.RPUSH(key, values)
+			key := string(args[0])
+
+			value, ok, err := r.GET(key);
+			if err != nil {
+				return errorReply(err)
+			}
 			if !ok {
-				return "-ERR values could not be pushed\r\n"
+				return resp.Null()
 			}
 
-			return fmt.Sprintf(":%d\r\n", listLength)
+			return resp.BulkString(string(value))
 
-		case "LRANGE":
-			// example command: LRANGE myItems 1 2
-			// arguments derived from the command: ["myItems", myItems[1], muItems[2]]
-			// args[0] = "myItems" --> key
-			if len(args) < 3 {
-				return "-ERR wrong number of arguments for 'LRANGE' command\r\n"
+		case "GETDEL":
+			// command syntax: GETDEL key
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'getdel' command")
 			}
 
-			// parsing the key
-			key, ok := args[0].(string)
+			key := string(args[0])
+
+			value, ok, err := r.GETDEL(key)
+			if err != nil {
+				return errorReply(err)
+			}
 			if !ok {
-				return "-ERR key must be string\r\n"
+				return resp.Null()
 			}
 
-			// after parsing, the parser reads everything as strings
-			// so need to convert strings to integers using strconv.Atoi()
-			// converting start & end indices (they come as strings)
-			startStr, ok1 := args[1].(string)
-			endStr, ok2 := args[2].(string)
-			if !ok1 || !ok2 {
-				return "-ERR indices must be strings\r\n"
-			}
+			return resp.BulkString(string(value))
 
-			start, err1 := strconv.Atoi(startStr)
-			end, err2 := strconv.Atoi(endStr)
-			if err1 != nil || err2 != nil {
-				return "-ERR start and end indices must be integers\r\n"
+		case "GETEX":
+			// command syntax: GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'getex' command")
 			}
 
-			list, ok := r.LRANGE(key, start, end)
-			fmt.Println("list: ", list)
-			if !ok {
-				return "-ERR list not found or invalid range\r\n"
+			key := string(args[0])
+
+			opts, err := parseGetExOptions(args[1:])
+			if err != nil {
+				return errorReply(err)
 			}
 
-			// list is of type interface{}
-			items, ok := list.([]string)
-			fmt.Println("items: ", items)
+			value, ok, err := r.GETEX(key, opts)
+			if err != nil {
+				return errorReply(err)
+			}
 			if !ok {
-				return "-ERR internal type error\r\n"
+				return resp.Null()
 			}
 
-			// formatting like Redis output
-			var response string
-			response = fmt.Sprintf("*%d\r\n", len(items))
-			for _,v := range items {
-				// response += fmt.Sprintf("$%d) \"%s\"\r\n", i+1, v)
-				response += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			return resp.BulkString(string(value))
+
+		case "INCR", "DECR":
+			// command syntax: INCR key / DECR key
+			if len(args) != 1 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			return response
+			key := string(args[0])
 
-		case "LPOP":
-			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'LPOP' command\r\n"
+			increment := int64(1)
+			if command == "DECR" {
+				increment = -1
 			}
 
-			// parsing the key
-			key, ok := args[0].(string)
-			if !ok {
-				return "-ERR key must be string\r\n"
+			result, err := r.INCRBY(key, increment)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			poppedElement, ok := r.LPOP(key)
-			if !ok {
-				return "-ERR list not found or invalid\r\n"
+			return resp.Integer(result)
+
+		case "INCRBY", "DECRBY":
+			// command syntax: INCRBY key increment / DECRBY key decrement
+			if len(args) != 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			return poppedElement
+			key := string(args[0])
 
-		case "RPOP":
-			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'RPOP' command\r\n"
+			increment, ok := parseInteger(args[1])
+			if !ok {
+				return errorReply(ErrNotInteger)
 			}
 
-			// parsing the key
-			key, ok := args[0].(string)
-			if !ok {
-				return "-ERR key must be string\r\n"
+			if command == "DECRBY" {
+				// -math.MinInt64 does not fit into an int64
+				if increment == math.MinInt64 {
+					return resp.Error("ERR decrement would overflow")
+				}
+				increment = -increment
 			}
 
-			poppedElement, ok := r.RPOP(key)
-			if !ok {
-				return "-ERR list not found or invalid\r\n"
+			result, err := r.INCRBY(key, increment)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return poppedElement
+			return resp.Integer(result)
 
-		case "LLEN":
-			// command syntax: LLEN key --> args = [1]
-			if len(args) != 1 {
-				return "-ERR wrong number of arguments for 'LLEN' command\r\n"
+		case "INCRBYFLOAT":
+			// command syntax: INCRBYFLOAT key increment
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'incrbyfloat' command")
 			}
 
-			key, ok := args[0].(string)
+			key := string(args[0])
+
+			increment, ok := parseFloat(args[1])
 			if !ok {
-				return "-ERR key must be string\r\n"
+				return errorReply(ErrNotFloat)
 			}
 
-			listLength, ok := r.LLEN(key)
-			if !ok {
-				return ":0\r\n" // sending 0 if key doesn't exist
+			result, err := r.INCRBYFLOAT(key, increment)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%d\r\n", listLength)
-		
-		case "LINDEX":
-			// command syntax: LINDEX key index --> args = [key, index]
+			return resp.BulkString(string(result))
+
+		case "APPEND":
+			// command syntax: APPEND key value
 			if len(args) != 2 {
-				return "-ERR wrong number of arguments for 'LINDEX' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'append' command")
 			}
 
-			key, ok := args[0].(string)
-			if !ok {
-				return "-ERR key must be string\r\n"
-			}
+			key := string(args[0])
+			value := bytes.Clone(args[1])
 
-			index, ok := args[1].(string)
-			if !ok {
-				return "-ERR index is required\r\n"
+			result, err := r.APPEND(key, value)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			reqIndex, err := strconv.Atoi(index)
-			if err != nil {
-				return "-ERR index must be integer\r\n"
+			return resp.Integer(int64(result))
+
+		case "STRLEN":
+			// command syntax: STRLEN key
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'strlen' command")
 			}
 
-			element, ok := r.LINDEX(key, reqIndex)
-			if !ok {
-				return "$-1\r\n"
+			key := string(args[0])
+
+			result, err := r.STRLEN(key)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf("$%d\r\n%s\r\n", len(element), element)
+			return resp.Integer(int64(result))
 
-		case "LSET":
-			// command syntax: LSET key index element (LSET myList 0 "four")
+		case "GETRANGE", "SUBSTR":
+			// command syntax: GETRANGE key start end
 			if len(args) != 3 {
-				return "-ERR wrong number of arguments for 'LSET' command\r\n"
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			// checking & validating key, index & element
-			key, ok := args[0].(string)
-			if !ok {
-				return "-ERR key must be string\r\n"
-			}
-			indexStr, ok := args[1].(string)
+			key := string(args[0])
+
+			start, ok := parseInteger(args[1])
 			if !ok {
-				return "-ERR index must be provided\r\n"
+				return errorReply(ErrNotInteger)
 			}
-			element, ok := args[2].(string)
+			end, ok := parseInteger(args[2])
 			if !ok {
-				return "-ERR element must be string\r\n"
+				return errorReply(ErrNotInteger)
 			}
 
-			// type conversion for index, from string to integer
-			indexInt, err := strconv.Atoi(indexStr)
+			result, err := r.GETRANGE(key, start, end)
 			if err != nil {
-				return "-ERR error converting index to integer\r\n"
-			}
-
-			// calling the .LSET function
-			ok = r.LSET(key, indexInt, element)
-			if !ok {
-				return "-ERR index out of bounds or argument invalid\r\n"
+				return errorReply(err)
 			}
 
-			return "+OK\r\n"
+			return resp.BulkString(string(result))
 
-		case "LREM":
-			// command syntax: LREM key count element (LREM myList -2 "hello")
+		case "SETRANGE":
+			// command syntax: SETRANGE key offset value
 			if len(args) != 3 {
-				return "-ERR wrong number of arguments for 'LREM' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'setrange' command")
 			}
 
-			key, keyOk := args[0].(string)
-			count, countOk := args[1].(string)
-			element, elementOk := args[2].(string)
+			key := string(args[0])
 
-			if !keyOk || !countOk || !elementOk {
-				return "-ERR arguments provided are of wrong types\r\n"
+			offset, ok := parseInteger(args[1])
+			if !ok {
+				return errorReply(ErrNotInteger)
 			}
 
-			countInt, err := strconv.Atoi(count)
+			result, err := r.SETRANGE(key, offset, args[2])
 			if err != nil {
-				return "-ERR error converting integer to string"
+				return errorReply(err)
 			}
 
-			removed, ok := r.LREM(key, countInt, element)
-			if !ok {
-				return "-ERR something went wrong\r\n"
+			return resp.Integer(int64(result))
+
+		case "MGET":
+			// command syntax: MGET key [key ...]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'mget' command")
 			}
 
-			strRemoved := strconv.Itoa(removed)
-			return fmt.Sprintf("$%d\r\n%s\r\n", len(strRemoved), strRemoved)
+			values := r.MGET(stringArgs(args))
 
-		case "LTRIM":
-			// command syntax: LTRIM key start stop --> args = [key, start, stop]
-			if len(args) != 3 {
-				return "-ERR wrong number of arguments for 'LTRIM' command\r\n"
+			replies := make([]resp.Value, len(values))
+			for i, value := range values {
+				if value == nil {
+					replies[i] = resp.Null()
+				} else {
+					replies[i] = resp.BulkString(string(value))
+				}
 			}
 
-			key, keyOk := args[0].(string)
-			start, startOk := args[1].(string)
-			stop, stopOk := args[2].(string)
+			return resp.Array(replies...)
 
-			if !keyOk || !startOk || !stopOk {
-				return "-ERR arguments are of wrong types\r\n"
+		case "MSET", "MSETNX":
+			// command syntax: MSET key value [key value ...] / MSETNX key value [key value ...]
+			if len(args) < 2 || len(args)%2 != 0 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			startInt, err1 := strconv.Atoi(start)
-			stopInt, err2 := strconv.Atoi(stop)
-
-			if err1 != nil || err2 != nil {
-				return "-ERR start and stop indices must be integers\r\n"
+			keys := make([]string, 0, len(args)/2)
+			values := make([][]byte, 0, len(args)/2)
+			for i := 0; i < len(args); i += 2 {
+				keys = append(keys, string(args[i]))
+				values = append(values, bytes.Clone(args[i+1]))
 			}
 
-			list, ok := r.LTRIM(key, startInt, stopInt)
-			if !ok {
-				return "-ERR list not found or invalid range\r\n"
+			if command == "MSET" {
+				r.MSET(keys, values)
+				return resp.OK
 			}
 
-			// list is of type interface{}
-			items, ok := list.([]string)
-			fmt.Println("items: ", items)
-			if !ok {
-				return "-ERR internal type error\r\n"
+			if !r.MSETNX(keys, values) {
+				return resp.Integer(0)
 			}
 
-			var response string
-			response = fmt.Sprintf("*%d\r\n", len(items))
-			for _, v := range items {
-				response += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			return resp.Integer(1)
+
+		case "SETBIT":
+			// command syntax: SETBIT key offset value
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'setbit' command")
 			}
 
-			return response
+			key := string(args[0])
 
-		case "SADD":
-			// example command: SADD key member [member ...]
-			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'SADD' command\r\n"
+			offset, err := r.parseBitOffset(args[1])
+			if err != nil {
+				return errorReply(err)
 			}
 
-			key, keyOk := args[0].(string)
-			if !keyOk {
-				return "-ERR key must be string\r\n"
+			bit, ok := parseBit(args[2])
+			if !ok {
+				return errorReply(ErrBitValue)
 			}
 
-			members := []string{}
-			for _, v := range args[1:] {
-				member, ok := v.(string)
-				if !ok {
-					return "-ERR members must be string\r\n"
-				}
-				members = append(members, member)
+			result, err := r.SETBIT(key, offset, bit)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			added, ok := r.SADD(key, members)
-			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			return resp.Integer(int64(result))
+
+		case "GETBIT":
+			// command syntax: GETBIT key offset
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'getbit' command")
 			}
 
-			return fmt.Sprintf(":%d\r\n", added)
+			key := string(args[0])
 
-		case "SISMEMBER":
-			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'SISMEMBER' command\r\n"
+			offset, err := r.parseBitOffset(args[1])
+			if err != nil {
+				return errorReply(err)
 			}
 
-			key, keyOk := args[0].(string)
-			member, memberOk := args[1].(string)
-			if !keyOk || !memberOk {
-				return "-ERR key must be string\r\n"
+			result, err := r.GETBIT(key, offset)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			result, ok := r.SISMEMBER(key, member)
-			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			return resp.Integer(int64(result))
+
+		case "BITCOUNT":
+			// command syntax: BITCOUNT key [start end [BYTE | BIT]]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'bitcount' command")
 			}
 
-			resultInt := strconv.Itoa(result)
+			key := string(args[0])
 
-			return fmt.Sprintf(":%v\r\n", resultInt)
+			rng, err := parseBitRange(args[1:], false)
+			if err != nil {
+				return errorReply(err)
+			}
 
-		case "SREM":
-			// example command: SREM key member [member...]
+			result, err := r.BITCOUNT(key, rng)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(result)
+
+		case "BITPOS":
+			// command syntax: BITPOS key bit [start [end [BYTE | BIT]]]
 			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'SREM' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'bitpos' command")
 			}
 
-			key, keyOk := args[0].(string)
-			if !keyOk {
-				return "-ERR key must be string\r\n"
+			key := string(args[0])
+
+			bit, ok := parseBit(args[1])
+			if !ok {
+				return errorReply(ErrBitArgument)
 			}
 
-			members := []string{}
-			for _, v := range args[1:] {
-				memberStr, ok := v.(string)
-				if !ok {
-					return "-ERR member shall be string\r\n"
-				}
-				members = append(members, memberStr)
+			rng, err := parseBitRange(args[2:], true)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			result, ok := r.SREM(key, members)
-			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			result, err := r.BITPOS(key, bit, rng)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%v\r\n", result)
+			return resp.Integer(result)
 
-		case "SCARD":
-			// command syntax: SCARD key (SCARD list)
-			if len(args) != 1 {
-				return "-ERR wrong number of arguments for 'SCARD' command\r\n"
+		case "BITOP":
+			// command syntax: BITOP AND | OR | XOR | NOT destkey key [key ...]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'bitop' command")
 			}
 
-			key, keyOk := args[0].(string)
-			if !keyOk {
-				return "-ERR key must be string\r\n"
+			operation := strings.ToUpper(string(args[0]))
+			destination := string(args[1])
+			keys := stringArgs(args[2:])
+
+			switch operation {
+			case "AND", "OR", "XOR":
+			case "NOT":
+				if len(keys) != 1 {
+					return resp.Error("ERR BITOP NOT must be called with a single source key.")
+				}
+			default:
+				return errorReply(ErrSyntax)
 			}
 
-			result, ok := r.SCARD(key)
-			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			result, err := r.BITOP(operation, destination, keys)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%v\r\n", result)
+			return resp.Integer(int64(result))
 
-		case "SMEMBERS":
+		case "BITFIELD", "BITFIELD_RO":
+			// command syntax: BITFIELD key [GET encoding offset | [OVERFLOW WRAP | SAT | FAIL] SET encoding offset value | INCRBY encoding offset increment ...]
+			// command syntax: BITFIELD_RO key [GET encoding offset ...]
 			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'SMEMBERS' command\r\n"
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			key, keyOk := args[0].(string)
-			if !keyOk {
-				return "-ERR key must be string\r\n"
+			key := string(args[0])
+
+			ops, err := r.parseBitfieldOps(args[1:], command == "BITFIELD_RO")
+			if err != nil {
+				return errorReply(err)
 			}
 
-			members, ok := r.SMEMBERS(key)
-			if !ok {
-				return "*0\r\n" // returning empty set
+			results, err := r.BITFIELD(key, ops)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			var response string
-			response = fmt.Sprintf("*%d\r\n", len(members))
-			for _, v := range members {
-				response += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			replies := make([]resp.Value, len(results))
+			for i, result := range results {
+				if result.Failed {
+					replies[i] = resp.Null()
+				} else {
+					replies[i] = resp.Integer(result.Value)
+				}
 			}
 
-			return response
+			return resp.Array(replies...)
 
-		case "HSET":
-			if len(args) < 3 {
-				return "-ERR wrong number of arguments for 'HSET' command\r\n"
+		case "DELETE":
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'delete' command")
 			}
 
-			key, ok := args[0].(string)
+			key := string(args[0])
+
+			ok := r.DELETE(key);
 			if !ok {
-				return "-ERR key must be string\r\n"
+				return resp.Integer(0) // nothing was deleted
 			}
 
-			fields := []string{}
-			for i:=1; i<len(args); i=i+2 {
-				fields = append(fields, args[i].(string))
-			}
+			return resp.Integer(1)
 
-			values := []string{}
-			for i:=2; i<len(args); i=i+2 {
-				values = append(values, args[i].(string))
+		case "LPUSH":
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'LPUSH' command")
 			}
 
-			fieldValues := make(map[string]string)
-			for idx, v := range fields {
-				fieldValues[v] = values[idx]
-			}
+			key := string(args[0])
+
+			// remaining arguments in the commandArray are values corresponding to the key
+			values := stringArgs(args[1:])
 
-			result, isOk := r.HSET(key, fieldValues)
-			if !isOk {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			// calling the LPUSH implementation
+			listLength, err := r.LPUSH(key, values...)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%d\r\n", result)
+			return resp.Integer(int64(listLength))
 
-		case "HGET":
-			if len(args) < 3 {
-				return "-ERR wrong number of arguments for 'HGET' command\r\n"
+		case "RPUSH":
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'RPUSH' command")
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
-			}
+			key := string(args[0])
 
-			field, ok2 := args[1].(string)
-			if !ok2 {
-				return "-ERR field must be string\r\n"
-			}
+			values := stringArgs(args[1:])
 
-			result, ok3 := r.HGET(key, field)
-			if !ok3 {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			listLength, err := r.RPUSH(key, values)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%s\r\n", result)
+			return resp.Integer(int64(listLength))
 
-		case "HGETALL":
-			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'HGET' command\r\n"
+		case "LRANGE":
+			// example command: LRANGE myItems 1 2
+			// arguments derived from the command: ["myItems", myItems[1], muItems[2]]
+			// args[0] = "myItems" --> key
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'LRANGE' command")
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
+			// parsing the key
+			key := string(args[0])
+
+			// after parsing, the parser reads everything as strings
+			// so need to convert strings to integers using strconv.Atoi()
+			// converting start & end indices (they come as strings)
+			startStr := string(args[1])
+			endStr := string(args[2])
+
+			start, err1 := strconv.Atoi(startStr)
+			end, err2 := strconv.Atoi(endStr)
+			if err1 != nil || err2 != nil {
+				return resp.Error("ERR start and end indices must be integers")
 			}
 
-			result, ok2 := r.HGETALL(key)
-			if !ok2 {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			items, err := r.LRANGE(key, start, end)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			var response string
-			response = fmt.Sprintf("*%d\r\n", len(result))
-			for _,v := range result {
-				response += fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			return resp.BulkStrings(items)
+
+		case "LPOP", "RPOP":
+			// command syntax: LPOP key [count]
+			// without count the reply is the element (or null), with count it is an array of up to count elements
+			if len(args) < 1 || len(args) > 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			return response
+			// parsing the key
+			key := string(args[0])
 
-		case "HDEL":
-			if len(args) < 3 {
-				return "-ERR wrong number of arguments for 'HGET' command\r\n"
+			count := int64(1)
+			if len(args) == 2 {
+				var ok bool
+				if count, ok = parseInteger(args[1]); !ok || count < 0 {
+					return errorReply(ErrNotPositive)
+				}
+				if count > math.MaxInt32 {
+					count = math.MaxInt32
+				}
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key and field must be string\r\n"
+			pop := r.LPOP
+			if command == "RPOP" {
+				pop = r.RPOP
 			}
 
-			field := args[1:]
-			fields := []string{}
-			for _, v := range field {
-				if _, ok := v.(string); !ok {
+			popped, ok, err := pop(key, int(count))
+			if err != nil {
+				return errorReply(err)
+			}
+			if len(args) == 2 {
+				if !ok {
+					return resp.NullArray()
 				}
-				vStr := v.(string)
-				fields = append(fields, vStr)
+				return resp.BulkStrings(popped)
 			}
-
-			result, ok := r.HDEL(key, fields)
 			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+				return resp.Null()
 			}
 
-			resultInt := strconv.Itoa(result)
-			return fmt.Sprintf(":%v\r\n", resultInt)
+			return resp.BulkString(popped[0])
 
-		case "HLEN":
-			// command syntax: HLEN key
-			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'HGET' command\r\n"
+		case "LPUSHX", "RPUSHX":
+			// command syntax: LPUSHX key element [element ...]
+			if len(args) < 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
+			push := r.LPUSHX
+			if command == "RPUSHX" {
+				push = r.RPUSHX
 			}
 
-			result, ok2 := r.HLEN(key)
-			if !ok2 {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+			listLength, err := push(string(args[0]), stringArgs(args[1:]))
+			if err != nil {
+				return errorReply(err)
 			}
 
-			resultInt := strconv.Itoa(result)
-			return fmt.Sprintf(":%v\r\n", resultInt)
-
-		case "EXPIRE":
-			// command syntax: EXPIRE key seconds
-			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'EXPIRE' command\r\n"
-			}
+			return resp.Integer(int64(listLength))
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
+		case "LINSERT":
+			// command syntax: LINSERT key BEFORE | AFTER pivot element
+			if len(args) != 4 {
+				return resp.Error("ERR wrong number of arguments for 'linsert' command")
 			}
 
-			seconds, ok2 := args[1].(string)
-			if !ok2 {
-				return "-ERR seconds must be string\r\n"
+			var before bool
+			switch strings.ToUpper(string(args[1])) {
+			case "BEFORE":
+				before = true
+			case "AFTER":
+			default:
+				return errorReply(ErrSyntax)
 			}
 
-			secondsInt, err := strconv.Atoi(seconds)
+			listLength, err := r.LINSERT(string(args[0]), before, string(args[2]), string(args[3]))
 			if err != nil {
-				return "-ERR operation failed while converting seconds to integer\r\n"
-			}
-
-			result, ok := r.EXPIRE(key, secondsInt)
-			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+				return errorReply(err)
 			}
 
-			return fmt.Sprintf(":%d\r\n", result)
+			return resp.Integer(int64(listLength))
 
-		case "PEXPIRE":
-			// command syntax: PEXPIRE key milliseconds
+		case "LPOS":
+			// command syntax: LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+			// without COUNT the reply is the index of the match (or null), with COUNT an array of indexes
 			if len(args) < 2 {
-				return "-ERR wrong number of arguments for 'PEXPIRE' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'lpos' command")
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
+			opts, hasCount, err := parseLPosOptions(args[2:])
+			if err != nil {
+				return errorReply(err)
 			}
 
-			ms, ok2 := args[1].(string)
-			if !ok2 {
-				return "-ERR milliseconds must be string\r\n"
+			matches, err := r.LPOS(string(args[0]), string(args[1]), opts)
+			if err != nil {
+				return errorReply(err)
 			}
 
-			msInt, err := strconv.Atoi(ms)
+			if !hasCount {
+				if len(matches) == 0 {
+					return resp.Null()
+				}
+				return resp.Integer(int64(matches[0]))
+			}
+
+			indexes := make([]resp.Value, len(matches))
+			for i, index := range matches {
+				indexes[i] = resp.Integer(int64(index))
+			}
+			return resp.Array(indexes...)
+
+		case "LMOVE", "RPOPLPUSH":
+			// command syntax: LMOVE source destination LEFT | RIGHT LEFT | RIGHT
+			//                 RPOPLPUSH source destination
+			fromLeft, toLeft := false, true
+			if command == "LMOVE" {
+				if len(args) != 4 {
+					return resp.Error("ERR wrong number of arguments for 'lmove' command")
+				}
+
+				var err error
+				if fromLeft, err = parseListEnd(args[2]); err != nil {
+					return errorReply(err)
+				}
+				if toLeft, err = parseListEnd(args[3]); err != nil {
+					return errorReply(err)
+				}
+			} else if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'rpoplpush' command")
+			}
+
+			element, ok, err := r.LMOVE(string(args[0]), string(args[1]), fromLeft, toLeft)
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				return resp.Null()
+			}
+
+			return resp.BulkString(element)
+
+		case "LMPOP":
+			// command syntax: LMPOP numkeys key [key ...] LEFT | RIGHT [COUNT count]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'lmpop' command")
+			}
+
+			keys, left, count, err := parseLMPopArgs(args, "lmpop")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			key, popped, err := r.LMPOP(keys, left, count)
+			if err != nil {
+				return errorReply(err)
+			}
+			if key == "" {
+				return resp.NullArray()
+			}
+
+			return resp.Array(resp.BulkString(key), resp.BulkStrings(popped))
+
+		case "BLPOP", "BRPOP":
+			// command syntax: BLPOP key [key ...] timeout
+			// the reply is [key, element], or a null array once the timeout (in seconds, 0 waits forever) runs out
+			if len(args) < 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			timeout, err := parseBlockSeconds(args[len(args)-1])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			key, popped, err := r.BLMPOP(client, stringArgs(args[:len(args)-1]), command == "BLPOP", 1, timeout)
+			if err != nil {
+				return errorReply(err)
+			}
+			if key == "" {
+				return resp.NullArray()
+			}
+
+			return resp.Array(resp.BulkString(key), resp.BulkString(popped[0]))
+
+		case "BLMPOP":
+			// command syntax: BLMPOP timeout numkeys key [key ...] LEFT | RIGHT [COUNT count]
+			if len(args) < 4 {
+				return resp.Error("ERR wrong number of arguments for 'blmpop' command")
+			}
+
+			timeout, err := parseBlockSeconds(args[0])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			keys, left, count, err := parseLMPopArgs(args[1:], "blmpop")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			key, popped, err := r.BLMPOP(client, keys, left, count, timeout)
+			if err != nil {
+				return errorReply(err)
+			}
+			if key == "" {
+				return resp.NullArray()
+			}
+
+			return resp.Array(resp.BulkString(key), resp.BulkStrings(popped))
+
+		case "BLMOVE", "BRPOPLPUSH":
+			// command syntax: BLMOVE source destination LEFT | RIGHT LEFT | RIGHT timeout
+			//                 BRPOPLPUSH source destination timeout
+			fromLeft, toLeft := false, true
+			if command == "BLMOVE" {
+				if len(args) != 5 {
+					return resp.Error("ERR wrong number of arguments for 'blmove' command")
+				}
+
+				var err error
+				if fromLeft, err = parseListEnd(args[2]); err != nil {
+					return errorReply(err)
+				}
+				if toLeft, err = parseListEnd(args[3]); err != nil {
+					return errorReply(err)
+				}
+			} else if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'brpoplpush' command")
+			}
+
+			timeout, err := parseBlockSeconds(args[len(args)-1])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			element, ok, err := r.BLMOVE(client, string(args[0]), string(args[1]), fromLeft, toLeft, timeout)
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				// like Redis: a plain null when it could not block (inside MULTI/EXEC), a null array when the timeout ran out
+				if client.inExec {
+					return resp.Null()
+				}
+				return resp.NullArray()
+			}
+
+			return resp.BulkString(element)
+
+		case "LLEN":
+			// command syntax: LLEN key --> args = [1]
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'LLEN' command")
+			}
+
+			key := string(args[0])
+
+			listLength, ok := r.LLEN(key)
+			if !ok {
+				return resp.Integer(0) // sending 0 if key doesn't exist
+			}
+
+			return resp.Integer(int64(listLength))
+		
+		case "LINDEX":
+			// command syntax: LINDEX key index --> args = [key, index]
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'LINDEX' command")
+			}
+
+			key := string(args[0])
+
+			index := string(args[1])
+
+			reqIndex, err := strconv.Atoi(index)
+			if err != nil {
+				return resp.Error("ERR index must be integer")
+			}
+
+			element, ok := r.LINDEX(key, reqIndex)
+			if !ok {
+				return resp.Null()
+			}
+
+			return resp.BulkString(element)
+
+		case "LSET":
+			// command syntax: LSET key index element (LSET myList 0 "four")
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'LSET' command")
+			}
+
+			// checking & validating key, index & element
+			key := string(args[0])
+			indexStr := string(args[1])
+			element := string(args[2])
+
+			// type conversion for index, from string to integer
+			indexInt, err := strconv.Atoi(indexStr)
+			if err != nil {
+				return resp.Error("ERR error converting index to integer")
+			}
+
+			// calling the .LSET function
+			ok := r.LSET(key, indexInt, element)
+			if !ok {
+				return resp.Error("ERR index out of bounds or argument invalid")
+			}
+
+			return resp.OK
+
+		case "LREM":
+			// command syntax: LREM key count element (LREM myList -2 "hello")
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'LREM' command")
+			}
+
+			key := string(args[0])
+			count := string(args[1])
+			element := string(args[2])
+
+			countInt, err := strconv.Atoi(count)
+			if err != nil {
+				return resp.Error("ERR error converting integer to string")
+			}
+
+			removed, ok := r.LREM(key, countInt, element)
+			if !ok {
+				return resp.Error("ERR something went wrong")
+			}
+
+			return resp.Integer(int64(removed))
+
+		case "LTRIM":
+			// command syntax: LTRIM key start stop --> args = [key, start, stop]
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'LTRIM' command")
+			}
+
+			key := string(args[0])
+			start := string(args[1])
+			stop := string(args[2])
+
+			startInt, err1 := strconv.Atoi(start)
+			stopInt, err2 := strconv.Atoi(stop)
+
+			if err1 != nil || err2 != nil {
+				return resp.Error("ERR start and stop indices must be integers")
+			}
+
+			ok := r.LTRIM(key, startInt, stopInt)
+			if !ok {
+				return errorReply(ErrWrongType)
+			}
+
+			return resp.OK
+
+		case "SADD":
+			// example command: SADD key member [member ...]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'SADD' command")
+			}
+
+			key := string(args[0])
+
+			members := stringArgs(args[1:])
+
+			added, err := r.SADD(key, members)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(added))
+
+		case "SISMEMBER":
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'SISMEMBER' command")
+			}
+
+			key := string(args[0])
+			member := string(args[1])
+
+			result, err := r.SISMEMBER(key, member)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			if result {
+				return resp.Integer(1)
+			}
+			return resp.Integer(0)
+
+		case "SREM":
+			// example command: SREM key member [member...]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'SREM' command")
+			}
+
+			key := string(args[0])
+
+			members := stringArgs(args[1:])
+
+			result, err := r.SREM(key, members)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "SCARD":
+			// command syntax: SCARD key (SCARD list)
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'SCARD' command")
+			}
+
+			key := string(args[0])
+
+			result, err := r.SCARD(key)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "SMEMBERS":
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'SMEMBERS' command")
+			}
+
+			key := string(args[0])
+
+			members, err := r.SMEMBERS(key)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return setReply(members)
+
+		case "SINTER", "SUNION", "SDIFF":
+			// command syntax: SINTER key [key ...]
+			if len(args) < 1 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			keys := stringArgs(args)
+			operations := map[string]func([]string) ([]string, error){"SINTER": r.SINTER, "SUNION": r.SUNION, "SDIFF": r.SDIFF}
+
+			members, err := operations[command](keys)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return setReply(members)
+
+		case "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE":
+			// command syntax: SINTERSTORE destination key [key ...]
+			if len(args) < 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			destination := string(args[0])
+			keys := stringArgs(args[1:])
+			operations := map[string]func(string, []string) (int, error){"SINTERSTORE": r.SINTERSTORE, "SUNIONSTORE": r.SUNIONSTORE, "SDIFFSTORE": r.SDIFFSTORE}
+
+			result, err := operations[command](destination, keys)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "SINTERCARD":
+			// command syntax: SINTERCARD numkeys key [key ...] [LIMIT limit]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'sintercard' command")
+			}
+
+			if numKeys, ok := parseInteger(args[0]); !ok || numKeys < 1 {
+				return errorReply(ErrNumKeys)
+			}
+
+			keys, rest, err := parseNumKeys(args, "sintercard")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			var limit int64
+			if len(rest) > 0 {
+				if len(rest) != 2 || !strings.EqualFold(string(rest[0]), "LIMIT") {
+					return errorReply(ErrSyntax)
+				}
+				var ok bool
+				if limit, ok = parseInteger(rest[1]); !ok || limit < 0 {
+					return errorReply(ErrLimitNegative)
+				}
+			}
+
+			result, err := r.SINTERCARD(keys, limit)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "SMOVE":
+			// command syntax: SMOVE source destination member
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'smove' command")
+			}
+
+			moved, err := r.SMOVE(string(args[0]), string(args[1]), string(args[2]))
+			if err != nil {
+				return errorReply(err)
+			}
+			if !moved {
+				return resp.Integer(0)
+			}
+
+			return resp.Integer(1)
+
+		case "SMISMEMBER":
+			// command syntax: SMISMEMBER key member [member ...]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'smismember' command")
+			}
+
+			result, err := r.SMISMEMBER(string(args[0]), stringArgs(args[1:]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(result))
+			for i, isMember := range result {
+				replies[i] = resp.Integer(0)
+				if isMember {
+					replies[i] = resp.Integer(1)
+				}
+			}
+			return resp.Array(replies...)
+
+		case "SPOP", "SRANDMEMBER":
+			// command syntax: SPOP key [count] / SRANDMEMBER key [count]
+			// without a count the reply is a single member (or null), with a count an array
+			if len(args) < 1 || len(args) > 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			count := int64(1)
+			if len(args) == 2 {
+				var ok bool
+				if count, ok = parseInteger(args[1]); !ok {
+					return errorReply(ErrNotInteger)
+				}
+				// only SRANDMEMBER knows negative counts
+				if command == "SPOP" && count < 0 {
+					return errorReply(ErrNotPositive)
+				}
+				// a negative count is the size of the reply, it is refused before anything gets allocated for it
+				if command == "SRANDMEMBER" && (count < -math.MaxInt64/2 || count > math.MaxInt64/2) {
+					return errorReply(ErrOutOfRange)
+				}
+			}
+
+			members, err := r.SRANDMEMBER(key, count)
+			if command == "SPOP" {
+				members, err = r.SPOP(key, count)
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			if len(args) == 2 {
+				if command == "SPOP" {
+					return setReply(members)
+				}
+				return resp.BulkStrings(members)
+			}
+			if len(members) == 0 {
+				return resp.Null()
+			}
+			return resp.BulkString(members[0])
+
+		case "HSET", "HMSET":
+			// command syntax: HSET key field value [field value ...]
+			if len(args) < 3 || len(args)%2 == 0 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			fields := make([]HashField, 0, len(args)/2)
+			for i := 1; i < len(args); i += 2 {
+				fields = append(fields, HashField{Field: string(args[i]), Value: string(args[i+1])})
+			}
+
+			result, err := r.HSET(key, fields)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// HMSET is the older form, it replies OK instead of the number of new fields
+			if command == "HMSET" {
+				return resp.OK
+			}
+			return resp.Integer(int64(result))
+
+		case "HSETNX":
+			// command syntax: HSETNX key field value
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'hsetnx' command")
+			}
+
+			set, err := r.HSETNX(string(args[0]), string(args[1]), string(args[2]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			if set {
+				return resp.Integer(1)
+			}
+			return resp.Integer(0)
+
+		case "HGET":
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'HGET' command")
+			}
+
+			key := string(args[0])
+
+			field := string(args[1])
+
+			result, ok, err := r.HGET(key, field)
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				return resp.Null() // key or field does not exist
+			}
+
+			return resp.BulkString(result)
+
+		case "HMGET":
+			// command syntax: HMGET key field [field ...]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'hmget' command")
+			}
+
+			values, found, err := r.HMGET(string(args[0]), stringArgs(args[1:]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(values))
+			for i, value := range values {
+				if found[i] {
+					replies[i] = resp.BulkString(value)
+				} else {
+					replies[i] = resp.Null()
+				}
+			}
+
+			return resp.Array(replies...)
+
+		case "HGETALL":
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'HGETALL' command")
+			}
+
+			key := string(args[0])
+
+			result, err := r.HGETALL(key)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// every field is followed by its value: [field1, value1, field2, value2, ...]
+			pairs := make([]resp.Value, 0, 2*len(result))
+			for _, f := range result {
+				pairs = append(pairs, resp.BulkString(f.Field), resp.BulkString(f.Value))
+			}
+
+			return resp.Map(pairs...)
+
+		case "HKEYS", "HVALS":
+			// command syntax: HKEYS key / HVALS key
+			if len(args) != 1 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			columns := map[string]func(string) ([]string, error){"HKEYS": r.HKEYS, "HVALS": r.HVALS}
+
+			result, err := columns[command](string(args[0]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.BulkStrings(result)
+
+		case "HEXISTS":
+			// command syntax: HEXISTS key field
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'hexists' command")
+			}
+
+			exists, err := r.HEXISTS(string(args[0]), string(args[1]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			if exists {
+				return resp.Integer(1)
+			}
+			return resp.Integer(0)
+
+		case "HSTRLEN":
+			// command syntax: HSTRLEN key field
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'hstrlen' command")
+			}
+
+			length, err := r.HSTRLEN(string(args[0]), string(args[1]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(length))
+
+		case "HDEL":
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'HDEL' command")
+			}
+
+			key := string(args[0])
+
+			fields := stringArgs(args[1:])
+
+			result, err := r.HDEL(key, fields)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "HLEN":
+			// command syntax: HLEN key
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'hlen' command")
+			}
+
+			key := string(args[0])
+
+			result, err := r.HLEN(key)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "HINCRBY":
+			// command syntax: HINCRBY key field increment
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'hincrby' command")
+			}
+
+			increment, ok := parseInteger(args[2])
+			if !ok {
+				return errorReply(ErrNotInteger)
+			}
+
+			result, err := r.HINCRBY(string(args[0]), string(args[1]), increment)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(result)
+
+		case "HINCRBYFLOAT":
+			// command syntax: HINCRBYFLOAT key field increment
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'hincrbyfloat' command")
+			}
+
+			increment, ok := parseFloat(args[2])
+			if !ok {
+				return errorReply(ErrNotFloat)
+			}
+
+			result, err := r.HINCRBYFLOAT(string(args[0]), string(args[1]), increment)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.BulkString(result)
+
+		case "HEXPIRE", "HPEXPIRE", "HEXPIREAT", "HPEXPIREAT":
+			// command syntax: HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+			if len(args) < 5 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			at, err := parseFieldExpiry(command, args[1])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// the condition is optional, anything else in its place has to be FIELDS
+			condition := ""
+			rest := args[2:]
+			switch option := strings.ToUpper(string(rest[0])); option {
+			case "NX", "XX", "GT", "LT":
+				condition = option
+				rest = rest[1:]
+			}
+
+			fields, err := parseFieldsArgument(rest, 1)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			results, err := r.HEXPIRE(string(args[0]), at, condition, stringArgs(fields))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return integersReply(results)
+
+		case "HTTL", "HPTTL", "HEXPIRETIME", "HPEXPIRETIME":
+			// command syntax: HTTL key FIELDS numfields field [field ...]
+			if len(args) < 4 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			fields, err := parseFieldsArgument(args[1:], 1)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			var results []int64
+			if command == "HTTL" || command == "HPTTL" {
+				results, err = r.HTTL(string(args[0]), stringArgs(fields))
+			} else {
+				results, err = r.HEXPIRETIME(string(args[0]), stringArgs(fields))
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// everything comes in milliseconds, HTTL rounds the time left up and HEXPIRETIME the unix time down
+			if command == "HTTL" || command == "HEXPIRETIME" {
+				for i, result := range results {
+					if result < 0 {
+						continue
+					}
+					if command == "HTTL" {
+						results[i] = (result + 999) / 1000
+					} else {
+						results[i] = result / 1000
+					}
+				}
+			}
+
+			return integersReply(results)
+
+		case "HPERSIST":
+			// command syntax: HPERSIST key FIELDS numfields field [field ...]
+			if len(args) < 4 {
+				return resp.Error("ERR wrong number of arguments for 'hpersist' command")
+			}
+
+			fields, err := parseFieldsArgument(args[1:], 1)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			results, err := r.HPERSIST(string(args[0]), stringArgs(fields))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return integersReply(results)
+
+		case "HGETEX":
+			// command syntax: HGETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST] FIELDS numfields field [field ...]
+			if len(args) < 4 {
+				return resp.Error("ERR wrong number of arguments for 'hgetex' command")
+			}
+
+			opts, rest, err := parseHGetExOptions(args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			fields, err := parseFieldsArgument(rest, 1)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			values, found, err := r.HGETEX(string(args[0]), opts, stringArgs(fields))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(values))
+			for i, value := range values {
+				if found[i] {
+					replies[i] = resp.BulkString(value)
+				} else {
+					replies[i] = resp.Null()
+				}
+			}
+
+			return resp.Array(replies...)
+
+		case "HSETEX":
+			// command syntax: HSETEX key [FNX | FXX] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL] FIELDS numfields field value [field value ...]
+			if len(args) < 5 {
+				return resp.Error("ERR wrong number of arguments for 'hsetex' command")
+			}
+
+			opts, rest, err := parseHSetExOptions(args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			pairs, err := parseFieldsArgument(rest, 2)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			fields := make([]HashField, 0, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				fields = append(fields, HashField{Field: string(pairs[i]), Value: string(pairs[i+1])})
+			}
+
+			set, err := r.HSETEX(string(args[0]), opts, fields)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			if set {
+				return resp.Integer(1)
+			}
+			return resp.Integer(0)
+
+		case "HRANDFIELD":
+			// command syntax: HRANDFIELD key [count [WITHVALUES]]
+			if len(args) < 1 || len(args) > 3 {
+				return resp.Error("ERR wrong number of arguments for 'hrandfield' command")
+			}
+
+			key := string(args[0])
+
+			// without a count the reply is a single field, or null for a missing key
+			if len(args) == 1 {
+				fields, err := r.HRANDFIELD(key, 1)
+				if err != nil {
+					return errorReply(err)
+				}
+				if len(fields) == 0 {
+					return resp.Null()
+				}
+				return resp.BulkString(fields[0].Field)
+			}
+
+			count, ok := parseInteger(args[1])
+			if !ok {
+				return errorReply(ErrNotInteger)
+			}
+
+			withValues := len(args) == 3
+			if withValues && !strings.EqualFold(string(args[2]), "WITHVALUES") {
+				return errorReply(ErrSyntax)
+			}
+			// a negative count is the size of the reply (twice that with values), it is refused before anything
+			// gets allocated for it
+			if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+				return errorReply(ErrOutOfRange)
+			}
+
+			fields, err := r.HRANDFIELD(key, count)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return hashFieldsReply(client, fields, withValues)
+
+		case "ZADD":
+			// command syntax: ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'zadd' command")
+			}
+
+			key := string(args[0])
+
+			opts, members, err := parseZAddArgs(args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// ZADD ... INCR replies like ZINCRBY, or with null when NX/XX/GT/LT kept it from doing anything
+			if opts.Incr {
+				score, ok, err := r.ZINCRBY(key, members[0].Member, members[0].Score, opts)
+				if err != nil {
+					return errorReply(err)
+				}
+				if !ok {
+					return resp.Null()
+				}
+				return resp.Double(score)
+			}
+
+			result, err := r.ZADD(key, opts, members)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZINCRBY":
+			// command syntax: ZINCRBY key increment member
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'zincrby' command")
+			}
+
+			key := string(args[0])
+			member := string(args[2])
+
+			increment, ok := parseFloat(args[1])
+			if !ok {
+				return errorReply(ErrNotFloat)
+			}
+
+			score, _, err := r.ZINCRBY(key, member, increment, ZAddOptions{})
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Double(score)
+
+		case "ZREM":
+			// command syntax: ZREM key member [member ...]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'zrem' command")
+			}
+
+			key := string(args[0])
+
+			result, err := r.ZREM(key, stringArgs(args[1:]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZSCORE":
+			// command syntax: ZSCORE key member
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'zscore' command")
+			}
+
+			key := string(args[0])
+			member := string(args[1])
+
+			score, ok, err := r.ZSCORE(key, member)
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				return resp.Null()
+			}
+
+			return resp.Double(score)
+
+		case "ZCARD":
+			// command syntax: ZCARD key
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'zcard' command")
+			}
+
+			key := string(args[0])
+
+			result, err := r.ZCARD(key)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZRANK", "ZREVRANK":
+			// command syntax: ZRANK key member [WITHSCORE] / ZREVRANK key member [WITHSCORE]
+			if len(args) != 2 && len(args) != 3 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+			member := string(args[1])
+
+			withScore := len(args) == 3
+			if withScore && !strings.EqualFold(string(args[2]), "WITHSCORE") {
+				return errorReply(ErrSyntax)
+			}
+
+			rank, score, ok, err := r.ZRANK(key, member, command == "ZREVRANK")
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				if withScore {
+					return resp.NullArray()
+				}
+				return resp.Null()
+			}
+
+			if withScore {
+				return resp.Array(resp.Integer(int64(rank)), resp.Double(score))
+			}
+			return resp.Integer(int64(rank))
+
+		case "ZRANGE", "ZREVRANGE", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZRANGEBYLEX", "ZREVRANGEBYLEX":
+			// command syntax: ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+			// the other forms are ZRANGE with the options already chosen, e.g. ZREVRANGEBYSCORE key max min is
+			// ZRANGE key max min BYSCORE REV
+			if len(args) < 3 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			by := zrangeByRank
+			if strings.Contains(command, "BYSCORE") {
+				by = zrangeByScore
+			} else if strings.Contains(command, "BYLEX") {
+				by = zrangeByLex
+			}
+
+			q, err := parseZRangeArgs(args[1:], by, strings.HasPrefix(command, "ZREV"), command != "ZRANGE")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			members, err := r.ZRANGE(key, q)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return zmembersReply(client, members, q.withScores)
+
+		case "ZCOUNT", "ZLEXCOUNT":
+			// command syntax: ZCOUNT key min max / ZLEXCOUNT key min max
+			if len(args) != 3 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			var result int
+			if command == "ZCOUNT" {
+				rng, err := parseScoreRange(args[1], args[2])
+				if err != nil {
+					return errorReply(err)
+				}
+				result, err = r.ZCOUNT(key, rng)
+				if err != nil {
+					return errorReply(err)
+				}
+			} else {
+				rng, err := parseLexRange(args[1], args[2])
+				if err != nil {
+					return errorReply(err)
+				}
+				result, err = r.ZLEXCOUNT(key, rng)
+				if err != nil {
+					return errorReply(err)
+				}
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZREMRANGEBYRANK":
+			// command syntax: ZREMRANGEBYRANK key start stop
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'zremrangebyrank' command")
+			}
+
+			key := string(args[0])
+
+			start, ok := parseInteger(args[1])
+			if !ok {
+				return errorReply(ErrNotInteger)
+			}
+			stop, ok := parseInteger(args[2])
+			if !ok {
+				return errorReply(ErrNotInteger)
+			}
+
+			result, err := r.ZREMRANGEBYRANK(key, start, stop)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZREMRANGEBYSCORE":
+			// command syntax: ZREMRANGEBYSCORE key min max
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'zremrangebyscore' command")
+			}
+
+			key := string(args[0])
+
+			rng, err := parseScoreRange(args[1], args[2])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			result, err := r.ZREMRANGEBYSCORE(key, rng)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZREMRANGEBYLEX":
+			// command syntax: ZREMRANGEBYLEX key min max
+			if len(args) != 3 {
+				return resp.Error("ERR wrong number of arguments for 'zremrangebylex' command")
+			}
+
+			key := string(args[0])
+
+			rng, err := parseLexRange(args[1], args[2])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			result, err := r.ZREMRANGEBYLEX(key, rng)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZUNION", "ZINTER", "ZDIFF":
+			// command syntax: ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+			// ZINTER takes the same options, ZDIFF only WITHSCORES
+			if len(args) < 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			keys, rest, err := parseNumKeys(args, strings.ToLower(command))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			opts, err := parseZStoreOptions(rest, len(keys), false, command == "ZDIFF")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			var members []ZMember
+			switch command {
+			case "ZUNION":
+				members, err = r.ZUNION(keys, opts)
+			case "ZINTER":
+				members, err = r.ZINTER(keys, opts)
+			default:
+				members, err = r.ZDIFF(keys)
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return zmembersReply(client, members, opts.WithScores)
+
+		case "ZUNIONSTORE", "ZINTERSTORE", "ZDIFFSTORE":
+			// command syntax: ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+			// ZINTERSTORE takes the same options, ZDIFFSTORE none
+			if len(args) < 3 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			dest := string(args[0])
+
+			keys, rest, err := parseNumKeys(args[1:], strings.ToLower(command))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			opts, err := parseZStoreOptions(rest, len(keys), true, command == "ZDIFFSTORE")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			var result int
+			switch command {
+			case "ZUNIONSTORE":
+				result, err = r.ZUNIONSTORE(dest, keys, opts)
+			case "ZINTERSTORE":
+				result, err = r.ZINTERSTORE(dest, keys, opts)
+			default:
+				result, err = r.ZDIFFSTORE(dest, keys)
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZINTERCARD":
+			// command syntax: ZINTERCARD numkeys key [key ...] [LIMIT limit]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'zintercard' command")
+			}
+
+			// unlike ZINTER, a numkeys that is not a positive integer has its own error here
+			if numKeys, ok := parseInteger(args[0]); !ok || numKeys < 1 {
+				return errorReply(ErrNumKeys)
+			}
+
+			keys, rest, err := parseNumKeys(args, "zintercard")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			var limit int64
+			if len(rest) > 0 {
+				if len(rest) != 2 || !strings.EqualFold(string(rest[0]), "LIMIT") {
+					return errorReply(ErrSyntax)
+				}
+				var ok bool
+				if limit, ok = parseInteger(rest[1]); !ok || limit < 0 {
+					return errorReply(ErrLimitNegative)
+				}
+			}
+
+			result, err := r.ZINTERCARD(keys, limit)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "ZPOPMIN", "ZPOPMAX":
+			// command syntax: ZPOPMIN key [count] / ZPOPMAX key [count]
+			if len(args) != 1 && len(args) != 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			count := int64(1)
+			if len(args) == 2 {
+				var ok bool
+				if count, ok = parseInteger(args[1]); !ok {
+					return errorReply(ErrNotInteger)
+				}
+				if count < 0 {
+					return errorReply(ErrNotPositive)
+				}
+			}
+
+			members, err := r.ZPOP(key, count, command == "ZPOPMAX")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// without a count the reply is a flat [member, score] even in RESP3
+			if len(args) == 1 {
+				if len(members) == 0 {
+					return resp.Array()
+				}
+				return resp.Array(resp.BulkString(members[0].Member), resp.Double(members[0].Score))
+			}
+			return zmembersReply(client, members, true)
+
+		case "ZMPOP":
+			// command syntax: ZMPOP numkeys key [key ...] MIN | MAX [COUNT count]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'zmpop' command")
+			}
+
+			if numKeys, ok := parseInteger(args[0]); !ok || numKeys < 1 {
+				return errorReply(ErrNumKeys)
+			}
+
+			keys, rest, err := parseNumKeys(args, "zmpop")
+			if err != nil {
+				return errorReply(err)
+			}
+			if len(rest) == 0 {
+				return errorReply(ErrSyntax)
+			}
+
+			var max bool
+			switch strings.ToUpper(string(rest[0])) {
+			case "MIN":
+			case "MAX":
+				max = true
+			default:
+				return errorReply(ErrSyntax)
+			}
+
+			count := int64(1)
+			if len(rest) > 1 {
+				if len(rest) != 3 || !strings.EqualFold(string(rest[1]), "COUNT") {
+					return errorReply(ErrSyntax)
+				}
+				var ok bool
+				if count, ok = parseInteger(rest[2]); !ok || count < 1 {
+					return errorReply(ErrCountNotPositive)
+				}
+			}
+
+			key, members, err := r.ZMPOP(keys, count, max)
+			if err != nil {
+				return errorReply(err)
+			}
+			if key == "" {
+				return resp.NullArray()
+			}
+
+			// the members are always [member, score] pairs here, in RESP2 as well
+			pairs := make([]resp.Value, len(members))
+			for i, m := range members {
+				pairs[i] = resp.Array(resp.BulkString(m.Member), resp.Double(m.Score))
+			}
+			return resp.Array(resp.BulkString(key), resp.Array(pairs...))
+
+		case "ZRANDMEMBER":
+			// command syntax: ZRANDMEMBER key [count [WITHSCORES]]
+			if len(args) < 1 || len(args) > 3 {
+				return resp.Error("ERR wrong number of arguments for 'zrandmember' command")
+			}
+
+			key := string(args[0])
+
+			// without a count the reply is a single member, or null for a missing key
+			if len(args) == 1 {
+				members, err := r.ZRANDMEMBER(key, 1)
+				if err != nil {
+					return errorReply(err)
+				}
+				if len(members) == 0 {
+					return resp.Null()
+				}
+				return resp.BulkString(members[0].Member)
+			}
+
+			count, ok := parseInteger(args[1])
+			if !ok {
+				return errorReply(ErrNotInteger)
+			}
+
+			withScores := len(args) == 3
+			if withScores && !strings.EqualFold(string(args[2]), "WITHSCORES") {
+				return errorReply(ErrSyntax)
+			}
+			// a negative count is the size of the reply (twice that with scores), it is refused before anything
+			// gets allocated for it
+			if count < -math.MaxInt64/2 || count > math.MaxInt64/2 {
+				return errorReply(ErrOutOfRange)
+			}
+
+			members, err := r.ZRANDMEMBER(key, count)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return zmembersReply(client, members, withScores)
+
+		case "ZRANGESTORE":
+			// command syntax: ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+			if len(args) < 4 {
+				return resp.Error("ERR wrong number of arguments for 'zrangestore' command")
+			}
+
+			dest := string(args[0])
+			source := string(args[1])
+
+			q, err := parseZRangeArgs(args[2:], zrangeByRank, false, false)
+			if err != nil {
+				return errorReply(err)
+			}
+			// there are no scores to reply with, the stored members always keep theirs
+			if q.withScores {
+				return errorReply(ErrSyntax)
+			}
+
+			result, err := r.ZRANGESTORE(dest, source, q)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "XADD":
+			// command syntax: XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]] * | id field value [field value ...]
+			if len(args) < 4 {
+				return resp.Error("ERR wrong number of arguments for 'xadd' command")
+			}
+
+			key := string(args[0])
+
+			opts, fields, err := parseXAddArgs(args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			id, ok, err := r.XADD(key, opts, fields)
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				return resp.Null()
+			}
+
+			return resp.BulkString(id.String())
+
+		case "XLEN":
+			// command syntax: XLEN key
+			if len(args) != 1 {
+				return resp.Error("ERR wrong number of arguments for 'xlen' command")
+			}
+
+			key := string(args[0])
+
+			result, err := r.XLEN(key)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "XRANGE", "XREVRANGE":
+			// command syntax: XRANGE key start end [COUNT count] / XREVRANGE key end start [COUNT count]
+			if len(args) != 3 && len(args) != 5 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			startArg, endArg := args[1], args[2]
+			if command == "XREVRANGE" {
+				startArg, endArg = endArg, startArg
+			}
+
+			start, err := parseRangeID(startArg, true)
+			if err != nil {
+				return errorReply(err)
+			}
+			end, err := parseRangeID(endArg, false)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			count := int64(-1)
+			if len(args) == 5 {
+				if !strings.EqualFold(string(args[3]), "COUNT") {
+					return errorReply(ErrSyntax)
+				}
+				var ok bool
+				if count, ok = parseInteger(args[4]); !ok {
+					return errorReply(ErrNotInteger)
+				}
+				// a negative count returns nothing, just like COUNT 0
+				count = max(count, 0)
+			}
+
+			entries, err := r.XRANGE(key, start, end, count, command == "XREVRANGE")
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return streamEntriesReply(entries)
+
+		case "XDEL":
+			// command syntax: XDEL key id [id ...]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'xdel' command")
+			}
+
+			key := string(args[0])
+
+			// every ID is checked before anything is deleted
+			ids := make([]StreamID, len(args)-1)
+			for i, arg := range args[1:] {
+				id, ok := parseStreamID(arg, 0)
+				if !ok {
+					return errorReply(ErrInvalidStreamID)
+				}
+				ids[i] = id
+			}
+
+			result, err := r.XDEL(key, ids)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "XTRIM":
+			// command syntax: XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'xtrim' command")
+			}
+
+			key := string(args[0])
+
+			var trim StreamTrim
+			for i := 1; i < len(args); {
+				next, matched, err := parseTrimOption(&trim, args, i)
+				if err != nil {
+					return errorReply(err)
+				}
+				if !matched {
+					return errorReply(ErrSyntax)
+				}
+				i = next
+			}
+			if trim.Strategy == trimNone {
+				return errorReply(ErrSyntax)
+			}
+			if err := trim.validate(); err != nil {
+				return errorReply(err)
+			}
+
+			result, err := r.XTRIM(key, trim)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "XREAD":
+			// command syntax: XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'xread' command")
+			}
+
+			q, err := parseXReadArgs(args, false)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			ids, err := r.resolveStreamIDs(q.keys, q.ids)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			var result []StreamRead
+			try := func() bool {
+				result, err = r.XREAD(q.keys, ids, q.count)
+				return err != nil || len(result) > 0
+			}
+
+			if q.block {
+				r.blockOn(client, q.keys, q.timeout, try)
+			} else {
+				try()
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return streamReadReply(client, result)
+
+		case "XREADGROUP":
+			// command syntax: XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+			if len(args) < 6 {
+				return resp.Error("ERR wrong number of arguments for 'xreadgroup' command")
+			}
+
+			q, err := parseXReadArgs(args, true)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			ids, err := parseGroupReadIDs(q.ids)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// reading the consumer's history always replies right away, only waiting for new entries (">") blocks
+			var result []StreamRead
+			try := func() bool {
+				result, err = r.XREADGROUP(q.group, q.consumer, q.keys, ids, q.count, q.noAck)
+				return err != nil || len(result) > 0
+			}
+
+			if q.block {
+				r.blockOn(client, q.keys, q.timeout, try)
+			} else {
+				try()
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return streamReadReply(client, result)
+
+		case "XGROUP":
+			// command syntax: XGROUP CREATE key group id | $ [MKSTREAM] [ENTRIESREAD entries-read]
+			//                 XGROUP SETID key group id | $ [ENTRIESREAD entries-read]
+			//                 XGROUP DESTROY key group
+			//                 XGROUP CREATECONSUMER key group consumer
+			//                 XGROUP DELCONSUMER key group consumer
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'xgroup' command")
+			}
+
+			subcommand := strings.ToUpper(string(args[0]))
+			wrongArgs := resp.Errorf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(subcommand))
+
+			switch subcommand {
+			case "CREATE", "SETID":
+				if len(args) < 4 {
+					return wrongArgs
+				}
+
+				key := string(args[1])
+				group := string(args[2])
+
+				mkStream := false
+				entriesRead := int64(entriesReadUnknown)
+				for i := 4; i < len(args); i++ {
+					option := strings.ToUpper(string(args[i]))
+
+					switch {
+					case option == "MKSTREAM" && subcommand == "CREATE":
+						mkStream = true
+					case option == "ENTRIESREAD" && i+1 < len(args):
+						var err error
+						if entriesRead, err = parseEntriesRead(args[i+1]); err != nil {
+							return errorReply(err)
+						}
+						i++
+					default:
+						return errorReply(ErrSyntax)
+					}
+				}
+
+				var err error
+				if subcommand == "CREATE" {
+					err = r.XGROUPCREATE(key, group, args[3], mkStream, entriesRead)
+				} else {
+					err = r.XGROUPSETID(key, group, args[3], entriesRead)
+				}
+				if err != nil {
+					return errorReply(err)
+				}
+
+				return resp.OK
+
+			case "DESTROY":
+				if len(args) != 3 {
+					return wrongArgs
+				}
+
+				destroyed, err := r.XGROUPDESTROY(string(args[1]), string(args[2]))
+				if err != nil {
+					return errorReply(err)
+				}
+				if destroyed {
+					return resp.Integer(1)
+				}
+				return resp.Integer(0)
+
+			case "CREATECONSUMER":
+				if len(args) != 4 {
+					return wrongArgs
+				}
+
+				created, err := r.XGROUPCREATECONSUMER(string(args[1]), string(args[2]), string(args[3]))
+				if err != nil {
+					return errorReply(err)
+				}
+				if created {
+					return resp.Integer(1)
+				}
+				return resp.Integer(0)
+
+			case "DELCONSUMER":
+				if len(args) != 4 {
+					return wrongArgs
+				}
+
+				pending, err := r.XGROUPDELCONSUMER(string(args[1]), string(args[2]), string(args[3]))
+				if err != nil {
+					return errorReply(err)
+				}
+
+				return resp.Integer(int64(pending))
+			}
+
+			return resp.Errorf("ERR unknown subcommand '%s'. Try XGROUP HELP.", string(args[0]))
+
+		case "XACK":
+			// command syntax: XACK key group id [id ...]
+			if len(args) < 3 {
+				return resp.Error("ERR wrong number of arguments for 'xack' command")
+			}
+
+			key := string(args[0])
+			group := string(args[1])
+
+			ids := make([]StreamID, len(args)-2)
+			for i, arg := range args[2:] {
+				id, ok := parseStreamID(arg, 0)
+				if !ok {
+					return errorReply(ErrInvalidStreamID)
+				}
+				ids[i] = id
+			}
+
+			result, err := r.XACK(key, group, ids)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "XPENDING":
+			// command syntax: XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'xpending' command")
+			}
+
+			key := string(args[0])
+			group := string(args[1])
+
+			// without a range the reply is a summary: [count, smallest ID, greatest ID, [[consumer, count], ...]]
+			if len(args) == 2 {
+				summary, err := r.XPENDINGSUMMARY(key, group)
+				if err != nil {
+					return errorReply(err)
+				}
+				if summary.Count == 0 {
+					return resp.Array(resp.Integer(0), resp.Null(), resp.Null(), resp.NullArray())
+				}
+
+				consumers := make([]resp.Value, len(summary.Consumers))
+				for i, c := range summary.Consumers {
+					consumers[i] = resp.Array(resp.BulkString(c.Name), resp.BulkString(strconv.Itoa(c.Count)))
+				}
+				return resp.Array(
+					resp.Integer(int64(summary.Count)),
+					resp.BulkString(summary.Min.String()),
+					resp.BulkString(summary.Max.String()),
+					resp.Array(consumers...),
+				)
+			}
+
+			rest := args[2:]
+			var minIdle int64
+			if strings.EqualFold(string(rest[0]), "IDLE") && len(rest) > 1 {
+				var ok bool
+				if minIdle, ok = parseInteger(rest[1]); !ok {
+					return errorReply(ErrNotInteger)
+				}
+				rest = rest[2:]
+			}
+			if len(rest) != 3 && len(rest) != 4 {
+				return errorReply(ErrSyntax)
+			}
+
+			start, err := parseRangeID(rest[0], true)
+			if err != nil {
+				return errorReply(err)
+			}
+			end, err := parseRangeID(rest[1], false)
+			if err != nil {
+				return errorReply(err)
+			}
+			count, ok := parseInteger(rest[2])
+			if !ok {
+				return errorReply(ErrNotInteger)
+			}
+
+			consumerName := ""
+			if len(rest) == 4 {
+				consumerName = string(rest[3])
+			}
+
+			pending, err := r.XPENDING(key, group, minIdle, start, end, count, consumerName)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(pending))
+			for i, p := range pending {
+				replies[i] = resp.Array(resp.BulkString(p.ID.String()), resp.BulkString(p.Consumer), resp.Integer(p.Idle), resp.Integer(p.DeliveryCount))
+			}
+			return resp.Array(replies...)
+
+		case "XCLAIM":
+			// command syntax: XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+			//                 [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+			if len(args) < 5 {
+				return resp.Error("ERR wrong number of arguments for 'xclaim' command")
+			}
+
+			key := string(args[0])
+			group := string(args[1])
+			consumerName := string(args[2])
+
+			minIdle, ok := parseInteger(args[3])
+			if !ok {
+				return errorReply(errInvalidClaimArgument("min-idle-time", "XCLAIM"))
+			}
+
+			ids, opts, err := parseXClaimArgs(args[4:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			claimed, err := r.XCLAIM(key, group, consumerName, max(minIdle, 0), ids, opts)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			if opts.JustID {
+				claimedIDs := make([]StreamID, len(claimed))
+				for i, entry := range claimed {
+					claimedIDs[i] = entry.ID
+				}
+				return streamIDsReply(claimedIDs)
+			}
+			return streamEntriesReply(claimed)
+
+		case "XAUTOCLAIM":
+			// command syntax: XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+			if len(args) < 5 {
+				return resp.Error("ERR wrong number of arguments for 'xautoclaim' command")
+			}
+
+			key := string(args[0])
+			group := string(args[1])
+			consumerName := string(args[2])
+
+			minIdle, ok := parseInteger(args[3])
+			if !ok {
+				return errorReply(errInvalidClaimArgument("min-idle-time", "XAUTOCLAIM"))
+			}
+
+			start, err := parseRangeID(args[4], true)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			count := int64(100)
+			justID := false
+			for i := 5; i < len(args); i++ {
+				option := strings.ToUpper(string(args[i]))
+
+				switch {
+				case option == "COUNT" && i+1 < len(args):
+					// the count is multiplied by the number of attempts per entry, so it has to stay well below the limit
+					if count, ok = parseInteger(args[i+1]); !ok || count < 1 || count > math.MaxInt64/10 {
+						return errorReply(ErrCountMustBePositive)
+					}
+					i++
+				case option == "JUSTID":
+					justID = true
+				default:
+					return errorReply(ErrSyntax)
+				}
+			}
+
+			next, claimed, deleted, err := r.XAUTOCLAIM(key, group, consumerName, max(minIdle, 0), start, count, justID)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			claimedReply := streamEntriesReply(claimed)
+			if justID {
+				claimedIDs := make([]StreamID, len(claimed))
+				for i, entry := range claimed {
+					claimedIDs[i] = entry.ID
+				}
+				claimedReply = streamIDsReply(claimedIDs)
+			}
+			return resp.Array(resp.BulkString(next.String()), claimedReply, streamIDsReply(deleted))
+
+		case "XINFO":
+			// command syntax: XINFO STREAM key [FULL [COUNT count]] / XINFO GROUPS key / XINFO CONSUMERS key group
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'xinfo' command")
+			}
+
+			subcommand := strings.ToUpper(string(args[0]))
+			wrongArgs := resp.Errorf("ERR wrong number of arguments for 'xinfo|%s' command", strings.ToLower(subcommand))
+
+			var result resp.Value
+			var err error
+
+			switch subcommand {
+			case "STREAM":
+				if len(args) < 2 {
+					return wrongArgs
+				}
+
+				full := false
+				count := int64(10)
+				switch {
+				case len(args) == 2:
+				case strings.EqualFold(string(args[2]), "FULL") && len(args) == 3:
+					full = true
+				case strings.EqualFold(string(args[2]), "FULL") && len(args) == 5 && strings.EqualFold(string(args[3]), "COUNT"):
+					var ok bool
+					if count, ok = parseInteger(args[4]); !ok {
+						return errorReply(ErrNotInteger)
+					}
+					full = true
+				default:
+					return errorReply(ErrSyntax)
+				}
+
+				result, err = r.XINFOSTREAM(string(args[1]), full, count)
+
+			case "GROUPS":
+				if len(args) != 2 {
+					return wrongArgs
+				}
+				result, err = r.XINFOGROUPS(string(args[1]))
+
+			case "CONSUMERS":
+				if len(args) != 3 {
+					return wrongArgs
+				}
+				result, err = r.XINFOCONSUMERS(string(args[1]), string(args[2]))
+
+			default:
+				return resp.Errorf("ERR unknown subcommand '%s'. Try XINFO HELP.", string(args[0]))
+			}
+
+			if err != nil {
+				return errorReply(err)
+			}
+			return result
+
+		case "PFADD":
+			// command syntax: PFADD key [element [element ...]]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'pfadd' command")
+			}
+
+			result, err := r.PFADD(string(args[0]), args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "PFCOUNT":
+			// command syntax: PFCOUNT key [key ...]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'pfcount' command")
+			}
+
+			keys := make([]string, len(args))
+			for i, arg := range args {
+				keys[i] = string(arg)
+			}
+
+			result, err := r.PFCOUNT(keys)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(result)
+
+		case "PFMERGE":
+			// command syntax: PFMERGE destkey [sourcekey [sourcekey ...]]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'pfmerge' command")
+			}
+
+			sources := make([]string, len(args)-1)
+			for i, arg := range args[1:] {
+				sources[i] = string(arg)
+			}
+
+			if err := r.PFMERGE(string(args[0]), sources); err != nil {
+				return errorReply(err)
+			}
+
+			return resp.OK
+
+		case "PFDEBUG":
+			// command syntax: PFDEBUG subcommand key
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'pfdebug' command")
+			}
+
+			result, err := r.PFDEBUG(string(args[0]), string(args[1]))
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return result
+
+		case "GEOADD":
+			// command syntax: GEOADD key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]
+			if len(args) < 4 {
+				return resp.Error("ERR wrong number of arguments for 'geoadd' command")
+			}
+
+			opts, members, err := parseGeoAddArgs(args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			result, err := r.GEOADD(string(args[0]), opts, members)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "GEOPOS":
+			// command syntax: GEOPOS key [member [member ...]]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'geopos' command")
+			}
+
+			members := make([]string, len(args)-1)
+			for i, arg := range args[1:] {
+				members[i] = string(arg)
+			}
+
+			positions, err := r.GEOPOS(string(args[0]), members)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(positions))
+			for i, position := range positions {
+				if position == nil {
+					replies[i] = resp.NullArray()
+					continue
+				}
+				replies[i] = geoCoordinatesReply(client, position.Longitude, position.Latitude)
+			}
+			return resp.Array(replies...)
+
+		case "GEODIST":
+			// command syntax: GEODIST key member1 member2 [M | KM | FT | MI]
+			if len(args) != 3 && len(args) != 4 {
+				return resp.Error("ERR wrong number of arguments for 'geodist' command")
+			}
+
+			unit := 1.0
+			if len(args) == 4 {
+				var err error
+				if unit, err = parseGeoUnit(args[3]); err != nil {
+					return errorReply(err)
+				}
+			}
+
+			distance, ok, err := r.GEODIST(string(args[0]), string(args[1]), string(args[2]), unit)
+			if err != nil {
+				return errorReply(err)
+			}
+			if !ok {
+				return resp.Null()
+			}
+
+			return resp.BulkString(formatGeoDistance(distance))
+
+		case "GEOHASH":
+			// command syntax: GEOHASH key [member [member ...]]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'geohash' command")
+			}
+
+			members := make([]string, len(args)-1)
+			for i, arg := range args[1:] {
+				members[i] = string(arg)
+			}
+
+			hashes, found, err := r.GEOHASH(string(args[0]), members)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(hashes))
+			for i, hash := range hashes {
+				if !found[i] {
+					replies[i] = resp.Null()
+					continue
+				}
+				replies[i] = resp.BulkString(hash)
+			}
+			return resp.Array(replies...)
+
+		case "GEOSEARCH":
+			// command syntax: GEOSEARCH key FROMMEMBER member | FROMLONLAT longitude latitude
+			//                 BYRADIUS radius M | KM | FT | MI | BYBOX width height M | KM | FT | MI
+			//                 [ASC | DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+			if len(args) < 6 {
+				return resp.Error("ERR wrong number of arguments for 'geosearch' command")
+			}
+
+			q, err := parseGeoSearchArgs(args[1:], command, false)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			results, err := r.GEOSEARCH(string(args[0]), q)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			replies := make([]resp.Value, len(results))
+			for i, result := range results {
+				if !q.WithDist && !q.WithHash && !q.WithCoord {
+					replies[i] = resp.BulkString(result.Member)
+					continue
+				}
+
+				// [member, distance, hash, [longitude, latitude]], with only the parts that were asked for
+				reply := []resp.Value{resp.BulkString(result.Member)}
+				if q.WithDist {
+					reply = append(reply, resp.BulkString(formatGeoDistance(result.Distance)))
+				}
+				if q.WithHash {
+					reply = append(reply, resp.Integer(int64(result.Hash)))
+				}
+				if q.WithCoord {
+					reply = append(reply, geoCoordinatesReply(client, result.Longitude, result.Latitude))
+				}
+				replies[i] = resp.Array(reply...)
+			}
+			return resp.Array(replies...)
+
+		case "GEOSEARCHSTORE":
+			// command syntax: GEOSEARCHSTORE destination source FROMMEMBER member | FROMLONLAT longitude latitude
+			//                 BYRADIUS radius M | KM | FT | MI | BYBOX width height M | KM | FT | MI
+			//                 [ASC | DESC] [COUNT count [ANY]] [STOREDIST]
+			if len(args) < 7 {
+				return resp.Error("ERR wrong number of arguments for 'geosearchstore' command")
+			}
+
+			q, err := parseGeoSearchArgs(args[2:], command, true)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			result, err := r.GEOSEARCHSTORE(string(args[0]), string(args[1]), q)
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return resp.Integer(int64(result))
+
+		case "SCAN":
+			// command syntax: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'scan' command")
+			}
+
+			cursor, err := parseScanCursor(args[0])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			opts, err := parseScanOptions(command, args[1:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			next, keys := r.SCAN(cursor, opts)
+
+			return scanReply(next, keys)
+
+		case "SSCAN", "HSCAN", "ZSCAN":
+			// command syntax: SSCAN key cursor [MATCH pattern] [COUNT count] (HSCAN also takes NOVALUES)
+			if len(args) < 2 {
+				return resp.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(command))
+			}
+
+			key := string(args[0])
+
+			cursor, err := parseScanCursor(args[1])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			opts, err := parseScanOptions(command, args[2:])
+			if err != nil {
+				return errorReply(err)
+			}
+
+			// HSCAN replies field, value, field, value, ... and ZSCAN member, score, member, score, ...
+			var next uint64
+			var elements []string
+			switch command {
+			case "SSCAN":
+				next, elements, err = r.SSCAN(key, cursor, opts)
+
+			case "HSCAN":
+				var fields []HashField
+				next, fields, err = r.HSCAN(key, cursor, opts)
+				for _, f := range fields {
+					elements = append(elements, f.Field)
+					if !opts.NoValues {
+						elements = append(elements, f.Value)
+					}
+				}
+
+			case "ZSCAN":
+				var members []ZMember
+				next, members, err = r.ZSCAN(key, cursor, opts)
+				for _, m := range members {
+					elements = append(elements, m.Member, resp.FormatDouble(m.Score))
+				}
+			}
+			if err != nil {
+				return errorReply(err)
+			}
+
+			return scanReply(next, elements)
+
+		case "EXPIRE":
+			// command syntax: EXPIRE key seconds
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'EXPIRE' command")
+			}
+
+			key := string(args[0])
+
+			seconds := string(args[1])
+
+			secondsInt, err := strconv.Atoi(seconds)
+			if err != nil {
+				return resp.Error("ERR operation failed while converting seconds to integer")
+			}
+
+			result, ok := r.EXPIRE(key, secondsInt)
+			if !ok {
+				return wrongTypeReply
+			}
+
+			return resp.Integer(int64(result))
+
+		case "PEXPIRE":
+			// command syntax: PEXPIRE key milliseconds
+			if len(args) < 2 {
+				return resp.Error("ERR wrong number of arguments for 'PEXPIRE' command")
+			}
+
+			key := string(args[0])
+
+			ms := string(args[1])
+
+			msInt, err := strconv.Atoi(ms)
 			if err != nil {
-				return "-ERR operation failed while converting milliseconds to integer\r\n"
+				return resp.Error("ERR operation failed while converting milliseconds to integer")
 			}
 
 			result, ok := r.PEXPIRE(key, msInt)
 			if !ok {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+				return wrongTypeReply
 			}
 
-			return fmt.Sprintf(":%d\r\n", result)
+			return resp.Integer(int64(result))
 
-		case "TTL":
+		case "OBJECT":
+			// command syntax: OBJECT ENCODING key
 			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'TTL' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'object' command")
+			}
+
+			subcommand := strings.ToUpper(string(args[0]))
+			if subcommand != "ENCODING" {
+				return resp.Errorf("ERR unknown subcommand '%s'. Try OBJECT HELP.", string(args[0]))
+			}
+			if len(args) != 2 {
+				return resp.Error("ERR wrong number of arguments for 'object|encoding' command")
+			}
+
+			encoding, ok := r.OBJECTENCODING(string(args[1]))
+			if !ok {
+				return resp.Null()
 			}
+			return resp.BulkString(encoding)
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
+		case "TTL":
+			if len(args) < 1 {
+				return resp.Error("ERR wrong number of arguments for 'TTL' command")
 			}
 
+			key := string(args[0])
+
 			result, ok2 := r.TTL(key)
 			if !ok2 {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+				return wrongTypeReply
 			}
 
-			resultInt := strconv.Itoa(result)
-			return fmt.Sprintf(":%s\r\n", resultInt)
+			return resp.Integer(int64(result))
 
 		case "PTTL":
 			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'PTTL' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'PTTL' command")
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
-			}
+			key := string(args[0])
 
 			result, ok2 := r.PTTL(key)
 			if !ok2 {
-				return "-WRONGTYPE operation against a key holding the wrong kind of value\r\n"
+				return wrongTypeReply
 			}
 
-			resultInt := strconv.Itoa(result)
-			return fmt.Sprintf(":%s\r\n", resultInt)
+			return resp.Integer(int64(result))
 
 		case "PERSIST":
 			if len(args) < 1 {
-				return "-ERR wrong number of arguments for 'PTTL' command\r\n"
+				return resp.Error("ERR wrong number of arguments for 'PTTL' command")
 			}
 
-			key, ok1 := args[0].(string)
-			if !ok1 {
-				return "-ERR key must be string\r\n"
-			}
+			key := string(args[0])
 
 			result := r.PERSIST(key)
-			return fmt.Sprintf(":%d\r\n", result)
+			return resp.Integer(int64(result))
+
+		case "HELLO":
+			// command syntax: HELLO [protover [AUTH username password] [SETNAME clientname]]
+			return r.HELLO(client, stringArgs(args))
+
+		case "INFO":
+			// command syntax: INFO [section [section ...]]
+			sections := stringArgs(args)
+
+			// INFO is meant to be read by humans, RESP3 clients get it as a verbatim text string
+			return resp.Verbatim("txt", r.INFO(sections))
 
 		case "SAVE":
 			err := r.SaveToDisk("dump.rgb.json")
 			if err != nil {
-				return "-ERR error while saving file to disc\r\n"
+				return resp.Error("ERR error while saving file to disc")
 			}
 
 			fmt.Println("data loaded onto disc with saved data")
-			return "+OK\r\n"
+			return resp.OK
+
+		default:
+			return resp.Error("ERR unknown command")
+	}
+}
+
+// setReply runs a SET and builds its reply: the old value (or null) with the GET option,
+// otherwise OK, or null when NX/XX prevented the write
+func(r *RedisCache) setReply(key string, value []byte, opts SetOptions) resp.Value {
+	old, hadOld, written, err := r.SET(key, value, opts)
+	if err != nil {
+		return errorReply(err)
+	}
+
+	if opts.Get {
+		if !hadOld {
+			return resp.Null()
+		}
+		return resp.BulkString(string(old))
+	}
+
+	if !written {
+		return resp.Null()
+	}
+	return resp.OK
+}
+
+// zmembersReply builds the reply of ZRANGE and friends
+// with scores, RESP2 clients get a flat [member, score, member, score, ...] array
+// and RESP3 clients an array of [member, score] pairs, which is what Redis 7 sends
+func zmembersReply(client *Client, members []ZMember, withScores bool) resp.Value {
+	replies := make([]resp.Value, 0, len(members))
+	resp3 := client.writer.Protocol() >= resp.RESP3
+
+	for _, m := range members {
+		switch {
+		case !withScores:
+			replies = append(replies, resp.BulkString(m.Member))
+		case resp3:
+			replies = append(replies, resp.Array(resp.BulkString(m.Member), resp.Double(m.Score)))
+		default:
+			replies = append(replies, resp.BulkString(m.Member), resp.Double(m.Score))
+		}
+	}
 
+	return resp.Array(replies...)
+}
+
+// streamEntriesReply is the reply of XRANGE: [[id, [field, value, ...]], ...]
+func streamEntriesReply(entries []StreamEntry) resp.Value {
+	replies := make([]resp.Value, len(entries))
+	for i, entry := range entries {
+		replies[i] = streamEntryReply(entry)
+	}
+	return resp.Array(replies...)
+}
+
+// streamEntryReply is [id, [field, value, ...]], an entry without fields is one XREADGROUP found deleted: [id, nil]
+func streamEntryReply(entry StreamEntry) resp.Value {
+	if entry.Fields == nil {
+		return resp.Array(resp.BulkString(entry.ID.String()), resp.NullArray())
+	}
+	return resp.Array(resp.BulkString(entry.ID.String()), resp.BulkStrings(entry.Fields))
+}
+
+// streamIDsReply is a plain list of IDs, e.g. XCLAIM ... JUSTID
+func streamIDsReply(ids []StreamID) resp.Value {
+	replies := make([]resp.Value, len(ids))
+	for i, id := range ids {
+		replies[i] = resp.BulkString(id.String())
+	}
+	return resp.Array(replies...)
+}
+
+// streamReadReply is the reply of XREAD, a map from key to entries in RESP3 and [[key, entries], ...] in RESP2
+// nothing to read is a null array
+func streamReadReply(client *Client, reads []StreamRead) resp.Value {
+	if len(reads) == 0 {
+		return resp.NullArray()
+	}
+
+	replies := make([]resp.Value, 0, len(reads)*2)
+	resp3 := client.writer.Protocol() >= resp.RESP3
+
+	for _, read := range reads {
+		if resp3 {
+			replies = append(replies, resp.BulkString(read.Key), streamEntriesReply(read.Entries))
+		} else {
+			replies = append(replies, resp.Array(resp.BulkString(read.Key), streamEntriesReply(read.Entries)))
+		}
+	}
+
+	if resp3 {
+		return resp.Map(replies...)
+	}
+	return resp.Array(replies...)
+}
+
+// stringArgs copies the arguments of a command into strings
+func stringArgs(args [][]byte) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = string(arg)
+	}
+	return result
+}
+
+// geoCoordinatesReply is the [longitude, latitude] pair of GEOPOS and WITHCOORD,
+// RESP2 gets the same text Redis sends, RESP3 real doubles
+func geoCoordinatesReply(client *Client, longitude float64, latitude float64) resp.Value {
+	if client.writer.Protocol() >= resp.RESP3 {
+		return resp.Array(resp.Double(longitude), resp.Double(latitude))
+	}
+	return resp.Array(resp.BulkString(formatGeoCoordinate(longitude)), resp.BulkString(formatGeoCoordinate(latitude)))
+}
+
+// scanReply is the reply of SCAN and friends: the next cursor (as a string) and the elements of this call
+func scanReply(next uint64, elements []string) resp.Value {
+	return resp.Array(resp.BulkString(strconv.FormatUint(next, 10)), resp.BulkStrings(elements))
+}
+
+// integersReply is an array of integers, one for every field of the hash field TTL commands
+func integersReply(results []int64) resp.Value {
+	elems := make([]resp.Value, len(results))
+	for i, result := range results {
+		elems[i] = resp.Integer(result)
+	}
+	return resp.Array(elems...)
+}
+
+// setReply is the reply of the commands that return a set of members, a set in RESP3 and an array in RESP2
+func setReply(members []string) resp.Value {
+	elems := make([]resp.Value, len(members))
+	for i, member := range members {
+		elems[i] = resp.BulkString(member)
+	}
+	return resp.Set(elems...)
+}
+
+// hashFieldsReply is the reply of HRANDFIELD, with values it is [field, value] pairs in RESP3
+// and a flat [field, value, field, value, ...] array in RESP2
+func hashFieldsReply(client *Client, fields []HashField, withValues bool) resp.Value {
+	replies := make([]resp.Value, 0, len(fields))
+	resp3 := client.writer.Protocol() >= resp.RESP3
+
+	for _, f := range fields {
+		switch {
+		case !withValues:
+			replies = append(replies, resp.BulkString(f.Field))
+		case resp3:
+			replies = append(replies, resp.Array(resp.BulkString(f.Field), resp.BulkString(f.Value)))
 		default:
-			return "-ERR unknown command\r\n"
+			replies = append(replies, resp.BulkString(f.Field), resp.BulkString(f.Value))
+		}
 	}
-}
\ No newline at end of file
+
+	return resp.Array(replies...)
+}
@@ -25,7 +25,7 @@ func(r *RedisCache) EXPIRE(key string, seconds int) (int, bool) {
 
 	// key gets deleted for 0 or negative ttl
 	if seconds <= 0 {
-		delete(r.store, key)
+		r.deleteEntry(key)
 		return 1, true
 	}
 
@@ -48,7 +48,7 @@ func(r *RedisCache) PEXPIRE(key string, ms int) (int, bool) {
 
 	// key gets deleted for 0 or negative ttl
 	if ms <= 0 {
-		delete(r.store, key)
+		r.deleteEntry(key)
 		return 1, true
 	}
 
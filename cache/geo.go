@@ -0,0 +1,736 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// commands needed to be implemented:
+// GEOADD					--> Done
+// GEOPOS, GEODIST, GEOHASH	--> Done
+// GEOSEARCH				--> Done
+// GEOSEARCHSTORE			--> Done
+
+// geo indexes are sorted sets: every member's score is the 52 bit geohash of its position,
+// so ZRANGE, ZREM, ZSCORE and friends all work on them, and points that are close have close scores
+// a geohash halves the world 26 times in each direction and interleaves the bits, longitude in the odd bits:
+// cutting off the lowest 2*n bits gives the cell of size 2^n that contains the point,
+// so a search only has to look at the score ranges of the cell around the center and its 8 neighbours
+
+const (
+	geoStepMax 		= 26 // 26 bits per coordinate, 52 in total
+	geoLatMin 		= -85.05112878 // the limits of EPSG:3857 (web mercator)
+	geoLatMax 		= 85.05112878
+	geoLongMin 		= -180.0
+	geoLongMax 		= 180.0
+	earthRadius 	= 6372797.560856 // meters, the same number Redis uses so distances match to the last digit
+	mercatorMax 	= 20037726.37
+)
+
+const geoAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geoHash is a geohash of step bits per coordinate
+type geoHash struct {
+	bits uint64
+	step uint
+}
+
+func(h geoHash) isZero() bool {
+	return h.bits == 0 && h.step == 0
+}
+
+// geoArea is the rectangle covered by a geohash cell
+type geoArea struct {
+	longMin, longMax float64
+	latMin, latMax float64
+}
+
+// spreadBits moves the 32 bits of x to the even bit positions of the result
+func spreadBits(x uint32) uint64 {
+	v := uint64(x)
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+// squashBits is the inverse of spreadBits, it collects the even bits of v
+func squashBits(v uint64) uint32 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return uint32(v)
+}
+
+// geoEncode returns the geohash of a point inside the given ranges, ok is false if the point is outside of them
+func geoEncode(longMin, longMax, latMin, latMax, longitude, latitude float64, step uint) (geoHash, bool) {
+	if !validLongLat(longitude, latitude) ||
+		longitude < longMin || longitude > longMax || latitude < latMin || latitude > latMax {
+		return geoHash{}, false
+	}
+
+	latOffset := (latitude - latMin) / (latMax - latMin) * float64(uint64(1)<<step)
+	longOffset := (longitude - longMin) / (longMax - longMin) * float64(uint64(1)<<step)
+	return geoHash{bits: spreadBits(uint32(latOffset)) | spreadBits(uint32(longOffset))<<1, step: step}, true
+}
+
+func geoEncodeWGS84(longitude, latitude float64, step uint) (geoHash, bool) {
+	return geoEncode(geoLongMin, geoLongMax, geoLatMin, geoLatMax, longitude, latitude, step)
+}
+
+func validLongLat(longitude, latitude float64) bool {
+	return longitude >= geoLongMin && longitude <= geoLongMax && latitude >= geoLatMin && latitude <= geoLatMax
+}
+
+func(h geoHash) area() geoArea {
+	latBits := squashBits(h.bits)
+	longBits := squashBits(h.bits >> 1)
+	cells := float64(uint64(1) << h.step)
+
+	return geoArea{
+		latMin: geoLatMin + float64(latBits)/cells*(geoLatMax-geoLatMin),
+		latMax: geoLatMin + (float64(latBits)+1)/cells*(geoLatMax-geoLatMin),
+		longMin: geoLongMin + float64(longBits)/cells*(geoLongMax-geoLongMin),
+		longMax: geoLongMin + (float64(longBits)+1)/cells*(geoLongMax-geoLongMin),
+	}
+}
+
+// geoDecodeScore turns the score of a geo member back into the center of its cell
+func geoDecodeScore(score float64) (longitude float64, latitude float64) {
+	area := geoHash{bits: uint64(score), step: geoStepMax}.area()
+
+	longitude = min(max((area.longMin+area.longMax)/2, geoLongMin), geoLongMax)
+	latitude = min(max((area.latMin+area.latMax)/2, geoLatMin), geoLatMax)
+	return longitude, latitude
+}
+
+// move returns the neighbouring cell dx steps east and dy steps north (-1, 0 or 1), wrapping around the edges
+func(h geoHash) move(dx int, dy int) geoHash {
+	const oddBits, evenBits = 0xaaaaaaaaaaaaaaaa, 0x5555555555555555
+
+	x := h.bits & oddBits
+	y := h.bits & evenBits
+	shift := 64 - h.step*2
+
+	if dx != 0 {
+		zz := uint64(evenBits) >> shift
+		if dx > 0 {
+			x = x + (zz + 1)
+		} else {
+			x = (x | zz) - (zz + 1)
+		}
+		x &= uint64(oddBits) >> shift
+	}
+
+	if dy != 0 {
+		zz := uint64(oddBits) >> shift
+		if dy > 0 {
+			y = y + (zz + 1)
+		} else {
+			y = (y | zz) - (zz + 1)
+		}
+		y &= uint64(evenBits) >> shift
+	}
+
+	return geoHash{bits: x | y, step: h.step}
+}
+
+// scoreRange is the range of 52 bit scores of the members inside the cell
+func(h geoHash) scoreRange() scoreRange {
+	shift := 52 - h.step*2
+	return scoreRange{
+		min: float64(h.bits << shift),
+		max: float64((h.bits + 1) << shift),
+		maxExclusive: true,
+	}
+}
+
+func degToRad(degrees float64) float64 {
+	return degrees * (math.Pi / 180.0)
+}
+
+func radToDeg(radians float64) float64 {
+	return radians / (math.Pi / 180.0)
+}
+
+func geoLatDistance(lat1, lat2 float64) float64 {
+	return earthRadius * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
+
+// geoDistance is the haversine distance in meters between two points
+func geoDistance(long1, lat1, long2, lat2 float64) float64 {
+	v := math.Sin((degToRad(long2) - degToRad(long1)) / 2)
+	// on the same meridian the latitude difference is all there is
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2.0 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// parseGeoUnit returns how many meters one unit is
+func parseGeoUnit(arg []byte) (float64, error) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, ErrGeoUnit
+}
+
+// parseLongLat reads a "longitude latitude" pair and checks that it can be indexed
+func parseLongLat(longArg []byte, latArg []byte) (float64, float64, error) {
+	longitude, ok := parseFloat(longArg)
+	if !ok {
+		return 0, 0, ErrNotFloat
+	}
+	latitude, ok := parseFloat(latArg)
+	if !ok {
+		return 0, 0, ErrNotFloat
+	}
+
+	if !validLongLat(longitude, latitude) {
+		return 0, 0, errInvalidLongLat(longitude, latitude)
+	}
+	return longitude, latitude, nil
+}
+
+// GeoAddOptions are the flags of GEOADD, they mean the same as for ZADD
+type GeoAddOptions struct {
+	NX 	bool
+	XX 	bool
+	CH 	bool
+}
+
+// GeoMember is a member of a geo index with its position
+type GeoMember struct {
+	Member 		string
+	Longitude 	float64
+	Latitude 	float64
+}
+
+func parseGeoAddArgs(args [][]byte) (GeoAddOptions, []GeoMember, error) {
+	var opts GeoAddOptions
+
+	i := 0
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			opts.NX = true
+			continue
+		case "XX":
+			opts.XX = true
+			continue
+		case "CH":
+			opts.CH = true
+			continue
+		}
+		break
+	}
+
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%3 != 0 || (opts.NX && opts.XX) {
+		return opts, nil, ErrSyntax
+	}
+
+	members := make([]GeoMember, 0, len(rest)/3)
+	for j := 0; j < len(rest); j += 3 {
+		longitude, latitude, err := parseLongLat(rest[j], rest[j+1])
+		if err != nil {
+			return opts, nil, err
+		}
+		members = append(members, GeoMember{Member: string(rest[j+2]), Longitude: longitude, Latitude: latitude})
+	}
+
+	return opts, members, nil
+}
+
+func(r *RedisCache) GEOADD(key string, opts GeoAddOptions, members []GeoMember) (int, error) {
+	// command syntax: GEOADD key [NX | XX] [CH] longitude latitude member [longitude latitude member ...]
+	// it is a ZADD with the geohashes as scores
+	scored := make([]ZMember, len(members))
+	for i, m := range members {
+		hash, _ := geoEncodeWGS84(m.Longitude, m.Latitude, geoStepMax)
+		scored[i] = ZMember{Member: m.Member, Score: float64(hash.bits)}
+	}
+
+	return r.ZADD(key, ZAddOptions{NX: opts.NX, XX: opts.XX, CH: opts.CH}, scored)
+}
+
+func(r *RedisCache) GEOPOS(key string, members []string) ([]*GeoMember, error) {
+	// command syntax: GEOPOS key member [member ...] --> the position of every member, nil for the missing ones
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]*GeoMember, len(members))
+	if zset == nil {
+		return positions, nil
+	}
+
+	for i, member := range members {
+		if score, exists := zset.score(member); exists {
+			longitude, latitude := geoDecodeScore(score)
+			positions[i] = &GeoMember{Member: member, Longitude: longitude, Latitude: latitude}
+		}
+	}
+	return positions, nil
+}
+
+func(r *RedisCache) GEODIST(key string, member1 string, member2 string, unit float64) (float64, bool, error) {
+	// command syntax: GEODIST key member1 member2 [M | KM | FT | MI] --> ok is false if the key or a member is missing
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil || zset == nil {
+		return 0, false, err
+	}
+
+	score1, exists1 := zset.score(member1)
+	score2, exists2 := zset.score(member2)
+	if !exists1 || !exists2 {
+		return 0, false, nil
+	}
+
+	long1, lat1 := geoDecodeScore(score1)
+	long2, lat2 := geoDecodeScore(score2)
+	return geoDistance(long1, lat1, long2, lat2) / unit, true, nil
+}
+
+func(r *RedisCache) GEOHASH(key string, members []string) ([]string, []bool, error) {
+	// command syntax: GEOHASH key member [member ...] --> the standard 11 character geohash strings
+	// the scores use the mercator latitude range, a standard geohash the full -90..90 one, so the position is encoded again
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(members))
+	found := make([]bool, len(members))
+	if zset == nil {
+		return hashes, found, nil
+	}
+
+	for i, member := range members {
+		score, exists := zset.score(member)
+		if !exists {
+			continue
+		}
+
+		longitude, latitude := geoDecodeScore(score)
+		hash, _ := geoEncode(-180, 180, -90, 90, longitude, latitude, geoStepMax)
+
+		// 52 bits make 10 characters and 2 bits, the 11th character is always the first letter of the alphabet
+		var text [11]byte
+		for j := 0; j < 11; j++ {
+			index := 0
+			if j < 10 {
+				index = int((hash.bits >> (52 - (j+1)*5)) & 0x1f)
+			}
+			text[j] = geoAlphabet[index]
+		}
+		hashes[i], found[i] = string(text[:]), true
+	}
+	return hashes, found, nil
+}
+
+// GeoSearchQuery is everything after the key of GEOSEARCH (and after the source key of GEOSEARCHSTORE)
+type GeoSearchQuery struct {
+	FromMember 	string
+	HasMember 	bool // search around FromMember instead of Longitude/Latitude
+	Longitude 	float64
+	Latitude 	float64
+
+	ByBox 		bool // a Width x Height box instead of a circle of Radius
+	Radius 		float64
+	Width 		float64
+	Height 		float64
+	Unit 		float64 // meters per unit of Radius, Width, Height and the returned distances
+
+	Sort 		int // 0 for scan order, 1 for nearest first, -1 for farthest first
+	Count 		int64 // 0 for no limit
+	Any 		bool // stop as soon as Count matches are found instead of returning the nearest ones
+
+	WithCoord 	bool
+	WithDist 	bool
+	WithHash 	bool
+	StoreDist 	bool // GEOSEARCHSTORE stores the distances as scores instead of the geohashes
+}
+
+// GeoResult is one match of GEOSEARCH
+type GeoResult struct {
+	Member 		string
+	Distance 	float64 // in the unit of the query
+	Hash 		uint64
+	Longitude 	float64
+	Latitude 	float64
+}
+
+func parseGeoSearchArgs(args [][]byte, command string, store bool) (GeoSearchQuery, error) {
+	q := GeoSearchQuery{Unit: 1}
+	fromSet, bySet := false, false
+	exactlyOneFrom, exactlyOneBy := errGeoExactlyOneFrom(command), errGeoExactlyOneBy(command)
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		remaining := len(args) - i - 1
+
+		switch {
+		case option == "FROMMEMBER" && remaining >= 1:
+			if fromSet {
+				return q, exactlyOneFrom
+			}
+			q.FromMember, q.HasMember, fromSet = string(args[i+1]), true, true
+			i++
+
+		case option == "FROMLONLAT" && remaining >= 2:
+			if fromSet {
+				return q, exactlyOneFrom
+			}
+			var err error
+			if q.Longitude, q.Latitude, err = parseLongLat(args[i+1], args[i+2]); err != nil {
+				return q, err
+			}
+			fromSet = true
+			i += 2
+
+		case option == "BYRADIUS" && remaining >= 2:
+			if bySet {
+				return q, exactlyOneBy
+			}
+			radius, ok := parseFloat(args[i+1])
+			if !ok {
+				return q, ErrNeedNumericRadius
+			}
+			if radius < 0 {
+				return q, ErrRadiusNegative
+			}
+			unit, err := parseGeoUnit(args[i+2])
+			if err != nil {
+				return q, err
+			}
+			q.Radius, q.Unit, bySet = radius, unit, true
+			i += 2
+
+		case option == "BYBOX" && remaining >= 3:
+			if bySet {
+				return q, exactlyOneBy
+			}
+			width, ok := parseFloat(args[i+1])
+			if !ok {
+				return q, ErrNeedNumericWidth
+			}
+			height, ok := parseFloat(args[i+2])
+			if !ok {
+				return q, ErrNeedNumericHeight
+			}
+			if width < 0 || height < 0 {
+				return q, ErrBoxNegative
+			}
+			unit, err := parseGeoUnit(args[i+3])
+			if err != nil {
+				return q, err
+			}
+			q.ByBox, q.Width, q.Height, q.Unit, bySet = true, width, height, unit, true
+			i += 3
+
+		case option == "ASC":
+			q.Sort = 1
+		case option == "DESC":
+			q.Sort = -1
+
+		case option == "COUNT" && remaining >= 1:
+			count, ok := parseInteger(args[i+1])
+			if !ok {
+				return q, ErrNotInteger
+			}
+			if count <= 0 {
+				return q, ErrCountMustBePositive
+			}
+			q.Count = count
+			i++
+			if i+1 < len(args) && strings.EqualFold(string(args[i+1]), "ANY") {
+				q.Any = true
+				i++
+			}
+
+		case option == "WITHCOORD" && !store:
+			q.WithCoord = true
+		case option == "WITHDIST" && !store:
+			q.WithDist = true
+		case option == "WITHHASH" && !store:
+			q.WithHash = true
+		case option == "STOREDIST" && store:
+			q.StoreDist = true
+
+		default:
+			return q, ErrSyntax
+		}
+	}
+
+	if !fromSet {
+		return q, exactlyOneFrom
+	}
+	if !bySet {
+		return q, exactlyOneBy
+	}
+
+	// without ANY the COUNT nearest matches are wanted, so they have to be sorted
+	if q.Count > 0 && !q.Any && q.Sort == 0 {
+		q.Sort = 1
+	}
+	return q, nil
+}
+
+// within tells whether a point is inside the searched shape, and how far it is from the center in meters
+func(q GeoSearchQuery) within(longitude float64, latitude float64) (float64, bool) {
+	if !q.ByBox {
+		distance := geoDistance(q.Longitude, q.Latitude, longitude, latitude)
+		return distance, distance <= q.Radius*q.Unit
+	}
+
+	// the latitude distance is the cheaper one, so it is checked first
+	if geoLatDistance(latitude, q.Latitude) > q.Height*q.Unit/2 {
+		return 0, false
+	}
+	if geoDistance(longitude, latitude, q.Longitude, latitude) > q.Width*q.Unit/2 {
+		return 0, false
+	}
+	return geoDistance(q.Longitude, q.Latitude, longitude, latitude), true
+}
+
+// cells returns the geohash cells to scan: the one around the center and those of its 8 neighbours that
+// can contain matches, all of a size at least as big as the shape, zero cells are to be skipped
+func(q GeoSearchQuery) cells() [9]geoHash {
+	width, height := q.Radius, q.Radius
+	radius := q.Radius
+	if q.ByBox {
+		width, height = q.Width/2, q.Height/2
+		radius = math.Sqrt(width*width + height*height)
+	}
+	width, height, radius = width*q.Unit, height*q.Unit, radius*q.Unit
+
+	// the bounding box of the shape, its longitudes are wider on the side that is closer to a pole
+	latDelta := radToDeg(height / earthRadius)
+	longDeltaTop := radToDeg(width / earthRadius / math.Cos(degToRad(q.Latitude+latDelta)))
+	longDeltaBottom := radToDeg(width / earthRadius / math.Cos(degToRad(q.Latitude-latDelta)))
+	minLat, maxLat := q.Latitude-latDelta, q.Latitude+latDelta
+	minLong, maxLong := q.Longitude-longDeltaTop, q.Longitude+longDeltaTop
+	if q.Latitude < 0 {
+		minLong, maxLong = q.Longitude-longDeltaBottom, q.Longitude+longDeltaBottom
+	}
+
+	step := geoEstimateStep(radius, q.Latitude)
+	hash, _ := geoEncodeWGS84(q.Longitude, q.Latitude, step)
+
+	// near the edge of the center cell a neighbour may not reach as far as the shape does, then the cells have to be bigger
+	if step > 1 {
+		north, south := hash.move(0, 1).area(), hash.move(0, -1).area()
+		east, west := hash.move(1, 0).area(), hash.move(-1, 0).area()
+		if north.latMax < maxLat || south.latMin > minLat || east.longMax < maxLong || west.longMin > minLong {
+			step--
+			hash, _ = geoEncodeWGS84(q.Longitude, q.Latitude, step)
+		}
+	}
+
+	// in the order Redis scans them: center, N, S, E, W, NE, NW, SE, SW
+	cells := [9]geoHash{
+		hash, hash.move(0, 1), hash.move(0, -1), hash.move(1, 0), hash.move(-1, 0),
+		hash.move(1, 1), hash.move(-1, 1), hash.move(1, -1), hash.move(-1, -1),
+	}
+
+	// neighbours on a side the shape does not reach past the center cell cannot hold matches
+	if step >= 2 {
+		area := hash.area()
+		if area.latMin < minLat {
+			cells[2], cells[7], cells[8] = geoHash{}, geoHash{}, geoHash{}
+		}
+		if area.latMax > maxLat {
+			cells[1], cells[5], cells[6] = geoHash{}, geoHash{}, geoHash{}
+		}
+		if area.longMin < minLong {
+			cells[4], cells[6], cells[8] = geoHash{}, geoHash{}, geoHash{}
+		}
+		if area.longMax > maxLong {
+			cells[3], cells[5], cells[7] = geoHash{}, geoHash{}, geoHash{}
+		}
+	}
+
+	return cells
+}
+
+// geoEstimateStep picks the number of bits per coordinate whose cells are about as big as radius meters
+func geoEstimateStep(radius float64, latitude float64) uint {
+	if radius == 0 {
+		return geoStepMax
+	}
+
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// make sure the radius fits in most cases
+	step -= 2
+
+	// cells get narrower towards the poles
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+
+	return uint(min(max(step, 1), geoStepMax))
+}
+
+// geoSearch returns the members of zset inside the shape of q, the caller must hold r.mu
+// ok is false if FROMMEMBER names a member that is not in zset
+func geoSearch(zset *sortedSet, q GeoSearchQuery) ([]GeoResult, bool) {
+	if q.HasMember {
+		score, exists := zset.score(q.FromMember)
+		if !exists {
+			return nil, false
+		}
+		q.Longitude, q.Latitude = geoDecodeScore(score)
+	}
+
+	// with ANY the scan stops as soon as there are enough matches
+	limit := 0
+	if q.Any {
+		limit = int(q.Count)
+	}
+
+	results := []GeoResult{}
+	cells := q.cells()
+	last := -1
+	for i, cell := range cells {
+		if cell.isZero() {
+			continue
+		}
+		// for huge shapes neighbouring cells can be the same cell, which must not be scanned twice
+		if last >= 0 && cell == cells[last] {
+			continue
+		}
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+		last = i
+
+		rng := cell.scoreRange()
+		zset.forEachInScoreRange(rng, func(m ZMember) bool {
+			longitude, latitude := geoDecodeScore(m.Score)
+			distance, inside := q.within(longitude, latitude)
+			if !inside {
+				return true
+			}
+
+			results = append(results, GeoResult{
+				Member: m.Member,
+				Distance: distance / q.Unit,
+				Hash: uint64(m.Score),
+				Longitude: longitude,
+				Latitude: latitude,
+			})
+			return limit == 0 || len(results) < limit
+		})
+	}
+
+	switch q.Sort {
+	case 1:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Distance < results[j].Distance })
+	case -1:
+		sort.SliceStable(results, func(i, j int) bool { return results[i].Distance > results[j].Distance })
+	}
+
+	if q.Count > 0 && int64(len(results)) > q.Count {
+		results = results[:q.Count]
+	}
+	return results, true
+}
+
+func(r *RedisCache) GEOSEARCH(key string, q GeoSearchQuery) ([]GeoResult, error) {
+	// command syntax: GEOSEARCH key FROMMEMBER member | FROMLONLAT longitude latitude
+	//                 BYRADIUS radius M | KM | FT | MI | BYBOX width height M | KM | FT | MI
+	//                 [ASC | DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil || zset == nil {
+		return []GeoResult{}, err
+	}
+
+	results, ok := geoSearch(zset, q)
+	if !ok {
+		return nil, ErrGeoMemberNotFound
+	}
+	return results, nil
+}
+
+func(r *RedisCache) GEOSEARCHSTORE(destination string, key string, q GeoSearchQuery) (int, error) {
+	// command syntax: GEOSEARCHSTORE destination source FROMMEMBER member | FROMLONLAT longitude latitude
+	//                 BYRADIUS radius M | KM | FT | MI | BYBOX width height M | KM | FT | MI
+	//                 [ASC | DESC] [COUNT count [ANY]] [STOREDIST]
+	// --> the number of members stored, destination is deleted if there are none
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil {
+		return 0, err
+	}
+
+	results := []GeoResult{}
+	if zset != nil {
+		var ok bool
+		if results, ok = geoSearch(zset, q); !ok {
+			return 0, ErrGeoMemberNotFound
+		}
+	}
+
+	stored := newSortedSet(&r.Config)
+	for _, result := range results {
+		score := float64(result.Hash)
+		if q.StoreDist {
+			score = result.Distance
+		}
+		stored.set(result.Member, score)
+	}
+	return r.storeSortedSet(destination, stored), nil
+}
+
+// formatGeoCoordinate writes a coordinate the way Redis does, with up to 17 decimals
+func formatGeoCoordinate(f float64) string {
+	text := strconv.FormatFloat(f, 'f', 17, 64)
+	text = strings.TrimRight(text, "0")
+	return strings.TrimSuffix(text, ".")
+}
+
+// formatGeoDistance writes a distance with 4 decimals, like GEODIST and WITHDIST reply
+func formatGeoDistance(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// the examples of the Redis documentation, the replies have to match to the last digit
+func TestGeoAddPosDistHash(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, ":2\r\n"},
+		{[]string{"ZSCORE", "Sicily", "Palermo"}, "$16\r\n3479099956230698\r\n"},
+		{[]string{"ZSCORE", "Sicily", "Catania"}, "$16\r\n3479447370796909\r\n"},
+
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania"}, "$11\r\n166274.1516\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania", "km"}, "$8\r\n166.2742\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania", "mi"}, "$8\r\n103.3182\r\n"},
+		{[]string{"GEODIST", "Sicily", "Foo", "Bar"}, "$-1\r\n"},
+		{[]string{"GEODIST", "Sicily", "Palermo", "Catania", "parsec"}, "-ERR unsupported unit provided. please use M, KM, FT, MI\r\n"},
+
+		{[]string{"GEOHASH", "Sicily", "Palermo", "Catania", "NonExisting"}, "*3\r\n$11\r\nsqc8b49rny0\r\n$11\r\nsqdtr74hyu0\r\n$-1\r\n"},
+		{[]string{"GEOPOS", "Sicily", "Palermo", "Catania", "NonExisting"}, "*3\r\n" +
+			"*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n" +
+			"*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n" +
+			"*-1\r\n"},
+		{[]string{"GEOPOS", "missing", "a"}, "*1\r\n*-1\r\n"},
+
+		// GEOADD is a ZADD, so NX / XX / CH work the same way
+		{[]string{"GEOADD", "Sicily", "NX", "13", "38", "Palermo"}, ":0\r\n"},
+		{[]string{"GEOADD", "Sicily", "XX", "CH", "13", "38", "Palermo", "14", "38", "New"}, ":1\r\n"},
+		{[]string{"ZCARD", "Sicily"}, ":2\r\n"},
+		{[]string{"GEOADD", "Sicily", "NX", "XX", "13", "38", "Palermo"}, "-ERR syntax error\r\n"},
+		{[]string{"GEOADD", "Sicily", "13", "38", "Palermo", "14"}, "-ERR syntax error\r\n"},
+		{[]string{"GEOADD", "Sicily", "200", "100", "Nowhere"}, "-ERR invalid longitude,latitude pair 200.000000,100.000000\r\n"},
+		{[]string{"GEOADD", "Sicily", "abc", "38", "Nowhere"}, "-ERR value is not a valid float\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"GEOPOS", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestGeoSearch(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, ":2\r\n"},
+		{[]string{"GEOADD", "Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"}, ":2\r\n"},
+
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"}, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHCOORD", "WITHDIST"}, "*4\r\n" +
+			"*3\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n" +
+			"*3\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n" +
+			"*3\r\n$5\r\nedge2\r\n$8\r\n279.7403\r\n*2\r\n$20\r\n17.24151045083999634\r\n$20\r\n38.78813451624225195\r\n" +
+			"*3\r\n$5\r\nedge1\r\n$8\r\n279.7405\r\n*2\r\n$19\r\n12.7584877610206604\r\n$20\r\n38.78813451624225195\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "DESC", "WITHHASH"}, "*3\r\n" +
+			"*2\r\n$7\r\nCatania\r\n:3479447370796909\r\n*2\r\n$5\r\nedge1\r\n:3479273021651468\r\n*2\r\n$7\r\nPalermo\r\n:3479099956230698\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "COUNT", "2"}, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "COUNT", "1", "ANY"}, "*1\r\n$7\r\nPalermo\r\n"},
+		{[]string{"GEOSEARCH", "missing", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"}, "*0\r\n"},
+
+		{[]string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Nobody", "BYRADIUS", "200", "km"}, "-ERR could not decode requested zset member\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "BYRADIUS", "200", "km", "ASC", "WITHDIST"}, "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"}, "-ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "ASC", "WITHDIST"}, "-ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "-1", "km"}, "-ERR radius cannot be negative\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "x", "km"}, "-ERR need numeric radius\r\n"},
+		{[]string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "COUNT", "0"}, "-ERR COUNT must be > 0\r\n"},
+
+		{[]string{"GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"}, ":2\r\n"},
+		{[]string{"ZSCORE", "near", "Palermo"}, "$16\r\n3479099956230698\r\n"},
+		{[]string{"GEOSEARCHSTORE", "dists", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC", "COUNT", "1", "STOREDIST"}, ":1\r\n"},
+		{[]string{"ZRANGE", "dists", "0", "-1", "WITHSCORES"}, "*2\r\n$7\r\nCatania\r\n$16\r\n56.4412578701582\r\n"},
+		{[]string{"GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"}, ":0\r\n"},
+		{[]string{"ZCARD", "near"}, ":0\r\n"},
+		{[]string{"GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "WITHDIST"}, "-ERR syntax error\r\n"},
+	});
+}
+
+// testing the cell scan against checking every member, for shapes of all sizes and all over the map
+func TestGeoSearchMatchesFullScan(t *testing.T) {
+	cache := NewRedisServer();
+
+	var members []GeoMember;
+	for i := 0; i < 2000; i++ {
+		longitude := math.Mod(float64(i)*37.77, 360) - 180;
+		latitude := math.Mod(float64(i)*13.13, 170) - 85;
+		members = append(members, GeoMember{Member: "m" + strconv.Itoa(i), Longitude: longitude, Latitude: latitude});
+	};
+	cache.GEOADD("points", GeoAddOptions{}, members);
+
+	zset := cache.store["points"].Value.(*sortedSet);
+	centers := [][2]float64{{0, 0}, {13.4, 52.5}, {-179.9, 10}, {179.9, -10}, {20, 84}, {-40, -84}};
+	for _, center := range centers {
+		for _, radius := range []float64{10, 500, 3000, 10000} {
+			for _, box := range []bool{false, true} {
+				q := GeoSearchQuery{Longitude: center[0], Latitude: center[1], Radius: radius, Width: radius, Height: radius, ByBox: box, Unit: 1000};
+
+				found := map[string]bool{};
+				results, _ := cache.GEOSEARCH("points", q);
+				for _, result := range results {
+					found[result.Member] = true;
+				};
+
+				for member, score := range zset.dict {
+					longitude, latitude := geoDecodeScore(score);
+					if _, inside := q.within(longitude, latitude); inside != found[member] {
+						t.Errorf("Center %v, size %v km, box %t: %s at %f,%f inside: %t, found: %t", center, radius, box, member, longitude, latitude, inside, found[member]);
+					};
+				};
+			};
+		};
+	};
+}
@@ -1,111 +1,456 @@
 package cache
 
-func(r *RedisCache) HSET(key string, fieldValues map[string]string) (int, bool) {
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// commands needed to be implemented:
+// HSET, HMSET key field value [field value ...]	--> Done
+// HSETNX key field value							--> Done
+// HGET, HMGET, HGETALL, HKEYS, HVALS				--> Done
+// HEXISTS, HLEN, HSTRLEN							--> Done
+// HDEL key field [field ...]						--> Done
+// HINCRBY, HINCRBYFLOAT key field increment		--> Done
+// HRANDFIELD key [count [WITHVALUES]]				--> Done
+// field TTLs (HEXPIRE, HTTL, HPERSIST, HGETEX, HSETEX, ...) are in hashexpire.go
+
+// HashField is a field of a hash together with its value
+type HashField struct {
+	Field 	string
+	Value 	string
+}
+
+// a hash is stored as a listpack of field, value, field, value, ... while it is small (hash-max-listpack-entries fields,
+// none of the fields and values longer than hash-max-listpack-value bytes), and as a map once it outgrows that: the fields
+// and values then sit in a slice and the map holds where each field is in it, HRANDFIELD picks from the slice in O(1)
+// fields can have a TTL of their own (HEXPIRE and friends, hashexpire.go), those are kept next to the fields in expires
+type redisHash struct {
+	lp 			listpack
+	dict 		map[string]int // the hashtable encoding when not nil, the position of every field in entries
+	entries 	[]HashField // the fields of dict in no particular order, removing one moves the last one into its place
+	index 		*scanIndex // the fields of dict ordered for HSCAN, see scanindex.go
+	expires 	map[string]time.Time // when the fields with a TTL expire, nil until the first field gets one
+	nextExpiry 	time.Time // no field expires before this, so most lookups do not have to look at expires at all
+	cfg 		*Config // the encoding limits, a nil config means always a hashtable
+}
+
+func newRedisHash(cfg *Config) *redisHash {
+	h := &redisHash{cfg: cfg}
+	if cfg == nil {
+		h.dict, h.index = make(map[string]int), newScanIndex()
+	}
+	return h
+}
+
+func(h *redisHash) encoding() string {
+	switch {
+	case h.dict != nil:
+		return "hashtable"
+	case h.expires != nil:
+		// Redis calls a listpack that also holds TTLs a listpackex
+		return "listpackex"
+	}
+	return "listpack"
+}
+
+func(h *redisHash) len() int {
+	if h.dict != nil {
+		return len(h.dict)
+	}
+	return h.lp.len() / 2
+}
+
+func(h *redisHash) get(field string) (string, bool) {
+	if h.dict != nil {
+		pos, exists := h.dict[field]
+		if !exists {
+			return "", false
+		}
+		return h.entries[pos].Value, true
+	}
+
+	pos := h.lp.find(field, 2)
+	if pos < 0 {
+		return "", false
+	}
+	_, next := h.lp.entry(pos)
+	value, _ := h.lp.entry(next)
+	return string(value), true
+}
+
+// set stores value under field, true if the field is new
+func(h *redisHash) set(field string, value string) bool {
+	if h.dict != nil {
+		if pos, exists := h.dict[field]; exists {
+			h.entries[pos].Value = value
+			return false
+		}
+		h.dict[field] = len(h.entries)
+		h.entries = append(h.entries, HashField{Field: field, Value: value})
+		h.index.insert(field)
+		return true
+	}
+
+	pos := h.lp.find(field, 2)
+	size := h.len()
+	if pos < 0 {
+		size++
+	}
+	if size > h.cfg.HashMaxListpackEntries || len(field) > h.cfg.HashMaxListpackValue || len(value) > h.cfg.HashMaxListpackValue {
+		h.convertToHashtable()
+		return h.set(field, value)
+	}
+
+	if pos < 0 {
+		h.lp.append(field, value)
+		return true
+	}
+	_, next := h.lp.entry(pos)
+	h.lp.replace(next, value)
+	return false
+}
+
+// remove deletes field together with its TTL, false if the hash did not have it
+func(h *redisHash) remove(field string) bool {
+	delete(h.expires, field)
+
+	if h.dict != nil {
+		pos, exists := h.dict[field]
+		if !exists {
+			return false
+		}
+		last := len(h.entries) - 1
+		h.entries[pos] = h.entries[last]
+		h.dict[h.entries[pos].Field] = pos
+		h.entries[last] = HashField{}
+		h.entries = h.entries[:last]
+		delete(h.dict, field)
+		h.index.remove(field)
+		return true
+	}
+
+	pos := h.lp.find(field, 2)
+	if pos < 0 {
+		return false
+	}
+	h.lp.remove(pos, 2)
+	return true
+}
+
+// forEach calls fn for every field and its value until fn returns false, the hash must not change meanwhile
+func(h *redisHash) forEach(fn func(field string, value string) bool) {
+	if h.dict != nil {
+		for _, f := range h.entries {
+			if !fn(f.Field, f.Value) {
+				return
+			}
+		}
+		return
+	}
+
+	var field []byte
+	i := 0
+	h.lp.forEach(func(_ int, entry []byte) bool {
+		i++
+		if i%2 == 1 {
+			field = entry
+			return true
+		}
+		return fn(string(field), string(entry))
+	})
+}
+
+func(h *redisHash) fields() []HashField {
+	fields := make([]HashField, 0, h.len())
+	h.forEach(func(field string, value string) bool {
+		fields = append(fields, HashField{Field: field, Value: value})
+		return true
+	})
+	return fields
+}
+
+// sample picks random fields the way HRANDFIELD does with its count (see samplePositions)
+func(h *redisHash) sample(count int64) []HashField {
+	fields := h.entries
+	if h.dict == nil {
+		// a listpack is small, copying its fields out is cheap
+		fields = h.fields()
+	}
+
+	positions := samplePositions(len(fields), count)
+	result := make([]HashField, len(positions))
+	for i, pos := range positions {
+		result[i] = fields[pos]
+	}
+	return result
+}
+
+func(h *redisHash) convertToHashtable() {
+	entries := h.fields()
+	dict := make(map[string]int, len(entries)+1)
+	for i, f := range entries {
+		dict[f.Field] = i
+	}
+	h.lp, h.dict, h.entries, h.index = listpack{}, dict, entries, newScanIndexOf(dict)
+}
+
+// hashFor returns the hash stored under key, nil if there is none; the caller must hold r.mu
+func(r *RedisCache) hashFor(key string) (*redisHash, error) {
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+
+	hash, isHash := entry.Value.(*redisHash)
+	if !isHash {
+		return nil, ErrWrongType
+	}
+	return hash, nil
+}
+
+// hashForWrite returns the hash stored under key, creating an empty one if there is none; the caller must hold r.mu
+func(r *RedisCache) hashForWrite(key string) (*redisHash, error) {
+	hash, err := r.hashFor(key)
+	if err != nil || hash != nil {
+		return hash, err
+	}
+
+	hash = newRedisHash(&r.Config)
+	r.setEntry(key, &Entry{Type: "hash", Value: hash})
+	return hash, nil
+}
+
+func(r *RedisCache) HSET(key string, fields []HashField) (int, error) {
+	// command syntax: HSET key field value [field value ...] (HMSET is the same, it only replies differently)
+	// returns the number of new fields, existing ones are only updated; a field given twice gets the last value
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		// creating a hash table and inserting field-value pairs into the hashtable
-		hashTable := make(map[string]string)
-		for field, value := range fieldValues {
-			hashTable[field] = value
+	hash, err := r.hashForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, f := range fields {
+		if hash.set(f.Field, f.Value) {
+			added++
 		}
-		r.store[key] = &Entry{Type: "hash", Value: hashTable}
-		return len(hashTable), true
+		// a field that is overwritten loses its TTL, just like SET does to a key
+		hash.persist(f.Field)
+	}
+	return added, nil
+}
+
+func(r *RedisCache) HSETNX(key string, field string, value string) (bool, error) {
+	// command syntax: HSETNX key field value --> false if the field exists already, it is left alone then
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashForWrite(key)
+	if err != nil {
+		return false, err
 	}
 
-	hashTable, ok := entry.Value.(map[string]string)
-	if !ok {
-		return -1, false // WRONGTYPE error in real Redis
+	if _, exists := hash.get(field); exists {
+		return false, nil
 	}
+	hash.set(field, value)
+	return true, nil
+}
 
-	// updating existing hashtable and counting new fields
-	newCount := 0
-	for field, value := range fieldValues {
-		if _, exists := hashTable[field]; !exists {
-			newCount++
-		}
+func(r *RedisCache) HGET(key string, field string) (string, bool, error) {
+	// command syntax: HGET key field --> ok is false if the key or the field does not exist
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		hashTable[field] = value
+	hash, err := r.hashFor(key)
+	if hash == nil {
+		return "", false, err
 	}
 
-	return newCount, true
+	value, exists := hash.get(field)
+	return value, exists, nil
 }
 
-func(r *RedisCache) HGET(key string, field string) (string, bool) {
-	// command syntax: HGET key field
+func(r *RedisCache) HMGET(key string, fields []string) ([]string, []bool, error) {
+	// command syntax: HMGET key field [field ...]
+	// one value per field, found tells the missing ones apart (a missing key has no fields at all)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return "", false
+	hash, err := r.hashFor(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	if hash == nil {
+		return values, found, nil
 	}
 
-	hash := entry.Value.(map[string]string)
-	return hash[field], true
+	for i, field := range fields {
+		values[i], found[i] = hash.get(field)
+	}
+	return values, found, nil
 }
 
-func(r *RedisCache) HGETALL(key string) (map[string]string, bool) {
+func(r *RedisCache) HGETALL(key string) ([]HashField, error) {
 	// command syntax: HGETALL key
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return nil, false
+	hash, err := r.hashFor(key)
+	if hash == nil {
+		return []HashField{}, err
 	}
+	return hash.fields(), nil
+}
 
-	hash, ok := entry.Value.(map[string]string)
-	if !ok {
-		return nil, false
+func(r *RedisCache) HKEYS(key string) ([]string, error) {
+	// command syntax: HKEYS key
+	return r.hashColumn(key, func(f HashField) string { return f.Field })
+}
+
+func(r *RedisCache) HVALS(key string) ([]string, error) {
+	// command syntax: HVALS key
+	return r.hashColumn(key, func(f HashField) string { return f.Value })
+}
+
+// hashColumn returns either the fields or the values of a hash, in the same order HGETALL has them
+func(r *RedisCache) hashColumn(key string, column func(HashField) string) ([]string, error) {
+	fields, err := r.HGETALL(key)
+	if err != nil {
+		return nil, err
 	}
 
-	return hash, true
+	result := make([]string, len(fields))
+	for i, f := range fields {
+		result[i] = column(f)
+	}
+	return result, nil
 }
 
-func(r *RedisCache) HDEL(key string, fields []string) (int, bool) {
+func(r *RedisCache) HEXISTS(key string, field string) (bool, error) {
+	// command syntax: HEXISTS key field
+	_, exists, err := r.HGET(key, field)
+	return exists, err
+}
+
+func(r *RedisCache) HSTRLEN(key string, field string) (int, error) {
+	// command syntax: HSTRLEN key field --> the length of the value in bytes, 0 for a missing field
+	value, _, err := r.HGET(key, field)
+	return len(value), err
+}
+
+func(r *RedisCache) HDEL(key string, fields []string) (int, error) {
+	// command syntax: HDEL key field [field ...]
+	// returns the number of fields deleted, the key goes away with the last field
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return -1, false
+	hash, err := r.hashFor(key)
+	if hash == nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, field := range fields {
+		// if a field does not exist, then it is simply ignored
+		if hash.remove(field) {
+			deleted++
+		}
+	}
+
+	if hash.len() == 0 {
+		r.deleteEntry(key)
 	}
+	return deleted, nil
+}
 
-	// getting the hashtable
-	hashTable := entry.Value.(map[string]string)
+func(r *RedisCache) HLEN(key string) (int, error) {
+	// command syntax: HLEN key --> the number of fields, 0 for a missing key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if hash == nil {
+		return 0, err
+	}
+	return hash.len(), nil
+}
+
+func(r *RedisCache) HINCRBY(key string, field string, increment int64) (int64, error) {
+	// command syntax: HINCRBY key field increment
+	// a missing field counts as 0, a value that is not an integer cannot be incremented; the TTL of the field is kept
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	// getting the length of the hashtable
-	// then checking if there are no elements inside hashtable, then the whole hashtable shall be deleted
-	length := len(hashTable)
-	if length == 0 {}
+	hash, err := r.hashForWrite(key)
+	if err != nil {
+		return 0, err
+	}
 
-	deleteCount := 0
-	for _, v := range fields {
-		// if a key does not exist, then it is simply ignored
-		if _, exists := hashTable[v]; !exists {
-			continue
+	var current int64
+	if value, exists := hash.get(field); exists {
+		n, ok := parseInteger([]byte(value))
+		if !ok {
+			return 0, ErrHashNotInteger
 		}
+		current = n
+	}
 
-		delete(hashTable, v)
-		deleteCount++
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, ErrOverflow
 	}
 
-	return deleteCount, true
+	hash.set(field, strconv.FormatInt(current+increment, 10))
+	return current + increment, nil
 }
 
-func(r *RedisCache) HLEN(key string) (int, bool) {
+func(r *RedisCache) HINCRBYFLOAT(key string, field string, increment float64) (string, error) {
+	// command syntax: HINCRBYFLOAT key field increment
+	// the result is stored (and returned) as a plain decimal string, just like INCRBYFLOAT does it
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return 0, false
+	hash, err := r.hashForWrite(key)
+	if err != nil {
+		return "", err
 	}
 
-	hashTable := entry.Value.(map[string]string)
+	current := 0.0
+	if value, exists := hash.get(field); exists {
+		n, ok := parseFloat([]byte(value))
+		if !ok {
+			return "", ErrHashNotFloat
+		}
+		current = n
+	}
+
+	result := current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return "", ErrNaNOrInfinity
+	}
 
-	return len(hashTable), true
-}
\ No newline at end of file
+	formatted := strconv.FormatFloat(result, 'f', -1, 64)
+	hash.set(field, formatted)
+	return formatted, nil
+}
+
+func(r *RedisCache) HRANDFIELD(key string, count int64) ([]HashField, error) {
+	// command syntax: HRANDFIELD key [count [WITHVALUES]]
+	// a positive count returns distinct fields (at most all of them), a negative count returns exactly -count
+	// fields that may repeat
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if hash == nil {
+		return []HashField{}, err
+	}
+	return hash.sample(count), nil
+}
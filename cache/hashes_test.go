@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"redis-clone/resp"
+)
+
+func TestHRandField(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"HSET", "h", "f1", "v1", "f2", "v2", "f3", "v3"}, ":3\r\n"},
+		{[]string{"HRANDFIELD", "missing"}, "$-1\r\n"},
+		{[]string{"HRANDFIELD", "missing", "2"}, "*0\r\n"},
+		{[]string{"HRANDFIELD", "h", "0"}, "*0\r\n"},
+		{[]string{"HRANDFIELD", "h", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"HRANDFIELD", "h", "1", "VALUES"}, "-ERR syntax error\r\n"},
+		{[]string{"HRANDFIELD", "h", "-9223372036854775808", "WITHVALUES"}, "-ERR value is out of range\r\n"},
+		{[]string{"HRANDFIELD", "h", "-9223372036854775808"}, "-ERR value is out of range\r\n"},
+		{[]string{"HRANDFIELD", "h", "-9223372036854775807"}, "-ERR value is out of range\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"HRANDFIELD", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+
+	if got := sortedMembers(t, cache, "HRANDFIELD", "h", "5"); got != "f1,f2,f3" {
+		t.Errorf("Expected every field, but got %q", got);
+	};
+
+	// RESP2 WITHVALUES is a flat list, every field followed by its value
+	reply := cache.ExecuteCommands(NewClient(nil), command("HRANDFIELD", "h", "-6", "WITHVALUES"));
+	if len(reply.Elems) != 12 {
+		t.Fatalf("Expected 12 elements, but got %d", len(reply.Elems));
+	};
+	for i := 0; i < len(reply.Elems); i += 2 {
+		if "v"+reply.Elems[i].Str[1:] != reply.Elems[i+1].Str {
+			t.Errorf("Field %q came with value %q", reply.Elems[i].Str, reply.Elems[i+1].Str);
+		};
+	};
+
+	// RESP3 WITHVALUES is a list of [field, value] pairs
+	client := NewClient(nil);
+	cache.ExecuteCommands(client, command("HELLO", "3"));
+	reply = cache.ExecuteCommands(client, command("HRANDFIELD", "h", "2", "WITHVALUES"));
+	if len(reply.Elems) != 2 {
+		t.Fatalf("Expected 2 pairs, but got %d", len(reply.Elems));
+	};
+	for _, pair := range reply.Elems {
+		if pair.Kind != resp.KindArray || len(pair.Elems) != 2 || "v"+pair.Elems[0].Str[1:] != pair.Elems[1].Str {
+			t.Errorf("Expected a [field, value] pair, but got %v", pair);
+		};
+	};
+}
+
+func TestHashEncodings(t *testing.T) {
+	cache := NewRedisServer();
+	cache.Config.HashMaxListpackEntries = 2;
+	cache.Config.HashMaxListpackValue = 5;
+
+	runSteps(t, cache, []step{
+		{[]string{"HSET", "h", "a", "1"}, ":1\r\n"},
+		{[]string{"HSET", "h", "b", "2"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "h"}, "$8\r\nlistpack\r\n"},
+		{[]string{"HSET", "h", "a", "one"}, ":0\r\n"},
+		{[]string{"HGET", "h", "a"}, "$3\r\none\r\n"},
+		{[]string{"HDEL", "h", "a"}, ":1\r\n"},
+		{[]string{"HLEN", "h"}, ":1\r\n"},
+		{[]string{"HGETALL", "h"}, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"HSET", "h", "c", "3"}, ":1\r\n"},
+		{[]string{"HSET", "h", "d", "4"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "h"}, "$9\r\nhashtable\r\n"},
+		{[]string{"HGET", "h", "c"}, "$1\r\n3\r\n"},
+		{[]string{"HLEN", "h"}, ":3\r\n"},
+
+		// a long value turns the hash into a hashtable too, even when it replaces a short one
+		{[]string{"HSET", "v", "a", "1"}, ":1\r\n"},
+		{[]string{"HSET", "v", "a", "toolong"}, ":0\r\n"},
+		{[]string{"OBJECT", "ENCODING", "v"}, "$9\r\nhashtable\r\n"},
+		{[]string{"HGET", "v", "a"}, "$7\r\ntoolong\r\n"},
+	});
+}
+
+func TestHashCommands(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"HSET", "h", "a", "1", "b", "2", "a", "3"}, ":2\r\n"},
+		{[]string{"HGET", "h", "a"}, "$1\r\n3\r\n"},
+		{[]string{"HMSET", "h", "c", "hello"}, "+OK\r\n"},
+		{[]string{"HSETNX", "h", "c", "other"}, ":0\r\n"},
+		{[]string{"HSETNX", "h", "d", "4"}, ":1\r\n"},
+		{[]string{"HSETNX", "new", "f", "v"}, ":1\r\n"},
+		{[]string{"HMGET", "h", "a", "missing", "c"}, "*3\r\n$1\r\n3\r\n$-1\r\n$5\r\nhello\r\n"},
+		{[]string{"HMGET", "missing", "a"}, "*1\r\n$-1\r\n"},
+		{[]string{"HKEYS", "h"}, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"HVALS", "h"}, "*4\r\n$1\r\n3\r\n$1\r\n2\r\n$5\r\nhello\r\n$1\r\n4\r\n"},
+		{[]string{"HKEYS", "missing"}, "*0\r\n"},
+		{[]string{"HEXISTS", "h", "c"}, ":1\r\n"},
+		{[]string{"HEXISTS", "h", "x"}, ":0\r\n"},
+		{[]string{"HEXISTS", "missing", "x"}, ":0\r\n"},
+		{[]string{"HSTRLEN", "h", "c"}, ":5\r\n"},
+		{[]string{"HSTRLEN", "h", "x"}, ":0\r\n"},
+		{[]string{"HLEN", "missing"}, ":0\r\n"},
+		{[]string{"HGETALL", "missing"}, "*0\r\n"},
+		{[]string{"HSET", "h", "a"}, "-ERR wrong number of arguments for 'hset' command\r\n"},
+		{[]string{"HSET", "h", "a", "1", "b"}, "-ERR wrong number of arguments for 'hset' command\r\n"},
+
+		// the key goes away with its last field
+		{[]string{"HDEL", "h", "a", "b", "c", "x"}, ":3\r\n"},
+		{[]string{"HDEL", "h", "d"}, ":1\r\n"},
+		{[]string{"HLEN", "h"}, ":0\r\n"},
+		{[]string{"OBJECT", "ENCODING", "h"}, "$-1\r\n"},
+		{[]string{"HDEL", "missing", "a"}, ":0\r\n"},
+	});
+}
+
+func TestHIncrBy(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"HINCRBY", "h", "n", "5"}, ":5\r\n"},
+		{[]string{"HINCRBY", "h", "n", "-7"}, ":-2\r\n"},
+		{[]string{"HGET", "h", "n"}, "$2\r\n-2\r\n"},
+		{[]string{"HINCRBY", "h", "n", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"HSET", "h", "s", "abc", "big", "9223372036854775807", "f", "1.5", "z", "010"}, ":4\r\n"},
+		{[]string{"HINCRBY", "h", "s", "1"}, "-ERR hash value is not an integer\r\n"},
+		{[]string{"HINCRBY", "h", "z", "1"}, "-ERR hash value is not an integer\r\n"},
+		{[]string{"HINCRBY", "h", "big", "1"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "f", "0.1"}, "$3\r\n1.6\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "n", "2.5e2"}, "$3\r\n248\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "new", "-1.25"}, "$5\r\n-1.25\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "s", "1"}, "-ERR hash value is not a float\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "f", "x"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"HINCRBYFLOAT", "h", "f", "inf"}, "-ERR increment would produce NaN or Infinity\r\n"},
+		{[]string{"HGET", "h", "f"}, "$3\r\n1.6\r\n"},
+	});
+}
+
+// every hash command fails with WRONGTYPE on a key of another type instead of touching it
+func TestHashWrongType(t *testing.T) {
+	cache := NewRedisServer();
+	cache.ExecuteCommands(NewClient(nil), command("SET", "str", "v"));
+
+	for _, args := range [][]string{
+		{"HSET", "str", "f", "v"},
+		{"HMSET", "str", "f", "v"},
+		{"HSETNX", "str", "f", "v"},
+		{"HGET", "str", "f"},
+		{"HMGET", "str", "f"},
+		{"HGETALL", "str"},
+		{"HKEYS", "str"},
+		{"HVALS", "str"},
+		{"HEXISTS", "str", "f"},
+		{"HSTRLEN", "str", "f"},
+		{"HLEN", "str"},
+		{"HDEL", "str", "f"},
+		{"HINCRBY", "str", "f", "1"},
+		{"HINCRBYFLOAT", "str", "f", "1"},
+		{"HRANDFIELD", "str"},
+		{"HEXPIRE", "str", "10", "FIELDS", "1", "f"},
+		{"HTTL", "str", "FIELDS", "1", "f"},
+		{"HPERSIST", "str", "FIELDS", "1", "f"},
+		{"HGETEX", "str", "FIELDS", "1", "f"},
+		{"HSETEX", "str", "FIELDS", "1", "f", "v"},
+	} {
+		reply := cache.ExecuteCommands(NewClient(nil), command(args...));
+		if reply.Kind != resp.KindError || reply.Str != ErrWrongType.Error() {
+			t.Errorf("%q: expected WRONGTYPE, but got %#v", args, reply);
+		};
+	};
+
+	if value, _, _ := cache.GET("str"); string(value) != "v" {
+		t.Errorf("Expected the string to be left alone, but got %q", value);
+	};
+}
+
+func TestHashFieldExpire(t *testing.T) {
+	cache := NewRedisServer();
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10);
+
+	runSteps(t, cache, []step{
+		{[]string{"HSET", "h", "a", "1", "b", "2", "c", "3"}, ":3\r\n"},
+		{[]string{"HEXPIRE", "missing", "10", "FIELDS", "2", "a", "b"}, "*2\r\n:-2\r\n:-2\r\n"},
+		{[]string{"HEXPIRE", "h", "100", "FIELDS", "2", "a", "nope"}, "*2\r\n:1\r\n:-2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "h"}, "$10\r\nlistpackex\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "3", "a", "b", "nope"}, "*3\r\n:100\r\n:-1\r\n:-2\r\n"},
+
+		// NX needs no TTL, XX a TTL, GT a later and LT an earlier time; no TTL counts as never expiring
+		{[]string{"HEXPIRE", "h", "50", "NX", "FIELDS", "2", "a", "b"}, "*2\r\n:0\r\n:1\r\n"},
+		{[]string{"HEXPIRE", "h", "200", "XX", "FIELDS", "2", "a", "c"}, "*2\r\n:1\r\n:0\r\n"},
+		{[]string{"HEXPIRE", "h", "100", "GT", "FIELDS", "2", "a", "c"}, "*2\r\n:0\r\n:0\r\n"},
+		{[]string{"HEXPIRE", "h", "100", "LT", "FIELDS", "2", "a", "c"}, "*2\r\n:1\r\n:1\r\n"},
+		{[]string{"HPEXPIRE", "h", "100000", "FIELDS", "1", "a"}, "*1\r\n:1\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "1", "a"}, "*1\r\n:100\r\n"},
+		{[]string{"HEXPIREAT", "h", future, "FIELDS", "1", "a"}, "*1\r\n:1\r\n"},
+		{[]string{"HEXPIRETIME", "h", "FIELDS", "1", "a"}, fmt.Sprintf("*1\r\n:%s\r\n", future)},
+		{[]string{"HPEXPIRETIME", "h", "FIELDS", "1", "a"}, fmt.Sprintf("*1\r\n:%s000\r\n", future)},
+
+		// HPERSIST, and HSET clears the TTL of a field it overwrites while HINCRBY keeps it
+		{[]string{"HPERSIST", "h", "FIELDS", "3", "a", "a", "nope"}, "*3\r\n:1\r\n:-1\r\n:-2\r\n"},
+		{[]string{"HSET", "h", "b", "20"}, ":0\r\n"},
+		{[]string{"HINCRBY", "h", "c", "1"}, ":4\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "2", "b", "c"}, "*2\r\n:-1\r\n:100\r\n"},
+
+		// a time that is not in the future deletes the field, and the key with its last field
+		{[]string{"HEXPIRE", "h", "0", "FIELDS", "2", "a", "b"}, "*2\r\n:2\r\n:2\r\n"},
+		{[]string{"HPEXPIREAT", "h", "1", "FIELDS", "1", "c"}, "*1\r\n:2\r\n"},
+		{[]string{"HLEN", "h"}, ":0\r\n"},
+		{[]string{"OBJECT", "ENCODING", "h"}, "$-1\r\n"},
+
+		// argument errors
+		{[]string{"HSET", "h", "a", "1"}, ":1\r\n"},
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "1"}, "-ERR wrong number of arguments for 'hexpire' command\r\n"},
+		{[]string{"HEXPIRE", "h", "10", "XX", "1", "a"}, "-ERR Mandatory argument FIELDS is missing or not at the right position\r\n"},
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "0", "a"}, "-ERR Parameter `numFields` should be greater than 0\r\n"},
+		{[]string{"HEXPIRE", "h", "10", "FIELDS", "2", "a"}, "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+		{[]string{"HEXPIRE", "h", "-1", "FIELDS", "1", "a"}, "-ERR invalid expire time, must be >= 0\r\n"},
+		{[]string{"HEXPIRE", "h", "x", "FIELDS", "1", "a"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"HPEXPIREAT", "h", "281474976710656", "FIELDS", "1", "a"}, "-ERR invalid expire time in 'hpexpireat' command\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "1", "a", "b"}, "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+	});
+}
+
+func TestHGetExAndHSetEx(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"HSETEX", "h", "EX", "100", "FIELDS", "2", "a", "1", "b", "2"}, ":1\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "2", "a", "b"}, "*2\r\n:100\r\n:100\r\n"},
+		{[]string{"HSETEX", "h", "FNX", "FIELDS", "2", "a", "x", "c", "3"}, ":0\r\n"},
+		{[]string{"HSETEX", "h", "FXX", "KEEPTTL", "FIELDS", "1", "a", "10"}, ":1\r\n"},
+		{[]string{"HSETEX", "h", "FXX", "FIELDS", "1", "b", "20"}, ":1\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "2", "a", "b"}, "*2\r\n:100\r\n:-1\r\n"},
+		{[]string{"HSETEX", "missing", "FXX", "FIELDS", "1", "a", "1"}, ":0\r\n"},
+		{[]string{"OBJECT", "ENCODING", "missing"}, "$-1\r\n"},
+
+		{[]string{"HGETEX", "h", "PX", "50000", "FIELDS", "3", "a", "b", "nope"}, "*3\r\n$2\r\n10\r\n$2\r\n20\r\n$-1\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "2", "a", "b"}, "*2\r\n:50\r\n:50\r\n"},
+		{[]string{"HGETEX", "h", "PERSIST", "FIELDS", "1", "a"}, "*1\r\n$2\r\n10\r\n"},
+		{[]string{"HGETEX", "h", "FIELDS", "1", "b"}, "*1\r\n$2\r\n20\r\n"},
+		{[]string{"HTTL", "h", "FIELDS", "2", "a", "b"}, "*2\r\n:-1\r\n:50\r\n"},
+		{[]string{"HGETEX", "missing", "EX", "10", "FIELDS", "1", "a"}, "*1\r\n$-1\r\n"},
+
+		// a time in the past still returns the values, then deletes the fields
+		{[]string{"HGETEX", "h", "PXAT", "1", "FIELDS", "2", "a", "b"}, "*2\r\n$2\r\n10\r\n$2\r\n20\r\n"},
+		{[]string{"OBJECT", "ENCODING", "h"}, "$-1\r\n"},
+
+		{[]string{"HGETEX", "h", "EX", "0", "FIELDS", "1", "a"}, "-ERR invalid expire time in 'hgetex' command\r\n"},
+		{[]string{"HGETEX", "h", "EX", "10", "PERSIST", "FIELDS", "1", "a"}, "-ERR syntax error\r\n"},
+		{[]string{"HGETEX", "h", "a", "b", "c"}, "-ERR syntax error\r\n"},
+		{[]string{"HSETEX", "h", "FNX", "FXX", "FIELDS", "1", "a", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"HSETEX", "h", "EX", "10", "FIELDS", "1", "a"}, "-ERR The `numfields` parameter must match the number of arguments\r\n"},
+	});
+}
+
+// testing that expired fields are gone for every command right away, and that the cleaner removes them from hashes
+// nobody reads
+func TestHashFieldsExpire(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+	cache.ExecuteCommands(client, command("HSET", "read", "a", "1", "b", "2"));
+	cache.ExecuteCommands(client, command("HSET", "unread", "a", "1"));
+	cache.ExecuteCommands(client, command("HSET", "big", "a", "1", "b", "2"));
+	cache.ExecuteCommands(client, command("HPEXPIRE", "read", "10", "FIELDS", "1", "a"));
+	cache.ExecuteCommands(client, command("HPEXPIRE", "unread", "10", "FIELDS", "1", "a"));
+
+	// the same in a hashtable
+	cache.Config.HashMaxListpackEntries = 0;
+	cache.ExecuteCommands(client, command("HSET", "big", "c", "3"));
+	cache.ExecuteCommands(client, command("HPEXPIRE", "big", "10", "FIELDS", "2", "a", "c"));
+
+	cache.StartExpiryCleaner(5 * time.Millisecond);
+	time.Sleep(50 * time.Millisecond);
+
+	runSteps(t, cache, []step{
+		{[]string{"HGETALL", "read"}, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"HGETALL", "big"}, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "big"}, "$9\r\nhashtable\r\n"},
+	});
+
+	cache.mu.Lock();
+	_, exists := cache.store["unread"];
+	cache.mu.Unlock();
+	if exists {
+		t.Errorf("Expected the cleaner to delete the hash whose only field expired");
+	};
+}
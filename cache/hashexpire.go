@@ -0,0 +1,459 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+// commands needed to be implemented:
+// HEXPIRE, HPEXPIRE, HEXPIREAT, HPEXPIREAT key time [NX | XX | GT | LT] FIELDS numfields field [field ...]	--> Done
+// HTTL, HPTTL, HEXPIRETIME, HPEXPIRETIME key FIELDS numfields field [field ...]							--> Done
+// HPERSIST key FIELDS numfields field [field ...]														--> Done
+// HGETEX key [EX | PX | EXAT | PXAT | PERSIST] FIELDS numfields field [field ...]						--> Done
+// HSETEX key [FNX | FXX] [EX | PX | EXAT | PXAT | KEEPTTL] FIELDS numfields field value [field value ...]	--> Done
+
+// every field of a hash can have a TTL of its own, it lives in redisHash.expires as an absolute time
+// an expired field is dropped the same way an expired key is: lookup removes it before anything can read it, and
+// StartExpiryCleaner sweeps the hashes nobody looks at; a hash that loses its last field is deleted as a whole
+
+// maxFieldExpiry is the latest a field can expire, in milliseconds since the epoch (Redis keeps it in 48 bits)
+const maxFieldExpiry = 1<<48 - 1
+
+// ttl returns when field expires, ok is false if it has no TTL
+func(h *redisHash) ttl(field string) (time.Time, bool) {
+	at, ok := h.expires[field]
+	return at, ok
+}
+
+// setTTL makes field expire at the given time, the field must exist
+func(h *redisHash) setTTL(field string, at time.Time) {
+	if h.expires == nil {
+		h.expires = make(map[string]time.Time)
+	}
+	h.expires[field] = at
+
+	if h.nextExpiry.IsZero() || at.Before(h.nextExpiry) {
+		h.nextExpiry = at
+	}
+}
+
+// persist removes the TTL of field, false if it had none
+func(h *redisHash) persist(field string) bool {
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+	delete(h.expires, field)
+	return true
+}
+
+// expireFields drops every field whose TTL has passed
+// nextExpiry may be too early (the field that set it got persisted or deleted), which only costs an extra pass
+func(h *redisHash) expireFields(now time.Time) {
+	if len(h.expires) == 0 || !now.After(h.nextExpiry) {
+		return
+	}
+
+	next := time.Time{}
+	for field, at := range h.expires {
+		if now.After(at) {
+			h.remove(field)
+			continue
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	h.nextExpiry = next
+}
+
+// expireHashFields drops the expired fields of the hash under key, and the key itself once no field is left
+// returns false if the key is gone; the caller must hold r.mu
+func(r *RedisCache) expireHashFields(key string, hash *redisHash, now time.Time) bool {
+	hash.expireFields(now)
+	if hash.len() == 0 {
+		r.deleteEntry(key)
+		return false
+	}
+	return true
+}
+
+// parseFieldsArgument reads the "FIELDS numfields ..." that ends every command in this file and returns what follows
+// numfields, width is the number of arguments a field takes (2 for the field value pairs of HSETEX)
+func parseFieldsArgument(args [][]byte, width int) ([][]byte, error) {
+	if len(args) < 2 || !strings.EqualFold(string(args[0]), "FIELDS") {
+		return nil, ErrFieldsMissing
+	}
+
+	numFields, ok := parseInteger(args[1])
+	if !ok || numFields <= 0 {
+		return nil, ErrNumFieldsNotPositive
+	}
+
+	rest := args[2:]
+	if numFields > int64(len(rest)) || numFields*int64(width) != int64(len(rest)) {
+		return nil, ErrNumFieldsMismatch
+	}
+	return rest, nil
+}
+
+// parseFieldExpiry turns the time of HEXPIRE (seconds from now), HPEXPIRE (milliseconds from now), HEXPIREAT (unix
+// seconds) or HPEXPIREAT (unix milliseconds) into an absolute time
+// unlike EXPIRE a time of 0 is fine, it deletes the fields right away
+func parseFieldExpiry(command string, value []byte) (time.Time, error) {
+	n, ok := parseInteger(value)
+	if !ok {
+		return time.Time{}, ErrNotInteger
+	}
+	if n < 0 {
+		return time.Time{}, ErrNegativeExpireTime
+	}
+
+	lower := strings.ToLower(command)
+	if command == "HEXPIRE" || command == "HEXPIREAT" {
+		if n > maxFieldExpiry/1000 {
+			return time.Time{}, errInvalidExpireTime(lower)
+		}
+		n *= 1000
+	}
+
+	if command == "HEXPIRE" || command == "HPEXPIRE" {
+		n += time.Now().UnixMilli()
+	}
+
+	if n > maxFieldExpiry {
+		return time.Time{}, errInvalidExpireTime(lower)
+	}
+	return time.UnixMilli(n), nil
+}
+
+func(r *RedisCache) HEXPIRE(key string, at time.Time, condition string, fields []string) ([]int64, error) {
+	// command syntax: HEXPIRE key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+	// HPEXPIRE, HEXPIREAT and HPEXPIREAT only differ in how the time is given, they all end up here
+	// one reply per field:
+	// -2 --> no such field (or no such key)
+	// 0 --> the condition was not met: NX needs a field without a TTL, XX one with a TTL, GT a later time than the
+	// current one and LT an earlier one (a field without a TTL counts as never expiring)
+	// 1 --> the TTL was set
+	// 2 --> the time is not in the future, so the field was deleted
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		if hash == nil {
+			results[i] = -2
+			continue
+		}
+		if _, exists := hash.get(field); !exists {
+			results[i] = -2
+			continue
+		}
+
+		current, hasTTL := hash.ttl(field)
+		met := true
+		switch condition {
+		case "NX":
+			met = !hasTTL
+		case "XX":
+			met = hasTTL
+		case "GT":
+			met = hasTTL && at.After(current)
+		case "LT":
+			met = !hasTTL || at.Before(current)
+		}
+		if !met {
+			results[i] = 0
+			continue
+		}
+
+		if !at.After(now) {
+			hash.remove(field)
+			results[i] = 2
+			continue
+		}
+
+		hash.setTTL(field, at)
+		results[i] = 1
+	}
+
+	if hash != nil && hash.len() == 0 {
+		r.deleteEntry(key)
+	}
+	return results, nil
+}
+
+func(r *RedisCache) HEXPIRETIME(key string, fields []string) ([]int64, error) {
+	// command syntax: HPEXPIRETIME key FIELDS numfields field [field ...]
+	// the unix time in milliseconds every field expires at, -1 for a field without a TTL and -2 for a missing one
+	// HEXPIRETIME, HTTL and HPTTL are worked out from these
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		if hash == nil {
+			results[i] = -2
+			continue
+		}
+		if _, exists := hash.get(field); !exists {
+			results[i] = -2
+			continue
+		}
+
+		at, hasTTL := hash.ttl(field)
+		if !hasTTL {
+			results[i] = -1
+			continue
+		}
+		results[i] = at.UnixMilli()
+	}
+	return results, nil
+}
+
+func(r *RedisCache) HTTL(key string, fields []string) ([]int64, error) {
+	// command syntax: HPTTL key FIELDS numfields field [field ...]
+	// the milliseconds every field has left, with the same -1 and -2 as HEXPIRETIME; HTTL rounds these to seconds
+	times, err := r.HEXPIRETIME(key, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	for i, at := range times {
+		if at >= 0 {
+			times[i] = max(at-now, 0)
+		}
+	}
+	return times, nil
+}
+
+func(r *RedisCache) HPERSIST(key string, fields []string) ([]int64, error) {
+	// command syntax: HPERSIST key FIELDS numfields field [field ...]
+	// one reply per field: 1 --> the TTL was removed, -1 --> the field had no TTL, -2 --> no such field
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]int64, len(fields))
+	for i, field := range fields {
+		if hash == nil {
+			results[i] = -2
+			continue
+		}
+		if _, exists := hash.get(field); !exists {
+			results[i] = -2
+			continue
+		}
+
+		if hash.persist(field) {
+			results[i] = 1
+		} else {
+			results[i] = -1
+		}
+	}
+	return results, nil
+}
+
+// parseHGetExOptions reads the option between "HGETEX key" and FIELDS (the ones GETEX has), and returns the FIELDS part
+func parseHGetExOptions(args [][]byte) (GetExOptions, [][]byte, error) {
+	var opts GetExOptions
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		hasOption := opts.Persist || !opts.ExpiryTime.IsZero()
+
+		switch option {
+		case "FIELDS":
+			return opts, args[i:], nil
+
+		case "PERSIST":
+			if hasOption {
+				return opts, nil, ErrSyntax
+			}
+			opts.Persist = true
+
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasOption || i+1 == len(args) {
+				return opts, nil, ErrSyntax
+			}
+
+			expiryTime, err := parseExpiry(option, args[i+1], "hgetex")
+			if err != nil {
+				return opts, nil, err
+			}
+			if expiryTime.UnixMilli() > maxFieldExpiry {
+				return opts, nil, errInvalidExpireTime("hgetex")
+			}
+			opts.ExpiryTime = expiryTime
+			i++
+
+		default:
+			return opts, nil, ErrSyntax
+		}
+	}
+
+	return opts, nil, ErrFieldsMissing
+}
+
+func(r *RedisCache) HGETEX(key string, opts GetExOptions, fields []string) ([]string, []bool, error) {
+	// command syntax: HGETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST] FIELDS numfields field [field ...]
+	// HMGET that also changes the TTL of the fields it finds, the way GETEX does it for a key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]string, len(fields))
+	found := make([]bool, len(fields))
+	if hash == nil {
+		return values, found, nil
+	}
+
+	now := time.Now()
+	for i, field := range fields {
+		values[i], found[i] = hash.get(field)
+		if !found[i] {
+			continue
+		}
+
+		switch {
+		case opts.Persist:
+			hash.persist(field)
+		case opts.ExpiryTime.IsZero():
+		case !opts.ExpiryTime.After(now):
+			// a time in the past deletes the field, its value is still returned
+			hash.remove(field)
+		default:
+			hash.setTTL(field, opts.ExpiryTime)
+		}
+	}
+
+	if hash.len() == 0 {
+		r.deleteEntry(key)
+	}
+	return values, found, nil
+}
+
+// HSetExOptions holds the flags of an HSETEX command
+type HSetExOptions struct {
+	FNX 		bool // only set the fields if none of them exist yet
+	FXX 		bool // only set the fields if all of them exist already
+	KeepTTL 	bool // keep the TTLs the fields have instead of clearing them
+	ExpiryTime 	time.Time // when the fields expire, zero for never
+}
+
+// parseHSetExOptions reads the options between "HSETEX key" and FIELDS, and returns the FIELDS part that follows them
+func parseHSetExOptions(args [][]byte) (HSetExOptions, [][]byte, error) {
+	var opts HSetExOptions
+	hasExpiry := false
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+
+		switch option {
+		case "FIELDS":
+			return opts, args[i:], nil
+
+		case "FNX", "FXX":
+			if opts.FNX || opts.FXX {
+				return opts, nil, ErrSyntax
+			}
+			opts.FNX = option == "FNX"
+			opts.FXX = option == "FXX"
+
+		case "KEEPTTL":
+			if hasExpiry {
+				return opts, nil, ErrSyntax
+			}
+			opts.KeepTTL = true
+			hasExpiry = true
+
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpiry || i+1 == len(args) {
+				return opts, nil, ErrSyntax
+			}
+
+			expiryTime, err := parseExpiry(option, args[i+1], "hsetex")
+			if err != nil {
+				return opts, nil, err
+			}
+			if expiryTime.UnixMilli() > maxFieldExpiry {
+				return opts, nil, errInvalidExpireTime("hsetex")
+			}
+			opts.ExpiryTime = expiryTime
+			hasExpiry = true
+			i++
+
+		default:
+			return opts, nil, ErrSyntax
+		}
+	}
+
+	return opts, nil, ErrFieldsMissing
+}
+
+func(r *RedisCache) HSETEX(key string, opts HSetExOptions, fields []HashField) (bool, error) {
+	// command syntax: HSETEX key [FNX | FXX] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL] FIELDS numfields field value [field value ...]
+	// HSET that gives all the fields the same TTL, without an expiry and without KEEPTTL their TTLs are cleared
+	// it is all or nothing: false if FNX or FXX kept the fields from being set
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range fields {
+		exists := false
+		if hash != nil {
+			_, exists = hash.get(f.Field)
+		}
+		if (opts.FNX && exists) || (opts.FXX && !exists) {
+			return false, nil
+		}
+	}
+
+	if hash == nil {
+		hash = newRedisHash(&r.Config)
+		r.setEntry(key, &Entry{Type: "hash", Value: hash})
+	}
+
+	now := time.Now()
+	for _, f := range fields {
+		hash.set(f.Field, f.Value)
+
+		switch {
+		case opts.KeepTTL:
+		case opts.ExpiryTime.IsZero():
+			hash.persist(f.Field)
+		case !opts.ExpiryTime.After(now):
+			hash.remove(f.Field)
+		default:
+			hash.setTTL(f.Field, opts.ExpiryTime)
+		}
+	}
+
+	if hash.len() == 0 {
+		r.deleteEntry(key)
+	}
+	return true, nil
+}
@@ -0,0 +1,568 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"redis-clone/resp"
+)
+
+// commands needed to be implemented:
+// PFADD				--> Done
+// PFCOUNT				--> Done
+// PFMERGE				--> Done
+// PFDEBUG				--> Done
+
+// a HyperLogLog estimates the number of distinct elements with 16384 6 bit registers, about 0.81% standard error in 12kB
+// like bitmaps it is not a type of its own but a string entry, laid out byte for byte like Redis lays it out:
+//
+//	"HYLL" | encoding (0 dense, 1 sparse) | 3 unused bytes | cached cardinality (8 bytes little endian) | registers
+//
+// the highest bit of the cached cardinality marks it as stale, PFADD sets it and the next PFCOUNT recomputes it
+// dense registers are packed 6 bits each, least significant bits first, which makes 12288 bytes
+// sparse registers are run length encoded with three opcodes, so a fresh HLL takes a few bytes instead of 12kB:
+//
+//	ZERO	00xxxxxx			xxxxxx+1 registers set to 0 (1 to 64)
+//	XZERO	01xxxxxx yyyyyyyy	xxxxxxyyyyyyyy+1 registers set to 0 (1 to 16384)
+//	VAL		1vvvvvxx			xx+1 registers set to vvvvv+1 (a value of 1 to 32, 1 to 4 registers)
+//
+// a sparse HLL is switched to dense for good when a register needs a value above 32 or it grows past hll-sparse-max-bytes
+
+const (
+	hllP 				= 14 // the first 14 bits of an element's hash pick its register
+	hllQ 				= 64 - hllP // the remaining ones are used to count zeros
+	hllRegisters 		= 1 << hllP
+	hllBits 			= 6
+	hllRegisterMax 		= 1<<hllBits - 1
+	hllHeaderSize 		= 16
+	hllDenseSize 		= hllHeaderSize + (hllRegisters*hllBits+7)/8
+	hllDense 			= 0
+	hllSparse 			= 1
+	hllSparseValMax 	= 32
+	hllSparseValMaxLen 	= 4
+	hllSparseZeroMaxLen = 64
+	hllSparseXZeroMaxLen = 16384
+	hllAlphaInf 		= 0.721347520444481703680 // 1 / (2 ln 2)
+	hllHashSeed 		= 0xadc83b19
+)
+
+var hllMagic = []byte("HYLL")
+
+// murmurHash64A is the hash Redis uses for HLL elements, the same element has to land in the same register in both
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ (uint64(len(key)) * m)
+
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen returns the register of element and the length of the run of zero bits (plus one) in the rest of its hash
+func hllPatLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, hllHashSeed)
+	index := int(hash & (hllRegisters - 1))
+
+	// the bit above the Q used bits makes sure the loop ends, so the count is at most Q+1
+	hash >>= hllP
+	hash |= 1 << hllQ
+
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// isHLL tells whether the bytes of a string look like a HyperLogLog
+func isHLL(value []byte) bool {
+	if len(value) < hllHeaderSize || !bytes.Equal(value[:4], hllMagic) {
+		return false
+	}
+
+	switch value[4] {
+	case hllDense:
+		return len(value) == hllDenseSize
+	case hllSparse:
+		return true
+	}
+	return false
+}
+
+// newHLL returns an empty sparse HyperLogLog, one XZERO opcode that covers every register
+func newHLL() []byte {
+	value := make([]byte, hllHeaderSize, hllHeaderSize+2)
+	copy(value, hllMagic)
+	value[4] = hllSparse
+	return append(value, 0x40|byte((hllRegisters-1)>>8), byte((hllRegisters-1)&0xff))
+}
+
+func hllDenseGet(registers []byte, index int) uint8 {
+	bit := index * hllBits
+	b := bit >> 3
+	shift := uint(bit & 7)
+
+	value := uint(registers[b]) >> shift
+	if b+1 < len(registers) {
+		value |= uint(registers[b+1]) << (8 - shift)
+	}
+	return uint8(value & hllRegisterMax)
+}
+
+func hllDenseSet(registers []byte, index int, value uint8) {
+	bit := index * hllBits
+	b := bit >> 3
+	shift := uint(bit & 7)
+
+	registers[b] &^= byte(hllRegisterMax << shift)
+	registers[b] |= byte(uint(value) << shift)
+	if b+1 < len(registers) {
+		registers[b+1] &^= byte(hllRegisterMax >> (8 - shift))
+		registers[b+1] |= byte(uint(value) >> (8 - shift))
+	}
+}
+
+// hllDecode unpacks the registers of a HyperLogLog into one byte each
+func hllDecode(value []byte) ([]uint8, error) {
+	registers := make([]uint8, hllRegisters)
+
+	if value[4] == hllDense {
+		for i := range registers {
+			registers[i] = hllDenseGet(value[hllHeaderSize:], i)
+		}
+		return registers, nil
+	}
+
+	index := 0
+	ops := value[hllHeaderSize:]
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+
+		var run int
+		switch {
+		case op&0xc0 == 0x00:
+			run = int(op&0x3f) + 1
+			index += run
+		case op&0xc0 == 0x40:
+			if i+1 >= len(ops) {
+				return nil, ErrInvalidHLL
+			}
+			run = (int(op&0x3f)<<8 | int(ops[i+1])) + 1
+			index += run
+			i++
+		default:
+			run = int(op&0x3) + 1
+			if index+run > hllRegisters {
+				return nil, ErrInvalidHLL
+			}
+			for end := index + run; index < end; index++ {
+				registers[index] = (op>>2)&0x1f + 1
+			}
+		}
+
+		if index > hllRegisters {
+			return nil, ErrInvalidHLL
+		}
+	}
+
+	// the opcodes have to cover every register exactly
+	if index != hllRegisters {
+		return nil, ErrInvalidHLL
+	}
+	return registers, nil
+}
+
+// hllEncodeSparse builds the sparse form of registers, ok is false if a register is too big for it
+// or the result would be larger than maxBytes
+func hllEncodeSparse(registers []uint8, maxBytes int) ([]byte, bool) {
+	value := make([]byte, hllHeaderSize, hllHeaderSize+64)
+	copy(value, hllMagic)
+	value[4] = hllSparse
+
+	for i := 0; i < hllRegisters; {
+		current := registers[i]
+		if current > hllSparseValMax {
+			return nil, false
+		}
+
+		run := 1
+		for i+run < hllRegisters && registers[i+run] == current {
+			run++
+		}
+		i += run
+
+		for run > 0 {
+			switch {
+			case current != 0:
+				n := min(run, hllSparseValMaxLen)
+				value = append(value, 0x80|(current-1)<<2|byte(n-1))
+				run -= n
+			case run > hllSparseZeroMaxLen:
+				n := min(run, hllSparseXZeroMaxLen)
+				value = append(value, 0x40|byte((n-1)>>8), byte((n-1)&0xff))
+				run -= n
+			default:
+				value = append(value, byte(run-1))
+				run = 0
+			}
+		}
+
+		if len(value)-hllHeaderSize > maxBytes {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+func hllEncodeDense(registers []uint8) []byte {
+	value := make([]byte, hllDenseSize)
+	copy(value, hllMagic)
+	value[4] = hllDense
+
+	for i, register := range registers {
+		if register != 0 {
+			hllDenseSet(value[hllHeaderSize:], i, register)
+		}
+	}
+	return value
+}
+
+// hllEncode picks the sparse encoding when it is allowed and fits, the cached cardinality is left marked as stale
+func(r *RedisCache) hllEncode(registers []uint8, sparse bool) []byte {
+	var value []byte
+	if sparse {
+		value, sparse = hllEncodeSparse(registers, r.Config.HLLSparseMaxBytes)
+	}
+	if !sparse {
+		value = hllEncodeDense(registers)
+	}
+
+	hllInvalidateCache(value)
+	return value
+}
+
+func hllInvalidateCache(value []byte) {
+	value[15] |= 0x80
+}
+
+func hllCachedCount(value []byte) (int64, bool) {
+	if value[15]&0x80 != 0 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(value[8:16])), true
+}
+
+func hllSetCachedCount(value []byte, count int64) {
+	binary.LittleEndian.PutUint64(value[8:16], uint64(count))
+}
+
+// hllCount estimates the cardinality from the histogram of the register values,
+// with the estimator from Otmar Ertl's "New cardinality estimation algorithms for HyperLogLog sketches" that Redis uses
+func hllCount(registers []uint8) int64 {
+	var histogram [hllQ + 2]int
+	for _, register := range registers {
+		histogram[register]++
+	}
+
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+
+	return int64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		previous := z
+		z += x * y
+		y += y
+		if previous == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		previous := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if previous == z {
+			return z / 3
+		}
+	}
+}
+
+// hllFor returns the bytes of the HyperLogLog at key, nil if the key does not exist, the caller must hold r.mu
+func(r *RedisCache) hllFor(key string) (*Entry, []byte, error) {
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, nil, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return nil, nil, ErrWrongType
+	}
+	if !isHLL(value) {
+		return nil, nil, ErrNotHLL
+	}
+	return entry, value, nil
+}
+
+func(r *RedisCache) PFADD(key string, elements [][]byte) (int, error) {
+	// command syntax: PFADD key [element [element ...]] --> 1 if the estimate may have changed (or the key was created), else 0
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, value, err := r.hllFor(key)
+	if err != nil {
+		return 0, err
+	}
+
+	created := false
+	if entry == nil {
+		entry = &Entry{Type: "string", Value: newHLL()}
+		r.setEntry(key, entry)
+		value = entry.Value.([]byte)
+		created = true
+	}
+
+	updated := false
+	if value[4] == hllDense {
+		// the dense registers are changed in place
+		registers := value[hllHeaderSize:]
+		for _, element := range elements {
+			index, count := hllPatLen(element)
+			if count > hllDenseGet(registers, index) {
+				hllDenseSet(registers, index, count)
+				updated = true
+			}
+		}
+		if updated {
+			hllInvalidateCache(value)
+		}
+	} else {
+		registers, err := hllDecode(value)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, element := range elements {
+			index, count := hllPatLen(element)
+			if count > registers[index] {
+				registers[index] = count
+				updated = true
+			}
+		}
+		if updated {
+			entry.Value = r.hllEncode(registers, true)
+		}
+	}
+
+	if created || updated {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func(r *RedisCache) PFCOUNT(keys []string) (int64, error) {
+	// command syntax: PFCOUNT key [key ...] --> the estimated number of distinct elements added to the keys together
+	// a single key keeps the estimate in its header until the next PFADD, a union of several keys is computed every time
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(keys) == 1 {
+		entry, value, err := r.hllFor(keys[0])
+		if err != nil || entry == nil {
+			return 0, err
+		}
+
+		if count, ok := hllCachedCount(value); ok {
+			return count, nil
+		}
+
+		registers, err := hllDecode(value)
+		if err != nil {
+			return 0, err
+		}
+
+		count := hllCount(registers)
+		hllSetCachedCount(stringForWrite(entry, 0), count)
+		return count, nil
+	}
+
+	union, _, err := r.hllUnion(keys)
+	if err != nil {
+		return 0, err
+	}
+	return hllCount(union), nil
+}
+
+// hllUnion takes the highest value of every register over the HyperLogLogs at keys, missing keys are skipped
+// dense tells whether any of them used the dense encoding, the caller must hold r.mu
+func(r *RedisCache) hllUnion(keys []string) (union []uint8, dense bool, err error) {
+	union = make([]uint8, hllRegisters)
+
+	for _, key := range keys {
+		entry, value, err := r.hllFor(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		registers, err := hllDecode(value)
+		if err != nil {
+			return nil, false, err
+		}
+		for i, register := range registers {
+			union[i] = max(union[i], register)
+		}
+		if value[4] == hllDense {
+			dense = true
+		}
+	}
+
+	return union, dense, nil
+}
+
+func(r *RedisCache) PFMERGE(destination string, sources []string) error {
+	// command syntax: PFMERGE destkey [sourcekey [sourcekey ...]]
+	// destkey becomes the union of itself and the sources, it stays sparse only if all of them were sparse
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	union, dense, err := r.hllUnion(append([]string{destination}, sources...))
+	if err != nil {
+		return err
+	}
+
+	value := r.hllEncode(union, !dense)
+
+	// the key is changed rather than replaced, so it keeps its TTL
+	if entry, exists := r.lookup(destination); exists {
+		entry.Value = value
+	} else {
+		r.setEntry(destination, &Entry{Type: "string", Value: value})
+	}
+	return nil
+}
+
+func(r *RedisCache) PFDEBUG(subcommand string, key string) (resp.Value, error) {
+	// command syntax: PFDEBUG GETREG|DECODE|ENCODING|TODENSE key
+	// GETREG --> every register (switching the key to dense), DECODE --> the sparse opcodes,
+	// ENCODING --> sparse or dense, TODENSE --> 1 if the key was switched to dense, 0 if it already was
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, value, err := r.hllFor(key)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if entry == nil {
+		return resp.Value{}, ErrKeyDoesNotExist
+	}
+
+	switch strings.ToUpper(subcommand) {
+	case "GETREG", "TODENSE":
+		converted := false
+		if value[4] == hllSparse {
+			registers, err := hllDecode(value)
+			if err != nil {
+				return resp.Value{}, err
+			}
+			dense := hllEncodeDense(registers)
+			copy(dense[8:16], value[8:16])
+			entry.Value, value, converted = dense, dense, true
+		}
+
+		if strings.EqualFold(subcommand, "TODENSE") {
+			if converted {
+				return resp.Integer(1), nil
+			}
+			return resp.Integer(0), nil
+		}
+
+		registers := make([]resp.Value, hllRegisters)
+		for i := range registers {
+			registers[i] = resp.Integer(int64(hllDenseGet(value[hllHeaderSize:], i)))
+		}
+		return resp.Array(registers...), nil
+
+	case "DECODE":
+		if value[4] != hllSparse {
+			return resp.Value{}, ErrHLLNotSparse
+		}
+
+		var decoded []string
+		ops := value[hllHeaderSize:]
+		for i := 0; i < len(ops); i++ {
+			op := ops[i]
+			switch {
+			case op&0xc0 == 0x00:
+				decoded = append(decoded, fmt.Sprintf("z:%d", op&0x3f+1))
+			case op&0xc0 == 0x40 && i+1 < len(ops):
+				decoded = append(decoded, fmt.Sprintf("Z:%d", (int(op&0x3f)<<8|int(ops[i+1]))+1))
+				i++
+			case op&0xc0 == 0x40:
+				return resp.Value{}, ErrInvalidHLL
+			default:
+				decoded = append(decoded, fmt.Sprintf("v:%d,%d", (op>>2)&0x1f+1, op&0x3+1))
+			}
+		}
+		return resp.BulkString(strings.Join(decoded, " ")), nil
+
+	case "ENCODING":
+		if value[4] == hllSparse {
+			return resp.SimpleString("sparse"), nil
+		}
+		return resp.SimpleString("dense"), nil
+	}
+
+	return resp.Value{}, fmt.Errorf("ERR Unknown PFDEBUG subcommand '%s'", subcommand)
+}
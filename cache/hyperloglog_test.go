@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestPFAddAndCount(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"PFADD", "hll"}, ":1\r\n"},
+		{[]string{"PFADD", "hll"}, ":0\r\n"},
+		{[]string{"PFCOUNT", "hll"}, ":0\r\n"},
+		{[]string{"PFDEBUG", "DECODE", "hll"}, "$7\r\nZ:16384\r\n"},
+		{[]string{"PFADD", "hll", "1", "2", "3", "4", "5"}, ":1\r\n"},
+		{[]string{"PFADD", "hll", "1", "2", "3"}, ":0\r\n"},
+		{[]string{"PFCOUNT", "hll"}, ":5\r\n"},
+		{[]string{"PFADD", "hll", "6", "7", "8", "8", "9", "10"}, ":1\r\n"},
+		{[]string{"PFCOUNT", "hll"}, ":10\r\n"},
+		{[]string{"PFADD", "empty", ""}, ":1\r\n"},
+		{[]string{"PFCOUNT", "empty"}, ":1\r\n"},
+		{[]string{"PFCOUNT", "missing"}, ":0\r\n"},
+		{[]string{"PFDEBUG", "ENCODING", "hll"}, "+sparse\r\n"},
+
+		{[]string{"SET", "str", "hello"}, "+OK\r\n"},
+		{[]string{"PFADD", "str", "a"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"PFCOUNT", "hll", "str"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"PFMERGE", "str", "hll"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"PFCOUNT", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+
+		{[]string{"PFDEBUG", "GETREG", "missing"}, "-ERR The specified key does not exist\r\n"},
+		{[]string{"PFDEBUG", "NOPE", "hll"}, "-ERR Unknown PFDEBUG subcommand 'NOPE'\r\n"},
+		{[]string{"PFDEBUG", "TODENSE", "hll"}, ":1\r\n"},
+		{[]string{"PFDEBUG", "TODENSE", "hll"}, ":0\r\n"},
+		{[]string{"PFDEBUG", "ENCODING", "hll"}, "+dense\r\n"},
+		{[]string{"PFDEBUG", "DECODE", "hll"}, "-ERR HLL encoding is not sparse\r\n"},
+		{[]string{"PFCOUNT", "hll"}, ":10\r\n"},
+		{[]string{"STRLEN", "hll"}, ":12304\r\n"},
+	});
+}
+
+// testing that the estimate is kept in the header until the registers change
+func TestPFCountCache(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"PFADD", "hll", "a", "b", "c"}, ":1\r\n"},
+		{[]string{"GETRANGE", "hll", "15", "15"}, "$1\r\n\x80\r\n"},
+		{[]string{"PFCOUNT", "hll"}, ":3\r\n"},
+		{[]string{"GETRANGE", "hll", "8", "15"}, "$8\r\n\x03\x00\x00\x00\x00\x00\x00\x00\r\n"},
+		{[]string{"PFADD", "hll", "a", "b", "c"}, ":0\r\n"},
+		{[]string{"GETRANGE", "hll", "15", "15"}, "$1\r\n\x00\r\n"},
+		{[]string{"PFADD", "hll", "1", "2", "3"}, ":1\r\n"},
+		{[]string{"GETRANGE", "hll", "15", "15"}, "$1\r\n\x80\r\n"},
+	});
+}
+
+func TestPFMerge(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"PFADD", "a", "1", "2", "3"}, ":1\r\n"},
+		{[]string{"PFADD", "b", "3", "4", "5"}, ":1\r\n"},
+		{[]string{"PFMERGE", "dest", "a", "b", "missing"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "dest"}, ":5\r\n"},
+		{[]string{"PFCOUNT", "a", "b"}, ":5\r\n"},
+		{[]string{"PFDEBUG", "ENCODING", "dest"}, "+sparse\r\n"},
+
+		// a dense input makes the result dense
+		{[]string{"PFDEBUG", "TODENSE", "b"}, ":1\r\n"},
+		{[]string{"PFMERGE", "dense", "a", "b"}, "+OK\r\n"},
+		{[]string{"PFDEBUG", "ENCODING", "dense"}, "+dense\r\n"},
+		{[]string{"PFCOUNT", "dense"}, ":5\r\n"},
+
+		{[]string{"PFMERGE", "new"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "new"}, ":0\r\n"},
+	});
+}
+
+// testing that a sparse HLL switches to dense once it grows, and that both give the same registers
+func TestHLLPromotion(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	for i := 0; i < 5000; i++ {
+		cache.ExecuteCommands(client, command("PFADD", "sparse", strconv.Itoa(i)));
+		cache.ExecuteCommands(client, command("PFADD", "dense", strconv.Itoa(i)));
+		if i == 0 {
+			cache.ExecuteCommands(client, command("PFDEBUG", "TODENSE", "dense"));
+		};
+
+		if i%500 != 0 {
+			continue;
+		};
+		sparse := cache.ExecuteCommands(client, command("PFCOUNT", "sparse"));
+		dense := cache.ExecuteCommands(client, command("PFCOUNT", "dense"));
+		if sparse.Int != dense.Int {
+			t.Fatalf("After %d elements the sparse count is %d but the dense one is %d", i+1, sparse.Int, dense.Int);
+		};
+	};
+
+	if reply := cache.ExecuteCommands(client, command("PFDEBUG", "ENCODING", "sparse")); reply.Str != "dense" {
+		t.Errorf("Expected the HLL to be dense after 5000 elements, but it is %s", reply.Str);
+	};
+
+	sparse := cache.ExecuteCommands(client, command("PFDEBUG", "GETREG", "sparse"));
+	dense := cache.ExecuteCommands(client, command("PFDEBUG", "GETREG", "dense"));
+	for i := range sparse.Elems {
+		if sparse.Elems[i].Int != dense.Elems[i].Int {
+			t.Fatalf("Register %d: %d against %d", i, sparse.Elems[i].Int, dense.Elems[i].Int);
+		};
+	};
+}
+
+func TestHLLAccuracy(t *testing.T) {
+	cache := NewRedisServer();
+
+	elements := make([][]byte, 0, 1000);
+	for i := 0; i < 100000; i++ {
+		elements = append(elements, []byte("element:"+strconv.Itoa(i)));
+		if len(elements) == cap(elements) {
+			cache.PFADD("hll", elements);
+			elements = elements[:0];
+		};
+
+		if (i+1)%10000 != 0 {
+			continue;
+		};
+		count, _ := cache.PFCOUNT([]string{"hll"});
+		if relative := math.Abs(float64(count)-float64(i+1)) / float64(i+1); relative > 0.03 {
+			t.Errorf("Estimated %d for %d elements (%.2f%% off)", count, i+1, relative*100);
+		};
+	};
+}
+
+func TestHLLCorruption(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		// the opcodes cover one register too many
+		{[]string{"SET", "hll", "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xff\x00"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "hll"}, "-INVALIDOBJ Corrupted HLL object detected\r\n"},
+		{[]string{"PFADD", "hll", "a"}, "-INVALIDOBJ Corrupted HLL object detected\r\n"},
+		// and here one too few
+		{[]string{"SET", "hll", "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xfe"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "hll"}, "-INVALIDOBJ Corrupted HLL object detected\r\n"},
+		// a dense HLL must have exactly 16384 registers
+		{[]string{"SET", "hll", "HYLL\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x00"}, "+OK\r\n"},
+		{[]string{"PFCOUNT", "hll"}, "-WRONGTYPE Key is not a valid HyperLogLog string value.\r\n"},
+	});
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+func(r *RedisCache) INFO(sections []string) string {
+	// command syntax: INFO [section [section ...]]
+	// returns human readable "field:value" lines grouped under "# Section" headers
+	// without arguments the default sections are returned
+	r.mu.Lock()
+	keys, expires := len(r.store), 0
+	for _, entry := range r.store {
+		if !entry.ExpiryTime.IsZero() && time.Now().Before(entry.ExpiryTime) {
+			expires++
+		}
+	}
+	r.mu.Unlock()
+
+	wanted := map[string]bool{}
+	for _, section := range sections {
+		wanted[strings.ToLower(section)] = true
+	}
+	all := len(wanted) == 0 || wanted["all"] || wanted["default"] || wanted["everything"]
+
+	var info strings.Builder
+	if all || wanted["server"] {
+		info.WriteString("# Server\r\n")
+		fmt.Fprintf(&info, "redis_version:%s\r\n", serverVersion)
+		info.WriteString("redis_mode:standalone\r\n")
+		fmt.Fprintf(&info, "os:%s\r\n", runtime.GOOS)
+		fmt.Fprintf(&info, "arch_bits:%d\r\n", 32<<(^uint(0)>>63))
+		fmt.Fprintf(&info, "go_version:%s\r\n", runtime.Version())
+		fmt.Fprintf(&info, "process_id:%d\r\n", os.Getpid())
+	}
+
+	if all || wanted["keyspace"] {
+		if info.Len() > 0 {
+			info.WriteString("\r\n")
+		}
+		info.WriteString("# Keyspace\r\n")
+		if keys > 0 {
+			fmt.Fprintf(&info, "db0:keys=%d,expires=%d,avg_ttl=0\r\n", keys, expires)
+		}
+	}
+
+	return info.String()
+}
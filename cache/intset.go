@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"slices"
+	"strconv"
+)
+
+// an intset is how Redis stores a set that only holds integers: a sorted array, searched with a binary search
+// a member is an integer when it is exactly how the number is written (parseInteger), "10" is one, "010" and "+10" are not,
+// so turning the numbers back into strings gives the very same members
+type intset []int64
+
+func(is intset) contains(n int64) bool {
+	_, found := slices.BinarySearch(is, n)
+	return found
+}
+
+func(is *intset) add(n int64) bool {
+	i, found := slices.BinarySearch(*is, n)
+	if found {
+		return false
+	}
+	*is = slices.Insert(*is, i, n)
+	return true
+}
+
+func(is *intset) remove(n int64) bool {
+	i, found := slices.BinarySearch(*is, n)
+	if !found {
+		return false
+	}
+	*is = slices.Delete(*is, i, i+1)
+	return true
+}
+
+// intsetMember returns the integer member is, ok is false if it is not one
+func intsetMember(member string) (int64, bool) {
+	return parseInteger([]byte(member))
+}
+
+func formatIntsetMember(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
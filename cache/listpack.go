@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+)
+
+// a listpack is how Redis keeps small hashes, sets and sorted sets: every element is packed into one byte slice,
+// so a collection of a few members costs a single allocation instead of a map with all its buckets
+// looking something up walks the entries, which is why a collection only stays a listpack while it is small
+// (the *-max-listpack-entries and *-max-listpack-value settings in config.go), past that it becomes a hashtable
+//
+// every entry is its length (as a uvarint) followed by its bytes:
+// [3]foo[5]hello[1]x
+// hashes store field, value, field, value, ... and sorted sets member, score, member, score, ...
+type listpack struct {
+	buf 	[]byte
+	count 	int // number of entries
+}
+
+func(lp *listpack) len() int {
+	return lp.count
+}
+
+// entry returns the entry starting at pos and the position of the next one
+func(lp *listpack) entry(pos int) ([]byte, int) {
+	size, n := binary.Uvarint(lp.buf[pos:])
+	start := pos + n
+	return lp.buf[start : start+int(size)], start + int(size)
+}
+
+// forEach calls fn for every entry with its position, until fn returns false
+func(lp *listpack) forEach(fn func(pos int, entry []byte) bool) {
+	for pos := 0; pos < len(lp.buf); {
+		entry, next := lp.entry(pos)
+		if !fn(pos, entry) {
+			return
+		}
+		pos = next
+	}
+}
+
+// find returns the position of the first entry equal to v, -1 if there is none
+// only every step-th entry is compared, for pairs that is the field or the member, never the value or the score
+func(lp *listpack) find(v string, step int) int {
+	found, i := -1, 0
+	lp.forEach(func(pos int, entry []byte) bool {
+		if i%step == 0 && string(entry) == v {
+			found = pos
+			return false
+		}
+		i++
+		return true
+	})
+	return found
+}
+
+// insert puts entries at pos, in order, a pos of len(buf) appends them
+func(lp *listpack) insert(pos int, entries ...string) {
+	size := 0
+	for _, e := range entries {
+		size += uvarintLen(len(e)) + len(e)
+	}
+
+	end := len(lp.buf)
+	lp.buf = slices.Grow(lp.buf, size)[:end+size]
+	copy(lp.buf[pos+size:], lp.buf[pos:end])
+
+	for _, e := range entries {
+		pos += binary.PutUvarint(lp.buf[pos:], uint64(len(e)))
+		pos += copy(lp.buf[pos:], e)
+	}
+	lp.count += len(entries)
+}
+
+func(lp *listpack) append(entries ...string) {
+	lp.insert(len(lp.buf), entries...)
+}
+
+// remove deletes n entries starting at pos
+func(lp *listpack) remove(pos int, n int) {
+	end := pos
+	for i := 0; i < n; i++ {
+		_, end = lp.entry(end)
+	}
+	lp.buf = append(lp.buf[:pos], lp.buf[end:]...)
+	lp.count -= n
+}
+
+// replace swaps the entry at pos for v
+func(lp *listpack) replace(pos int, v string) {
+	lp.remove(pos, 1)
+	lp.insert(pos, v)
+}
+
+// entries copies every entry out of the listpack
+func(lp *listpack) entries() []string {
+	result := make([]string, 0, lp.count)
+	lp.forEach(func(_ int, entry []byte) bool {
+		result = append(result, string(entry))
+		return true
+	})
+	return result
+}
+
+func uvarintLen(n int) int {
+	size := 1
+	for ; n >= 0x80; n >>= 7 {
+		size++
+	}
+	return size
+}
+
+// scores of sorted sets are packed as the 8 bytes of the float, so reading them back is exact and cheap
+func packScore(score float64) string {
+	return string(binary.BigEndian.AppendUint64(nil, math.Float64bits(score)))
+}
+
+func unpackScore(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
@@ -1,99 +1,163 @@
 package cache
 
-import "fmt"
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// commands needed to be implemented:
+// LPUSHX, RPUSHX key element [element ...]								--> Done
+// LPOP, RPOP key [count]												--> Done
+// LINSERT key BEFORE | AFTER pivot element								--> Done
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]		--> Done
+// LMOVE source destination LEFT | RIGHT LEFT | RIGHT, RPOPLPUSH			--> Done
+// LMPOP numkeys key [key ...] LEFT | RIGHT [COUNT count]				--> Done
+// BLPOP, BRPOP key [key ...] timeout									--> Done
+// BLMOVE source destination LEFT | RIGHT LEFT | RIGHT timeout			--> Done
+// BLMPOP timeout numkeys key [key ...] LEFT | RIGHT [COUNT count]		--> Done
+// BRPOPLPUSH source destination timeout								--> Done
+
+// listFor returns the list stored under key, nil if there is none (empty lists are never stored)
+// the caller must hold r.mu
+func(r *RedisCache) listFor(key string) (*quicklist, error) {
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, nil
+	}
 
+	list, isList := entry.Value.(*quicklist)
+	if !isList {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
 
-func(r *RedisCache) LPUSH(key string, values ...string) (int, bool) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// pushList adds values to the head (left) or the tail of the list under key, creating it when needed,
+// and serves the clients blocked on key; the caller must hold r.mu and have checked the type
+func(r *RedisCache) pushList(key string, left bool, values []string) int {
+	list, _ := r.listFor(key)
+	if list == nil {
+		list = newQuicklist(r.Config.ListMaxListpackSize)
+		r.setEntry(key, &Entry{Type: "list", Value: list})
+	}
 
-	// checking whether the same key exists in the memory
-	entry, exists := r.store[key]
+	// every value goes to the head one after the other, so LPUSH leaves them in reverse order
+	// for example: existing list = ['a', 'b'] & values = ['c', 'd'] --> ['d', 'c', 'a', 'b']
+	for _, v := range values {
+		list.push(left, v)
+	}
 
-	// CASE 1
-	// if it does not exist, then make a new list
-	// and append all the values in the right order
-	if !exists {
-		fmt.Println("key does not exist, new list is created")
-		// building the list
-		list := []string{}
-		for i:=len(values)-1; i>=0; i-- {
-			list = append([]string{values[i]}, list...)
-			// list = append(list, values[i])
-		}
+	length := list.len()
+	r.signalKey(key)
+	return length
+}
+
+// popList removes up to count elements from the head (left) or the tail of the list under key,
+// the key is deleted once the list is empty; the caller must hold r.mu and make sure the list exists
+func(r *RedisCache) popList(key string, left bool, count int) []string {
+	list, _ := r.listFor(key)
 
-		// then, assigning the list to entry.Value
-		entry = &Entry{Type: "list", Value: list}
-		
-		// storing the list corresponding to the key and returning the length of the list
-		r.store[key] = entry
-		return len(list), true
+	if count > list.len() {
+		count = list.len()
 	}
 
-	// CASE 2
-	// if the list already exists, then simply append the values to the left of the existing values
+	// popping from the tail returns the last element first
+	popped := make([]string, count)
+	for i := range popped {
+		popped[i] = list.pop(left)
+	}
 
-	// for example: existing list = ['a', 'b'] & values = ['c', 'd']
-	// expected resultant list: lst = ['d', 'c', 'a', 'b']
+	r.deleteIfEmpty(key, list)
+	return popped
+}
 
-	lst, isList := entry.Value.([]string)
-	if !isList {
-		fmt.Println("wrong type WRONGTYPE")
-		return 0, false
+// deleteIfEmpty removes the key of a list that ran empty, the caller must hold r.mu
+func(r *RedisCache) deleteIfEmpty(key string, list *quicklist) {
+	if list.len() == 0 {
+		r.deleteEntry(key)
 	}
+}
 
-	for i:=len(values)-1; i>=0; i-- {
-		lst = append([]string{values[i]}, lst...)
+// moveList pops one element off source and pushes it to destination, ok is false when source does not exist
+// the caller must hold r.mu
+func(r *RedisCache) moveList(source string, destination string, fromLeft bool, toLeft bool) (string, bool, error) {
+	list, err := r.listFor(source)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+	if _, err := r.listFor(destination); err != nil {
+		return "", false, err
 	}
 
-	entry.Value = lst
-	r.store[key] = entry
-
-	fmt.Println("after creating a new list and prepending values: ", lst)
-	return len(lst), true
+	element := r.popList(source, fromLeft, 1)[0]
+	r.pushList(destination, toLeft, []string{element})
+	return element, true, nil
 }
 
-func(r *RedisCache) RPUSH(key string, values []string) (int, bool) {
+func(r *RedisCache) LPUSH(key string, values ...string) (int, error) {
+	// command syntax: LPUSH key element [element ...]
+	// every element is inserted at the head, so LPUSH mylist a b c leaves mylist as c, b, a
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		list := append([]string{}, values...)
-		entry = &Entry{Type: "list", Value: list}
-		r.store[key] = entry
-		return len(list), true
+	if _, err := r.listFor(key); err != nil {
+		return 0, err
 	}
 
-	lst, isList := entry.Value.([]string)
-	if !isList {
-		return 0, false
+	return r.pushList(key, true, values), nil
+}
+
+func(r *RedisCache) RPUSH(key string, values []string) (int, error) {
+	// command syntax: RPUSH key element [element ...]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.listFor(key); err != nil {
+		return 0, err
 	}
 
-	lst = append(lst, values...)
-	entry.Value = lst
-	r.store[key] = entry
+	return r.pushList(key, false, values), nil
+}
 
-	return len(lst), true
+func(r *RedisCache) LPUSHX(key string, values []string) (int, error) {
+	// command syntax: LPUSHX key element [element ...]
+	// same as LPUSH, but only when the list already exists, 0 is returned otherwise
+	return r.pushExisting(key, true, values)
 }
 
-func(r *RedisCache) LRANGE(key string, start int, end int) (interface{}, bool) {
+func(r *RedisCache) RPUSHX(key string, values []string) (int, error) {
+	// command syntax: RPUSHX key element [element ...]
+	return r.pushExisting(key, false, values)
+}
+
+func(r *RedisCache) pushExisting(key string, left bool, values []string) (int, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// getting the values from the stored key
-	entry, exists := r.store[key]
-	if !exists {
-		return nil, false
+	list, err := r.listFor(key)
+	if err != nil || list == nil {
+		return 0, err
 	}
 
-	values, isList := entry.Value.([]string)
-	if !isList {
-		return nil, false
+	return r.pushList(key, left, values), nil
+}
+
+func(r *RedisCache) LRANGE(key string, start int, end int) ([]string, error) {
+	// command syntax: LRANGE key start stop
+	// a missing key is an empty list, so the range is empty
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// getting the list from the stored key
+	values, err := r.listFor(key)
+	if values == nil {
+		return []string{}, err
 	}
 
 	// handle negative indices
-	length := len(values)
+	length := values.len()
 
 	// start --> starting index & end --> ending index
 	// suppose a list named "myList" exists with elements like: "item1", "item2", "item3", "item4"
@@ -116,7 +180,7 @@ func(r *RedisCache) LRANGE(key string, start int, end int) (interface{}, bool) {
 
 	// bounds checking
 	if start > length-1 {
-		return []string{}, true // returning empty list if start is out of bounds
+		return []string{}, nil // returning empty list if start is out of bounds
 	}
 	if end >= length {
 		end = length - 1
@@ -124,96 +188,212 @@ func(r *RedisCache) LRANGE(key string, start int, end int) (interface{}, bool) {
 
 	// returning empty list if range is invalid
 	if start > end {
-		return []string{}, true
+		return []string{}, nil
 	}
 
-	// for normal cases, simple loop through the list
-	// resultant_list := []string{}
-	// for i:=start; i<=end; i++ {
-	// 	resultant_list = append(resultant_list, values[i])
-	// }
-
-	// simple approach as opposed to looping through: slice the list
-	resultant_list := values[start:end+1]
-	fmt.Println("resultant_list: ", resultant_list)
-	return resultant_list, true
+	// for normal cases, copying the range out of the nodes
+	// (the list can change as soon as the lock is released, so the reply must not share memory with it)
+	resultant_list := values.rangeValues(start, end)
+	return resultant_list, nil
 }
 
-func(r *RedisCache) LPOP(key string) (string, bool) {
+func(r *RedisCache) LPOP(key string, count int) ([]string, bool, error) {
 	// syntax: LPOP key [count]
 	// [count] can be an integer or null
 	// Case A: if count == null, then by default, one element will be popped out | Status: Done
-	// Case B: if count >= 1, then [count] number of elements will be pooped out | Status: Not Completed
+	// Case B: if count >= 1, then [count] number of elements will be pooped out | Status: Done
+	// the handler passes 1 for Case A, ok is false when there is no list at all
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// getting the values stored corresponding to the key
-	entry, exists := r.store[key]
-	if !exists {
-		return "list does not exist", false
+	// getting the list stored corresponding to the key
+	values, err := r.listFor(key)
+	if err != nil || values == nil {
+		return nil, false, err
 	}
 
-	// extracting the list into the values variable
-	values, isList := entry.Value.([]string)
-	if !isList {
-		return "incorrect type found", false
+	// removing the left-most elements, the key goes away together with the last element
+	return r.popList(key, true, count), true, nil
+}
+
+func(r *RedisCache) RPOP(key string, count int) ([]string, bool, error) {
+	// every functionality in RPOP is same as LPOP, except here we remove the right-most elements in the list i.e., from the last element backwards
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values, err := r.listFor(key)
+	if err != nil || values == nil {
+		return nil, false, err
 	}
 
-	poppedElement := values[0]
-	length := len(values)
+	return r.popList(key, false, count), true, nil
+}
 
-	// slicing the list by removing the left-most element and storing it in newList
-	// replacing the old list with 'newList' i.e., the sliced list
-	// returning the popped element
-	newList := values[1:length-1]
-	entry.Value = newList
+func(r *RedisCache) LMPOP(keys []string, left bool, count int) (string, []string, error) {
+	// command syntax: LMPOP numkeys key [key ...] LEFT | RIGHT [COUNT count]
+	// pops from the first key that holds a list, the key is "" when none does
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	return poppedElement, true
+	for _, key := range keys {
+		values, err := r.listFor(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if values == nil {
+			continue
+		}
+
+		return key, r.popList(key, left, count), nil
+	}
+
+	return "", nil, nil
 }
 
-func(r *RedisCache) RPOP(key string) (string, bool) {
-	// every functionality in RPOP is same as LPOP, except here we remove the right-most element in the list i.e., the last element
-	// Case A: if count == null, then by default, one element will be popped out | Status: Done
-	// Case B: if count >= 1, then [count] number of elements will be pooped out | Status: Not Completed
+func(r *RedisCache) LMOVE(source string, destination string, fromLeft bool, toLeft bool) (string, bool, error) {
+	// command syntax: LMOVE source destination LEFT | RIGHT LEFT | RIGHT
+	// RPOPLPUSH source destination is LMOVE source destination RIGHT LEFT
+	// source and destination may be the same list, then the element just goes around to the other end
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.moveList(source, destination, fromLeft, toLeft)
+}
 
+func(r *RedisCache) LINSERT(key string, before bool, pivot string, element string) (int, error) {
+	// command syntax: LINSERT key BEFORE | AFTER pivot element
+	// inserts element next to the first occurrence of pivot and returns the new length,
+	// -1 when pivot is not in the list and 0 when there is no list
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// getting the values stored corresponding to the key
-	entry, exists := r.store[key]
-	if !exists {
-		return "list does not exist", false
+	values, err := r.listFor(key)
+	if err != nil || values == nil {
+		return 0, err
 	}
 
-	// extracting the list into the values variable
-	values, isList := entry.Value.([]string)
-	if !isList {
-		return "incorrect type found", false
+	position := -1
+	values.forEach(false, func(i int, v string) bool {
+		if v == pivot {
+			position = i
+			return false
+		}
+		return true
+	})
+	if position < 0 {
+		return -1, nil
 	}
 
-	length := len(values)
-	poppedElement := values[length-1]
-	newList := values[0:length-2]
+	if !before {
+		position++
+	}
+	values.insert(position, element)
+	return values.len(), nil
+}
 
-	entry.Value = newList
-	return poppedElement, true
+// LPosOptions are the options of LPOS, Count 0 means every match and MaxLen 0 the whole list
+type LPosOptions struct {
+	Rank 	int64 // 1 is the first match from the head, -1 the first one from the tail
+	Count 	int64
+	MaxLen 	int64
 }
 
-func(r *RedisCache) LLEN(key string) (int, bool) {
+// parseLPosOptions reads "[RANK rank] [COUNT num-matches] [MAXLEN len]", hasCount tells whether COUNT was given
+func parseLPosOptions(args [][]byte) (LPosOptions, bool, error) {
+	opts := LPosOptions{Rank: 1, Count: 1}
+	hasCount := false
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return opts, false, ErrSyntax
+		}
+
+		value, ok := parseInteger(args[i+1])
+		if !ok {
+			return opts, false, ErrNotInteger
+		}
+
+		switch strings.ToUpper(string(args[i])) {
+		case "RANK":
+			if value == 0 {
+				return opts, false, ErrRankZero
+			}
+			if value == math.MinInt64 {
+				return opts, false, ErrOutOfRange
+			}
+			opts.Rank = value
+		case "COUNT":
+			if value < 0 {
+				return opts, false, ErrLPosCountNegative
+			}
+			opts.Count, hasCount = value, true
+		case "MAXLEN":
+			if value < 0 {
+				return opts, false, ErrMaxLenNegativeLPos
+			}
+			opts.MaxLen = value
+		default:
+			return opts, false, ErrSyntax
+		}
+	}
+
+	return opts, hasCount, nil
+}
+
+func(r *RedisCache) LPOS(key string, element string, opts LPosOptions) ([]int, error) {
+	// command syntax: LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+	// returns the indexes of the matches, always counted from the head, even when a negative rank scans from the tail
+	// RANK 2 skips the first match, COUNT 0 returns all of them and MAXLEN stops after comparing that many elements
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return 0, false
+	values, err := r.listFor(key)
+	if err != nil {
+		return nil, err
 	}
 
-	values, isList := entry.Value.([]string)
-	if !isList {
+	matches := []int{}
+	if values == nil {
+		return matches, nil
+	}
+
+	skip := opts.Rank - 1
+	if opts.Rank < 0 {
+		skip = -opts.Rank - 1
+	}
+
+	compared := int64(0)
+	values.forEach(opts.Rank < 0, func(i int, v string) bool {
+		if opts.MaxLen > 0 && compared == opts.MaxLen {
+			return false
+		}
+		compared++
+
+		if v != element {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+
+		matches = append(matches, i)
+		return opts.Count == 0 || int64(len(matches)) < opts.Count
+	})
+
+	return matches, nil
+}
+
+func(r *RedisCache) LLEN(key string) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values, err := r.listFor(key)
+	if err != nil || values == nil {
 		return 0, false
 	}
 
-	length := len(values)
+	length := values.len()
 
 	return length, true
 }
@@ -226,29 +406,24 @@ func(r *RedisCache) LINDEX(key string, index int) (string, bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return "", false
-	}
-
-	values, isList := entry.Value.([]string)
-	if !isList {
+	values, err := r.listFor(key)
+	if err != nil || values == nil {
 		return "", false
 	}
 
 	// handling the negative index case
 	if index < 0 {
-		index = len(values) + index
+		index = values.len() + index
 	}
 
 	// if the index is still negative from above
 	// or if the index is greater than or equal to the length of the list
-	if index < 0 || index >= len(values) {
+	if index < 0 || index >= values.len() {
 		return "", false
 	}
 
-	// getting the element by the index from the list, and returning it
-	element := values[index]
+	// getting the element by the index from the list (only the nodes are walked), and returning it
+	element := values.get(index)
 	return element, true
 }
 
@@ -260,18 +435,13 @@ func(r*RedisCache) LSET(key string, index int, element string) (bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return false
-	}
-
-	values, isList := entry.Value.([]string)
-	if !isList {
+	values, err := r.listFor(key)
+	if err != nil || values == nil {
 		return false
 	}
 
 	// negative indices need to handled
-	length := len(values)
+	length := values.len()
 	if index < 0 {
 		index = index + length
 	}
@@ -281,7 +451,7 @@ func(r*RedisCache) LSET(key string, index int, element string) (bool) {
 		return false
 	}
 
-	values[index] = element
+	values.set(index, element)
 	return true
 }
 
@@ -296,93 +466,63 @@ func(r *RedisCache) LREM(key string, count int, element string) (int, bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return 0, true
-	}
-
-	values, isList := entry.Value.([]string)
-	if !isList {
+	values, err := r.listFor(key)
+	if err != nil {
 		return 0, false
 	}
+	if values == nil {
+		return 0, true
+	}
 
 	// defining some useful variables
-	length := len(values) 	// length of the list stored corresponding to the key
-	removed := 0			// tracking how many elements have been removed
-	newList := []string{}	// empty list
-
-	// my approach: depending upon the value and sign of count, list will be looped, elements will be removed & remaining elements will be appended to the newList
-	if count == 0 {
-		// remove all occurences of element
-		for _, v := range values {
-			if v == element {
-				removed++
-				continue
-			}
-			newList = append(newList, v)
-		}
-	} else if count > 0 {
-		for _, v := range values {
-			if count > removed && v == element {
-				removed++
-				continue
-			}
-			newList = append(newList, v)
-		}
-	} else if count < 0 {
-		targetCount := -count // making the targetCount variable positive
-
-		// below is a very inefficient method
-		for i:=length-1; i>=0; i-- {
-			if values[i] == element && targetCount > removed {
-				removed++
-				continue
-			}
-
-			// prepending the elements to maintain the order of elements in the original list
-			newList = append([]string{values[i]}, newList...)
+	removed := 0	// tracking how many elements have been removed
+	kept := make([]string, 0, values.len())
+
+	// my approach: depending upon the value and sign of count, list will be looped, elements will be removed & remaining elements will be kept
+	// count < 0 walks from the tail, so the kept elements come out back to front there
+	limit := count
+	if count < 0 {
+		limit = -count
+	}
+	values.forEach(count < 0, func(_ int, v string) bool {
+		if v == element && (limit == 0 || removed < limit) {
+			removed++
+			return true
 		}
-
-		// more efficient method
-		// reverse := make([]string, 0, length)
-
-		// // traverse from tail to head
-		// for i:=length-1; i>=0; i++ {
-		// 	v := values[i]
-		// 	if v == element && targetCount > removed {
-		// 		removed++
-		// 		continue
-		// 	}
-		// 	reverse = append(reverse, v)
-		// }
-
-		// // reverse back to original order
-		// for i:=len(reverse)-1; i>=0; i-- {
-		// 	newList = append(newList, reverse[i])
-		// }
+		kept = append(kept, v)
+		return true
+	})
+	if count < 0 {
+		slices.Reverse(kept)
 	}
 
-	// assigning the newList to the key
-	entry.Value = newList
+	// putting the remaining elements back into a fresh list, an empty list is gone
+	if removed > 0 {
+		entry, _ := r.lookup(key)
+		entry.Value = newQuicklistFrom(r.Config.ListMaxListpackSize, kept)
+		r.deleteIfEmpty(key, entry.Value.(*quicklist))
+	}
 	return removed, true
 }
 
-func(r *RedisCache) LTRIM(key string, start int, stop int) (interface{}, bool) {
+func(r *RedisCache) LTRIM(key string, start int, stop int) (bool) {
+	// command syntax: LTRIM key start stop
+	// keeps the elements from start to stop (both inclusive), the usual pattern is LPUSH + LTRIM to cap a list
+	// so only the trimmed ends are touched, whole nodes are dropped at once
+
 	// the usual checking & validation
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return nil, false
+	values, err := r.listFor(key)
+	if err != nil {
+		return false
 	}
-
-	values, isList := entry.Value.([]string)
-	if !isList {
-		return nil, false
+	if values == nil {
+		return true
 	}
 
-	length := len(values)
+	length := values.len()
 
 	// checking negative indices
 	// negative starting index
@@ -405,17 +545,131 @@ func(r *RedisCache) LTRIM(key string, start int, stop int) (interface{}, bool) {
 	}
 
 	if start > stop {
-		// empty list will be returned
-		entry.Value = []string{}
-		return entry.Value, true
+		// nothing is left, so the key goes away
+		r.deleteEntry(key)
+		return true
 	}
 
-	newList := []string{}
-	for i:=start; i<=stop; i++ {
-		newList = append(newList, values[i])
+	values.trim(true, start)
+	values.trim(false, length-1-stop)
+	return true
+}
+
+// parseBlockSeconds reads the timeout of the blocking list commands, in seconds with an optional fraction, 0 waits forever
+func parseBlockSeconds(arg []byte) (time.Duration, error) {
+	seconds, ok := parseFloat(arg)
+	if !ok || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, ErrTimeoutNotFloat
+	}
+	if seconds < 0 {
+		return 0, ErrTimeoutNegative
+	}
+	if seconds >= float64(math.MaxInt64/int64(time.Second)) {
+		return 0, ErrTimeoutOutOfRange
 	}
 
-	entry.Value = newList
-	return newList, true
+	timeout := time.Duration(seconds * float64(time.Second))
+	if seconds > 0 && timeout == 0 {
+		// too short to measure, but still not forever
+		timeout = 1
+	}
+	return timeout, nil
 }
 
+// parseListEnd reads LEFT or RIGHT, it reports true for LEFT
+func parseListEnd(arg []byte) (bool, error) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, ErrSyntax
+}
+
+// parseLMPopArgs reads "numkeys key [key ...] LEFT | RIGHT [COUNT count]" of LMPOP and BLMPOP
+func parseLMPopArgs(args [][]byte, command string) ([]string, bool, int, error) {
+	if numKeys, ok := parseInteger(args[0]); !ok || numKeys < 1 {
+		return nil, false, 0, ErrNumKeys
+	}
+
+	keys, rest, err := parseNumKeys(args, command)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	if len(rest) == 0 {
+		return nil, false, 0, ErrSyntax
+	}
+
+	left, err := parseListEnd(rest[0])
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	count := int64(1)
+	if len(rest) > 1 {
+		if len(rest) != 3 || !strings.EqualFold(string(rest[1]), "COUNT") {
+			return nil, false, 0, ErrSyntax
+		}
+		var ok bool
+		if count, ok = parseInteger(rest[2]); !ok || count < 1 {
+			return nil, false, 0, ErrCountNotPositive
+		}
+	}
+	if count > math.MaxInt32 {
+		count = math.MaxInt32
+	}
+
+	return keys, left, int(count), nil
+}
+
+func(r *RedisCache) BLMPOP(client *Client, keys []string, left bool, count int, timeout time.Duration) (string, []string, error) {
+	// command syntax: BLMPOP timeout numkeys key [key ...] LEFT | RIGHT [COUNT count]
+	// BLPOP and BRPOP are the same thing with a count of 1
+	// pops from the first key that holds a list, if none does the client waits for a push to any of them
+	// the key is "" when the timeout ran out (or right away inside MULTI/EXEC)
+	var (
+		poppedKey 	string
+		popped 		[]string
+		err 		error
+	)
+
+	serve := func(key string) bool {
+		values, listErr := r.listFor(key)
+		if listErr != nil {
+			err = listErr
+			return true
+		}
+		if values == nil {
+			return false
+		}
+
+		poppedKey, popped = key, r.popList(key, left, count)
+		return true
+	}
+
+	if !r.blockPop(client, keys, timeout, serve) {
+		return "", nil, nil
+	}
+	return poppedKey, popped, err
+}
+
+func(r *RedisCache) BLMOVE(client *Client, source string, destination string, fromLeft bool, toLeft bool, timeout time.Duration) (string, bool, error) {
+	// command syntax: BLMOVE source destination LEFT | RIGHT LEFT | RIGHT timeout
+	// ok is false when the timeout ran out before source got an element
+	var (
+		element 	string
+		err 		error
+	)
+
+	serve := func(string) bool {
+		moved, ok, moveErr := r.moveList(source, destination, fromLeft, toLeft)
+		element, err = moved, moveErr
+		return ok || moveErr != nil
+	}
+
+	if !r.blockPop(client, []string{source}, timeout, serve) {
+		return "", false, nil
+	}
+	return element, err == nil, err
+}
@@ -1 +1,608 @@
-package cache
\ No newline at end of file
+package cache
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"redis-clone/resp"
+)
+
+func TestPushAndPop(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"LPUSH", "l", "a", "b", "c"}, ":3\r\n"},
+		{[]string{"RPUSH", "l", "d"}, ":4\r\n"},
+		{[]string{"LRANGE", "l", "0", "-1"}, "*4\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nd\r\n"},
+		{[]string{"LPOP", "l"}, "$1\r\nc\r\n"},
+		{[]string{"RPOP", "l"}, "$1\r\nd\r\n"},
+		{[]string{"RPOP", "l"}, "$1\r\na\r\n"},
+		{[]string{"LPOP", "l"}, "$1\r\nb\r\n"},
+		{[]string{"LPOP", "l"}, "$-1\r\n"},
+		{[]string{"LLEN", "l"}, ":0\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"LPUSH", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"RPUSH", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"LPOP", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"LRANGE", "str", "0", "-1"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"LRANGE", "missing", "0", "-1"}, "*0\r\n"},
+		{[]string{"LRANGE", "l", "5", "1"}, "*0\r\n"},
+	});
+
+	// a popped list that ran empty is gone
+	cache.mu.Lock();
+	defer cache.mu.Unlock();
+	if _, exists := cache.store["l"]; exists {
+		t.Error("Expected the empty list to be deleted");
+	};
+}
+
+func TestCountPopsAndPushX(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"LPUSHX", "l", "a"}, ":0\r\n"},
+		{[]string{"LLEN", "l"}, ":0\r\n"},
+		{[]string{"RPUSH", "l", "a", "b", "c", "d", "e"}, ":5\r\n"},
+		{[]string{"LPUSHX", "l", "z", "y"}, ":7\r\n"},
+		{[]string{"RPUSHX", "l", "f"}, ":8\r\n"},
+		{[]string{"LPOP", "l", "3"}, "*3\r\n$1\r\ny\r\n$1\r\nz\r\n$1\r\na\r\n"},
+		{[]string{"RPOP", "l", "2"}, "*2\r\n$1\r\nf\r\n$1\r\ne\r\n"},
+		{[]string{"LPOP", "l", "0"}, "*0\r\n"},
+		{[]string{"RPOP", "l", "10"}, "*3\r\n$1\r\nd\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"LPOP", "l", "1"}, "*-1\r\n"},
+		{[]string{"LPOP", "l"}, "$-1\r\n"},
+		{[]string{"LPOP", "l", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"LPOP", "l", "1", "2"}, "-ERR wrong number of arguments for 'lpop' command\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"RPUSHX", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"RPOP", "str", "2"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestLInsertAndLPos(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"LINSERT", "l", "BEFORE", "a", "x"}, ":0\r\n"},
+		{[]string{"RPUSH", "l", "a", "b", "c", "1", "2", "3", "c", "c"}, ":8\r\n"},
+		{[]string{"LINSERT", "l", "BEFORE", "a", "start"}, ":9\r\n"},
+		{[]string{"LINSERT", "l", "AFTER", "3", "end"}, ":10\r\n"},
+		{[]string{"LINSERT", "l", "AFTER", "nope", "x"}, ":-1\r\n"},
+		{[]string{"LINSERT", "l", "NEXTTO", "a", "x"}, "-ERR syntax error\r\n"},
+		{[]string{"LRANGE", "l", "0", "2"}, "*3\r\n$5\r\nstart\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"LINDEX", "l", "7"}, "$3\r\nend\r\n"},
+
+		// start a b c 1 2 3 end c c
+		{[]string{"LPOS", "l", "c"}, ":3\r\n"},
+		{[]string{"LPOS", "l", "c", "RANK", "2"}, ":8\r\n"},
+		{[]string{"LPOS", "l", "c", "RANK", "-1"}, ":9\r\n"},
+		{[]string{"LPOS", "l", "c", "COUNT", "2"}, "*2\r\n:3\r\n:8\r\n"},
+		{[]string{"LPOS", "l", "c", "COUNT", "0"}, "*3\r\n:3\r\n:8\r\n:9\r\n"},
+		{[]string{"LPOS", "l", "c", "RANK", "-2", "COUNT", "0"}, "*2\r\n:8\r\n:3\r\n"},
+		{[]string{"LPOS", "l", "c", "COUNT", "0", "MAXLEN", "4"}, "*1\r\n:3\r\n"},
+		{[]string{"LPOS", "l", "c", "MAXLEN", "3"}, "$-1\r\n"},
+		{[]string{"LPOS", "l", "x", "COUNT", "0"}, "*0\r\n"},
+		{[]string{"LPOS", "missing", "x"}, "$-1\r\n"},
+		{[]string{"LPOS", "l", "c", "RANK", "0"}, "-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n"},
+		{[]string{"LPOS", "l", "c", "COUNT", "-1"}, "-ERR COUNT can't be negative\r\n"},
+		{[]string{"LPOS", "l", "c", "MAXLEN", "-1"}, "-ERR MAXLEN can't be negative\r\n"},
+		{[]string{"LPOS", "l", "c", "RANK"}, "-ERR syntax error\r\n"},
+		{[]string{"LPOS", "l", "c", "RANK", "x"}, "-ERR value is not an integer or out of range\r\n"},
+	});
+}
+
+func TestLMoveAndLMPop(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"RPUSH", "src", "one", "two", "three"}, ":3\r\n"},
+		{[]string{"LMOVE", "src", "dst", "RIGHT", "LEFT"}, "$5\r\nthree\r\n"},
+		{[]string{"LMOVE", "src", "dst", "LEFT", "RIGHT"}, "$3\r\none\r\n"},
+		{[]string{"RPOPLPUSH", "src", "dst"}, "$3\r\ntwo\r\n"},
+		{[]string{"LRANGE", "dst", "0", "-1"}, "*3\r\n$3\r\ntwo\r\n$5\r\nthree\r\n$3\r\none\r\n"},
+		{[]string{"LMOVE", "src", "dst", "LEFT", "LEFT"}, "$-1\r\n"},
+		// rotating a list in place
+		{[]string{"LMOVE", "dst", "dst", "LEFT", "RIGHT"}, "$3\r\ntwo\r\n"},
+		{[]string{"LRANGE", "dst", "0", "-1"}, "*3\r\n$5\r\nthree\r\n$3\r\none\r\n$3\r\ntwo\r\n"},
+		{[]string{"LMOVE", "dst", "dst", "UP", "LEFT"}, "-ERR syntax error\r\n"},
+		{[]string{"RPOPLPUSH", "dst"}, "-ERR wrong number of arguments for 'rpoplpush' command\r\n"},
+
+		{[]string{"LMPOP", "2", "missing", "dst", "RIGHT", "COUNT", "2"}, "*2\r\n$3\r\ndst\r\n*2\r\n$3\r\ntwo\r\n$3\r\none\r\n"},
+		{[]string{"LMPOP", "1", "dst", "LEFT"}, "*2\r\n$3\r\ndst\r\n*1\r\n$5\r\nthree\r\n"},
+		{[]string{"LMPOP", "1", "dst", "LEFT"}, "*-1\r\n"},
+		{[]string{"LMPOP", "0", "dst", "LEFT"}, "-ERR numkeys should be greater than 0\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"RPUSH", "src", "x"}, ":1\r\n"},
+		{[]string{"LMOVE", "src", "str", "LEFT", "LEFT"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"LLEN", "src"}, ":1\r\n"},
+		{[]string{"LMPOP", "2", "str", "src", "LEFT"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+// testing that LMOVE serves a client blocked on the destination
+func TestLMoveWakesBlockedClient(t *testing.T) {
+	cache := NewRedisServer();
+	cache.RPUSH("src", []string{"job"});
+
+	popped := make(chan resp.Value, 1);
+	go func() {
+		popped <- cache.ExecuteCommands(NewClient(nil), command("BRPOPLPUSH", "dst", "done", "0"));
+	}();
+	waitForWaiters(t, cache, "dst", 1);
+
+	cache.ExecuteCommands(NewClient(nil), command("LMOVE", "src", "dst", "LEFT", "LEFT"));
+
+	select {
+	case reply := <-popped:
+		if reply.Str != "job" {
+			t.Errorf("Expected the blocked client to get job, but got %#v", reply);
+		};
+	case <-time.After(time.Second):
+		t.Fatal("BRPOPLPUSH did not wake up after LMOVE");
+	};
+
+	runSteps(t, cache, []step{
+		{[]string{"LRANGE", "done", "0", "-1"}, "*1\r\n$3\r\njob\r\n"},
+		{[]string{"LLEN", "dst"}, ":0\r\n"},
+	});
+}
+
+func TestBlockingPopsWithData(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"RPUSH", "b", "1", "2", "3"}, ":3\r\n"},
+		{[]string{"BLPOP", "a", "b", "0"}, "*2\r\n$1\r\nb\r\n$1\r\n1\r\n"},
+		{[]string{"BRPOP", "a", "b", "0"}, "*2\r\n$1\r\nb\r\n$1\r\n3\r\n"},
+		{[]string{"BLMPOP", "0", "2", "a", "b", "LEFT", "COUNT", "5"}, "*2\r\n$1\r\nb\r\n*1\r\n$1\r\n2\r\n"},
+		{[]string{"BLPOP", "a", "b", "0.01"}, "*-1\r\n"},
+		{[]string{"BLMPOP", "0.01", "1", "a", "RIGHT"}, "*-1\r\n"},
+
+		{[]string{"RPUSH", "src", "x", "y"}, ":2\r\n"},
+		{[]string{"BLMOVE", "src", "dst", "RIGHT", "LEFT", "0"}, "$1\r\ny\r\n"},
+		{[]string{"BLMOVE", "src", "src", "LEFT", "RIGHT", "0"}, "$1\r\nx\r\n"},
+		{[]string{"LRANGE", "dst", "0", "-1"}, "*1\r\n$1\r\ny\r\n"},
+		{[]string{"BLMOVE", "missing", "dst", "LEFT", "LEFT", "0.01"}, "*-1\r\n"},
+
+		{[]string{"BLPOP", "a", "-1"}, "-ERR timeout is negative\r\n"},
+		{[]string{"BLPOP", "a", "soon"}, "-ERR timeout is not a float or out of range\r\n"},
+		{[]string{"BLPOP", "a", "inf"}, "-ERR timeout is not a float or out of range\r\n"},
+		{[]string{"BLPOP", "a", "1e300"}, "-ERR timeout is out of range\r\n"},
+		{[]string{"BLPOP", "a"}, "-ERR wrong number of arguments for 'blpop' command\r\n"},
+		{[]string{"BLMPOP", "0", "0", "a", "LEFT"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"BLMPOP", "0", "1", "a", "UP"}, "-ERR syntax error\r\n"},
+		{[]string{"BLMPOP", "0", "1", "a", "LEFT", "COUNT", "0"}, "-ERR count should be greater than 0\r\n"},
+		{[]string{"BLMPOP", "0", "3", "a", "LEFT"}, "-ERR syntax error\r\n"},
+		{[]string{"BLMOVE", "src", "dst", "UP", "LEFT", "0"}, "-ERR syntax error\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"BLPOP", "str", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"BLMOVE", "dst", "str", "LEFT", "LEFT", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"LLEN", "dst"}, ":1\r\n"},
+	});
+}
+
+// waitForWaiters waits until exactly n clients are blocked on key
+func waitForWaiters(t *testing.T, cache *RedisCache, key string, n int) {
+	t.Helper();
+	for deadline := time.Now().Add(time.Second); ; {
+		cache.mu.Lock();
+		waiting := len(cache.waiters[key]);
+		cache.mu.Unlock();
+		if waiting == n {
+			return;
+		};
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d clients blocked on %s, but got %d", n, key, waiting);
+		};
+		time.Sleep(time.Millisecond);
+	};
+}
+
+// testing that blocked clients are served in the order they started waiting
+func TestBlockingPopFIFO(t *testing.T) {
+	cache := NewRedisServer();
+
+	replies := make([]chan resp.Value, 3);
+	for i := range replies {
+		replies[i] = make(chan resp.Value, 1);
+		go func(reply chan resp.Value) {
+			reply <- cache.ExecuteCommands(NewClient(nil), command("BLPOP", "other", "queue", "0"));
+		}(replies[i]);
+		waitForWaiters(t, cache, "queue", i+1);
+	};
+
+	cache.ExecuteCommands(NewClient(nil), command("RPUSH", "queue", "a", "b"));
+	cache.ExecuteCommands(NewClient(nil), command("LPUSH", "other", "c"));
+
+	for i, expected := range []string{"*2\r\n$5\r\nqueue\r\n$1\r\na\r\n", "*2\r\n$5\r\nqueue\r\n$1\r\nb\r\n", "*2\r\n$5\r\nother\r\n$1\r\nc\r\n"} {
+		select {
+		case reply := <-replies[i]:
+			if got := string(resp.Encode(reply, resp.RESP2)); got != expected {
+				t.Errorf("Client %d: expected %q, but got %q", i, expected, got);
+			};
+		case <-time.After(time.Second):
+			t.Fatalf("Client %d never got its element", i);
+		};
+	};
+
+	cache.mu.Lock();
+	defer cache.mu.Unlock();
+	if len(cache.waiters) != 0 || len(cache.store) != 0 {
+		t.Errorf("Expected no waiters and no keys left, but got %v and %v", cache.waiters, cache.store);
+	};
+}
+
+// testing that a blocked BLMOVE hands its element on to a client blocked on the destination
+func TestBlockingMoveChain(t *testing.T) {
+	cache := NewRedisServer();
+
+	moved := make(chan resp.Value, 1);
+	popped := make(chan resp.Value, 1);
+	go func() {
+		moved <- cache.ExecuteCommands(NewClient(nil), command("BLMOVE", "src", "dst", "LEFT", "RIGHT", "0"));
+	}();
+	waitForWaiters(t, cache, "src", 1);
+	go func() {
+		popped <- cache.ExecuteCommands(NewClient(nil), command("BRPOP", "dst", "0"));
+	}();
+	waitForWaiters(t, cache, "dst", 1);
+
+	cache.ExecuteCommands(NewClient(nil), command("LPUSH", "src", "job"));
+
+	for _, c := range []struct{ replies chan resp.Value; expected string }{
+		{moved, "$3\r\njob\r\n"},
+		{popped, "*2\r\n$3\r\ndst\r\n$3\r\njob\r\n"},
+	} {
+		select {
+		case reply := <-c.replies:
+			if got := string(resp.Encode(reply, resp.RESP2)); got != c.expected {
+				t.Errorf("Expected %q, but got %q", c.expected, got);
+			};
+		case <-time.After(time.Second):
+			t.Fatal("The blocked clients were not served");
+		};
+	};
+}
+
+// testing that blocking pops inside MULTI/EXEC return right away
+func TestBlockingPopInTransaction(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	client.inExec = true;
+	for _, c := range []struct{ cmd []string; expected string }{
+		{[]string{"BLPOP", "l", "0"}, "*-1\r\n"},
+		{[]string{"BLMPOP", "0", "1", "l", "LEFT"}, "*-1\r\n"},
+		{[]string{"BLMOVE", "l", "m", "LEFT", "LEFT", "0"}, "$-1\r\n"},
+	} {
+		if got := string(resp.Encode(cache.ExecuteCommands(client, command(c.cmd...)), resp.RESP2)); got != c.expected {
+			t.Errorf("%q: expected %q, but got %q", c.cmd, c.expected, got);
+		};
+	};
+
+	cache.mu.Lock();
+	defer cache.mu.Unlock();
+	if len(cache.waiters) != 0 {
+		t.Errorf("Expected no waiters, but got %v", cache.waiters);
+	};
+}
+
+// testing that a fractional timeout is honoured
+func TestBlockingPopTimeout(t *testing.T) {
+	cache := NewRedisServer();
+
+	start := time.Now();
+	reply := cache.ExecuteCommands(NewClient(nil), command("BLPOP", "l", "0.05"));
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("Expected BLPOP to wait about 50ms, but it took %v", elapsed);
+	};
+	if reply.Kind != resp.KindNullArray {
+		t.Errorf("Expected a null array, but got %#v", reply);
+	};
+}
+
+// testing that a client that disconnects while blocked does not swallow the next element
+func TestBlockedClientDisconnect(t *testing.T) {
+	cache := NewRedisServer();
+
+	server, conn := net.Pipe();
+	done := make(chan struct{});
+	go func() {
+		cache.HandleConnection(NewClient(server));
+		close(done);
+	}();
+
+	conn.Write([]byte("BLPOP l 0\r\n"));
+	waitForWaiters(t, cache, "l", 1);
+	conn.Close();
+	waitForWaiters(t, cache, "l", 0);
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The connection of the blocked client was not closed");
+	};
+
+	cache.mu.Lock();
+	waiting := len(cache.waiters);
+	cache.mu.Unlock();
+	if waiting != 0 {
+		t.Fatalf("Expected the disconnected client to stop waiting");
+	};
+
+	runSteps(t, cache, []step{
+		{[]string{"RPUSH", "l", "a"}, ":1\r\n"},
+		{[]string{"LLEN", "l"}, ":1\r\n"},
+	});
+}
+
+// testing that commands pipelined behind a blocked one run after it replied
+func TestBlockedClientPipeline(t *testing.T) {
+	cache := NewRedisServer();
+
+	server, conn := net.Pipe();
+	defer conn.Close();
+	go cache.HandleConnection(NewClient(server));
+
+	replies := make(chan string, 1);
+	go func() {
+		expected := "*2\r\n$1\r\nl\r\n$1\r\na\r\n+PONG\r\n";
+		buf := make([]byte, len(expected));
+		io.ReadFull(bufio.NewReader(conn), buf);
+		replies <- string(buf);
+	}();
+
+	conn.Write([]byte("BLPOP l 0\r\nPING\r\n"));
+	waitForWaiters(t, cache, "l", 1);
+	cache.ExecuteCommands(NewClient(nil), command("RPUSH", "l", "a"));
+
+	select {
+	case got := <-replies:
+		if got != "*2\r\n$1\r\nl\r\n$1\r\na\r\n+PONG\r\n" {
+			t.Errorf("Unexpected replies %q", got);
+		};
+	case <-time.After(time.Second):
+		t.Fatal("The blocked client never replied");
+	};
+}
+
+// checks every node against the fill limit and the links and counters against each other
+func checkQuicklist(t *testing.T, ql *quicklist) {
+	t.Helper();
+
+	count, nodes := 0, 0;
+	var prev *quicklistNode;
+	for n := ql.head; n != nil; n = n.next {
+		if n.prev != prev {
+			t.Fatalf("Node %d has a broken prev link", nodes);
+		};
+		if n.len() == 0 {
+			t.Fatalf("Node %d is empty", nodes);
+		};
+		if ql.fill > 0 && n.len() > ql.fill {
+			t.Fatalf("Node %d holds %d entries, the limit is %d", nodes, n.len(), ql.fill);
+		};
+		bytes := 0;
+		for _, v := range n.entries() {
+			bytes += entrySize(v);
+		};
+		if bytes != n.bytes {
+			t.Fatalf("Node %d counts %d bytes, but holds %d", nodes, n.bytes, bytes);
+		};
+		count += n.len();
+		nodes++;
+		prev = n;
+	};
+
+	if prev != ql.tail || count != ql.count || nodes != ql.nodes {
+		t.Fatalf("Quicklist reports %d entries in %d nodes, but holds %d in %d", ql.count, ql.nodes, count, nodes);
+	};
+}
+
+// testing the quicklist against a plain slice, with small nodes so that every operation crosses node borders
+func TestQuicklistMatchesSlice(t *testing.T) {
+	for _, fill := range []int{1, 3, 16, -1} {
+		ql := newQuicklist(fill);
+		var model []string;
+		rng := rand.New(rand.NewSource(int64(fill) + 10));
+
+		for i := 0; i < 20000; i++ {
+			v := strconv.Itoa(i);
+			if rng.Intn(50) == 0 {
+				v = strings.Repeat("x", 5000); // bigger than a 4 KB node
+			};
+
+			switch op := rng.Intn(10); {
+			case op < 3:
+				ql.push(true, v);
+				model = append([]string{v}, model...);
+			case op < 6:
+				ql.push(false, v);
+				model = append(model, v);
+			case op < 8 && len(model) > 0:
+				left := op == 6;
+				got := ql.pop(left);
+				var want string;
+				if left {
+					want, model = model[0], model[1:];
+				} else {
+					want, model = model[len(model)-1], model[:len(model)-1];
+				};
+				if got != want {
+					t.Fatalf("fill %d, step %d: popped %q, expected %q", fill, i, got, want);
+				};
+			case op == 8:
+				index := rng.Intn(len(model) + 1);
+				ql.insert(index, v);
+				model = slices.Insert(model, index, v);
+			case len(model) > 0:
+				index := rng.Intn(len(model));
+				ql.set(index, v);
+				model[index] = v;
+			};
+		};
+
+		checkQuicklist(t, ql);
+		if got := ql.values(); !slices.Equal(got, model) {
+			t.Fatalf("fill %d: the quicklist holds %d entries that differ from the %d expected", fill, len(got), len(model));
+		};
+		for i := range model {
+			if got := ql.get(i); got != model[i] {
+				t.Fatalf("fill %d: index %d is %q, expected %q", fill, i, got, model[i]);
+			};
+		};
+		if len(model) > 10 {
+			if got := ql.rangeValues(3, len(model)-4); !slices.Equal(got, model[3:len(model)-3]) {
+				t.Fatalf("fill %d: wrong range", fill);
+			};
+		};
+
+		ql.trim(true, 5);
+		ql.trim(false, 7);
+		model = model[5 : len(model)-7];
+		checkQuicklist(t, ql);
+		if got := ql.values(); !slices.Equal(got, model) {
+			t.Fatalf("fill %d: wrong entries after trimming", fill);
+		};
+	};
+}
+
+// a worker queue that never drains: pushed at the tail and popped at the head, the node buffer must not keep growing
+func TestQueueBufferStaysBounded(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+	for i := 0; i < 10; i++ {
+		cache.ExecuteCommands(client, command("RPUSH", "queue", strconv.Itoa(i)));
+	};
+
+	for i := 0; i < 200000; i++ {
+		cache.ExecuteCommands(client, command("RPUSH", "queue", strconv.Itoa(i)));
+		cache.ExecuteCommands(client, command("LPOP", "queue"));
+
+		if i%1000 == 0 {
+			head := cache.store["queue"].Value.(*quicklist).head;
+			if cap(head.buf) > 64 {
+				t.Fatalf("After %d pushes and pops the head node has room for %d entries, it holds %d", i, cap(head.buf), head.len());
+			};
+		};
+	};
+	runSteps(t, cache, []step{
+		{[]string{"LLEN", "queue"}, ":10\r\n"},
+	});
+}
+
+func TestListCommandsAcrossNodes(t *testing.T) {
+	cache := NewRedisServer();
+	cache.Config.ListMaxListpackSize = 4;
+
+	runSteps(t, cache, []step{
+		{[]string{"RPUSH", "l", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, ":10\r\n"},
+		{[]string{"LINDEX", "l", "5"}, "$1\r\nf\r\n"},
+		{[]string{"LINDEX", "l", "-2"}, "$1\r\ni\r\n"},
+		{[]string{"LSET", "l", "7", "H"}, "+OK\r\n"},
+		{[]string{"LINSERT", "l", "AFTER", "c", "c2"}, ":11\r\n"},
+		{[]string{"LRANGE", "l", "2", "8"}, "*7\r\n$1\r\nc\r\n$2\r\nc2\r\n$1\r\nd\r\n$1\r\ne\r\n$1\r\nf\r\n$1\r\ng\r\n$1\r\nH\r\n"},
+		{[]string{"LREM", "l", "-1", "c2"}, ":1\r\n"},
+		{[]string{"LTRIM", "l", "1", "-2"}, "+OK\r\n"},
+		{[]string{"LRANGE", "l", "0", "-1"}, "*8\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\ne\r\n$1\r\nf\r\n$1\r\ng\r\n$1\r\nH\r\n$1\r\ni\r\n"},
+		{[]string{"LPOS", "l", "H"}, ":6\r\n"},
+		{[]string{"LREM", "l", "0", "b"}, ":1\r\n"},
+		{[]string{"LTRIM", "l", "5", "1"}, "+OK\r\n"},
+		{[]string{"LLEN", "l"}, ":0\r\n"},
+		{[]string{"RPUSH", "l", "x"}, ":1\r\n"},
+		{[]string{"LREM", "l", "0", "x"}, ":1\r\n"},
+		// the emptied list is gone, so a blocking pop has to wait instead of popping nothing
+		{[]string{"BLPOP", "l", "0.01"}, "*-1\r\n"},
+	});
+}
+
+// a million element list, built the way a queue producer would
+func benchmarkList(n int) *RedisCache {
+	cache := NewRedisServer();
+	batch := make([]string, 0, 1000);
+	for i := 0; i < n; i++ {
+		batch = append(batch, "job:"+strconv.Itoa(i));
+		if len(batch) == cap(batch) {
+			cache.RPUSH("queue", batch);
+			batch = batch[:0];
+		};
+	};
+	return cache;
+}
+
+// go test ./cache -run '^$' -bench List
+func BenchmarkListLPushOnLargeList(b *testing.B) {
+	cache := benchmarkList(1000000);
+	b.ResetTimer();
+
+	for i := 0; i < b.N; i++ {
+		cache.LPUSH("queue", "job");
+	};
+}
+
+func BenchmarkListLPushManyValues(b *testing.B) {
+	cache := NewRedisServer();
+	values := make([]string, 100);
+	for i := range values {
+		values[i] = "job:" + strconv.Itoa(i);
+	};
+	b.ResetTimer();
+
+	for i := 0; i < b.N; i++ {
+		cache.LPUSH("queue", values...);
+	};
+}
+
+// a work queue: producers push at the tail, workers pop at the head
+func BenchmarkListQueue(b *testing.B) {
+	cache := benchmarkList(1000000);
+	b.ResetTimer();
+
+	for i := 0; i < b.N; i++ {
+		cache.RPUSH("queue", []string{"job"});
+		cache.LPOP("queue", 1);
+	};
+}
+
+func BenchmarkListLPopRPop(b *testing.B) {
+	cache := benchmarkList(1000000);
+	b.ResetTimer();
+
+	for i := 0; i < b.N; i++ {
+		cache.LPUSH("queue", "a", "b");
+		cache.LPOP("queue", 1);
+		cache.RPOP("queue", 1);
+	};
+}
+
+func BenchmarkListLIndex(b *testing.B) {
+	cache := benchmarkList(1000000);
+	rng := rand.New(rand.NewSource(1));
+	b.ResetTimer();
+
+	for i := 0; i < b.N; i++ {
+		cache.LINDEX("queue", rng.Intn(1000000));
+	};
+}
+
+func BenchmarkListLSet(b *testing.B) {
+	cache := benchmarkList(1000000);
+	rng := rand.New(rand.NewSource(1));
+	b.ResetTimer();
+
+	for i := 0; i < b.N; i++ {
+		cache.LSET("queue", rng.Intn(1000000), "updated");
+	};
+}
@@ -0,0 +1,47 @@
+package cache
+
+// commands needed to be implemented:
+// OBJECT ENCODING key		--> Done
+
+// the longest string Redis keeps in the same allocation as its object header, longer ones are "raw"
+const embstrSizeLimit = 44
+
+// objectEncoding names how the value of entry is stored, with the names Redis uses
+func objectEncoding(entry *Entry) string {
+	switch value := entry.Value.(type) {
+	case int64:
+		return "int"
+	case []byte:
+		if len(value) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case *quicklist:
+		// a list that fits into a single node is a plain listpack in Redis
+		if value.nodes <= 1 {
+			return "listpack"
+		}
+		return "quicklist"
+	case *redisSet:
+		return value.encoding()
+	case *redisHash:
+		return value.encoding()
+	case *sortedSet:
+		return value.encoding()
+	case *stream:
+		return "stream"
+	}
+	return "unknown"
+}
+
+func(r *RedisCache) OBJECTENCODING(key string) (string, bool) {
+	// command syntax: OBJECT ENCODING key --> ok is false if the key does not exist
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return "", false
+	}
+	return objectEncoding(entry), true
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	cache := NewRedisServer();
+	cache.Config.ListMaxListpackSize = 2;
+
+	runSteps(t, cache, []step{
+		{[]string{"SET", "n", "12345"}, "+OK\r\n"},
+		{[]string{"OBJECT", "ENCODING", "n"}, "$3\r\nint\r\n"},
+		{[]string{"SET", "short", "hello"}, "+OK\r\n"},
+		{[]string{"OBJECT", "ENCODING", "short"}, "$6\r\nembstr\r\n"},
+		{[]string{"SET", "long", strings.Repeat("x", 45)}, "+OK\r\n"},
+		{[]string{"OBJECT", "ENCODING", "long"}, "$3\r\nraw\r\n"},
+		{[]string{"RPUSH", "list", "a", "b"}, ":2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "list"}, "$8\r\nlistpack\r\n"},
+		{[]string{"RPUSH", "list", "c"}, ":3\r\n"},
+		{[]string{"OBJECT", "ENCODING", "list"}, "$9\r\nquicklist\r\n"},
+		{[]string{"XADD", "s", "1-1", "f", "v"}, "$3\r\n1-1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "s"}, "$6\r\nstream\r\n"},
+		{[]string{"OBJECT", "encoding", "missing"}, "$-1\r\n"},
+		{[]string{"OBJECT", "NOPE", "n"}, "-ERR unknown subcommand 'NOPE'. Try OBJECT HELP.\r\n"},
+		{[]string{"OBJECT", "ENCODING"}, "-ERR wrong number of arguments for 'object|encoding' command\r\n"},
+		{[]string{"OBJECT"}, "-ERR wrong number of arguments for 'object' command\r\n"},
+	});
+}
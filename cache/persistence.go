@@ -1,23 +1,145 @@
 package cache
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"redis-clone/resp"
 )
 
+// snapshot format, version 2:
+// {
+//  "version": 2,
+//  "keys": [
+//   {"key": "hello", "type": "string", "value": "world", "expiryTime": "0001-01-01T00:00:00Z"},
+//   {"key": "blob", "type": "string", "value": {"base64": "AP8NCg=="}, "expiryTime": "0001-01-01T00:00:00Z"}
+//  ]
+// }
+// version 1 was json.MarshalIndent(r.store) directly: JSON strings cannot hold arbitrary bytes, invalid UTF-8
+// was silently replaced with U+FFFD and list/hash members went through fmt.Sprintf("%v") on the way back in
+// now every key and value is a binaryString: plain JSON text when it is valid UTF-8 (so dumps stay readable),
+// {"base64": "..."} otherwise, and both forms round-trip any byte sequence exactly
+const snapshotVersion = 2
+
+type snapshot struct {
+	Version int             `json:"version"`
+	Keys    []snapshotEntry `json:"keys"`
+}
+
+type snapshotEntry struct {
+	Key        binaryString    `json:"key"`
+	Type       string          `json:"type"`
+	Value      json.RawMessage `json:"value"`
+	ExpiryTime time.Time       `json:"expiryTime"`
+}
+
+// a stream is saved together with the IDs that are not part of any entry, so XADD continues where it left off after a restart
+// {"lastId": "5-1", "maxDeletedId": "0-0", "entriesAdded": 3, "entries": [{"id": "5-0", "fields": ["field", "value"]}, ...]}
+type savedStream struct {
+	LastID       string             `json:"lastId"`
+	MaxDeletedID string             `json:"maxDeletedId"`
+	EntriesAdded uint64             `json:"entriesAdded"`
+	Entries      []savedStreamEntry `json:"entries"`
+	Groups       []savedGroup       `json:"groups,omitempty"`
+}
+
+type savedStreamEntry struct {
+	ID     string         `json:"id"`
+	Fields []binaryString `json:"fields"`
+}
+
+// a consumer group keeps its pending entries list, the consumers' own lists are rebuilt from it when loading
+type savedGroup struct {
+	Name        binaryString    `json:"name"`
+	LastID      string          `json:"lastId"`
+	EntriesRead int64           `json:"entriesRead"`
+	Consumers   []savedConsumer `json:"consumers"`
+	Pending     []savedPending  `json:"pending"`
+}
+
+type savedConsumer struct {
+	Name       binaryString `json:"name"`
+	SeenTime   int64        `json:"seenTime"`
+	ActiveTime int64        `json:"activeTime"`
+}
+
+type savedPending struct {
+	ID            string       `json:"id"`
+	Consumer      binaryString `json:"consumer"`
+	DeliveryTime  int64        `json:"deliveryTime"`
+	DeliveryCount int64        `json:"deliveryCount"`
+}
+
+// binaryString is how every key, value and member is written to disk
+type binaryString []byte
+
+func (b binaryString) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *binaryString) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = binaryString(text)
+		return nil
+	}
+
+	var encoded struct {
+		Base64 *string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil || encoded.Base64 == nil {
+		return fmt.Errorf("expected a string or {\"base64\": ...}, got %s", data)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(*encoded.Base64)
+	if err != nil {
+		return err
+	}
+	*b = binaryString(decoded)
+	return nil
+}
+
 func(r *RedisCache) SaveToDisk(filename string) error {
 	// locking the store
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// json.MarshalIndent() is used to encode Go data structures (like structs, maps or slices) into JSON formatted data, with human-readable indentation
-	// advantages: Debugging and logging data; Generating configuration files & Displaying readable API responses to the user
-	// json.MarshalIndent() makes the response more human-readable than json.Marshal()
+	// converting the data inside r.store into the snapshot format
+	// keys are sorted so that saving the same data twice produces the same file
+	keys := make([]string, 0, len(r.store))
+	for key := range r.store {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	snap := snapshot{Version: snapshotVersion, Keys: make([]snapshotEntry, 0, len(keys))}
+	for _, key := range keys {
+		entry := r.store[key]
+		value, err := encodeValue(entry)
+		if err != nil {
+			return fmt.Errorf("saving key %q: %w", key, err)
+		}
+
+		snap.Keys = append(snap.Keys, snapshotEntry{
+			Key: binaryString(key),
+			Type: entry.Type,
+			Value: value,
+			ExpiryTime: entry.ExpiryTime,
+		})
+	}
 
-	// converting the data inside r.store into a human-readable format
-	data, err := json.MarshalIndent(r.store, "", " ")
+	// json.MarshalIndent() makes the response more human-readable than json.Marshal()
+	data, err := json.MarshalIndent(snap, "", " ")
 	if err != nil {
 		return err
 	}
@@ -47,53 +169,344 @@ func(r *RedisCache) LoadData(filename string) error {
 		return err
 	}
 
+	var top map[string]json.RawMessage
+	if loadErr := json.Unmarshal(content, &top); loadErr != nil {
+		return loadErr
+	}
+
+	// a version 1 dump is a plain key -> entry object, a version 2 dump has a numeric "version" next to "keys"
+	var version int
+	if raw, ok := top["version"]; !ok || json.Unmarshal(raw, &version) != nil {
+		return r.loadLegacyData(content)
+	}
+
+	if version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	var snap snapshot
+	if loadErr := json.Unmarshal(content, &snap); loadErr != nil {
+		return loadErr
+	}
+
+	store := make(map[string]*Entry, len(snap.Keys))
+	for _, saved := range snap.Keys {
+		value, err := r.decodeValue(saved.Type, saved.Value)
+		if err != nil {
+			return fmt.Errorf("loading key %q: %w", saved.Key, err)
+		}
+
+		store[string(saved.Key)] = &Entry{Type: saved.Type, Value: value, ExpiryTime: saved.ExpiryTime}
+	}
+
+	r.mu.Lock()
+	r.store, r.keys = store, newScanIndexOf(store)
+	r.mu.Unlock()
+	return nil
+}
+
+// encodeValue converts the in-memory value of an entry into its snapshot form
+func encodeValue(entry *Entry) (json.RawMessage, error) {
+	switch entry.Type {
+	case "string":
+		value, ok := stringBytes(entry.Value)
+		if !ok {
+			return nil, fmt.Errorf("string entry holds %T", entry.Value)
+		}
+		return json.Marshal(binaryString(value))
+
+	case "list":
+		list, ok := entry.Value.(*quicklist)
+		if !ok {
+			return nil, fmt.Errorf("list entry holds %T", entry.Value)
+		}
+		items := make([]binaryString, 0, list.len())
+		list.forEach(false, func(_ int, item string) bool {
+			items = append(items, binaryString(item))
+			return true
+		})
+		return json.Marshal(items)
+
+	case "set":
+		set, ok := entry.Value.(*redisSet)
+		if !ok {
+			return nil, fmt.Errorf("set entry holds %T", entry.Value)
+		}
+		members := set.members()
+		sort.Strings(members)
+
+		saved := make([]binaryString, len(members))
+		for i, member := range members {
+			saved[i] = binaryString(member)
+		}
+		return json.Marshal(saved)
+
+	case "hash":
+		hash, ok := entry.Value.(*redisHash)
+		if !ok {
+			return nil, fmt.Errorf("hash entry holds %T", entry.Value)
+		}
+		fields := hash.fields()
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Field < fields[j].Field
+		})
+
+		// [[field, value], [field, value], ...] since a JSON object key could not hold arbitrary bytes
+		// a field with a TTL has its expiry time in unix milliseconds as a third element: [field, value, expiry]
+		pairs := make([][]binaryString, len(fields))
+		for i, f := range fields {
+			pairs[i] = []binaryString{binaryString(f.Field), binaryString(f.Value)}
+			if at, hasTTL := hash.ttl(f.Field); hasTTL {
+				pairs[i] = append(pairs[i], binaryString(strconv.FormatInt(at.UnixMilli(), 10)))
+			}
+		}
+		return json.Marshal(pairs)
+
+	case "zset":
+		zset, ok := entry.Value.(*sortedSet)
+		if !ok {
+			return nil, fmt.Errorf("zset entry holds %T", entry.Value)
+		}
+
+		// [[member, score], ...] in score order, the score is written as text because JSON numbers cannot be inf
+		pairs := make([][2]binaryString, 0, zset.len())
+		for _, m := range zset.members() {
+			pairs = append(pairs, [2]binaryString{binaryString(m.Member), binaryString(resp.FormatDouble(m.Score))})
+		}
+		return json.Marshal(pairs)
+
+	case "stream":
+		s, ok := entry.Value.(*stream)
+		if !ok {
+			return nil, fmt.Errorf("stream entry holds %T", entry.Value)
+		}
+
+		saved := savedStream{
+			LastID: s.lastID.String(),
+			MaxDeletedID: s.maxDeletedID.String(),
+			EntriesAdded: s.entriesAdded,
+			Entries: make([]savedStreamEntry, len(s.entries)),
+		}
+		for i, e := range s.entries {
+			fields := make([]binaryString, len(e.Fields))
+			for j, field := range e.Fields {
+				fields[j] = binaryString(field)
+			}
+			saved.Entries[i] = savedStreamEntry{ID: e.ID.String(), Fields: fields}
+		}
+		for _, name := range sortedGroupNames(s) {
+			g := s.groups[name]
+			group := savedGroup{Name: binaryString(name), LastID: g.lastID.String(), EntriesRead: g.entriesRead}
+			for _, c := range sortedConsumers(g) {
+				group.Consumers = append(group.Consumers, savedConsumer{Name: binaryString(c.name), SeenTime: c.seenTime, ActiveTime: c.activeTime})
+			}
+			for _, id := range sortedIDs(g.pel) {
+				p := g.pel[id]
+				group.Pending = append(group.Pending, savedPending{
+					ID: id.String(),
+					Consumer: binaryString(p.consumer.name),
+					DeliveryTime: p.deliveryTime,
+					DeliveryCount: p.deliveryCount,
+				})
+			}
+			saved.Groups = append(saved.Groups, group)
+		}
+		return json.Marshal(saved)
+	}
+
+	return nil, fmt.Errorf("unknown entry type %q", entry.Type)
+}
+
+// decodeValue is the inverse of encodeValue, lists are rebuilt with the configured node size
+func(r *RedisCache) decodeValue(entryType string, raw json.RawMessage) (interface{}, error) {
+	switch entryType {
+	case "string":
+		var value binaryString
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		// an empty string is still a string, not a missing value
+		if value == nil {
+			value = binaryString{}
+		}
+		return newStringValue(value), nil
+
+	case "list":
+		var items []binaryString
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		list := newQuicklist(r.Config.ListMaxListpackSize)
+		for _, item := range items {
+			list.push(false, string(item))
+		}
+		return list, nil
+
+	case "set":
+		var members []binaryString
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, err
+		}
+		// the encoding is picked again from what the set holds, just like when it was built by SADD
+		set := newRedisSet(&r.Config)
+		for _, member := range members {
+			set.add(string(member))
+		}
+		return set, nil
+
+	case "hash":
+		var pairs [][]binaryString
+		if err := json.Unmarshal(raw, &pairs); err != nil {
+			return nil, err
+		}
+		// fields that expired while the server was down are loaded anyway, lookup drops them like expired keys
+		hash := newRedisHash(&r.Config)
+		for _, pair := range pairs {
+			if len(pair) != 2 && len(pair) != 3 {
+				return nil, fmt.Errorf("hash field with %d elements", len(pair))
+			}
+			hash.set(string(pair[0]), string(pair[1]))
+
+			if len(pair) == 3 {
+				ms, ok := parseInteger(pair[2])
+				if !ok {
+					return nil, fmt.Errorf("invalid expiry time %q for hash field", pair[2])
+				}
+				hash.setTTL(string(pair[0]), time.UnixMilli(ms))
+			}
+		}
+		return hash, nil
+
+	case "zset":
+		var pairs [][2]binaryString
+		if err := json.Unmarshal(raw, &pairs); err != nil {
+			return nil, err
+		}
+		zset := newSortedSet(&r.Config)
+		for _, pair := range pairs {
+			score, ok := parseFloat(pair[1])
+			if !ok {
+				return nil, fmt.Errorf("invalid score %q for member %q", pair[1], pair[0])
+			}
+			zset.set(string(pair[0]), score)
+		}
+		return zset, nil
+
+	case "stream":
+		var saved savedStream
+		if err := json.Unmarshal(raw, &saved); err != nil {
+			return nil, err
+		}
+
+		s := newStream()
+		s.entriesAdded = saved.EntriesAdded
+
+		var ok bool
+		if s.lastID, ok = parseStreamID([]byte(saved.LastID), 0); !ok {
+			return nil, fmt.Errorf("invalid last ID %q", saved.LastID)
+		}
+		if s.maxDeletedID, ok = parseStreamID([]byte(saved.MaxDeletedID), 0); !ok {
+			return nil, fmt.Errorf("invalid max deleted ID %q", saved.MaxDeletedID)
+		}
+
+		s.entries = make([]StreamEntry, len(saved.Entries))
+		for i, e := range saved.Entries {
+			id, ok := parseStreamID([]byte(e.ID), 0)
+			if !ok {
+				return nil, fmt.Errorf("invalid entry ID %q", e.ID)
+			}
+			fields := make([]string, len(e.Fields))
+			for j, field := range e.Fields {
+				fields[j] = string(field)
+			}
+			s.entries[i] = StreamEntry{ID: id, Fields: fields}
+		}
+
+		if len(saved.Groups) > 0 {
+			s.groups = make(map[string]*consumerGroup, len(saved.Groups))
+		}
+		for _, saved := range saved.Groups {
+			lastID, ok := parseStreamID([]byte(saved.LastID), 0)
+			if !ok {
+				return nil, fmt.Errorf("invalid last ID %q for group %q", saved.LastID, saved.Name)
+			}
+			g := newConsumerGroup(lastID, saved.EntriesRead)
+			for _, c := range saved.Consumers {
+				g.consumers[string(c.Name)] = &consumer{
+					name: string(c.Name),
+					seenTime: c.SeenTime,
+					activeTime: c.ActiveTime,
+					pending: make(map[StreamID]*pendingEntry),
+				}
+			}
+			for _, p := range saved.Pending {
+				id, ok := parseStreamID([]byte(p.ID), 0)
+				if !ok {
+					return nil, fmt.Errorf("invalid pending ID %q for group %q", p.ID, saved.Name)
+				}
+				c, exists := g.consumers[string(p.Consumer)]
+				if !exists {
+					return nil, fmt.Errorf("pending entry %s belongs to unknown consumer %q", p.ID, p.Consumer)
+				}
+				entry := &pendingEntry{consumer: c, deliveryTime: p.DeliveryTime, deliveryCount: p.DeliveryCount}
+				g.pel[id] = entry
+				c.pending[id] = entry
+			}
+			s.groups[string(saved.Name)] = g
+		}
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("unknown entry type %q", entryType)
+}
+
+// loadLegacyData reads the version 1 format, where the file was json.MarshalIndent(r.store)
+// everything in there is plain JSON text already, so no bytes can be lost by reading it
+func(r *RedisCache) loadLegacyData(content []byte) error {
 	var store map[string]*Entry
 	if loadErr := json.Unmarshal(content, &store); loadErr != nil {
 		return loadErr
 	}
 
-	for key, entry := range store {
+	for _, entry := range store {
 		switch entry.Type {
 		case "string":
 			rawString, ok := entry.Value.(string)
 			if ok {
-				// strValue := rawString.(string)
-				entry.Value = rawString
+				entry.Value = newStringValue([]byte(rawString))
 			}
 		case "list":
 			rawList, ok := entry.Value.([]interface{})
 			if ok {
-				strList := make([]string, len(rawList))
-				for i, v := range rawList {
-					strList[i] = fmt.Sprintf("%v", v)
+				list := newQuicklist(r.Config.ListMaxListpackSize)
+				for _, v := range rawList {
+					list.push(false, fmt.Sprintf("%v", v))
 				}
-				entry.Value = strList
+				entry.Value = list
 			}
 		case "set":
 			rawSet, ok := entry.Value.(map[string]interface{})
 			if ok {
-				strSet := make(map[string]struct{}, len(rawSet))
+				set := newRedisSet(&r.Config)
 				for member := range rawSet {
-					strSet[member] = struct{}{}
+					set.add(member)
 				}
-				entry.Value = strSet
+				entry.Value = set
 			}
 		case "hash":
 			rawMap, ok := entry.Value.(map[string]interface{})
 			if ok {
-				strMap := make(map[string]string, len(rawMap))
+				hash := newRedisHash(&r.Config)
 				for k, v := range rawMap {
-					strMap[k] = fmt.Sprintf("%v", v)
+					hash.set(k, fmt.Sprintf("%v", v))
 				}
-				entry.Value = strMap
+				entry.Value = hash
 			}
 		}
-
-		r.store[key] = entry
 	}
 
 	r.mu.Lock()
-	r.store = store
+	r.store, r.keys = store, newScanIndexOf(store)
 	r.mu.Unlock()
 	return nil
 }
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"redis-clone/resp"
+)
+
+// values that a JSON string or a naive RESP parser would mangle
+var binaryValues = []string{
+	"line one\r\nline two",
+	"nul\x00in the middle",
+	"\xff\xfe invalid utf-8 \xc3\x28",
+	"",
+}
+
+// testing that binary values survive a trip through the command layer
+func TestBinarySafeCommands(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	for i, value := range binaryValues {
+		key := "key\x00" + string(rune('a'+i));
+		cache.ExecuteCommands(client, command("SET", key, value));
+
+		reply := cache.ExecuteCommands(client, command("GET", key));
+		if reply.Kind != resp.KindBulkString || reply.Str != value {
+			t.Errorf("GET %q: expected %q, but got %#v", key, value, reply);
+		};
+	};
+
+	cache.ExecuteCommands(client, command(append([]string{"RPUSH", "list"}, binaryValues...)...));
+	reply := cache.ExecuteCommands(client, command("LRANGE", "list", "0", "-1"));
+	if got := string(resp.Encode(reply, resp.RESP2)); got != string(resp.Encode(resp.BulkStrings(binaryValues), resp.RESP2)) {
+		t.Errorf("LRANGE returned %q", got);
+	};
+
+	cache.ExecuteCommands(client, command("HSET", "hash", "field\r\n", binaryValues[2]));
+	reply = cache.ExecuteCommands(client, command("HGET", "hash", "field\r\n"));
+	if reply.Str != binaryValues[2] {
+		t.Errorf("HGET: expected %q, but got %#v", binaryValues[2], reply);
+	};
+}
+
+// testing that SAVE followed by a restart gives back exactly the same bytes
+func TestSnapshotRoundTrip(t *testing.T) {
+	cache := NewRedisServer();
+	for _, value := range binaryValues {
+		cache.SET("string:"+value, []byte(value), SetOptions{});
+	};
+	cache.SET("counter", []byte("-42"), SetOptions{});
+	cache.RPUSH("list\xff", binaryValues);
+	cache.SADD("set", binaryValues);
+	cache.HSET("hash", []HashField{{"a\x00", binaryValues[0]}, {"\xfe", binaryValues[2]}});
+	cache.ZADD("zset", ZAddOptions{}, []ZMember{{"a\x00", 1.5}, {"\xfe", math.Inf(-1)}, {"c", 1.5}});
+	cache.XADD("stream", XAddOptions{ID: StreamID{5, 1}}, []string{"field\x00", binaryValues[2]});
+	cache.XADD("stream", XAddOptions{ID: StreamID{6, 0}}, []string{"a", "b", "c", "d"});
+	cache.XADD("stream", XAddOptions{ID: StreamID{7, 0}}, []string{"e", "f"});
+	cache.XDEL("stream", []StreamID{{6, 0}});
+	cache.EXPIRE("list\xff", 3600);
+	cache.HEXPIRE("hash", time.Now().Add(time.Hour), "", []string{"\xfe"});
+
+	filename := filepath.Join(t.TempDir(), "dump.rgb.json");
+	if err := cache.SaveToDisk(filename); err != nil {
+		t.Fatalf("SaveToDisk failed: %v", err);
+	};
+
+	restarted := NewRedisServer();
+	if err := restarted.LoadData(filename); err != nil {
+		t.Fatalf("LoadData failed: %v", err);
+	};
+
+	if len(restarted.store) != len(cache.store) {
+		t.Fatalf("Expected %d keys after loading, but got %d", len(cache.store), len(restarted.store));
+	};
+
+	for key, entry := range cache.store {
+		loaded, exists := restarted.store[key];
+		if !exists {
+			t.Errorf("Key %q is missing after loading", key);
+			continue;
+		};
+
+		// the skiplist levels are random and the snapshot keeps sets and hashes sorted,
+		// so collections are equal when their contents are
+		want, got := comparableValue(entry.Value), comparableValue(loaded.Value);
+
+		if loaded.Type != entry.Type || !reflect.DeepEqual(got, want) {
+			t.Errorf("Key %q: expected %s %#v, but got %s %#v", key, entry.Type, want, loaded.Type, got);
+		};
+
+		if !loaded.ExpiryTime.Equal(entry.ExpiryTime) {
+			t.Errorf("Key %q: expected expiry %v, but got %v", key, entry.ExpiryTime, loaded.ExpiryTime);
+		};
+	};
+
+	// plain text stays plain text in the file, only the invalid UTF-8 needs base64
+	content, _ := os.ReadFile(filename);
+	if !bytes.Contains(content, []byte(`"line one\r\nline two"`)) || !strings.Contains(string(content), `"base64"`) {
+		t.Errorf("Unexpected snapshot layout:\n%s", content);
+	};
+}
+
+// testing that dumps written before the snapshot format had a version still load
+func TestLoadLegacySnapshot(t *testing.T) {
+	legacy := `{
+ "fruits": {"type": "list", "value": ["apple", "banana"], "expiryTime": "0001-01-01T00:00:00Z"},
+ "hello": {"type": "string", "value": "world", "expiryTime": "0001-01-01T00:00:00Z"},
+ "users": {"type": "set", "value": {"alpha": {}}, "expiryTime": "0001-01-01T00:00:00Z"},
+ "user:1": {"type": "hash", "value": {"name": "alice"}, "expiryTime": "0001-01-01T00:00:00Z"}
+}`;
+
+	filename := filepath.Join(t.TempDir(), "dump.rgb.json");
+	if err := os.WriteFile(filename, []byte(legacy), 0644); err != nil {
+		t.Fatal(err);
+	};
+
+	cache := NewRedisServer();
+	if err := cache.LoadData(filename); err != nil {
+		t.Fatalf("LoadData failed: %v", err);
+	};
+
+	value, ok, err := cache.GET("hello");
+	if err != nil || !ok || string(value) != "world" {
+		t.Errorf("Expected 'world', but got %q (found: %t, err: %v)", value, ok, err);
+	};
+
+	expected := map[string]interface{}{
+		"fruits": []string{"apple", "banana"},
+		"users": []string{"alpha"},
+		"user:1": map[string]string{"name": "alice"},
+	};
+	for key, want := range expected {
+		got := comparableValue(cache.store[key].Value);
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Key %q: expected %#v, but got %#v", key, want, got);
+		};
+	};
+}
+
+// comparableValue turns the collections whose layout depends on how they were built into their plain contents
+func comparableValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *quicklist:
+		return v.values();
+	case *redisSet:
+		members := v.members();
+		sort.Strings(members);
+		return members;
+	case *redisHash:
+		// a field with a TTL is compared together with its expiry time
+		fields := map[string]string{};
+		for _, f := range v.fields() {
+			fields[f.Field] = f.Value;
+			if at, hasTTL := v.ttl(f.Field); hasTTL {
+				fields[f.Field] += "@" + strconv.FormatInt(at.UnixMilli(), 10);
+			};
+		};
+		return fields;
+	case *sortedSet:
+		return v.members();
+	};
+	return value;
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"slices"
 	"sync"
+
+	"redis-clone/resp"
 )
 
 func(r *RedisCache) IsAlreadySubscribed(channel string, client *Client) bool {
@@ -75,6 +77,7 @@ func(r *RedisCache) Publish(channel string, message string) (int, bool) {
 	r.pubsubs.mu.RLock()
 	subscribers, exists := r.pubsubs.channels[channel]
 	if !exists || len(subscribers) == 0 {
+		r.pubsubs.mu.RUnlock()
 		return 0, false
 	}
 
@@ -86,7 +89,8 @@ func(r *RedisCache) Publish(channel string, message string) (int, bool) {
 	var wg sync.WaitGroup
 
 	// getting all the clients subscribed to the mentioned channel
-	formattedMessage := fmt.Sprintf("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(message), message)
+	// RESP2 clients receive this as a regular array, RESP3 clients as an out-of-band push
+	formattedMessage := resp.Push(resp.BulkString("message"), resp.BulkString(channel), resp.BulkString(message))
 
 	// message shall be sent to all the clients, including the publisher
 	// spawning goroutines for each client to prevent blocking the publisher if any subscriber is slow and handle a large number of client connections at once
@@ -96,7 +100,7 @@ func(r *RedisCache) Publish(channel string, message string) (int, bool) {
 		go func(c *Client) {
 			defer wg.Done()
 
-			_, err := client.Conn.Write([]byte(formattedMessage))
+			err := client.writer.WriteValue(formattedMessage)
 			if err != nil {
 				// the below warning means there are some clients inside the global registry of channels which are not functioning or dead
 				// so, it's good if they are removed from all channels (cleanup)
@@ -115,7 +119,7 @@ func(r *RedisCache) Publish(channel string, message string) (int, bool) {
 	return count, true
 }
 
-func(r *RedisCache) Unsubscribe(client *Client, channels []string) (string, bool) {
+func(r *RedisCache) Unsubscribe(client *Client, channels []string) ([]resp.Value, bool) {
 	r.pubsubs.mu.Lock()
 	defer r.pubsubs.mu.Unlock()
 
@@ -123,8 +127,9 @@ func(r *RedisCache) Unsubscribe(client *Client, channels []string) (string, bool
 	// else loop over, both the client's subscription list and given array of channels and make a new list, and assign it
 	if len(channels) == 0 {
 		// no active subscriptions left --> turning OFF the subscribedMode
-		client.Subscriptions = []string{}
+		// copying the subscriptions first, they are needed below to clean up the global registry and to reply
 		channels = append([]string(nil), client.Subscriptions...)
+		client.Subscriptions = []string{}
 		client.inSubscription = false
 	} else {
 		newSubscriptionList := []string{}
@@ -165,11 +170,85 @@ func(r *RedisCache) Unsubscribe(client *Client, channels []string) (string, bool
 		}
 	}
 
+	// one confirmation per channel: ["unsubscribe", channel, remaining subscriptions]
 	remaining := len(client.Subscriptions)
-	var response string
+	response := []resp.Value{}
 	for _, chnl := range channels {
-		response += fmt.Sprintf("*3\r\n$11\r\nunsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(chnl), chnl, remaining)
+		response = append(response, resp.Push(resp.BulkString("unsubscribe"), resp.BulkString(chnl), resp.Integer(int64(remaining))))
 	}
 
 	return response, true
 }
+
+// one confirmation per channel: ["subscribe", channel, active subscriptions]
+func subscribeReplies(channels []string, active int) []resp.Value {
+	response := []resp.Value{}
+	for _, channel := range channels {
+		response = append(response, resp.Push(resp.BulkString("subscribe"), resp.BulkString(channel), resp.Integer(int64(active))))
+	}
+	return response
+}
+
+// pubsubCommand runs SUBSCRIBE, UNSUBSCRIBE and PUBLISH for the connection of client and queues the replies,
+// false for any other command
+// RESP2 subscribers can run nothing else, RESP3 clients run these next to every other command
+func(r *RedisCache) pubsubCommand(client *Client, command string, args [][]byte) bool {
+	switch command {
+	case "PUBLISH":
+		// command syntax: PUBLISH channel message
+		if len(args) < 2 {
+			client.reply(resp.Error("ERR wrong number of arguments for 'PUBLISH' command"))
+			return true
+		}
+
+		channel := string(args[0])
+		message := string(args[1])
+
+		result, ok := r.Publish(channel, message)
+		if !ok {
+			client.reply(resp.Error("ERR channel does not exist or no active subscribers left to send message"))
+			return true
+		}
+
+		client.reply(resp.Integer(int64(result)))
+
+	case "UNSUBSCRIBE":
+		// command syntax: UNSUBSCRIBE channel [channel...] or UNSUBSCRIBE
+		channels := stringArgs(args)
+
+		result, ok := r.Unsubscribe(client, channels)
+		if !ok {
+			client.reply(resp.Error("ERR something went wrong while unsubscribing"))
+			return true
+		}
+
+		for _, reply := range result {
+			client.reply(reply)
+		}
+		if len(client.Subscriptions) == 0 {
+			client.inSubscription = false
+		}
+
+	case "SUBSCRIBE":
+		// command syntax: SUBSCRIBE channel [channel...]
+		if len(args) < 1 {
+			client.reply(resp.Error("ERR wrong number of arguments for 'SUBSCRIBE' command"))
+			return true
+		}
+
+		channels := stringArgs(args)
+
+		result, ok := r.Subscribe(client, channels)
+		if !ok {
+			return true
+		}
+
+		for _, reply := range subscribeReplies(channels, result) {
+			client.reply(reply)
+		}
+
+	default:
+		return false
+	}
+	return true
+}
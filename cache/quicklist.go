@@ -0,0 +1,352 @@
+package cache
+
+// a quicklist is how Redis stores lists: a doubly linked list of nodes, every node packs a bunch of elements
+// next to each other (a listpack in Redis, a slice here), so pushing and popping at either end is O(1)
+// and LINDEX/LSET only walk the nodes, not every element
+//
+// example with a node size of 3 entries:
+// head --> [a b c] <--> [d e f] <--> [g] <-- tail
+//
+// how big a node may grow is list-max-listpack-size (Config.ListMaxListpackSize), with the same meaning as in Redis:
+// a positive value is the number of entries, -1 to -5 limit the node to 4, 8, 16, 32 or 64 KB
+
+// the bytes a single entry costs on top of its content, roughly what the listpack header of an entry takes
+const quicklistEntryOverhead = 2
+
+type quicklistNode struct {
+	prev 	*quicklistNode
+	next 	*quicklistNode
+	buf 	[]string // the entries are buf[start:], the free room in front makes pushing at the head O(1) too
+	start 	int
+	bytes 	int // the size of the entries, compared against negative fill values
+}
+
+type quicklist struct {
+	head 	*quicklistNode
+	tail 	*quicklistNode
+	count 	int // number of entries in all the nodes
+	nodes 	int
+	fill 	int
+}
+
+func newQuicklist(fill int) *quicklist {
+	if fill == 0 {
+		fill = -2
+	}
+	return &quicklist{fill: fill}
+}
+
+// newQuicklistFrom builds a quicklist holding values, in order
+func newQuicklistFrom(fill int, values []string) *quicklist {
+	ql := newQuicklist(fill)
+	for _, v := range values {
+		ql.push(false, v)
+	}
+	return ql
+}
+
+func(n *quicklistNode) entries() []string {
+	return n.buf[n.start:]
+}
+
+func(n *quicklistNode) len() int {
+	return len(n.buf) - n.start
+}
+
+func entrySize(v string) int {
+	return len(v) + quicklistEntryOverhead
+}
+
+// nodeSizeLimit returns the limit of a negative fill in bytes
+func nodeSizeLimit(fill int) int {
+	if fill < -5 {
+		fill = -5
+	}
+	return 4096 << (-fill - 1)
+}
+
+// fits reports whether v can still go into the node, an empty node takes anything,
+// so an element bigger than the limit simply gets a node of its own
+func(ql *quicklist) fits(n *quicklistNode, v string) bool {
+	if n == nil {
+		return false
+	}
+	if n.len() == 0 {
+		return true
+	}
+	if ql.fill > 0 {
+		return n.len() < ql.fill
+	}
+	return n.bytes+entrySize(v) <= nodeSizeLimit(ql.fill)
+}
+
+func(ql *quicklist) len() int {
+	return ql.count
+}
+
+// insertNode links n next to at, after it or before it, a nil at means the list is empty
+func(ql *quicklist) insertNode(at *quicklistNode, n *quicklistNode, after bool) {
+	ql.nodes++
+	if at == nil {
+		ql.head, ql.tail = n, n
+		return
+	}
+
+	if after {
+		n.prev, n.next = at, at.next
+		if at.next != nil {
+			at.next.prev = n
+		} else {
+			ql.tail = n
+		}
+		at.next = n
+	} else {
+		n.prev, n.next = at.prev, at
+		if at.prev != nil {
+			at.prev.next = n
+		} else {
+			ql.head = n
+		}
+		at.prev = n
+	}
+}
+
+func(ql *quicklist) unlinkNode(n *quicklistNode) {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		ql.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		ql.tail = n.prev
+	}
+	n.prev, n.next = nil, nil
+	ql.nodes--
+}
+
+// reserve makes sure there is room for one more entry in front of the entries (left) or behind them
+// out of room, the entries move to the middle of a new buffer twice their size, which leaves room on both ends
+// and drops the room pops left behind at the other end; a queue that is pushed at the tail and popped at the head
+// would otherwise keep appending to a buffer whose front is nothing but popped entries, and grow it forever
+func(n *quicklistNode) reserve(left bool) {
+	if (left && n.start > 0) || (!left && len(n.buf) < cap(n.buf)) {
+		return
+	}
+
+	size := n.len()
+	grown := make([]string, 2*size+4)
+	start := (len(grown) - size) / 2
+	copy(grown[start:], n.entries())
+	n.buf, n.start = grown[:start+size], start
+}
+
+// push adds v at the head (left) or at the tail, starting a new node when the end node is full
+func(ql *quicklist) push(left bool, v string) {
+	if left {
+		n := ql.head
+		if !ql.fits(n, v) {
+			n = &quicklistNode{}
+			ql.insertNode(ql.head, n, false)
+		}
+		n.reserve(true)
+		n.start--
+		n.buf[n.start] = v
+		n.bytes += entrySize(v)
+	} else {
+		n := ql.tail
+		if !ql.fits(n, v) {
+			n = &quicklistNode{}
+			ql.insertNode(ql.tail, n, true)
+		}
+		n.reserve(false)
+		n.buf = append(n.buf, v)
+		n.bytes += entrySize(v)
+	}
+	ql.count++
+}
+
+// pop removes and returns the entry at the head (left) or the tail, the list must not be empty
+func(ql *quicklist) pop(left bool) string {
+	var v string
+	if left {
+		n := ql.head
+		v = n.buf[n.start]
+		n.buf[n.start] = "" // letting the element be garbage collected
+		n.start++
+		n.bytes -= entrySize(v)
+		ql.dropIfEmpty(n)
+	} else {
+		n := ql.tail
+		last := len(n.buf) - 1
+		v = n.buf[last]
+		n.buf[last] = ""
+		n.buf = n.buf[:last]
+		n.bytes -= entrySize(v)
+		ql.dropIfEmpty(n)
+	}
+	ql.count--
+	return v
+}
+
+func(ql *quicklist) dropIfEmpty(n *quicklistNode) {
+	if n.len() == 0 {
+		ql.unlinkNode(n)
+	}
+}
+
+// locate finds the node holding the entry at index (0 <= index < len) and its offset inside the node,
+// walking from whichever end is closer
+func(ql *quicklist) locate(index int) (*quicklistNode, int) {
+	if index < ql.count/2 {
+		for n := ql.head; n != nil; n = n.next {
+			if index < n.len() {
+				return n, index
+			}
+			index -= n.len()
+		}
+		return nil, 0
+	}
+
+	index = ql.count - 1 - index // counting from the tail now
+	for n := ql.tail; n != nil; n = n.prev {
+		if index < n.len() {
+			return n, n.len() - 1 - index
+		}
+		index -= n.len()
+	}
+	return nil, 0
+}
+
+// get returns the entry at index, 0 <= index < len
+func(ql *quicklist) get(index int) string {
+	n, offset := ql.locate(index)
+	return n.entries()[offset]
+}
+
+// set replaces the entry at index, 0 <= index < len
+func(ql *quicklist) set(index int, v string) {
+	n, offset := ql.locate(index)
+	entries := n.entries()
+	n.bytes += entrySize(v) - entrySize(entries[offset])
+	entries[offset] = v
+}
+
+// insert puts v in front of the entry at index, an index of len appends it
+// a node that is full gets split in two, so no node ever grows past the limit
+func(ql *quicklist) insert(index int, v string) {
+	if index == 0 || index == ql.count {
+		ql.push(index == 0, v)
+		return
+	}
+
+	n, offset := ql.locate(index)
+	if !ql.fits(n, v) {
+		// splitting the node at the insert position: the entries from offset on move to a new node after it
+		entries := n.entries()
+		moved := &quicklistNode{buf: append([]string(nil), entries[offset:]...)}
+		for _, e := range moved.buf {
+			moved.bytes += entrySize(e)
+		}
+		ql.insertNode(n, moved, true)
+
+		clear(entries[offset:])
+		n.buf = n.buf[:n.start+offset]
+		n.bytes -= moved.bytes
+
+		// the new entry goes to whichever half has room, a fresh node if neither has
+		switch {
+		case ql.fits(n, v):
+			n.buf = append(n.buf, v)
+			n.bytes += entrySize(v)
+		case ql.fits(moved, v):
+			moved.buf = append([]string{v}, moved.buf...)
+			moved.bytes += entrySize(v)
+		default:
+			ql.insertNode(n, &quicklistNode{buf: []string{v}, bytes: entrySize(v)}, true)
+		}
+		ql.count++
+		return
+	}
+
+	n.reserve(false)
+	n.buf = append(n.buf, "")
+	entries := n.entries()
+	copy(entries[offset+1:], entries[offset:])
+	entries[offset] = v
+	n.bytes += entrySize(v)
+	ql.count++
+}
+
+// forEach calls fn for every entry from head to tail (or from tail to head when reverse is set)
+// together with its index counted from the head, until fn returns false
+func(ql *quicklist) forEach(reverse bool, fn func(index int, v string) bool) {
+	if !reverse {
+		index := 0
+		for n := ql.head; n != nil; n = n.next {
+			for _, v := range n.entries() {
+				if !fn(index, v) {
+					return
+				}
+				index++
+			}
+		}
+		return
+	}
+
+	index := ql.count - 1
+	for n := ql.tail; n != nil; n = n.prev {
+		entries := n.entries()
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !fn(index, entries[i]) {
+				return
+			}
+			index--
+		}
+	}
+}
+
+// rangeValues copies the entries from start to stop (both inclusive, 0 <= start <= stop < len)
+func(ql *quicklist) rangeValues(start int, stop int) []string {
+	result := make([]string, 0, stop-start+1)
+
+	n, offset := ql.locate(start)
+	for ; n != nil && len(result) < cap(result); n, offset = n.next, 0 {
+		entries := n.entries()[offset:]
+		if left := cap(result) - len(result); len(entries) > left {
+			entries = entries[:left]
+		}
+		result = append(result, entries...)
+	}
+	return result
+}
+
+// values copies every entry, head first
+func(ql *quicklist) values() []string {
+	if ql.count == 0 {
+		return []string{}
+	}
+	return ql.rangeValues(0, ql.count-1)
+}
+
+// trim removes count entries from the head (left) or from the tail, dropping whole nodes where it can
+func(ql *quicklist) trim(left bool, count int) {
+	for count > 0 {
+		n := ql.tail
+		if left {
+			n = ql.head
+		}
+
+		if n.len() <= count {
+			count -= n.len()
+			ql.count -= n.len()
+			ql.unlinkNode(n)
+			continue
+		}
+
+		for ; count > 0; count-- {
+			ql.pop(left)
+		}
+	}
+}
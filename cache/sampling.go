@@ -0,0 +1,66 @@
+package cache
+
+import "math/rand"
+
+// random members of sets and random fields of hashes (SPOP, SRANDMEMBER, HRANDFIELD)
+// Go maps have no random access, so a hashtable-encoded set or hash keeps its members in a slice next to the map
+// (the map says where each of them is, removing one moves the last one into its place), and members are picked by
+// their position in it: one random member is O(1), count of them O(count) until count gets close to the size
+
+// samplePositions picks positions in [0, n) the way SRANDMEMBER and HRANDFIELD do with their count: a positive count
+// gives distinct positions in random order (all of them when count is at least n), a negative one gives exactly
+// -count positions that may repeat
+func samplePositions(n int, count int64) []int {
+	switch {
+	case n == 0 || count == 0:
+		return []int{}
+
+	case count < 0:
+		picked := make([]int, -count)
+		for i := range picked {
+			picked[i] = rand.Intn(n)
+		}
+		return picked
+
+	case count >= int64(n):
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all
+
+	case count*3 > int64(n):
+		// a good part of all of them: shuffling just the first count of all the positions
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		for i := 0; i < int(count); i++ {
+			j := i + rand.Intn(n-i)
+			all[i], all[j] = all[j], all[i]
+		}
+		return all[:count]
+	}
+
+	// a few out of many: drawing until count different ones came up, which rarely takes more than count draws
+	picked := make([]int, 0, count)
+	seen := make(map[int]struct{}, count)
+	for len(picked) < int(count) {
+		pos := rand.Intn(n)
+		if _, dup := seen[pos]; !dup {
+			seen[pos] = struct{}{}
+			picked = append(picked, pos)
+		}
+	}
+	return picked
+}
+
+// sampleSlice picks from items by samplePositions
+func sampleSlice(items []string, count int64) []string {
+	positions := samplePositions(len(items), count)
+	picked := make([]string, len(positions))
+	for i, pos := range positions {
+		picked[i] = items[pos]
+	}
+	return picked
+}
@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// commands needed to be implemented:
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]		--> Done
+// SSCAN key cursor [MATCH pattern] [COUNT count]				--> Done
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]	--> Done
+// ZSCAN key cursor [MATCH pattern] [COUNT count]				--> Done
+
+// complexity in SCAN -> the cursor is all the state there is, the server remembers nothing between two calls, and still
+// every element that is there for the whole iteration has to come back at least once, even if the map grows meanwhile
+// Redis does it with a reverse-binary cursor: the buckets of its hash table are visited in the order of their index
+// with the bits reversed, so when the table doubles, the buckets that were already visited are exactly the ones
+// whose new index starts with the visited bits, and nothing is skipped
+//
+// a Go map keeps its buckets to itself, so the same order is kept on the side: every element has a fixed 64-bit
+// hash, and its position is that hash with the bits reversed, which is the order Redis visits it in no matter the
+// size of the table; the keyspace and every hashtable-encoded collection keep their elements sorted by position in
+// a skiplist (scanindex.go), a call returns the next COUNT of them, and the cursor is the position of the first one
+// it did not return, bits reversed again so it reads like a bucket index
+// since the positions never change, an element that stays put is returned exactly once; one added or removed
+// during the iteration may or may not be, just like in Redis
+// finding the start of a window is O(log n) and the rest of the call O(COUNT), however big the map is
+
+// scanSeed is the seed of the element hashes, a cursor stays valid for as long as the server runs
+var scanSeed = maphash.MakeSeed()
+
+// ScanOptions holds the options of SCAN, SSCAN, HSCAN and ZSCAN
+type ScanOptions struct {
+	Match 		string // only the elements matching this glob pattern are returned, "*" for all of them
+	Count 		int // how many elements one call looks at, MATCH and TYPE may leave fewer of them in the reply
+	Type 		string // SCAN only: only keys of this type, empty for every type
+	NoValues 	bool // HSCAN only: the fields without their values
+}
+
+// parseScanCursor reads the cursor, an unsigned 64-bit number
+func parseScanCursor(arg []byte) (uint64, error) {
+	cursor, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// parseScanOptions reads everything after the cursor, TYPE is only allowed for SCAN and NOVALUES only for HSCAN
+func parseScanOptions(command string, args [][]byte) (ScanOptions, error) {
+	opts := ScanOptions{Match: "*", Count: 10}
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+
+		switch {
+		case option == "NOVALUES" && command == "HSCAN":
+			opts.NoValues = true
+			continue
+		case i+1 == len(args):
+			return opts, ErrSyntax
+		}
+
+		switch {
+		case option == "MATCH":
+			opts.Match = string(args[i+1])
+
+		case option == "COUNT":
+			count, ok := parseInteger(args[i+1])
+			if !ok {
+				return opts, ErrNotInteger
+			}
+			if count < 1 {
+				return opts, ErrSyntax
+			}
+			opts.Count = int(min(count, math.MaxInt))
+
+		case option == "TYPE" && command == "SCAN":
+			opts.Type = strings.ToLower(string(args[i+1]))
+
+		default:
+			return opts, ErrSyntax
+		}
+		i++
+	}
+
+	return opts, nil
+}
+
+// globMatch reports whether s matches the glob pattern of a MATCH option, the way Redis matches them:
+// * --> any number of bytes, ? --> any single byte, [abc], [^abc] and [a-z] --> one byte of (or not of) the set,
+// \ --> the next byte taken literally
+func globMatch(pattern string, s string) bool {
+	p, i := 0, 0
+	// where the last * was, to go back to when the rest does not match: that * then takes one more byte
+	star, starMatched := -1, 0
+
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, starMatched = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			default:
+				if width, ok := globMatchByte(pattern[p:], s[i]); ok {
+					p += width
+					i++
+					continue
+				}
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+		starMatched++
+		p, i = star+1, starMatched
+	}
+
+	// only stars can match the empty rest
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// globMatchByte matches c against the start of pattern, which is a literal byte, an escaped one or a [...] set
+// width is how many bytes of the pattern that took
+func globMatchByte(pattern string, c byte) (width int, ok bool) {
+	switch {
+	case pattern[0] == '\\' && len(pattern) >= 2:
+		return 2, pattern[1] == c
+	case pattern[0] != '[':
+		return 1, pattern[0] == c
+	}
+
+	p := 1
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+
+	// a set that is never closed runs to the end of the pattern, like it does in Redis
+	match := false
+	for ; p < len(pattern) && pattern[p] != ']'; p++ {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			match = match || pattern[p] == c
+		case p+2 < len(pattern) && pattern[p+1] == '-':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (lo <= c && c <= hi)
+			p += 2
+		default:
+			match = match || pattern[p] == c
+		}
+	}
+	if p < len(pattern) {
+		p++ // the ]
+	}
+
+	return p, match != negate
+}
+
+func(r *RedisCache) SCAN(cursor uint64, opts ScanOptions) (uint64, []string) {
+	// command syntax: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+	// returns the next cursor and the keys of this call, MATCH and TYPE are applied after the keys were picked,
+	// so a call may well return nothing while the iteration is not done yet
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys, next := r.keys.window(cursor, opts.Count)
+
+	result := keys[:0]
+	for _, key := range keys {
+		// expired keys are never returned
+		entry, exists := r.lookup(key)
+		if !exists || (opts.Type != "" && entry.Type != opts.Type) || !globMatch(opts.Match, key) {
+			continue
+		}
+		result = append(result, key)
+	}
+	return next, result
+}
+
+// the compact encodings (intset and listpack) are small, SSCAN, HSCAN and ZSCAN return them in a single call with
+// cursor 0, just like Redis does
+
+func(r *RedisCache) SSCAN(key string, cursor uint64, opts ScanOptions) (uint64, []string, error) {
+	// command syntax: SSCAN key cursor [MATCH pattern] [COUNT count]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, err := r.setFor(key)
+	if set == nil {
+		return 0, []string{}, err
+	}
+
+	var members []string
+	next := uint64(0)
+	if set.dict != nil {
+		members, next = set.index.window(cursor, opts.Count)
+	} else {
+		members = set.members()
+	}
+
+	result := members[:0]
+	for _, member := range members {
+		if globMatch(opts.Match, member) {
+			result = append(result, member)
+		}
+	}
+	return next, result, nil
+}
+
+func(r *RedisCache) HSCAN(key string, cursor uint64, opts ScanOptions) (uint64, []HashField, error) {
+	// command syntax: HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+	// MATCH is applied to the fields, NOVALUES is left to the reply
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, err := r.hashFor(key)
+	if hash == nil {
+		return 0, []HashField{}, err
+	}
+
+	var fields []HashField
+	next := uint64(0)
+	if hash.dict != nil {
+		var names []string
+		names, next = hash.index.window(cursor, opts.Count)
+		fields = make([]HashField, len(names))
+		for i, name := range names {
+			fields[i] = hash.entries[hash.dict[name]]
+		}
+	} else {
+		fields = hash.fields()
+	}
+
+	result := fields[:0]
+	for _, f := range fields {
+		if globMatch(opts.Match, f.Field) {
+			result = append(result, f)
+		}
+	}
+	return next, result, nil
+}
+
+func(r *RedisCache) ZSCAN(key string, cursor uint64, opts ScanOptions) (uint64, []ZMember, error) {
+	// command syntax: ZSCAN key cursor [MATCH pattern] [COUNT count]
+	// MATCH is applied to the members
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, []ZMember{}, err
+	}
+
+	var members []ZMember
+	next := uint64(0)
+	if zset.zsl != nil {
+		var names []string
+		names, next = zset.index.window(cursor, opts.Count)
+		members = make([]ZMember, len(names))
+		for i, name := range names {
+			members[i] = ZMember{Member: name, Score: zset.dict[name]}
+		}
+	} else {
+		members = zset.members()
+	}
+
+	result := members[:0]
+	for _, m := range members {
+		if globMatch(opts.Match, m.Member) {
+			result = append(result, m)
+		}
+	}
+	return next, result, nil
+}
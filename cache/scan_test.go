@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// scanAll runs a SCAN-like command from cursor 0 until the cursor is 0 again and counts how often each element came
+// back, before every call after the first one grow is called with the number of calls so far
+func scanAll(t *testing.T, cache *RedisCache, prefix []string, options []string, grow func(call int)) map[string]int {
+	t.Helper();
+
+	seen := map[string]int{};
+	client := NewClient(nil);
+	cursor := "0";
+	for call := 0; call == 0 || cursor != "0"; call++ {
+		if call > 0 && grow != nil {
+			grow(call);
+		};
+		if call > 100000 {
+			t.Fatalf("The iteration does not end");
+		};
+
+		args := append(append(append([]string{}, prefix...), cursor), options...);
+		reply := cache.ExecuteCommands(client, command(args...));
+		if len(reply.Elems) != 2 {
+			t.Fatalf("%q: expected [cursor, elements], but got %#v", args, reply);
+		};
+
+		cursor = reply.Elems[0].Str;
+		for _, elem := range reply.Elems[1].Elems {
+			seen[elem.Str]++;
+		};
+	};
+	return seen;
+}
+
+func TestScanReturnsEveryKeyOnce(t *testing.T) {
+	cache := NewRedisServer();
+	for i := 0; i < 1000; i++ {
+		cache.SET(fmt.Sprintf("key:%d", i), []byte("v"), SetOptions{});
+	};
+
+	// a window is found in the index, not by walking the keyspace, and holds COUNT keys
+	reply := cache.ExecuteCommands(NewClient(nil), command("SCAN", "0", "COUNT", "7"));
+	if len(reply.Elems[1].Elems) != 7 {
+		t.Errorf("Expected 7 keys, but got %d", len(reply.Elems[1].Elems));
+	};
+
+	seen := scanAll(t, cache, []string{"SCAN"}, []string{"COUNT", "7"}, nil);
+	if len(seen) != 1000 {
+		t.Errorf("Expected 1000 keys, but got %d", len(seen));
+	};
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("Key %q came back %d times", key, n);
+		};
+	};
+}
+
+// testing the guarantee of the reverse-binary cursor: the keyspace grows a lot between calls, which changes the size
+// of the table the windows are cut from, and still every key that was there from the start is returned
+func TestScanWhileGrowing(t *testing.T) {
+	cache := NewRedisServer();
+	for i := 0; i < 100; i++ {
+		cache.SET(fmt.Sprintf("old:%d", i), []byte("v"), SetOptions{});
+	};
+
+	added := 0;
+	seen := scanAll(t, cache, []string{"SCAN"}, []string{"COUNT", "3"}, func(call int) {
+		// growing forever would keep the iteration from ever ending, in Redis as much as here
+		if call > 20 {
+			return;
+		};
+		for i := 0; i < 50; i++ {
+			cache.SET(fmt.Sprintf("new:%d", added), []byte("v"), SetOptions{});
+			added++;
+		};
+	});
+
+	for i := 0; i < 100; i++ {
+		if key := fmt.Sprintf("old:%d", i); seen[key] != 1 {
+			t.Errorf("Key %q came back %d times", key, seen[key]);
+		};
+	};
+}
+
+func TestScanOptions(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+	for i := 0; i < 50; i++ {
+		cache.ExecuteCommands(client, command("SET", fmt.Sprintf("user:%d", i), "v"));
+		cache.ExecuteCommands(client, command("RPUSH", fmt.Sprintf("queue:%d", i), "v"));
+	};
+	cache.ExecuteCommands(client, command("SADD", "user:set", "v"));
+
+	seen := scanAll(t, cache, []string{"SCAN"}, []string{"MATCH", "user:*"}, nil);
+	if len(seen) != 51 {
+		t.Errorf("Expected the 51 user keys, but got %d keys", len(seen));
+	};
+
+	seen = scanAll(t, cache, []string{"SCAN"}, []string{"MATCH", "user:*", "TYPE", "SET"}, nil);
+	if len(seen) != 1 || seen["user:set"] != 1 {
+		t.Errorf("Expected only user:set, but got %v", seen);
+	};
+
+	seen = scanAll(t, cache, []string{"SCAN"}, []string{"TYPE", "list", "COUNT", "1000"}, nil);
+	if len(seen) != 50 {
+		t.Errorf("Expected the 50 lists, but got %d keys", len(seen));
+	};
+
+	seen = scanAll(t, cache, []string{"SCAN"}, []string{"MATCH", "user:1?"}, nil);
+	if len(seen) != 10 {
+		t.Errorf("Expected user:10 to user:19, but got %v", seen);
+	};
+
+	runSteps(t, cache, []step{
+		{[]string{"SCAN", "x"}, "-ERR invalid cursor\r\n"},
+		{[]string{"SCAN", "-1"}, "-ERR invalid cursor\r\n"},
+		{[]string{"SCAN", "0", "COUNT", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"SCAN", "0", "COUNT", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SCAN", "0", "MATCH"}, "-ERR syntax error\r\n"},
+		{[]string{"SCAN", "0", "NOVALUES"}, "-ERR syntax error\r\n"},
+		{[]string{"SSCAN", "user:set", "0", "TYPE", "set"}, "-ERR syntax error\r\n"},
+		{[]string{"SSCAN", "user:1", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"HSCAN", "user:1", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"ZSCAN", "user:1", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SSCAN", "missing", "0"}, "*2\r\n$1\r\n0\r\n*0\r\n"},
+	});
+}
+
+func TestCollectionScans(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	// the compact encodings come back whole, with cursor 0
+	runSteps(t, cache, []step{
+		{[]string{"SADD", "small", "1", "2", "3"}, ":3\r\n"},
+		{[]string{"SSCAN", "small", "0", "MATCH", "[12]"}, "*2\r\n$1\r\n0\r\n*2\r\n$1\r\n1\r\n$1\r\n2\r\n"},
+		{[]string{"HSET", "h", "name", "alice", "age", "30"}, ":2\r\n"},
+		{[]string{"HSCAN", "h", "0"}, "*2\r\n$1\r\n0\r\n*4\r\n$4\r\nname\r\n$5\r\nalice\r\n$3\r\nage\r\n$2\r\n30\r\n"},
+		{[]string{"HSCAN", "h", "0", "NOVALUES", "MATCH", "n*"}, "*2\r\n$1\r\n0\r\n*1\r\n$4\r\nname\r\n"},
+		{[]string{"ZADD", "z", "1.5", "a", "2", "b"}, ":2\r\n"},
+		{[]string{"ZSCAN", "z", "0"}, "*2\r\n$1\r\n0\r\n*4\r\n$1\r\na\r\n$3\r\n1.5\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+	});
+
+	// the big ones are iterated like the keyspace
+	for i := 0; i < 500; i++ {
+		member := fmt.Sprintf("m%d", i);
+		cache.ExecuteCommands(client, command("SADD", "set", member));
+		cache.ExecuteCommands(client, command("HSET", "hash", member, "v"+member));
+		cache.ExecuteCommands(client, command("ZADD", "zset", fmt.Sprint(i), member));
+	};
+
+	for _, prefix := range [][]string{{"SSCAN", "set"}, {"HSCAN", "hash"}, {"ZSCAN", "zset"}} {
+		seen := scanAll(t, cache, prefix, []string{"COUNT", "20"}, nil);
+		for i := 0; i < 500; i++ {
+			member := fmt.Sprintf("m%d", i);
+			if seen[member] != 1 {
+				t.Errorf("%s: member %q came back %d times", prefix[0], member, seen[member]);
+			};
+		};
+
+		// every field is followed by its value and every member by its score
+		switch prefix[0] {
+		case "HSCAN":
+			if seen["vm42"] != 1 {
+				t.Errorf("Expected the values next to the fields, but got %d", seen["vm42"]);
+			};
+		case "ZSCAN":
+			if seen["42"] != 1 {
+				t.Errorf("Expected the scores next to the members, but got %d", seen["42"]);
+			};
+		};
+	};
+}
+
+// checkScanIndex checks that idx holds exactly the keys of m, ordered by their position
+func checkScanIndex[V any](t *testing.T, name string, idx *scanIndex, m map[string]V) {
+	t.Helper();
+
+	count := 0;
+	var prev *scanNode;
+	for x := idx.header.forward[0]; x != nil; x = x.forward[0] {
+		if _, exists := m[x.key]; !exists {
+			t.Fatalf("%s: the index has %q, the map does not", name, x.key);
+		};
+		if x.pos != scanPosition(x.key) || (prev != nil && !prev.before(x.pos, x.key)) {
+			t.Fatalf("%s: %q is out of order", name, x.key);
+		};
+		prev = x;
+		count++;
+	};
+	if count != len(m) || idx.length != len(m) {
+		t.Fatalf("%s: the index has %d keys (length %d), the map %d", name, count, idx.length, len(m));
+	};
+}
+
+// the indexes (and the entries of sets and hashes) are checked against their maps after every one of a random mix of the
+// commands that add and delete keys, fields and members, in every encoding
+func TestScanIndexFollowsTheMaps(t *testing.T) {
+	cache := NewRedisServer();
+	cache.Config.SetMaxIntsetEntries = 2;
+	cache.Config.SetMaxListpackEntries = 2;
+	cache.Config.HashMaxListpackEntries = 2;
+	cache.Config.ZSetMaxListpackEntries = 2;
+	client := NewClient(nil);
+	rng := rand.New(rand.NewSource(1));
+
+	for i := 0; i < 5000; i++ {
+		// every type has keys of its own, so the collections grow big enough to become hashtables
+		n, other := fmt.Sprint(rng.Intn(4)), fmt.Sprint(rng.Intn(4));
+		member, score := fmt.Sprint("m", rng.Intn(30)), fmt.Sprint(rng.Intn(10));
+
+		commands := [][]string{
+			{"SET", "str" + n, "v"},
+			{"SET", "str" + n, "v", "PX", "1"},
+			{"INCR", "str" + n},
+			{"DEL", "str" + n},
+			{"RPUSH", "list" + n, member},
+			{"LPOP", "list" + n},
+			{"SADD", "set" + n, member, "x" + member},
+			{"SREM", "set" + n, member},
+			{"SPOP", "set" + n},
+			{"SMOVE", "set" + n, "set" + other, member},
+			{"SUNIONSTORE", "set" + other, "set" + n, "set" + other},
+			{"HSET", "hash" + n, member, "v", "x" + member, "v"},
+			{"HDEL", "hash" + n, member},
+			{"HEXPIRE", "hash" + n, "0", "FIELDS", "1", "x" + member},
+			{"ZADD", "zset" + n, score, member, score, "x" + member},
+			{"ZREM", "zset" + n, member},
+			{"ZREMRANGEBYSCORE", "zset" + n, "0", score},
+			{"ZUNIONSTORE", "zset" + other, "1", "zset" + n},
+			{"DEL", "set" + n, "hash" + n, "zset" + n},
+		};
+		cache.ExecuteCommands(client, command(commands[rng.Intn(len(commands))]...));
+
+		cache.mu.Lock();
+		checkScanIndex(t, "keyspace", cache.keys, cache.store);
+		for key, entry := range cache.store {
+			switch value := entry.Value.(type) {
+			case *redisSet:
+				if value.dict != nil {
+					checkScanIndex(t, key, value.index, value.dict);
+					for member, pos := range value.dict {
+						if len(value.entries) != len(value.dict) || value.entries[pos] != member {
+							t.Fatalf("%s: %q is not at position %d of the %d entries", key, member, pos, len(value.entries));
+						};
+					};
+				};
+			case *redisHash:
+				if value.dict != nil {
+					checkScanIndex(t, key, value.index, value.dict);
+					for field, pos := range value.dict {
+						if len(value.entries) != len(value.dict) || value.entries[pos].Field != field {
+							t.Fatalf("%s: %q is not at position %d of the %d entries", key, field, pos, len(value.entries));
+						};
+					};
+				};
+			case *sortedSet:
+				if value.zsl != nil {
+					checkScanIndex(t, key, value.index, value.dict);
+				};
+			};
+		};
+		cache.mu.Unlock();
+	};
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s string
+		match bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"", "", true},
+		{"", "a", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hellox", false},
+		{"*a*b*c", "xaxbxbxc", true},
+		{"*a*b*c", "abcabx", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"[\\]]", "]", true},
+		{"a[bc", "ab", true},
+		{"**x", "x", true},
+	};
+
+	for _, test := range tests {
+		if got := globMatch(test.pattern, test.s); got != test.match {
+			t.Errorf("globMatch(%q, %q): expected %v, but got %v", test.pattern, test.s, test.match, got);
+		};
+	};
+}
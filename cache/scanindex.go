@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+// the ordered half of SCAN (scan.go): the keyspace and every hashtable-encoded set, hash and sorted set keep their keys
+// in a skiplist sorted by scan position next to their map, so a call finds where its cursor starts in O(log n) and
+// then only walks the keys it returns
+// the map and its index change together, whatever inserts or deletes a key in one does the same in the other
+
+// scanPosition is where key sorts in a scan: a fixed hash of the key with the bits reversed
+func scanPosition(key string) uint64 {
+	return bits.Reverse64(maphash.String(scanSeed, key))
+}
+
+type scanNode struct {
+	pos 		uint64
+	key 		string
+	forward 	[]*scanNode
+}
+
+type scanIndex struct {
+	header 	*scanNode // a sentinel, not a key
+	length 	int
+	level 	int
+}
+
+func newScanIndex() *scanIndex {
+	return &scanIndex{
+		header: &scanNode{forward: make([]*scanNode, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+// newScanIndexOf indexes the keys of a map that was filled without one, e.g. a listpack turned into a hashtable
+func newScanIndexOf[V any](m map[string]V) *scanIndex {
+	idx := newScanIndex()
+	for key := range m {
+		idx.insert(key)
+	}
+	return idx
+}
+
+// before reports whether the node sorts before (pos, key), keys with the same position are sorted by their bytes
+func(n *scanNode) before(pos uint64, key string) bool {
+	return n.pos < pos || (n.pos == pos && n.key < key)
+}
+
+// findUpdate returns the last node before (pos, key) on every level
+func(idx *scanIndex) findUpdate(pos uint64, key string) [skiplistMaxLevel]*scanNode {
+	var update [skiplistMaxLevel]*scanNode
+
+	x := idx.header
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].before(pos, key) {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// insert adds a key that is not in the index yet
+func(idx *scanIndex) insert(key string) {
+	pos := scanPosition(key)
+	update := idx.findUpdate(pos, key)
+
+	level := randomLevel()
+	if level > idx.level {
+		for i := idx.level; i < level; i++ {
+			update[i] = idx.header
+		}
+		idx.level = level
+	}
+
+	x := &scanNode{pos: pos, key: key, forward: make([]*scanNode, level)}
+	for i := 0; i < level; i++ {
+		x.forward[i] = update[i].forward[i]
+		update[i].forward[i] = x
+	}
+	idx.length++
+}
+
+// remove takes key out of the index, false if it was not there
+func(idx *scanIndex) remove(key string) bool {
+	pos := scanPosition(key)
+	update := idx.findUpdate(pos, key)
+
+	x := update[0].forward[0]
+	if x == nil || x.pos != pos || x.key != key {
+		return false
+	}
+
+	for i := 0; i < idx.level && update[i].forward[i] == x; i++ {
+		update[i].forward[i] = x.forward[i]
+	}
+	for idx.level > 1 && idx.header.forward[idx.level-1] == nil {
+		idx.level--
+	}
+	idx.length--
+	return true
+}
+
+// window returns count keys from cursor on, and the cursor of the next window (0 when the iteration is done)
+// keys with the same position never end up in two different windows, the cursor could not tell them apart
+func(idx *scanIndex) window(cursor uint64, count int) ([]string, uint64) {
+	start := bits.Reverse64(cursor)
+
+	// the first node at or after start
+	x := idx.header
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].pos < start {
+			x = x.forward[i]
+		}
+	}
+	x = x.forward[0]
+
+	keys := []string{}
+	last := uint64(0) // the position of the last key taken
+	for x != nil && (len(keys) < count || x.pos == last) {
+		keys = append(keys, x.key)
+		last = x.pos
+		x = x.forward[0]
+	}
+
+	if x == nil {
+		return keys, 0
+	}
+	return keys, bits.Reverse64(x.pos)
+}
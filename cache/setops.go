@@ -0,0 +1,270 @@
+package cache
+
+import "sort"
+
+// commands needed to be implemented:
+// SINTER, SUNION, SDIFF key [key ...]							--> Done
+// SINTERSTORE, SUNIONSTORE, SDIFFSTORE destination key [key ...]	--> Done
+// SINTERCARD numkeys key [key ...] [LIMIT limit]					--> Done
+// SMOVE source destination member								--> Done
+// SMISMEMBER key member [member ...]								--> Done
+// SPOP key [count]												--> Done
+// SRANDMEMBER key [count]										--> Done
+
+// setInputs returns the sets of every input key, a missing key is an empty set
+// every key is checked, so one that holds another type fails the command even if an earlier set is empty
+// the caller must hold r.mu
+func(r *RedisCache) setInputs(keys []string) ([]*redisSet, error) {
+	inputs := make([]*redisSet, len(keys))
+	for i, key := range keys {
+		set, err := r.setFor(key)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			set = &redisSet{} // an empty listpack, it has nothing
+		}
+		inputs[i] = set
+	}
+	return inputs, nil
+}
+
+// intersectSets walks the smallest set and keeps the members every other set has too,
+// so the work depends on the smallest input, not the biggest; it stops after limit members (0 means no limit)
+func intersectSets(cfg *Config, inputs []*redisSet, limit int) *redisSet {
+	sorted := append([]*redisSet(nil), inputs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].len() < sorted[j].len()
+	})
+
+	result := newRedisSet(cfg)
+	sorted[0].forEach(func(member string) bool {
+		for _, other := range sorted[1:] {
+			if !other.has(member) {
+				return true
+			}
+		}
+
+		result.add(member)
+		return result.len() != limit
+	})
+	return result
+}
+
+func unionSets(cfg *Config, inputs []*redisSet) *redisSet {
+	result := newRedisSet(cfg)
+	for _, set := range inputs {
+		set.forEach(func(member string) bool {
+			result.add(member)
+			return true
+		})
+	}
+	return result
+}
+
+// diffSets keeps the members of the first set that none of the others has
+func diffSets(cfg *Config, inputs []*redisSet) *redisSet {
+	result := newRedisSet(cfg)
+	inputs[0].forEach(func(member string) bool {
+		for _, other := range inputs[1:] {
+			if other.has(member) {
+				return true
+			}
+		}
+		result.add(member)
+		return true
+	})
+	return result
+}
+
+// the set operations, they all take the sets of the input keys and build a new set
+const (
+	setInter = iota
+	setUnion
+	setDiff
+)
+
+// combineSets runs one of the set operations over keys, the caller must hold r.mu
+func(r *RedisCache) combineSets(op int, keys []string) (*redisSet, error) {
+	inputs, err := r.setInputs(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case setInter:
+		return intersectSets(&r.Config, inputs, 0), nil
+	case setUnion:
+		return unionSets(&r.Config, inputs), nil
+	}
+	return diffSets(&r.Config, inputs), nil
+}
+
+func(r *RedisCache) SINTER(keys []string) ([]string, error) {
+	// command syntax: SINTER key [key ...]
+	return r.setAlgebra(setInter, keys)
+}
+
+func(r *RedisCache) SUNION(keys []string) ([]string, error) {
+	// command syntax: SUNION key [key ...]
+	return r.setAlgebra(setUnion, keys)
+}
+
+func(r *RedisCache) SDIFF(keys []string) ([]string, error) {
+	// command syntax: SDIFF key [key ...]
+	// the members of the first set that are in none of the others
+	return r.setAlgebra(setDiff, keys)
+}
+
+func(r *RedisCache) setAlgebra(op int, keys []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.combineSets(op, keys)
+	if err != nil {
+		return nil, err
+	}
+	return result.members(), nil
+}
+
+func(r *RedisCache) SINTERSTORE(destination string, keys []string) (int, error) {
+	// command syntax: SINTERSTORE destination key [key ...]
+	return r.setAlgebraStore(setInter, destination, keys)
+}
+
+func(r *RedisCache) SUNIONSTORE(destination string, keys []string) (int, error) {
+	// command syntax: SUNIONSTORE destination key [key ...]
+	return r.setAlgebraStore(setUnion, destination, keys)
+}
+
+func(r *RedisCache) SDIFFSTORE(destination string, keys []string) (int, error) {
+	// command syntax: SDIFFSTORE destination key [key ...]
+	return r.setAlgebraStore(setDiff, destination, keys)
+}
+
+// setAlgebraStore replaces destination with the result, whatever type it held before (and its TTL),
+// an empty result deletes destination
+func(r *RedisCache) setAlgebraStore(op int, destination string, keys []string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result, err := r.combineSets(op, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.len() == 0 {
+		r.deleteEntry(destination)
+		return 0, nil
+	}
+
+	r.setEntry(destination, &Entry{Type: "set", Value: result})
+	return result.len(), nil
+}
+
+func(r *RedisCache) SINTERCARD(keys []string, limit int64) (int, error) {
+	// command syntax: SINTERCARD numkeys key [key ...] [LIMIT limit]
+	// the size of the intersection, counting stops at limit (0 means no limit)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inputs, err := r.setInputs(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	return intersectSets(&r.Config, inputs, int(limit)).len(), nil
+}
+
+func(r *RedisCache) SMOVE(source string, destination string, member string) (bool, error) {
+	// command syntax: SMOVE source destination member
+	// moves member from source to destination, false when source does not have it
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	src, err := r.setFor(source)
+	if err != nil {
+		return false, err
+	}
+	dst, err := r.setFor(destination)
+	if err != nil {
+		return false, err
+	}
+
+	if src == nil || !src.has(member) {
+		return false, nil
+	}
+	if source == destination {
+		return true, nil
+	}
+
+	src.remove(member)
+	if src.len() == 0 {
+		r.deleteEntry(source)
+	}
+
+	if dst == nil {
+		dst = newRedisSet(&r.Config)
+		r.setEntry(destination, &Entry{Type: "set", Value: dst})
+	}
+	dst.add(member)
+	return true, nil
+}
+
+func(r *RedisCache) SMISMEMBER(key string, members []string) ([]bool, error) {
+	// command syntax: SMISMEMBER key member [member ...]
+	// one answer per member, a missing key has none of them
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, err := r.setFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]bool, len(members))
+	if set == nil {
+		return result, nil
+	}
+	for i, member := range members {
+		result[i] = set.has(member)
+	}
+	return result, nil
+}
+
+func(r *RedisCache) SPOP(key string, count int64) ([]string, error) {
+	// command syntax: SPOP key [count]
+	// removes and returns up to count random members, the key goes away with its last member
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, err := r.setFor(key)
+	if set == nil || count == 0 {
+		return []string{}, err
+	}
+
+	popped := set.sample(count)
+	if len(popped) == set.len() {
+		r.deleteEntry(key)
+		return popped, nil
+	}
+
+	for _, member := range popped {
+		set.remove(member)
+	}
+	return popped, nil
+}
+
+func(r *RedisCache) SRANDMEMBER(key string, count int64) ([]string, error) {
+	// command syntax: SRANDMEMBER key [count]
+	// a positive count returns distinct members (at most all of them), a negative count returns exactly -count
+	// members that may repeat
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, err := r.setFor(key)
+	if set == nil {
+		return []string{}, err
+	}
+	return set.sample(count), nil
+}
@@ -1,155 +1,306 @@
 package cache
 
-import "fmt"
+// complexity in redis sets -> there are three encodings of a set, and a set starts with the smallest one that fits:
+// intset --> only integer members, a sorted array of int64 found with a binary search (intset.go)
+// listpack --> a few short members, packed into a single byte slice and searched one by one (listpack.go)
+// hashtable --> everything else, a map from every member to its place in a slice of all of them, the slice is what
+// SPOP and SRANDMEMBER pick random members from in O(1)
+// a set moves on to a bigger encoding when it outgrows its own (set-max-intset-entries, set-max-listpack-entries and
+// set-max-listpack-value in config.go), but never goes back, just like in Redis
+type redisSet struct {
+	ints 	intset // the intset encoding when not nil
+	lp 		listpack
+	dict 	map[string]int // the hashtable encoding when not nil, the position of every member in entries
+	entries []string // the members of dict in no particular order, removing one moves the last one into its place
+	index 	*scanIndex // the members of dict ordered for SSCAN, see scanindex.go
+	cfg 	*Config // the encoding limits, a nil config means always a hashtable
+}
 
-// complexity in redis sets -> there are two sets: intsets and
+func newRedisSet(cfg *Config) *redisSet {
+	s := &redisSet{cfg: cfg}
+	if cfg == nil {
+		s.dict, s.index = make(map[string]int), newScanIndex()
+	}
+	return s
+}
 
+func(s *redisSet) encoding() string {
+	switch {
+	case s.dict != nil:
+		return "hashtable"
+	case s.ints != nil:
+		return "intset"
+	}
+	return "listpack"
+}
 
-func(r *RedisCache) SADD(key string, members []string) (int, bool) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func(s *redisSet) len() int {
+	switch {
+	case s.dict != nil:
+		return len(s.dict)
+	case s.ints != nil:
+		return len(s.ints)
+	}
+	return s.lp.len()
+}
 
-	entry, exists := r.store[key]
-	if !exists {
-		// new set is created
-		newSet := make(map[string]struct{})
-		added := 0
-		for i:=0; i<len(members); i++ {
-			if _, ok := newSet[members[i]]; !ok {
-				newSet[members[i]] = struct{}{}
-				added++
-			}
+func(s *redisSet) has(member string) bool {
+	switch {
+	case s.dict != nil:
+		_, exists := s.dict[member]
+		return exists
+	case s.ints != nil:
+		n, ok := intsetMember(member)
+		return ok && s.ints.contains(n)
+	}
+	return s.lp.find(member, 1) >= 0
+}
+
+// fitsListpack reports whether the set could be a listpack of size members, the longest of them maxLen bytes
+func(s *redisSet) fitsListpack(size int, maxLen int) bool {
+	return size <= s.cfg.SetMaxListpackEntries && maxLen <= s.cfg.SetMaxListpackValue
+}
+
+// add puts member into the set, false if it was already there
+func(s *redisSet) add(member string) bool {
+	// the first member picks the encoding
+	if s.dict == nil && s.ints == nil && s.lp.len() == 0 {
+		if _, ok := intsetMember(member); ok && s.cfg.SetMaxIntsetEntries > 0 {
+			s.ints = intset{}
+		} else if !s.fitsListpack(1, len(member)) {
+			s.dict, s.index = make(map[string]int), newScanIndex()
 		}
-		r.store[key] = &Entry{Type: "set", Value: newSet}
-		return added, true
 	}
 
-	// see if any one member already exists inside the set
-	// if yes, that member is not added into the set again, simply ignored
-	set, isSet := entry.Value.(map[string]struct{})
-	if !isSet {
-		return 0, false
+	switch {
+	case s.dict != nil:
+		if _, exists := s.dict[member]; exists {
+			return false
+		}
+		s.dict[member] = len(s.entries)
+		s.entries = append(s.entries, member)
+		s.index.insert(member)
+		return true
+
+	case s.ints != nil:
+		n, ok := intsetMember(member)
+		if ok && s.ints.contains(n) {
+			return false
+		}
+		if ok && len(s.ints) < s.cfg.SetMaxIntsetEntries {
+			return s.ints.add(n)
+		}
+
+		// a member that is not an integer turns a small intset into a listpack, a big one (or one integer too many)
+		// into a hashtable
+		longest := len(member)
+		for _, n := range s.ints {
+			longest = max(longest, len(formatIntsetMember(n)))
+		}
+		if !ok && s.fitsListpack(len(s.ints)+1, longest) {
+			s.convertToListpack()
+		} else {
+			s.convertToHashtable()
+		}
+		return s.add(member)
 	}
 
-	added := 0
-	for i:=0; i<len(members); i++ {
-		if _, ok := set[members[i]]; !ok {
-			set[members[i]] = struct{}{}
-			added++
+	if s.lp.find(member, 1) >= 0 {
+		return false
+	}
+	if !s.fitsListpack(s.lp.len()+1, len(member)) {
+		s.convertToHashtable()
+		return s.add(member)
+	}
+	s.lp.append(member)
+	return true
+}
+
+// remove takes member out of the set, false if it was not there
+func(s *redisSet) remove(member string) bool {
+	switch {
+	case s.dict != nil:
+		pos, exists := s.dict[member]
+		if !exists {
+			return false
 		}
+		last := len(s.entries) - 1
+		s.entries[pos] = s.entries[last]
+		s.dict[s.entries[pos]] = pos
+		s.entries[last] = ""
+		s.entries = s.entries[:last]
+		delete(s.dict, member)
+		s.index.remove(member)
+		return true
+	case s.ints != nil:
+		n, ok := intsetMember(member)
+		return ok && s.ints.remove(n)
 	}
 
-	entry.Value = set
-	r.store[key] = entry
+	pos := s.lp.find(member, 1)
+	if pos < 0 {
+		return false
+	}
+	s.lp.remove(pos, 1)
+	return true
+}
 
-	return added, true
+// forEach calls fn for every member until fn returns false, the set must not change meanwhile
+func(s *redisSet) forEach(fn func(member string) bool) {
+	switch {
+	case s.dict != nil:
+		for _, member := range s.entries {
+			if !fn(member) {
+				return
+			}
+		}
+	case s.ints != nil:
+		for _, n := range s.ints {
+			if !fn(formatIntsetMember(n)) {
+				return
+			}
+		}
+	default:
+		s.lp.forEach(func(_ int, entry []byte) bool {
+			return fn(string(entry))
+		})
+	}
 }
 
-func(r *RedisCache) SISMEMBER(key string, member string) (int, bool) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func(s *redisSet) members() []string {
+	members := make([]string, 0, s.len())
+	s.forEach(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
 
-	entry, exists := r.store[key]
-	if !exists {
-		return 0, false
+// sample picks random members the way SRANDMEMBER does with its count (see samplePositions)
+func(s *redisSet) sample(count int64) []string {
+	if s.dict != nil {
+		return sampleSlice(s.entries, count)
 	}
+	// the compact encodings are small, copying their members out is cheap
+	return sampleSlice(s.members(), count)
+}
 
-	set, isSet := entry.Value.(map[string]struct{})
-	if !isSet {
-		return 0, false
+func(s *redisSet) convertToListpack() {
+	members := s.members()
+	s.ints = nil
+	for _, member := range members {
+		s.lp.append(member)
 	}
+}
 
-	// structure of set:
-	// set = map[string]struct{}{
-	// 		"member1": {},
-	// 		"member2": {}
-	// }
+func(s *redisSet) convertToHashtable() {
+	entries := s.members()
+	dict := make(map[string]int, len(entries)+1)
+	for i, member := range entries {
+		dict[member] = i
+	}
+	s.ints, s.lp, s.dict, s.entries, s.index = nil, listpack{}, dict, entries, newScanIndexOf(dict)
+}
 
-	_, ok := set[member]
-	if !ok {
-		return 0, true // member does not exist
+// setFor returns the set stored under key, nil if there is none; the caller must hold r.mu
+func(r *RedisCache) setFor(key string) (*redisSet, error) {
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, nil
 	}
 
-	// member exists
-	return 1, true
+	set, isSet := entry.Value.(*redisSet)
+	if !isSet {
+		return nil, ErrWrongType
+	}
+	return set, nil
 }
 
-func(r *RedisCache) SREM(key string, members []string) (int, bool) {
+func(r *RedisCache) SADD(key string, members []string) (int, error) {
+	// command syntax: SADD key member [member ...]
+	// returns the number of members that were not in the set yet, the others are simply ignored
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return 0, false
+	set, err := r.setFor(key)
+	if err != nil {
+		return 0, err
 	}
 
-	set, isSet := entry.Value.(map[string]struct{})
-	if !isSet {
-		return 0, false
+	if set == nil {
+		// new set is created
+		set = newRedisSet(&r.Config)
+		r.setEntry(key, &Entry{Type: "set", Value: set})
 	}
 
-	for _, v := range members {
-		_, ok := set[v]
-		if !ok {
-			continue
+	added := 0
+	for _, member := range members {
+		if set.add(member) {
+			added++
 		}
-
-		delete(set, v)
 	}
-
-	return 1, true
+	return added, nil
 }
 
-func(r *RedisCache) SCARD(key string) (int, bool) {
-	// this command returns the cardinality or number of elements in the set
-	// returns the number of elements & returns 1 if the key does not exist
+func(r *RedisCache) SISMEMBER(key string, member string) (bool, error) {
+	// command syntax: SISMEMBER key member
+	// a missing key is an empty set, so it has no members
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return 0, false
-	}
-
-	set, isSet := entry.Value.(map[string]struct{})
-	if !isSet {
-		return 0, false
+	set, err := r.setFor(key)
+	if set == nil {
+		return false, err
 	}
-
-	length := len(set)
-	return length, true
+	return set.has(member), nil
 }
 
-func(r *RedisCache) SMEMBERS(key string) ([]string, bool) {
-	// this command returns all members present in the set
-	// return type: Array of strings
+func(r *RedisCache) SREM(key string, members []string) (int, error) {
+	// command syntax: SREM key member [member ...]
+	// returns the number of members removed, the key goes away with the last member
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	entry, exists := r.store[key]
-	if !exists {
-		return nil, false
+	set, err := r.setFor(key)
+	if set == nil {
+		return 0, err
 	}
 
-	set, isSet := entry.Value.(map[string]struct{})
-	if !isSet {
-		return nil, false
+	removed := 0
+	for _, member := range members {
+		if set.remove(member) {
+			removed++
+		}
 	}
 
-	members := []string{}
-
-	// looping with for...range through the set to get all members inside it
-	for member := range set {
-		members = append(members, member)
+	if set.len() == 0 {
+		r.deleteEntry(key)
 	}
-
-	fmt.Print("members present: ", members)
-	return members, true
+	return removed, nil
 }
 
+func(r *RedisCache) SCARD(key string) (int, error) {
+	// this command returns the cardinality or number of elements in the set
+	// a missing key is an empty set, so its cardinality is 0
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
+	set, err := r.setFor(key)
+	if set == nil {
+		return 0, err
+	}
+	return set.len(), nil
+}
 
+func(r *RedisCache) SMEMBERS(key string) ([]string, error) {
+	// this command returns all members present in the set
+	// return type: Array of strings
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-
-
-
+	set, err := r.setFor(key)
+	if set == nil {
+		return []string{}, err
+	}
+	return set.members(), nil
+}
@@ -1 +1,320 @@
-package cache
\ No newline at end of file
+package cache
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"redis-clone/resp"
+)
+
+// sortedMembers runs a command that replies with a set and returns the members sorted, the order of a set is random
+func sortedMembers(t *testing.T, cache *RedisCache, args ...string) string {
+	t.Helper();
+
+	reply := cache.ExecuteCommands(NewClient(nil), command(args...));
+	if reply.Kind == resp.KindError {
+		return reply.Str;
+	};
+
+	members := make([]string, len(reply.Elems));
+	for i, elem := range reply.Elems {
+		members[i] = elem.Str;
+	};
+	slices.Sort(members);
+	return strings.Join(members, ",");
+}
+
+func TestSetAlgebra(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SADD", "a", "1", "2", "3", "4"}, ":4\r\n"},
+		{[]string{"SADD", "b", "3", "4", "5"}, ":3\r\n"},
+		{[]string{"SADD", "c", "4", "5", "6"}, ":3\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+	});
+
+	for _, c := range []struct{ args []string; expected string }{
+		{[]string{"SINTER", "a", "b"}, "3,4"},
+		{[]string{"SINTER", "a", "b", "c"}, "4"},
+		{[]string{"SINTER", "a", "missing"}, ""},
+		{[]string{"SINTER", "a"}, "1,2,3,4"},
+		{[]string{"SUNION", "a", "b", "missing"}, "1,2,3,4,5"},
+		{[]string{"SDIFF", "a", "b"}, "1,2"},
+		{[]string{"SDIFF", "a", "b", "c"}, "1,2"},
+		{[]string{"SDIFF", "b", "a"}, "5"},
+		{[]string{"SDIFF", "missing", "a"}, ""},
+		// a key of another type fails the command, even after an empty input
+		{[]string{"SINTER", "missing", "str"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"SUNION", "a", "str"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"SDIFF", "str", "a"}, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"SINTER"}, "ERR wrong number of arguments for 'sinter' command"},
+	} {
+		if got := sortedMembers(t, cache, c.args...); got != c.expected {
+			t.Errorf("%q: expected %q, but got %q", c.args, c.expected, got);
+		};
+	};
+}
+
+func TestSetAlgebraStore(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SADD", "a", "1", "2", "3", "4"}, ":4\r\n"},
+		{[]string{"SADD", "b", "3", "4", "5"}, ":3\r\n"},
+		{[]string{"SET", "dest", "old"}, "+OK\r\n"},
+		{[]string{"SINTERSTORE", "dest", "a", "b"}, ":2\r\n"},
+		{[]string{"SCARD", "dest"}, ":2\r\n"},
+		{[]string{"SUNIONSTORE", "dest", "a", "b"}, ":5\r\n"},
+		{[]string{"SDIFFSTORE", "dest", "a", "b"}, ":2\r\n"},
+		{[]string{"SISMEMBER", "dest", "1"}, ":1\r\n"},
+		// the destination can be one of the inputs
+		{[]string{"SDIFFSTORE", "a", "a", "dest"}, ":2\r\n"},
+		{[]string{"SMISMEMBER", "a", "1", "3", "4"}, "*3\r\n:0\r\n:1\r\n:1\r\n"},
+		// an empty result deletes the destination
+		{[]string{"SINTERSTORE", "dest", "a", "missing"}, ":0\r\n"},
+		{[]string{"SMISMEMBER", "dest", "1"}, "*1\r\n:0\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"SUNIONSTORE", "dest", "a", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SUNIONSTORE", "dest"}, "-ERR wrong number of arguments for 'sunionstore' command\r\n"},
+	});
+
+	if got := sortedMembers(t, cache, "SMEMBERS", "a"); got != "3,4" {
+		t.Errorf("Expected a to be 3,4 but got %q", got);
+	};
+}
+
+func TestSInterCard(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SADD", "a", "1", "2", "3", "4", "5"}, ":5\r\n"},
+		{[]string{"SADD", "b", "2", "3", "4", "5", "6"}, ":5\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b"}, ":4\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT", "2"}, ":2\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT", "0"}, ":4\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT", "10"}, ":4\r\n"},
+		{[]string{"SINTERCARD", "1", "a"}, ":5\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "missing"}, ":0\r\n"},
+		{[]string{"SINTERCARD", "0", "a"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"SINTERCARD", "x", "a"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"SINTERCARD", "3", "a", "b"}, "-ERR syntax error\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT", "-1"}, "-ERR LIMIT can't be negative\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "b", "LIMIT"}, "-ERR syntax error\r\n"},
+		{[]string{"RPUSH", "list", "1"}, ":1\r\n"},
+		{[]string{"SINTERCARD", "2", "a", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestSMove(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SADD", "src", "one", "two"}, ":2\r\n"},
+		{[]string{"SADD", "dst", "three"}, ":1\r\n"},
+		{[]string{"SMOVE", "src", "dst", "two"}, ":1\r\n"},
+		{[]string{"SMOVE", "src", "dst", "two"}, ":0\r\n"},
+		{[]string{"SMOVE", "src", "src", "one"}, ":1\r\n"},
+		{[]string{"SMOVE", "src", "new", "one"}, ":1\r\n"},
+		{[]string{"SCARD", "new"}, ":1\r\n"},
+		{[]string{"SMISMEMBER", "dst", "two", "three", "one"}, "*3\r\n:1\r\n:1\r\n:0\r\n"},
+		{[]string{"SMOVE", "missing", "dst", "x"}, ":0\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"SMOVE", "dst", "str", "two"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SMOVE", "str", "dst", "two"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SMISMEMBER", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SMISMEMBER", "dst"}, "-ERR wrong number of arguments for 'smismember' command\r\n"},
+	});
+
+	// the emptied source set is gone
+	cache.mu.Lock();
+	defer cache.mu.Unlock();
+	if _, exists := cache.store["src"]; exists {
+		t.Error("Expected the empty source set to be deleted");
+	};
+}
+
+func TestSPopAndSRandMember(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SADD", "s", "a", "b", "c", "d", "e"}, ":5\r\n"},
+		{[]string{"SRANDMEMBER", "missing"}, "$-1\r\n"},
+		{[]string{"SRANDMEMBER", "missing", "3"}, "*0\r\n"},
+		{[]string{"SRANDMEMBER", "s", "0"}, "*0\r\n"},
+		{[]string{"SPOP", "missing"}, "$-1\r\n"},
+		{[]string{"SPOP", "missing", "2"}, "*0\r\n"},
+		{[]string{"SPOP", "s", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"SRANDMEMBER", "s", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SRANDMEMBER", "s", "-9223372036854775807"}, "-ERR value is out of range\r\n"},
+		{[]string{"SRANDMEMBER", "s", "-9223372036854775808"}, "-ERR value is out of range\r\n"},
+		{[]string{"SPOP", "s", "1", "2"}, "-ERR wrong number of arguments for 'spop' command\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"SRANDMEMBER", "str", "2"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SPOP", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+
+	// a positive count gives distinct members, never more than the set has
+	if got := sortedMembers(t, cache, "SRANDMEMBER", "s", "10"); got != "a,b,c,d,e" {
+		t.Errorf("Expected every member, but got %q", got);
+	};
+	reply := cache.ExecuteCommands(NewClient(nil), command("SRANDMEMBER", "s", "3"));
+	seen := map[string]bool{};
+	for _, elem := range reply.Elems {
+		seen[elem.Str] = true;
+	};
+	if len(reply.Elems) != 3 || len(seen) != 3 {
+		t.Errorf("Expected 3 distinct members, but got %v", reply.Elems);
+	};
+
+	// a negative count gives exactly that many members, repeating them
+	reply = cache.ExecuteCommands(NewClient(nil), command("SRANDMEMBER", "s", "-20"));
+	if len(reply.Elems) != 20 {
+		t.Errorf("Expected 20 members, but got %d", len(reply.Elems));
+	};
+
+	// popped members leave the set, the last one takes the key with it
+	popped := sortedMembers(t, cache, "SPOP", "s", "2");
+	remaining := sortedMembers(t, cache, "SMEMBERS", "s");
+	if len(strings.Split(popped, ",")) != 2 || len(strings.Split(remaining, ",")) != 3 {
+		t.Errorf("Expected 2 popped and 3 remaining, but got %q and %q", popped, remaining);
+	};
+	for _, member := range strings.Split(popped, ",") {
+		if strings.Contains(remaining, member) {
+			t.Errorf("Popped member %q is still in the set", member);
+		};
+	};
+
+	if got := sortedMembers(t, cache, "SPOP", "s", "5"); got != remaining {
+		t.Errorf("Expected the rest %q, but got %q", remaining, got);
+	};
+	cache.mu.Lock();
+	defer cache.mu.Unlock();
+	if _, exists := cache.store["s"]; exists {
+		t.Error("Expected the emptied set to be deleted");
+	};
+}
+
+// every member should come up about equally often, whether counts are positive or negative, in every encoding
+// (the hashtable ones pick by position, a few members by drawing until they are distinct, many by shuffling)
+func TestRandomMembersAreUniform(t *testing.T) {
+	members := make([]string, 10);
+	for i := range members {
+		members[i] = string(rune('a' + i));
+	};
+
+	for _, limit := range []int{128, 4} {
+		cache := NewRedisServer();
+		cache.Config.SetMaxListpackEntries = limit;
+		cache.Config.HashMaxListpackEntries = limit;
+		cache.ExecuteCommands(NewClient(nil), command(append([]string{"SADD", "s"}, members...)...));
+		for _, member := range members {
+			cache.ExecuteCommands(NewClient(nil), command("HSET", "h", member, "v"));
+		};
+
+		for _, cmd := range []string{"SRANDMEMBER s", "HRANDFIELD h"} {
+			for _, count := range []int{1, 3, 5, -3} {
+				const rounds = 20000;
+				seen := map[string]int{};
+				args := append(strings.Fields(cmd), strconv.Itoa(count));
+				for i := 0; i < rounds; i++ {
+					reply := cache.ExecuteCommands(NewClient(nil), command(args...));
+					for _, elem := range reply.Elems {
+						seen[elem.Str]++;
+					};
+				};
+
+				// each member is expected rounds*|count|/10 times
+				expected := rounds * max(count, -count) / 10;
+				for _, member := range members {
+					if seen[member] < expected*9/10 || seen[member] > expected*11/10 {
+						t.Errorf("%s %d (limit %d): member %q came up %d times, expected about %d", cmd, count, limit, member, seen[member], expected);
+					};
+				};
+			};
+		};
+	};
+}
+
+// one random member of a big set must not cost a walk over the whole set
+// go test ./cache -run '^$' -bench RandomMember
+func BenchmarkRandomMember(b *testing.B) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+	for i := 0; i < 1000000; i++ {
+		cache.ExecuteCommands(client, command("SADD", "s", strconv.Itoa(i) + "m"));
+	};
+
+	b.ResetTimer();
+	for i := 0; i < b.N; i++ {
+		cache.ExecuteCommands(client, command("SRANDMEMBER", "s"));
+		cache.ExecuteCommands(client, command("SPOP", "s"));
+		cache.ExecuteCommands(client, command("SADD", "s", strconv.Itoa(i) + "x"));
+	};
+}
+
+func TestSetEncodings(t *testing.T) {
+	cache := NewRedisServer();
+	cache.Config.SetMaxIntsetEntries = 4;
+	cache.Config.SetMaxListpackEntries = 3;
+	cache.Config.SetMaxListpackValue = 5;
+
+	runSteps(t, cache, []step{
+		// integers only: an intset, until there are too many of them
+		{[]string{"SADD", "ints", "3", "-1", "2"}, ":3\r\n"},
+		{[]string{"OBJECT", "ENCODING", "ints"}, "$6\r\nintset\r\n"},
+		{[]string{"SADD", "ints", "10", "2"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "ints"}, "$6\r\nintset\r\n"},
+		{[]string{"SADD", "ints", "11"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "ints"}, "$9\r\nhashtable\r\n"},
+		{[]string{"SCARD", "ints"}, ":5\r\n"},
+
+		// "010" is not how 10 is written, so it is not an integer member
+		{[]string{"SADD", "small", "1", "2"}, ":2\r\n"},
+		{[]string{"SADD", "small", "010"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "small"}, "$8\r\nlistpack\r\n"},
+		{[]string{"SMISMEMBER", "small", "1", "010", "10"}, "*3\r\n:1\r\n:1\r\n:0\r\n"},
+		{[]string{"SADD", "small", "x"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "small"}, "$9\r\nhashtable\r\n"},
+
+		// a member longer than the value limit skips the listpack
+		{[]string{"SADD", "long", "abcdef"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "long"}, "$9\r\nhashtable\r\n"},
+
+		// the encoding is never given up, not even when the set shrinks
+		{[]string{"SREM", "small", "x", "010", "missing"}, ":2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "small"}, "$9\r\nhashtable\r\n"},
+
+		// set algebra results get the encoding that fits them
+		{[]string{"SINTERSTORE", "both", "ints", "small"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "both"}, "$6\r\nintset\r\n"},
+	});
+
+	if got := sortedMembers(t, cache, "SMEMBERS", "ints"); got != "-1,10,11,2,3" {
+		t.Errorf("Expected the members to survive the conversion, but got %q", got);
+	};
+}
+
+// a missing key is an empty set, and a set that loses its last member is gone
+func TestSetMissingAndEmptied(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SISMEMBER", "missing", "a"}, ":0\r\n"},
+		{[]string{"SCARD", "missing"}, ":0\r\n"},
+		{[]string{"SREM", "missing", "a"}, ":0\r\n"},
+		{[]string{"SMEMBERS", "missing"}, "*0\r\n"},
+		{[]string{"SADD", "s", "a", "b"}, ":2\r\n"},
+		{[]string{"SREM", "s", "a", "c"}, ":1\r\n"},
+		{[]string{"SREM", "s", "b"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "s"}, "$-1\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"SISMEMBER", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SCARD", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SMEMBERS", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SADD", "str", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
@@ -0,0 +1,432 @@
+package cache
+
+import "math/rand"
+
+// the ordered half of a sorted set, a port of Redis' zskiplist (t_zset.c)
+// nodes are sorted by score, members with the same score by their bytes
+// every forward pointer also stores its span (how many nodes it jumps over), so the rank of a node is the sum of the
+// spans on the way to it, which makes ZRANK and ZRANGE by index O(log n) instead of a walk through the whole list
+
+const (
+	skiplistMaxLevel = 32 // enough for 2^64 elements
+	skiplistP = 0.25 // chance for a node to get one more level
+)
+
+type skiplistNode struct {
+	member 		string
+	score 		float64
+	backward 	*skiplistNode // previous node on level 0, nil for the first one
+	level 		[]skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span 	int
+}
+
+type skiplist struct {
+	header 	*skiplistNode // a sentinel, not an element
+	tail 	*skiplistNode
+	length 	int
+	level 	int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &skiplistNode{level: make([]skiplistLevel, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+// before reports whether the node sorts before (score, member)
+func(n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds a member that is not in the list yet
+func(zsl *skiplist) insert(score float64, member string) *skiplistNode {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	// finding the last node before the new one on every level, and its rank
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &skiplistNode{member: member, score: score, level: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+
+		// the new node takes over the part of the old span that comes after it
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+
+	// the levels above the new node now jump over one more node
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+
+	zsl.length++
+	return x
+}
+
+// deleteNode unlinks x, update holds the last node before x on every level
+func(zsl *skiplist) deleteNode(x *skiplistNode, update []*skiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// findUpdate returns the last node before (score, member) on every level
+func(zsl *skiplist) findUpdate(score float64, member string) [skiplistMaxLevel]*skiplistNode {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	return update
+}
+
+func(zsl *skiplist) delete(score float64, member string) bool {
+	update := zsl.findUpdate(score, member)
+
+	x := update[0].level[0].forward
+	if x != nil && x.score == score && x.member == member {
+		zsl.deleteNode(x, update[:])
+		return true
+	}
+	return false
+}
+
+// updateScore moves a member from score to newScore
+func(zsl *skiplist) updateScore(score float64, member string, newScore float64) *skiplistNode {
+	update := zsl.findUpdate(score, member)
+	x := update[0].level[0].forward
+
+	// if the node stays between the same neighbours, only its score changes
+	if (x.backward == nil || x.backward.score < newScore) && (x.level[0].forward == nil || x.level[0].forward.score > newScore) {
+		x.score = newScore
+		return x
+	}
+
+	zsl.deleteNode(x, update[:])
+	return zsl.insert(newScore, member)
+}
+
+// rank returns the 1-based position of a member, 0 if it is not in the list
+func(zsl *skiplist) rank(score float64, member string) int {
+	rank := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && (x.level[i].forward.before(score, member) || (x.level[i].forward.score == score && x.level[i].forward.member == member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at a 1-based position
+func(zsl *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// scoreRange is a "min max" pair of ZRANGEBYSCORE, ZCOUNT, ... like "(1 +inf"
+type scoreRange struct {
+	min 			float64
+	max 			float64
+	minExclusive 	bool
+	maxExclusive 	bool
+}
+
+func(r scoreRange) aboveMin(score float64) bool {
+	if r.minExclusive {
+		return score > r.min
+	}
+	return score >= r.min
+}
+
+func(r scoreRange) belowMax(score float64) bool {
+	if r.maxExclusive {
+		return score < r.max
+	}
+	return score <= r.max
+}
+
+func(r scoreRange) contains(score float64) bool {
+	return r.aboveMin(score) && r.belowMax(score)
+}
+
+func(r scoreRange) empty() bool {
+	return r.min > r.max || (r.min == r.max && (r.minExclusive || r.maxExclusive))
+}
+
+// firstInRange returns the first node with a score inside the range
+func(zsl *skiplist) firstInRange(r scoreRange) *skiplistNode {
+	if r.empty() || zsl.tail == nil || !r.aboveMin(zsl.tail.score) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !r.belowMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lastInRange returns the last node with a score inside the range
+func(zsl *skiplist) lastInRange(r scoreRange) *skiplistNode {
+	if r.empty() || zsl.header.level[0].forward == nil || !r.belowMax(zsl.header.level[0].forward.score) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == zsl.header || !r.aboveMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+// lexBound is one side of a ZRANGEBYLEX range: "[a" (inclusive), "(a" (exclusive), "-" or "+"
+type lexBound struct {
+	value 		string
+	exclusive 	bool
+	infinity 	int // -1 for "-", +1 for "+", 0 for a real value
+}
+
+type lexRange struct {
+	min lexBound
+	max lexBound
+}
+
+func(r lexRange) aboveMin(member string) bool {
+	switch {
+	case r.min.infinity < 0:
+		return true
+	case r.min.infinity > 0:
+		return false
+	case r.min.exclusive:
+		return member > r.min.value
+	}
+	return member >= r.min.value
+}
+
+func(r lexRange) belowMax(member string) bool {
+	switch {
+	case r.max.infinity > 0:
+		return true
+	case r.max.infinity < 0:
+		return false
+	case r.max.exclusive:
+		return member < r.max.value
+	}
+	return member <= r.max.value
+}
+
+func(r lexRange) contains(member string) bool {
+	return r.aboveMin(member) && r.belowMax(member)
+}
+
+func(r lexRange) empty() bool {
+	if r.min.infinity > 0 || r.max.infinity < 0 {
+		return true
+	}
+	if r.min.infinity < 0 || r.max.infinity > 0 {
+		return false
+	}
+	return r.min.value > r.max.value || (r.min.value == r.max.value && (r.min.exclusive || r.max.exclusive))
+}
+
+// lex ranges only make sense when all members have the same score, then the list is sorted by member
+func(zsl *skiplist) firstInLexRange(r lexRange) *skiplistNode {
+	if r.empty() || zsl.tail == nil || !r.aboveMin(zsl.tail.member) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if x == nil || !r.belowMax(x.member) {
+		return nil
+	}
+	return x
+}
+
+func(zsl *skiplist) lastInLexRange(r lexRange) *skiplistNode {
+	if r.empty() || zsl.header.level[0].forward == nil || !r.belowMax(zsl.header.level[0].forward.member) {
+		return nil
+	}
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+	}
+
+	if x == zsl.header || !r.aboveMin(x.member) {
+		return nil
+	}
+	return x
+}
+
+// deleteRangeByScore removes every node inside the range and returns their members
+func(zsl *skiplist) deleteRangeByScore(r scoreRange) []string {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	removed := []string{}
+	for x = x.level[0].forward; x != nil && r.belowMax(x.score); {
+		next := x.level[0].forward
+		zsl.deleteNode(x, update[:])
+		removed = append(removed, x.member)
+		x = next
+	}
+	return removed
+}
+
+func(zsl *skiplist) deleteRangeByLex(r lexRange) []string {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	removed := []string{}
+	for x = x.level[0].forward; x != nil && r.belowMax(x.member); {
+		next := x.level[0].forward
+		zsl.deleteNode(x, update[:])
+		removed = append(removed, x.member)
+		x = next
+	}
+	return removed
+}
+
+// deleteRangeByRank removes the nodes at the 1-based positions start to end (inclusive)
+func(zsl *skiplist) deleteRangeByRank(start int, end int) []string {
+	var update [skiplistMaxLevel]*skiplistNode
+	traversed := 0
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span < start {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	removed := []string{}
+	traversed++
+	for x = x.level[0].forward; x != nil && traversed <= end; traversed++ {
+		next := x.level[0].forward
+		zsl.deleteNode(x, update[:])
+		removed = append(removed, x.member)
+		x = next
+	}
+	return removed
+}
@@ -0,0 +1,983 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"redis-clone/resp"
+)
+
+// commands needed to be implemented:
+// XGROUP CREATE, DESTROY, SETID, CREATECONSUMER, DELCONSUMER		--> Done
+// XREADGROUP [COUNT] [BLOCK] [NOACK] with ">" and explicit IDs		--> Done
+// XACK, XPENDING (summary and extended)							--> Done
+// XCLAIM, XAUTOCLAIM												--> Done
+// XINFO STREAM [FULL], XINFO GROUPS, XINFO CONSUMERS				--> Done
+
+// a consumer group is a cursor into the stream shared by its consumers: XREADGROUP ... > hands every new entry to exactly
+// one consumer, and the entry stays in the group's pending entries list (PEL) until that consumer XACKs it
+// entries whose consumer died can be taken over with XCLAIM / XAUTOCLAIM once they have been idle long enough
+
+type consumerGroup struct {
+	lastID 		StreamID // the last entry handed out with ">"
+	entriesRead int64 // how many entries of the stream the group has read, -1 when that is not known
+	pel 		map[StreamID]*pendingEntry
+	consumers 	map[string]*consumer
+}
+
+// pendingEntry is an entry that was delivered but not acknowledged yet
+type pendingEntry struct {
+	consumer 		*consumer
+	deliveryTime 	int64 // unix ms of the last delivery
+	deliveryCount 	int64
+}
+
+type consumer struct {
+	name 		string
+	seenTime 	int64 // unix ms of the last read or claim attempt
+	activeTime 	int64 // unix ms of the last successful one, -1 for never
+	pending 	map[StreamID]*pendingEntry // the part of the group's PEL owned by this consumer
+}
+
+// entriesReadUnknown is the entriesRead of a group whose position in the stream cannot be worked out
+const entriesReadUnknown = -1
+
+func newConsumerGroup(lastID StreamID, entriesRead int64) *consumerGroup {
+	return &consumerGroup{
+		lastID: lastID,
+		entriesRead: entriesRead,
+		pel: make(map[StreamID]*pendingEntry),
+		consumers: make(map[string]*consumer),
+	}
+}
+
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+// consumer returns the consumer called name, creating it if needed, created tells whether it is new
+func(g *consumerGroup) consumer(name string) (c *consumer, created bool) {
+	if c, exists := g.consumers[name]; exists {
+		return c, false
+	}
+
+	c = &consumer{name: name, seenTime: nowMs(), activeTime: -1, pending: make(map[StreamID]*pendingEntry)}
+	g.consumers[name] = c
+	return c, true
+}
+
+// deliver adds id to the PEL as delivered to c right now, taking it over if another consumer had it
+func(g *consumerGroup) deliver(id StreamID, c *consumer, now int64) {
+	if p, exists := g.pel[id]; exists {
+		delete(p.consumer.pending, id)
+		p.consumer, p.deliveryTime, p.deliveryCount = c, now, 1
+		c.pending[id] = p
+		return
+	}
+
+	p := &pendingEntry{consumer: c, deliveryTime: now, deliveryCount: 1}
+	g.pel[id] = p
+	c.pending[id] = p
+}
+
+// claim moves a pending entry over to c
+func(g *consumerGroup) claim(id StreamID, p *pendingEntry, c *consumer) {
+	delete(p.consumer.pending, id)
+	p.consumer = c
+	c.pending[id] = p
+}
+
+func(g *consumerGroup) ack(id StreamID) bool {
+	p, exists := g.pel[id]
+	if !exists {
+		return false
+	}
+
+	delete(p.consumer.pending, id)
+	delete(g.pel, id)
+	return true
+}
+
+// sortedIDs returns the IDs of a PEL in order, the maps are not ordered but every reply that lists them is
+func sortedIDs(pel map[StreamID]*pendingEntry) []StreamID {
+	ids := make([]StreamID, 0, len(pel))
+	for id := range pel {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+// entry returns the stream entry with exactly this ID
+func(s *stream) entry(id StreamID) (StreamEntry, bool) {
+	i := s.search(id)
+	if i == len(s.entries) || s.entries[i].ID != id {
+		return StreamEntry{}, false
+	}
+	return s.entries[i], true
+}
+
+// firstID is the ID of the first entry, 0-0 for an empty stream
+func(s *stream) firstID() StreamID {
+	if len(s.entries) == 0 {
+		return StreamID{}
+	}
+	return s.entries[0].ID
+}
+
+// hasTombstonesAfter reports whether an entry with an ID of at least start was deleted with XDEL
+// only then the number of entries between start and the end of the stream cannot be worked out from the counters
+func(s *stream) hasTombstonesAfter(start StreamID) bool {
+	if len(s.entries) == 0 || s.maxDeletedID == (StreamID{}) || s.maxDeletedID.less(s.firstID()) {
+		return false
+	}
+	return !s.maxDeletedID.less(start)
+}
+
+// entriesBefore estimates how many entries were ever added up to and including id, like streamEstimateDistanceFromFirstEverEntry
+func(s *stream) entriesBefore(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if len(s.entries) == 0 && !s.lastID.less(id) {
+		return int64(s.entriesAdded)
+	}
+	if id == s.lastID {
+		return int64(s.entriesAdded)
+	}
+	if s.lastID.less(id) {
+		return entriesReadUnknown
+	}
+
+	// without deleted entries in the stream, everything before the first entry was trimmed
+	if s.maxDeletedID == (StreamID{}) || s.maxDeletedID.less(s.firstID()) {
+		first := s.firstID()
+		if id.less(first) {
+			return int64(s.entriesAdded) - int64(len(s.entries))
+		}
+		if id == first {
+			return int64(s.entriesAdded) - int64(len(s.entries)) + 1
+		}
+	}
+	return entriesReadUnknown
+}
+
+// lag is the number of entries the group has not read yet, ok is false when it cannot be known
+func(s *stream) lag(g *consumerGroup) (int64, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if g.entriesRead != entriesReadUnknown && !s.hasTombstonesAfter(g.lastID) {
+		return int64(s.entriesAdded) - g.entriesRead, true
+	}
+
+	read := s.entriesBefore(g.lastID)
+	if read == entriesReadUnknown {
+		return 0, false
+	}
+	return int64(s.entriesAdded) - read, true
+}
+
+// groupFor returns the stream under key and its group, either is nil when missing, the caller must hold r.mu
+func(r *RedisCache) groupFor(key string, group string) (*stream, *consumerGroup, error) {
+	s, err := r.streamFor(key)
+	if s == nil {
+		return nil, nil, err
+	}
+	return s, s.groups[group], nil
+}
+
+// parseGroupID reads the ID argument of XGROUP CREATE and SETID, "$" is the last ID of the stream
+func parseGroupID(arg []byte, s *stream) (StreamID, error) {
+	if string(arg) == "$" {
+		if s == nil {
+			return StreamID{}, nil
+		}
+		return s.lastID, nil
+	}
+
+	id, ok := parseStreamID(arg, 0)
+	if !ok {
+		return id, ErrInvalidStreamID
+	}
+	return id, nil
+}
+
+// parseEntriesRead reads the value of an ENTRIESREAD option
+func parseEntriesRead(arg []byte) (int64, error) {
+	entriesRead, ok := parseInteger(arg)
+	if !ok {
+		return 0, ErrNotInteger
+	}
+	if entriesRead < 0 && entriesRead != entriesReadUnknown {
+		return 0, ErrEntriesRead
+	}
+	return entriesRead, nil
+}
+
+func(r *RedisCache) XGROUPCREATE(key string, group string, rawID []byte, mkStream bool, entriesRead int64) error {
+	// command syntax: XGROUP CREATE key group id | $ [MKSTREAM] [ENTRIESREAD entries-read]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseGroupID(rawID, s)
+	if err != nil {
+		return err
+	}
+
+	if s == nil {
+		if !mkStream {
+			return ErrXGroupKeyMissing
+		}
+		s = newStream()
+		r.setEntry(key, &Entry{Type: "stream", Value: s})
+	}
+
+	if _, exists := s.groups[group]; exists {
+		return ErrBusyGroup
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*consumerGroup)
+	}
+
+	s.groups[group] = newConsumerGroup(id, entriesRead)
+	return nil
+}
+
+func(r *RedisCache) XGROUPSETID(key string, group string, rawID []byte, entriesRead int64) error {
+	// command syntax: XGROUP SETID key group id | $ [ENTRIESREAD entries-read]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return ErrXGroupKeyMissing
+	}
+	if g == nil {
+		return errNoGroupForKey(key, group)
+	}
+
+	id, err := parseGroupID(rawID, s)
+	if err != nil {
+		return err
+	}
+
+	g.lastID, g.entriesRead = id, entriesRead
+	return nil
+}
+
+func(r *RedisCache) XGROUPDESTROY(key string, group string) (bool, error) {
+	// command syntax: XGROUP DESTROY key group --> 1 if the group existed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return false, err
+	}
+	if s == nil {
+		return false, ErrXGroupKeyMissing
+	}
+	if g == nil {
+		return false, nil
+	}
+
+	delete(s.groups, group)
+
+	// clients blocked in XREADGROUP on this group find out that it is gone
+	r.signalKey(key)
+	return true, nil
+}
+
+func(r *RedisCache) XGROUPCREATECONSUMER(key string, group string, name string) (bool, error) {
+	// command syntax: XGROUP CREATECONSUMER key group consumer --> 1 if the consumer is new
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return false, err
+	}
+	if s == nil {
+		return false, ErrXGroupKeyMissing
+	}
+	if g == nil {
+		return false, errNoGroupForKey(key, group)
+	}
+
+	_, created := g.consumer(name)
+	return created, nil
+}
+
+func(r *RedisCache) XGROUPDELCONSUMER(key string, group string, name string) (int, error) {
+	// command syntax: XGROUP DELCONSUMER key group consumer
+	// returns how many entries the consumer still had pending, they are dropped from the PEL with it
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return 0, err
+	}
+	if s == nil {
+		return 0, ErrXGroupKeyMissing
+	}
+	if g == nil {
+		return 0, errNoGroupForKey(key, group)
+	}
+
+	c, exists := g.consumers[name]
+	if !exists {
+		return 0, nil
+	}
+
+	pending := len(c.pending)
+	for id := range c.pending {
+		delete(g.pel, id)
+	}
+	delete(g.consumers, name)
+	return pending, nil
+}
+
+// groupReadID is one ID of an XREADGROUP: ">" for entries never delivered to the group, or an ID to re-read
+// the consumer's own pending entries after it
+type groupReadID struct {
+	id 			StreamID
+	newEntries 	bool
+}
+
+func parseGroupReadIDs(rawIDs [][]byte) ([]groupReadID, error) {
+	ids := make([]groupReadID, len(rawIDs))
+	for i, raw := range rawIDs {
+		if string(raw) == ">" {
+			ids[i].newEntries = true
+			continue
+		}
+
+		id, ok := parseStreamID(raw, 0)
+		if !ok {
+			return nil, ErrInvalidStreamID
+		}
+		ids[i].id = id
+	}
+	return ids, nil
+}
+
+func(r *RedisCache) XREADGROUP(group string, name string, keys []string, ids []groupReadID, count int64, noAck bool) ([]StreamRead, error) {
+	// command syntax: XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+	// with ">" the entries after the group's last ID are handed to the consumer and added to the PEL (unless NOACK),
+	// with an ID the consumer's own pending entries after it are delivered again, a deleted one comes back with no fields
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// every key and group has to exist before anything is read
+	groups := make([]*consumerGroup, len(keys))
+	streams := make([]*stream, len(keys))
+	for i, key := range keys {
+		s, g, err := r.groupFor(key, group)
+		if err != nil {
+			return nil, err
+		}
+		if g == nil {
+			return nil, errNoGroupReadGroup(key, group)
+		}
+		streams[i], groups[i] = s, g
+	}
+
+	now := nowMs()
+	result := []StreamRead{}
+
+	for i, key := range keys {
+		s, g := streams[i], groups[i]
+		c, _ := g.consumer(name)
+		c.seenTime = now
+
+		if !ids[i].newEntries {
+			entries := []StreamEntry{}
+			for _, id := range sortedIDs(c.pending) {
+				if !ids[i].id.less(id) {
+					continue
+				}
+				if count > 0 && int64(len(entries)) == count {
+					break
+				}
+
+				// an entry deleted since it was delivered is still pending, it is reported with nil fields
+				entry, exists := s.entry(id)
+				if exists {
+					p := c.pending[id]
+					p.deliveryTime = now
+					p.deliveryCount++
+				} else {
+					entry = StreamEntry{ID: id}
+				}
+				entries = append(entries, entry)
+			}
+
+			result = append(result, StreamRead{Key: key, Entries: entries})
+			continue
+		}
+
+		after, ok := g.lastID.next()
+		if !ok {
+			continue
+		}
+
+		start := s.search(after)
+		end := len(s.entries)
+		if count > 0 && int64(end-start) > count {
+			end = start + int(count)
+		}
+		if start == end {
+			continue
+		}
+
+		entries := append([]StreamEntry{}, s.entries[start:end]...)
+		for _, entry := range entries {
+			// the group's read counter can be kept exact as long as no deleted entries lie ahead
+			if g.entriesRead != entriesReadUnknown && !s.hasTombstonesAfter(entry.ID) {
+				g.entriesRead++
+			} else {
+				g.entriesRead = s.entriesBefore(entry.ID)
+			}
+			g.lastID = entry.ID
+
+			if !noAck {
+				g.deliver(entry.ID, c, now)
+			}
+		}
+		c.activeTime = now
+
+		result = append(result, StreamRead{Key: key, Entries: entries})
+	}
+
+	return result, nil
+}
+
+func(r *RedisCache) XACK(key string, group string, ids []StreamID) (int, error) {
+	// command syntax: XACK key group id [id ...] --> the number of entries removed from the PEL
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, g, err := r.groupFor(key, group)
+	if g == nil {
+		return 0, err
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if g.ack(id) {
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+// PendingSummary is the reply of XPENDING key group
+type PendingSummary struct {
+	Count 		int
+	Min 		StreamID
+	Max 		StreamID
+	Consumers 	[]ConsumerPending // sorted by name
+}
+
+type ConsumerPending struct {
+	Name 	string
+	Count 	int
+}
+
+// PendingInfo is one line of XPENDING key group start end count
+type PendingInfo struct {
+	ID 				StreamID
+	Consumer 		string
+	Idle 			int64 // ms since the last delivery
+	DeliveryCount 	int64
+}
+
+func(r *RedisCache) XPENDINGSUMMARY(key string, group string) (PendingSummary, error) {
+	// command syntax: XPENDING key group
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var summary PendingSummary
+
+	_, g, err := r.groupFor(key, group)
+	if err != nil {
+		return summary, err
+	}
+	if g == nil {
+		return summary, errNoGroup(key, group)
+	}
+
+	ids := sortedIDs(g.pel)
+	summary.Count = len(ids)
+	if len(ids) == 0 {
+		return summary, nil
+	}
+	summary.Min, summary.Max = ids[0], ids[len(ids)-1]
+
+	for name, c := range g.consumers {
+		if len(c.pending) > 0 {
+			summary.Consumers = append(summary.Consumers, ConsumerPending{Name: name, Count: len(c.pending)})
+		}
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool { return summary.Consumers[i].Name < summary.Consumers[j].Name })
+	return summary, nil
+}
+
+func(r *RedisCache) XPENDING(key string, group string, minIdle int64, start StreamID, end StreamID, count int64, consumerName string) ([]PendingInfo, error) {
+	// command syntax: XPENDING key group [IDLE min-idle-time] start end count [consumer]
+	// lists the pending entries between start and end that are idle for at least minIdle ms, only consumerName's if given
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, g, err := r.groupFor(key, group)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errNoGroup(key, group)
+	}
+
+	pel := g.pel
+	if consumerName != "" {
+		c, exists := g.consumers[consumerName]
+		if !exists {
+			return []PendingInfo{}, nil
+		}
+		pel = c.pending
+	}
+
+	now := nowMs()
+	result := []PendingInfo{}
+	for _, id := range sortedIDs(pel) {
+		if int64(len(result)) >= count {
+			break
+		}
+		if id.less(start) || end.less(id) {
+			continue
+		}
+
+		p := pel[id]
+		idle := max(now-p.deliveryTime, 0)
+		if idle < minIdle {
+			continue
+		}
+		result = append(result, PendingInfo{ID: id, Consumer: p.consumer.name, Idle: idle, DeliveryCount: p.deliveryCount})
+	}
+	return result, nil
+}
+
+// XClaimOptions holds the options of XCLAIM after the IDs
+type XClaimOptions struct {
+	Idle 		int64 // set the delivery time this many ms in the past, -1 when not given
+	Time 		int64 // set the delivery time to this unix ms, -1 when not given
+	RetryCount 	int64 // set the delivery count, -1 when not given
+	Force 		bool // claim IDs that are in the stream but not in the PEL too
+	JustID 		bool // reply with IDs only and leave the delivery count alone
+	LastID 		StreamID
+	HasLastID 	bool
+}
+
+// parseXClaimArgs reads "id [id ...] [options]" of XCLAIM, the IDs end at the first argument that is not one
+func parseXClaimArgs(args [][]byte) ([]StreamID, XClaimOptions, error) {
+	opts := XClaimOptions{Idle: -1, Time: -1, RetryCount: -1}
+
+	ids := []StreamID{}
+	i := 0
+	for ; i < len(args); i++ {
+		id, ok := parseStreamID(args[i], 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		hasValue := i+1 < len(args)
+
+		switch {
+		case option == "FORCE":
+			opts.Force = true
+		case option == "JUSTID":
+			opts.JustID = true
+		case option == "IDLE" && hasValue:
+			idle, ok := parseInteger(args[i+1])
+			if !ok {
+				return nil, opts, errInvalidClaimArgument("IDLE option", "XCLAIM")
+			}
+			opts.Idle = idle
+			i++
+		case option == "TIME" && hasValue:
+			unixMs, ok := parseInteger(args[i+1])
+			if !ok {
+				return nil, opts, errInvalidClaimArgument("TIME option", "XCLAIM")
+			}
+			opts.Time = unixMs
+			i++
+		case option == "RETRYCOUNT" && hasValue:
+			retryCount, ok := parseInteger(args[i+1])
+			if !ok {
+				return nil, opts, errInvalidClaimArgument("RETRYCOUNT option", "XCLAIM")
+			}
+			opts.RetryCount = retryCount
+			i++
+		case option == "LASTID" && hasValue:
+			lastID, ok := parseStreamID(args[i+1], 0)
+			if !ok {
+				return nil, opts, ErrInvalidStreamID
+			}
+			opts.LastID, opts.HasLastID = lastID, true
+			i++
+		default:
+			return nil, opts, errUnrecognizedXClaimOption(string(args[i]))
+		}
+	}
+
+	return ids, opts, nil
+}
+
+func(r *RedisCache) XCLAIM(key string, group string, name string, minIdle int64, ids []StreamID, opts XClaimOptions) ([]StreamEntry, error) {
+	// command syntax: XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+	//                 [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+	// gives the pending entries idle for at least minIdle ms to the consumer and returns them (only their IDs with JUSTID)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, errNoGroup(key, group)
+	}
+
+	if opts.HasLastID && g.lastID.less(opts.LastID) {
+		g.lastID = opts.LastID
+	}
+
+	now := nowMs()
+	deliveryTime := now
+	if opts.Idle >= 0 {
+		deliveryTime = now - opts.Idle
+	} else if opts.Time >= 0 {
+		deliveryTime = opts.Time
+	}
+	// a delivery time in the future would make the entry look negatively idle
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+
+	c, _ := g.consumer(name)
+	c.seenTime = now
+
+	claimed := []StreamEntry{}
+	for _, id := range ids {
+		entry, inStream := s.entry(id)
+		p, pending := g.pel[id]
+
+		// FORCE creates the PEL entry for an entry of the stream that nobody has
+		if !pending && opts.Force && inStream {
+			p = &pendingEntry{consumer: c, deliveryTime: now, deliveryCount: 1}
+			g.pel[id] = p
+			c.pending[id] = p
+			pending = true
+		}
+		if !pending {
+			continue
+		}
+
+		// a pending entry that was deleted from the stream cannot be claimed, it is dropped from the PEL instead
+		if !inStream {
+			g.ack(id)
+			continue
+		}
+
+		if minIdle > 0 && now-p.deliveryTime < minIdle {
+			continue
+		}
+
+		g.claim(id, p, c)
+		p.deliveryTime = deliveryTime
+		if opts.RetryCount >= 0 {
+			p.deliveryCount = opts.RetryCount
+		} else if !opts.JustID {
+			p.deliveryCount++
+		}
+
+		if opts.JustID {
+			entry = StreamEntry{ID: id}
+		}
+		claimed = append(claimed, entry)
+		c.activeTime = now
+	}
+
+	return claimed, nil
+}
+
+func(r *RedisCache) XAUTOCLAIM(key string, group string, name string, minIdle int64, start StreamID, count int64, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	// command syntax: XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+	// like XCLAIM for the first count idle pending entries from start on, returns the ID to continue the scan from
+	// (0-0 once the end of the PEL was reached), the claimed entries and the IDs dropped because they were deleted
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+	if g == nil {
+		return StreamID{}, nil, nil, errNoGroup(key, group)
+	}
+
+	now := nowMs()
+	c, _ := g.consumer(name)
+	c.seenTime = now
+
+	claimed := []StreamEntry{}
+	deleted := []StreamID{}
+
+	// just like Redis, at most 10 PEL entries per requested one are looked at in one call
+	attempts := count * 10
+	ids := sortedIDs(g.pel)
+	i := sort.Search(len(ids), func(i int) bool { return !ids[i].less(start) })
+
+	for ; i < len(ids) && attempts > 0 && int64(len(claimed)) < count; i++ {
+		id := ids[i]
+		p := g.pel[id]
+		attempts--
+
+		entry, inStream := s.entry(id)
+		if !inStream {
+			g.ack(id)
+			deleted = append(deleted, id)
+			continue
+		}
+
+		if minIdle > 0 && now-p.deliveryTime < minIdle {
+			continue
+		}
+
+		g.claim(id, p, c)
+		p.deliveryTime = now
+		if !justID {
+			p.deliveryCount++
+		} else {
+			entry = StreamEntry{ID: id}
+		}
+		claimed = append(claimed, entry)
+		c.activeTime = now
+	}
+
+	next := StreamID{}
+	if i < len(ids) {
+		next = ids[i]
+	}
+	return next, claimed, deleted, nil
+}
+
+// the XINFO replies are maps of many different fields, so they are built right here while the stream is locked
+
+func(r *RedisCache) XINFOSTREAM(key string, full bool, count int64) (resp.Value, error) {
+	// command syntax: XINFO STREAM key [FULL [COUNT count]]
+	// FULL also lists the entries, every group with its PEL and every consumer, at most count of each list (0 for all)
+	// Redis also reports the shape of its radix tree here, which this stream does not have
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if s == nil {
+		return resp.Value{}, ErrNoSuchKey
+	}
+
+	fields := []resp.Value{
+		resp.BulkString("length"), resp.Integer(int64(len(s.entries))),
+		resp.BulkString("last-generated-id"), resp.BulkString(s.lastID.String()),
+		resp.BulkString("max-deleted-entry-id"), resp.BulkString(s.maxDeletedID.String()),
+		resp.BulkString("entries-added"), resp.Integer(int64(s.entriesAdded)),
+		resp.BulkString("recorded-first-entry-id"), resp.BulkString(s.firstID().String()),
+	}
+
+	if !full {
+		first, last := resp.Null(), resp.Null()
+		if len(s.entries) > 0 {
+			first = streamEntryReply(s.entries[0])
+			last = streamEntryReply(s.entries[len(s.entries)-1])
+		}
+
+		fields = append(fields,
+			resp.BulkString("groups"), resp.Integer(int64(len(s.groups))),
+			resp.BulkString("first-entry"), first,
+			resp.BulkString("last-entry"), last,
+		)
+		return resp.Map(fields...), nil
+	}
+
+	entries := s.entries
+	if count > 0 && int64(len(entries)) > count {
+		entries = entries[:count]
+	}
+
+	groups := []resp.Value{}
+	for _, name := range sortedGroupNames(s) {
+		g := s.groups[name]
+
+		pending := []resp.Value{}
+		for _, id := range limitIDs(sortedIDs(g.pel), count) {
+			p := g.pel[id]
+			pending = append(pending, resp.Array(
+				resp.BulkString(id.String()), resp.BulkString(p.consumer.name),
+				resp.Integer(p.deliveryTime), resp.Integer(p.deliveryCount),
+			))
+		}
+
+		consumers := []resp.Value{}
+		for _, c := range sortedConsumers(g) {
+			owned := []resp.Value{}
+			for _, id := range limitIDs(sortedIDs(c.pending), count) {
+				p := c.pending[id]
+				owned = append(owned, resp.Array(resp.BulkString(id.String()), resp.Integer(p.deliveryTime), resp.Integer(p.deliveryCount)))
+			}
+
+			consumers = append(consumers, resp.Map(
+				resp.BulkString("name"), resp.BulkString(c.name),
+				resp.BulkString("seen-time"), resp.Integer(c.seenTime),
+				resp.BulkString("active-time"), resp.Integer(c.activeTime),
+				resp.BulkString("pel-count"), resp.Integer(int64(len(c.pending))),
+				resp.BulkString("pending"), resp.Array(owned...),
+			))
+		}
+
+		groups = append(groups, resp.Map(
+			resp.BulkString("name"), resp.BulkString(name),
+			resp.BulkString("last-delivered-id"), resp.BulkString(g.lastID.String()),
+			resp.BulkString("entries-read"), entriesReadReply(g.entriesRead),
+			resp.BulkString("lag"), lagReply(s, g),
+			resp.BulkString("pel-count"), resp.Integer(int64(len(g.pel))),
+			resp.BulkString("pending"), resp.Array(pending...),
+			resp.BulkString("consumers"), resp.Array(consumers...),
+		))
+	}
+
+	fields = append(fields,
+		resp.BulkString("entries"), streamEntriesReply(entries),
+		resp.BulkString("groups"), resp.Array(groups...),
+	)
+	return resp.Map(fields...), nil
+}
+
+func(r *RedisCache) XINFOGROUPS(key string) (resp.Value, error) {
+	// command syntax: XINFO GROUPS key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if s == nil {
+		return resp.Value{}, ErrNoSuchKey
+	}
+
+	groups := []resp.Value{}
+	for _, name := range sortedGroupNames(s) {
+		g := s.groups[name]
+		groups = append(groups, resp.Map(
+			resp.BulkString("name"), resp.BulkString(name),
+			resp.BulkString("consumers"), resp.Integer(int64(len(g.consumers))),
+			resp.BulkString("pending"), resp.Integer(int64(len(g.pel))),
+			resp.BulkString("last-delivered-id"), resp.BulkString(g.lastID.String()),
+			resp.BulkString("entries-read"), entriesReadReply(g.entriesRead),
+			resp.BulkString("lag"), lagReply(s, g),
+		))
+	}
+	return resp.Array(groups...), nil
+}
+
+func(r *RedisCache) XINFOCONSUMERS(key string, group string) (resp.Value, error) {
+	// command syntax: XINFO CONSUMERS key group
+	// idle is the time since the consumer last tried to read or claim, inactive since it last succeeded (-1 for never)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, g, err := r.groupFor(key, group)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if s == nil {
+		return resp.Value{}, ErrNoSuchKey
+	}
+	if g == nil {
+		return resp.Value{}, errNoGroupForKey(key, group)
+	}
+
+	now := nowMs()
+	consumers := []resp.Value{}
+	for _, c := range sortedConsumers(g) {
+		inactive := int64(-1)
+		if c.activeTime >= 0 {
+			inactive = max(now-c.activeTime, 0)
+		}
+
+		consumers = append(consumers, resp.Map(
+			resp.BulkString("name"), resp.BulkString(c.name),
+			resp.BulkString("pending"), resp.Integer(int64(len(c.pending))),
+			resp.BulkString("idle"), resp.Integer(max(now-c.seenTime, 0)),
+			resp.BulkString("inactive"), resp.Integer(inactive),
+		))
+	}
+	return resp.Array(consumers...), nil
+}
+
+func sortedGroupNames(s *stream) []string {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedConsumers(g *consumerGroup) []*consumer {
+	consumers := make([]*consumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool { return consumers[i].name < consumers[j].name })
+	return consumers
+}
+
+func limitIDs(ids []StreamID, count int64) []StreamID {
+	if count > 0 && int64(len(ids)) > count {
+		return ids[:count]
+	}
+	return ids
+}
+
+func entriesReadReply(entriesRead int64) resp.Value {
+	if entriesRead == entriesReadUnknown {
+		return resp.Null()
+	}
+	return resp.Integer(entriesRead)
+}
+
+func lagReply(s *stream, g *consumerGroup) resp.Value {
+	lag, ok := s.lag(g)
+	if !ok {
+		return resp.Null()
+	}
+	return resp.Integer(lag)
+}
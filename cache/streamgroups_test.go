@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestXGroup(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"XGROUP", "CREATE", "s", "g", "$"}, "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"}, "+OK\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "0"}, "-BUSYGROUP Consumer Group name already exists\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g2", "0", "ENTRIESREAD", "-2"}, "-ERR value for ENTRIESREAD must be positive or -1\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g2", "0", "BOGUS"}, "-ERR syntax error\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g2", "abc"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"XGROUP", "CREATE", "s"}, "-ERR wrong number of arguments for 'xgroup|create' command\r\n"},
+		{[]string{"XGROUP", "NOPE", "s"}, "-ERR unknown subcommand 'NOPE'. Try XGROUP HELP.\r\n"},
+
+		{[]string{"XGROUP", "CREATECONSUMER", "s", "g", "alice"}, ":1\r\n"},
+		{[]string{"XGROUP", "CREATECONSUMER", "s", "g", "alice"}, ":0\r\n"},
+		{[]string{"XGROUP", "CREATECONSUMER", "s", "nope", "alice"}, "-NOGROUP No such consumer group 'nope' for key name 's'\r\n"},
+		{[]string{"XGROUP", "DELCONSUMER", "s", "g", "alice"}, ":0\r\n"},
+		{[]string{"XGROUP", "DELCONSUMER", "s", "g", "alice"}, ":0\r\n"},
+
+		{[]string{"XADD", "s", "1-0", "f", "v"}, "$3\r\n1-0\r\n"},
+		{[]string{"XGROUP", "SETID", "s", "g", "0", "ENTRIESREAD", "0"}, "+OK\r\n"},
+		{[]string{"XGROUP", "SETID", "s", "nope", "0"}, "-NOGROUP No such consumer group 'nope' for key name 's'\r\n"},
+		{[]string{"XGROUP", "SETID", "s", "g", "0", "MKSTREAM"}, "-ERR syntax error\r\n"},
+
+		{[]string{"XINFO", "GROUPS", "s"}, "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:0\r\n$7\r\npending\r\n:0\r\n" +
+			"$17\r\nlast-delivered-id\r\n$3\r\n0-0\r\n$12\r\nentries-read\r\n:0\r\n$3\r\nlag\r\n:1\r\n"},
+
+		{[]string{"XGROUP", "DESTROY", "s", "g"}, ":1\r\n"},
+		{[]string{"XGROUP", "DESTROY", "s", "g"}, ":0\r\n"},
+		{[]string{"XINFO", "GROUPS", "s"}, "*0\r\n"},
+		{[]string{"XINFO", "GROUPS", "missing"}, "-ERR no such key\r\n"},
+	});
+}
+
+func TestXReadGroup(t *testing.T) {
+	cache := NewRedisServer();
+
+	for i := 1; i <= 3; i++ {
+		cache.XADD("s", XAddOptions{ID: StreamID{uint64(i), 0}}, []string{"f", "v"});
+	};
+
+	entry := func(id string) string {
+		return "*2\r\n$3\r\n" + id + "\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n";
+	};
+
+	runSteps(t, cache, []step{
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"}, "-NOGROUP No such key 's' or consumer group 'g' in XREADGROUP with GROUP option\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g\r\n+OK", "alice", "STREAMS", "s", ">"}, "-NOGROUP No such key 's' or consumer group 'g  +OK' in XREADGROUP with GROUP option\r\n"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "0"}, "+OK\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "$"}, "-ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.\r\n"},
+		{[]string{"XREAD", "STREAMS", "s", ">"}, "-ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.\r\n"},
+
+		// new entries are handed out once, to whoever asks first
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*2\r\n" + entry("1-0") + entry("2-0")},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n" + entry("3-0")},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"}, "*-1\r\n"},
+
+		// the history only holds the consumer's own pending entries, even when there are none
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"}, "*1\r\n*2\r\n$1\r\ns\r\n*2\r\n" + entry("1-0") + entry("2-0")},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "1-0"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n" + entry("2-0")},
+		{[]string{"XREADGROUP", "GROUP", "g", "carol", "STREAMS", "s", "0"}, "*1\r\n*2\r\n$1\r\ns\r\n*0\r\n"},
+
+		// deleted entries stay pending and come back without fields
+		{[]string{"XDEL", "s", "2-0"}, ":1\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"}, "*1\r\n*2\r\n$1\r\ns\r\n*2\r\n" + entry("1-0") + "*2\r\n$3\r\n2-0\r\n*-1\r\n"},
+
+		{[]string{"XACK", "s", "g", "1-0", "2-0", "9-0"}, ":2\r\n"},
+		{[]string{"XACK", "s", "g", "1-0"}, ":0\r\n"},
+		{[]string{"XACK", "s", "g", "abc"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"}, "*1\r\n*2\r\n$1\r\ns\r\n*0\r\n"},
+
+		// NOACK reads skip the pending entries list
+		{[]string{"XADD", "s", "4-0", "f", "v"}, "$3\r\n4-0\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "NOACK", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n" + entry("4-0")},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:1\r\n$3\r\n3-0\r\n$3\r\n3-0\r\n*1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n"},
+		{[]string{"XGROUP", "DELCONSUMER", "s", "g", "bob"}, ":1\r\n"},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n"},
+	});
+}
+
+func TestXReadGroupBlock(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+	cache.ExecuteCommands(client, command("XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"));
+
+	done := make(chan string);
+	go func() {
+		reply := cache.ExecuteCommands(NewClient(nil), command("XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">"));
+		done <- reply.Elems[0].Elems[1].Elems[0].Elems[0].Str;
+	}();
+
+	time.Sleep(20 * time.Millisecond);
+	cache.ExecuteCommands(client, command("XADD", "s", "5-0", "f", "v"));
+
+	select {
+	case id := <-done:
+		if id != "5-0" {
+			t.Errorf("Expected the blocked XREADGROUP to get 5-0, but got %q", id);
+		};
+	case <-time.After(time.Second):
+		t.Fatal("XREADGROUP did not wake up after XADD");
+	};
+
+	summary, _ := cache.XPENDINGSUMMARY("s", "g");
+	if summary.Count != 1 || summary.Consumers[0].Name != "alice" {
+		t.Errorf("Expected the entry to be pending for alice, but got %+v", summary);
+	};
+
+	// a timeout runs out with a null reply
+	runSteps(t, cache, []step{
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "BLOCK", "10", "STREAMS", "s", ">"}, "*-1\r\n"},
+	});
+}
+
+func TestXPendingAndClaim(t *testing.T) {
+	cache := NewRedisServer();
+
+	for i := 1; i <= 4; i++ {
+		cache.XADD("s", XAddOptions{ID: StreamID{uint64(i), 0}}, []string{"f", "v"});
+	};
+	cache.XGROUPCREATE("s", "g", []byte("0"), false, entriesReadUnknown);
+	cache.XREADGROUP("g", "alice", []string{"s"}, []groupReadID{{newEntries: true}}, 0, false);
+
+	pending, err := cache.XPENDING("s", "g", 0, StreamID{}, maxStreamID, 10, "");
+	if err != nil || len(pending) != 4 || pending[0].Consumer != "alice" || pending[0].DeliveryCount != 1 {
+		t.Fatalf("Unexpected XPENDING result %+v (err: %v)", pending, err);
+	};
+
+	runSteps(t, cache, []step{
+		{[]string{"XPENDING", "s", "g", "-", "+", "10", "bob"}, "*0\r\n"},
+		{[]string{"XPENDING", "s", "g", "IDLE", "100000", "-", "+", "10"}, "*0\r\n"},
+		{[]string{"XPENDING", "s", "g", "-", "+"}, "-ERR syntax error\r\n"},
+		{[]string{"XPENDING", "s", "nope"}, "-NOGROUP No such key 's' or consumer group 'nope'\r\n"},
+
+		// nothing has been idle for an hour yet
+		{[]string{"XCLAIM", "s", "g", "bob", "3600000", "1-0"}, "*0\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1-0", "2-0", "JUSTID"}, "*2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "3-0", "RETRYCOUNT", "7"}, "*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "abc", "1-0"}, "-ERR Invalid min-idle-time argument for XCLAIM\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "1-0", "BOGUS"}, "-ERR Unrecognized XCLAIM option 'BOGUS'\r\n"},
+
+		// FORCE creates pending entries for IDs that nobody was handed yet
+		{[]string{"XADD", "s", "5-0", "f", "v"}, "$3\r\n5-0\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "5-0", "JUSTID"}, "*0\r\n"},
+		{[]string{"XCLAIM", "s", "g", "bob", "0", "5-0", "FORCE", "JUSTID"}, "*1\r\n$3\r\n5-0\r\n"},
+	});
+
+	pending, _ = cache.XPENDING("s", "g", 0, StreamID{}, maxStreamID, 10, "bob");
+	counts := map[string]int64{};
+	for _, p := range pending {
+		counts[p.ID.String()] = p.DeliveryCount;
+	};
+	if len(pending) != 4 || counts["1-0"] != 1 || counts["3-0"] != 7 || counts["5-0"] != 1 {
+		t.Errorf("Unexpected pending entries for bob %+v", pending);
+	};
+
+	// XAUTOCLAIM walks the PEL from start and drops entries that were deleted meanwhile, those do not count against COUNT
+	cache.XDEL("s", []StreamID{{2, 0}});
+	runSteps(t, cache, []step{
+		{[]string{"XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "2", "JUSTID"}, "*3\r\n$3\r\n4-0\r\n*2\r\n$3\r\n1-0\r\n$3\r\n3-0\r\n*1\r\n$3\r\n2-0\r\n"},
+		{[]string{"XAUTOCLAIM", "s", "g", "carol", "0", "4-0", "JUSTID"}, "*3\r\n$3\r\n0-0\r\n*2\r\n$3\r\n4-0\r\n$3\r\n5-0\r\n*0\r\n"},
+		{[]string{"XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "0"}, "-ERR COUNT must be > 0\r\n"},
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:4\r\n$3\r\n1-0\r\n$3\r\n5-0\r\n*1\r\n*2\r\n$5\r\ncarol\r\n$1\r\n4\r\n"},
+	});
+}
+
+// testing that consumer groups and their pending entries survive SAVE and a restart
+func TestStreamGroupsPersistence(t *testing.T) {
+	cache := NewRedisServer();
+
+	for i := 1; i <= 3; i++ {
+		cache.XADD("s", XAddOptions{ID: StreamID{uint64(i), 0}}, []string{"f", "v"});
+	};
+	cache.XGROUPCREATE("s", "g", []byte("0"), false, 0);
+	cache.XGROUPCREATE("s", "empty", []byte("$"), false, entriesReadUnknown);
+	cache.XGROUPCREATECONSUMER("s", "g", "idle");
+	cache.XREADGROUP("g", "alice", []string{"s"}, []groupReadID{{newEntries: true}}, 2, false);
+	cache.XREADGROUP("g", "alice", []string{"s"}, []groupReadID{{id: StreamID{}}}, 0, false);
+	cache.XCLAIM("s", "g", "bob", 0, []StreamID{{2, 0}}, XClaimOptions{RetryCount: -1});
+
+	filename := filepath.Join(t.TempDir(), "dump.rgb.json");
+	if err := cache.SaveToDisk(filename); err != nil {
+		t.Fatalf("SaveToDisk failed: %v", err);
+	};
+
+	restarted := NewRedisServer();
+	if err := restarted.LoadData(filename); err != nil {
+		t.Fatalf("LoadData failed: %v", err);
+	};
+
+	want, _ := cache.streamFor("s");
+	got, _ := restarted.streamFor("s");
+	if len(got.groups) != len(want.groups) {
+		t.Fatalf("Expected %d groups, but got %d", len(want.groups), len(got.groups));
+	};
+
+	for name, wantGroup := range want.groups {
+		gotGroup := got.groups[name];
+		if gotGroup == nil || gotGroup.lastID != wantGroup.lastID || gotGroup.entriesRead != wantGroup.entriesRead {
+			t.Errorf("Group %q: expected %+v, but got %+v", name, wantGroup, gotGroup);
+			continue;
+		};
+		if len(gotGroup.consumers) != len(wantGroup.consumers) {
+			t.Errorf("Group %q: expected %d consumers, but got %d", name, len(wantGroup.consumers), len(gotGroup.consumers));
+		};
+
+		for id, p := range wantGroup.pel {
+			loaded := gotGroup.pel[id];
+			if loaded == nil || loaded.consumer.name != p.consumer.name || loaded.deliveryTime != p.deliveryTime || loaded.deliveryCount != p.deliveryCount {
+				t.Errorf("Pending entry %s: expected %+v, but got %+v", id, p, loaded);
+				continue;
+			};
+			if gotGroup.consumers[p.consumer.name].pending[id] != loaded {
+				t.Errorf("Pending entry %s is missing from the PEL of %q", id, p.consumer.name);
+			};
+		};
+	};
+
+	runSteps(t, restarted, []step{
+		{[]string{"XPENDING", "s", "g"}, "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"}, "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+	});
+}
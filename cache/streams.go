@@ -0,0 +1,633 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commands needed to be implemented:
+// XADD [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]]	--> Done
+// XLEN, XDEL, XTRIM												--> Done
+// XRANGE, XREVRANGE [COUNT]										--> Done
+// XREAD [COUNT] [BLOCK] STREAMS									--> Done
+
+// a stream is an append-only log of entries, every entry has an ID and a list of field value pairs
+// Redis keeps the entries in a radix tree of listpacks, here they are a slice ordered by ID:
+// new entries always get the highest ID so adding is an append, lookups by ID are a binary search,
+// and trimming cuts off the front; only XDEL in the middle of a long stream has to move entries around
+
+// StreamID is "ms-seq": the unix time in milliseconds the entry was added at, and a sequence number
+// that tells apart the entries added within the same millisecond
+type StreamID struct {
+	Ms 	uint64
+	Seq uint64
+}
+
+func(id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func(id StreamID) less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// next returns the smallest ID after id, ok is false when id is already the largest possible one
+func(id StreamID) next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// prev returns the largest ID before id, ok is false for 0-0
+func(id StreamID) prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+var maxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+// StreamEntry is one entry of a stream, Fields holds field, value, field, value, ...
+type StreamEntry struct {
+	ID 		StreamID
+	Fields 	[]string
+}
+
+type stream struct {
+	entries 		[]StreamEntry
+	lastID 			StreamID // the ID of the last entry ever added, it stays even when that entry is deleted
+	maxDeletedID 	StreamID // the highest ID removed by XDEL
+	entriesAdded 	uint64 // every entry that was ever added, including the deleted and trimmed ones
+	groups 			map[string]*consumerGroup // nil until the first XGROUP CREATE
+}
+
+func newStream() *stream {
+	return &stream{}
+}
+
+// search returns the position of the first entry with an ID of at least id
+func(s *stream) search(id StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.less(id)
+	})
+}
+
+// streamFor returns the stream stored under key, nil if there is none, the caller must hold r.mu
+func(r *RedisCache) streamFor(key string) (*stream, error) {
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+
+	s, isStream := entry.Value.(*stream)
+	if !isStream {
+		return nil, ErrWrongType
+	}
+	return s, nil
+}
+
+// parseStreamID reads "ms-seq", or just "ms" in which case the sequence number is missingSeq
+func parseStreamID(arg []byte, missingSeq uint64) (StreamID, bool) {
+	ms, seq, hasSeq := bytes.Cut(arg, []byte("-"))
+
+	var id StreamID
+	var err error
+	if id.Ms, err = strconv.ParseUint(string(ms), 10, 64); err != nil {
+		return id, false
+	}
+
+	if !hasSeq {
+		id.Seq = missingSeq
+		return id, true
+	}
+	if id.Seq, err = strconv.ParseUint(string(seq), 10, 64); err != nil {
+		return id, false
+	}
+	return id, true
+}
+
+// parseRangeID reads one end of an XRANGE interval: "-", "+", an ID, or "(ID" for an exclusive end
+// an ID without a sequence number means all of that millisecond, so it is ms-0 for the start and ms-max for the end
+func parseRangeID(arg []byte, isStart bool) (StreamID, error) {
+	switch string(arg) {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+
+	exclusive := len(arg) > 0 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+
+	missingSeq := uint64(0)
+	if !isStart {
+		missingSeq = math.MaxUint64
+	}
+
+	id, ok := parseStreamID(arg, missingSeq)
+	if !ok {
+		return id, ErrInvalidStreamID
+	}
+	if !exclusive {
+		return id, nil
+	}
+
+	if isStart {
+		if id, ok = id.next(); !ok {
+			return id, ErrInvalidStartID
+		}
+	} else if id, ok = id.prev(); !ok {
+		return id, ErrInvalidEndID
+	}
+	return id, nil
+}
+
+// how XADD and XTRIM decide what to trim
+const (
+	trimNone = iota
+	trimMaxLen // keep at most MaxLen entries
+	trimMinID // drop every entry with an ID below MinID
+)
+
+// StreamTrim holds the MAXLEN / MINID options of XADD and XTRIM
+type StreamTrim struct {
+	Strategy 	int
+	MaxLen 		int64
+	MinID 		StreamID
+	Approx 		bool // "~", Redis may keep a few more entries than asked for
+	Limit 		int64 // with "~" at most this many entries are removed at once, 0 means no limit
+	hasLimit 	bool
+}
+
+// parseTrimOption reads a MAXLEN, MINID or LIMIT option starting at args[i]
+// it returns the index of the next argument, matched is false when args[i] is none of them
+func parseTrimOption(trim *StreamTrim, args [][]byte, i int) (int, bool, error) {
+	option := strings.ToUpper(string(args[i]))
+
+	switch {
+	case (option == "MAXLEN" || option == "MINID") && i+1 < len(args):
+		if trim.Strategy != trimNone {
+			return i, true, ErrMaxLenAndMinID
+		}
+
+		i++
+		if operator := string(args[i]); (operator == "=" || operator == "~") && i+1 < len(args) {
+			trim.Approx = operator == "~"
+			i++
+		}
+
+		if option == "MAXLEN" {
+			maxLen, ok := parseInteger(args[i])
+			if !ok {
+				return i, true, ErrNotInteger
+			}
+			if maxLen < 0 {
+				return i, true, ErrMaxLenNegative
+			}
+			trim.Strategy, trim.MaxLen = trimMaxLen, maxLen
+		} else {
+			minID, ok := parseStreamID(args[i], 0)
+			if !ok {
+				return i, true, ErrInvalidStreamID
+			}
+			trim.Strategy, trim.MinID = trimMinID, minID
+		}
+		return i + 1, true, nil
+
+	case option == "LIMIT" && i+1 < len(args):
+		limit, ok := parseInteger(args[i+1])
+		if !ok {
+			return i, true, ErrNotInteger
+		}
+		if limit < 0 {
+			return i, true, ErrLimitArgumentNegative
+		}
+		trim.Limit, trim.hasLimit = limit, true
+		return i + 2, true, nil
+	}
+
+	return i, false, nil
+}
+
+func(trim StreamTrim) validate() error {
+	if trim.hasLimit && !trim.Approx {
+		return ErrTrimLimitWithoutApprox
+	}
+	return nil
+}
+
+// trim removes entries from the front of the stream and returns how many
+func(s *stream) trim(trim StreamTrim) int {
+	remove := 0
+	switch trim.Strategy {
+	case trimMaxLen:
+		if int64(len(s.entries)) > trim.MaxLen {
+			remove = len(s.entries) - int(trim.MaxLen)
+		}
+	case trimMinID:
+		remove = s.search(trim.MinID)
+	}
+
+	if trim.Approx && trim.Limit > 0 && int64(remove) > trim.Limit {
+		remove = int(trim.Limit)
+	}
+
+	// clearing the entries that are cut off, so their fields are not kept alive by the backing array
+	for i := 0; i < remove; i++ {
+		s.entries[i] = StreamEntry{}
+	}
+	s.entries = s.entries[remove:]
+	return remove
+}
+
+// XAddOptions holds everything of an XADD before the field value pairs
+type XAddOptions struct {
+	NoMkStream 	bool
+	Trim 		StreamTrim
+	ID 			StreamID
+	AutoMs 		bool // "*", the whole ID is generated
+	AutoSeq 	bool // "ms-*", only the sequence number is generated
+}
+
+// parseXAddArgs reads everything after "XADD key": the options, the ID and the field value pairs
+func parseXAddArgs(args [][]byte) (XAddOptions, []string, error) {
+	var opts XAddOptions
+
+	i := 0
+	for i < len(args) {
+		if strings.EqualFold(string(args[i]), "NOMKSTREAM") {
+			opts.NoMkStream = true
+			i++
+			continue
+		}
+
+		next, matched, err := parseTrimOption(&opts.Trim, args, i)
+		if err != nil {
+			return opts, nil, err
+		}
+		if !matched {
+			break
+		}
+		i = next
+	}
+
+	if err := opts.Trim.validate(); err != nil {
+		return opts, nil, err
+	}
+
+	fields := len(args) - i - 1
+	if fields < 2 || fields%2 != 0 {
+		return opts, nil, errWrongNumberOfArgs("xadd")
+	}
+
+	id := args[i]
+	switch {
+	case string(id) == "*":
+		opts.AutoMs = true
+	case bytes.HasSuffix(id, []byte("-*")):
+		ms, err := strconv.ParseUint(string(id[:len(id)-2]), 10, 64)
+		if err != nil {
+			return opts, nil, ErrInvalidStreamID
+		}
+		opts.ID, opts.AutoSeq = StreamID{Ms: ms}, true
+	default:
+		var ok bool
+		if opts.ID, ok = parseStreamID(id, 0); !ok {
+			return opts, nil, ErrInvalidStreamID
+		}
+	}
+
+	return opts, stringArgs(args[i+1:]), nil
+}
+
+// newID works out the ID of the next entry, it has to be greater than every ID the stream ever had
+func(s *stream) newID(opts XAddOptions) (StreamID, error) {
+	if s.lastID == maxStreamID {
+		return StreamID{}, ErrStreamExhausted
+	}
+
+	id := opts.ID
+	switch {
+	case opts.AutoMs:
+		// the clock going backwards, or more than one entry in a millisecond, continues from the last ID
+		now := uint64(time.Now().UnixMilli())
+		if now > s.lastID.Ms {
+			return StreamID{Ms: now}, nil
+		}
+		next, _ := s.lastID.next()
+		return next, nil
+
+	case opts.AutoSeq && id.Ms == s.lastID.Ms:
+		if s.lastID.Seq == math.MaxUint64 {
+			return id, ErrXAddIDTooSmall
+		}
+		id.Seq = s.lastID.Seq + 1
+		return id, nil
+	}
+
+	if id == (StreamID{}) {
+		return id, ErrXAddIDZero
+	}
+	if !s.lastID.less(id) {
+		return id, ErrXAddIDTooSmall
+	}
+	return id, nil
+}
+
+func(r *RedisCache) XADD(key string, opts XAddOptions, fields []string) (StreamID, bool, error) {
+	// command syntax: XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]] * | id field value [field value ...]
+	// returns the ID of the new entry, ok is false when NOMKSTREAM kept a missing stream from being created
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+
+	created := s == nil
+	if created {
+		if opts.NoMkStream {
+			return StreamID{}, false, nil
+		}
+		s = newStream()
+	}
+
+	// the ID is checked before a new stream is stored, a rejected XADD leaves no empty stream behind
+	id, err := s.newID(opts)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+	s.entriesAdded++
+	if created {
+		r.setEntry(key, &Entry{Type: "stream", Value: s})
+	}
+
+	s.trim(opts.Trim)
+
+	// clients blocked in XREAD on this key get to look at the new entry
+	r.signalKey(key)
+	return id, true, nil
+}
+
+func(r *RedisCache) XLEN(key string) (int, error) {
+	// command syntax: XLEN key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if s == nil {
+		return 0, err
+	}
+	return len(s.entries), nil
+}
+
+func(r *RedisCache) XRANGE(key string, start StreamID, end StreamID, count int64, rev bool) ([]StreamEntry, error) {
+	// command syntax: XRANGE key start end [COUNT count] / XREVRANGE key end start [COUNT count]
+	// returns the entries with start <= ID <= end, newest first for XREVRANGE; a count of -1 means no limit
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []StreamEntry{}
+
+	s, err := r.streamFor(key)
+	if s == nil || end.less(start) {
+		return result, err
+	}
+
+	first := s.search(start)
+	last := s.search(end)
+	if last < len(s.entries) && s.entries[last].ID == end {
+		last++
+	}
+
+	for n := 0; n < last-first && int64(n) != count; n++ {
+		if rev {
+			result = append(result, s.entries[last-1-n])
+		} else {
+			result = append(result, s.entries[first+n])
+		}
+	}
+	return result, nil
+}
+
+func(r *RedisCache) XDEL(key string, ids []StreamID) (int, error) {
+	// command syntax: XDEL key id [id ...] --> the number of entries deleted
+	// a stream stays around even when it is empty, its last ID is still needed for the next XADD
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if s == nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		i := s.search(id)
+		if i == len(s.entries) || s.entries[i].ID != id {
+			continue
+		}
+
+		copy(s.entries[i:], s.entries[i+1:])
+		s.entries[len(s.entries)-1] = StreamEntry{}
+		s.entries = s.entries[:len(s.entries)-1]
+		if s.maxDeletedID.less(id) {
+			s.maxDeletedID = id
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func(r *RedisCache) XTRIM(key string, trim StreamTrim) (int, error) {
+	// command syntax: XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count] --> the number of entries removed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.streamFor(key)
+	if s == nil {
+		return 0, err
+	}
+	return s.trim(trim), nil
+}
+
+// StreamRead is the part of an XREAD reply for one stream
+type StreamRead struct {
+	Key 	string
+	Entries []StreamEntry
+}
+
+// xreadQuery is a parsed XREAD or XREADGROUP command
+type xreadQuery struct {
+	count 		int64 // 0 means no limit
+	block 		bool
+	timeout 	time.Duration
+	noAck 		bool // XREADGROUP only
+	group 		string
+	consumer 	string
+	keys 		[]string
+	ids 		[][]byte // still unparsed, "$" and ">" depend on the command and on the stream
+}
+
+// parseXReadArgs reads [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// XREADGROUP also takes GROUP group consumer and NOACK
+func parseXReadArgs(args [][]byte, group bool) (xreadQuery, error) {
+	var q xreadQuery
+	streams := -1
+	hasGroup := false
+
+	for i := 0; i < len(args) && streams < 0; i++ {
+		option := strings.ToUpper(string(args[i]))
+
+		switch {
+		case option == "STREAMS":
+			streams = i + 1
+		case option == "COUNT" && i+1 < len(args):
+			count, ok := parseInteger(args[i+1])
+			if !ok {
+				return q, ErrNotInteger
+			}
+			q.count = max(count, 0)
+			i++
+		case option == "BLOCK" && i+1 < len(args):
+			timeout, err := parseBlockTimeout(args[i+1])
+			if err != nil {
+				return q, err
+			}
+			q.block, q.timeout = true, timeout
+			i++
+		case option == "GROUP" && group && i+2 < len(args):
+			q.group, q.consumer = string(args[i+1]), string(args[i+2])
+			hasGroup = true
+			i += 2
+		case option == "NOACK" && group:
+			q.noAck = true
+		default:
+			return q, ErrSyntax
+		}
+	}
+
+	command := "xread"
+	if group {
+		command = "xreadgroup"
+	}
+
+	if streams < 0 {
+		return q, ErrSyntax
+	}
+	if (len(args)-streams)%2 != 0 || streams == len(args) {
+		return q, errUnbalancedStreams(command)
+	}
+	if group && !hasGroup {
+		return q, ErrMissingGroup
+	}
+
+	half := (len(args) - streams) / 2
+	q.keys = stringArgs(args[streams : streams+half])
+	q.ids = args[streams+half:]
+
+	// ">" and "$" only make sense for one of the two commands each
+	for _, id := range q.ids {
+		if string(id) == ">" && !group {
+			return q, ErrNewIDWithoutGroup
+		}
+		if string(id) == "$" && group {
+			return q, ErrDollarInGroup
+		}
+	}
+	return q, nil
+}
+
+// parseBlockTimeout reads the milliseconds of a BLOCK option, 0 means forever
+func parseBlockTimeout(arg []byte) (time.Duration, error) {
+	ms, ok := parseInteger(arg)
+	if !ok || ms > math.MaxInt64/int64(time.Millisecond) {
+		return 0, ErrTimeoutNotInteger
+	}
+	if ms < 0 {
+		return 0, ErrTimeoutNegative
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// resolveStreamIDs turns the IDs of an XREAD into real IDs, "$" is the last ID of the stream at the time of the call
+// so a blocking XREAD with "$" only gets the entries added while it waits
+func(r *RedisCache) resolveStreamIDs(keys []string, rawIDs [][]byte) ([]StreamID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]StreamID, len(keys))
+	for i, key := range keys {
+		s, err := r.streamFor(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if string(rawIDs[i]) == "$" {
+			if s != nil {
+				ids[i] = s.lastID
+			}
+			continue
+		}
+
+		id, ok := parseStreamID(rawIDs[i], 0)
+		if !ok {
+			return nil, ErrInvalidStreamID
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func(r *RedisCache) XREAD(keys []string, ids []StreamID, count int64) ([]StreamRead, error) {
+	// command syntax: XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+	// returns the entries after the given ID of every stream that has some, a count of 0 means no limit
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := []StreamRead{}
+	for i, key := range keys {
+		s, err := r.streamFor(key)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			continue
+		}
+
+		after, ok := ids[i].next()
+		if !ok {
+			continue
+		}
+
+		start := s.search(after)
+		end := len(s.entries)
+		if count > 0 && int64(end-start) > count {
+			end = start + int(count)
+		}
+		if start == end {
+			continue
+		}
+
+		result = append(result, StreamRead{Key: key, Entries: append([]StreamEntry{}, s.entries[start:end]...)})
+	}
+	return result, nil
+}
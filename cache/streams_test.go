@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"redis-clone/resp"
+)
+
+func TestXAdd(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"XADD", "s", "1-1", "name", "alice"}, "$3\r\n1-1\r\n"},
+		{[]string{"XADD", "s", "1-*", "name", "bob"}, "$3\r\n1-2\r\n"},
+		{[]string{"XADD", "s", "2-*", "name", "carol"}, "$3\r\n2-0\r\n"},
+		{[]string{"XADD", "s", "3", "name", "dave"}, "$3\r\n3-0\r\n"},
+		{[]string{"XADD", "s", "3", "name", "dave"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{[]string{"XADD", "s", "2-5", "name", "eve"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{[]string{"XADD", "s", "1-*", "name", "eve"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{[]string{"XLEN", "s"}, ":4\r\n"},
+
+		{[]string{"XADD", "new", "0-0", "f", "v"}, "-ERR The ID specified in XADD must be greater than 0-0\r\n"},
+		{[]string{"XLEN", "new"}, ":0\r\n"},
+		{[]string{"XADD", "new", "0-*", "f", "v"}, "$3\r\n0-1\r\n"},
+		{[]string{"XADD", "s", "abc", "f", "v"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"XADD", "s", "*", "f"}, "-ERR wrong number of arguments for 'xadd' command\r\n"},
+		{[]string{"XADD", "s", "*", "f", "v", "g"}, "-ERR wrong number of arguments for 'xadd' command\r\n"},
+
+		{[]string{"XADD", "missing", "NOMKSTREAM", "*", "f", "v"}, "$-1\r\n"},
+		{[]string{"XLEN", "missing"}, ":0\r\n"},
+
+		{[]string{"XADD", "max", "18446744073709551615-18446744073709551615", "f", "v"}, "$41\r\n18446744073709551615-18446744073709551615\r\n"},
+		{[]string{"XADD", "max", "*", "f", "v"}, "-ERR The stream has exhausted the last possible ID, unable to add more items\r\n"},
+
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"XADD", "str", "*", "f", "v"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"XLEN", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+
+	// generated IDs keep going up, even for many entries within one millisecond
+	client := NewClient(nil);
+	var last StreamID;
+	for i := 0; i < 1000; i++ {
+		reply := cache.ExecuteCommands(client, command("XADD", "auto", "*", "i", "x"));
+		id, ok := parseStreamID([]byte(reply.Str), 0);
+		if !ok || !last.less(id) {
+			t.Fatalf("XADD * returned %q after %s", reply.Str, last);
+		};
+		last = id;
+	};
+}
+
+func TestXAddTrimming(t *testing.T) {
+	cache := NewRedisServer();
+
+	for i := 1; i <= 10; i++ {
+		cache.XADD("s", XAddOptions{ID: StreamID{uint64(i), 0}}, []string{"f", "v"});
+	};
+
+	runSteps(t, cache, []step{
+		{[]string{"XADD", "s", "MAXLEN", "8", "11-0", "f", "v"}, "$4\r\n11-0\r\n"},
+		{[]string{"XLEN", "s"}, ":8\r\n"},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "1"}, "*1\r\n*2\r\n$3\r\n4-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{[]string{"XADD", "s", "MINID", "=", "6", "12-0", "f", "v"}, "$4\r\n12-0\r\n"},
+		{[]string{"XLEN", "s"}, ":7\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "~", "2", "LIMIT", "3"}, ":3\r\n"},
+		{[]string{"XLEN", "s"}, ":4\r\n"},
+		{[]string{"XTRIM", "s", "MINID", "10"}, ":1\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "100"}, ":0\r\n"},
+		{[]string{"XTRIM", "missing", "MAXLEN", "0"}, ":0\r\n"},
+
+		{[]string{"XTRIM", "s", "MAXLEN", "2", "LIMIT", "1"}, "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "-1"}, "-ERR The MAXLEN argument must be >= 0.\r\n"},
+		{[]string{"XTRIM", "s", "MAXLEN", "1", "MINID", "1"}, "-ERR syntax error, MAXLEN and MINID options at the same time are not compatible\r\n"},
+		{[]string{"XTRIM", "s", "LIMIT", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"XTRIM", "s", "SIZE", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"XADD", "s", "MAXLEN", "x", "*", "f", "v"}, "-ERR value is not an integer or out of range\r\n"},
+	});
+}
+
+func TestXRangeAndXDel(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"XADD", "s", "1-0", "a", "1"}, "$3\r\n1-0\r\n"},
+		{[]string{"XADD", "s", "1-1", "b", "2", "c", "3"}, "$3\r\n1-1\r\n"},
+		{[]string{"XADD", "s", "2-0", "d", "4"}, "$3\r\n2-0\r\n"},
+		{[]string{"XADD", "s", "3-0", "e", "5"}, "$3\r\n3-0\r\n"},
+
+		{[]string{"XRANGE", "s", "1", "1"}, "*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n1-1\r\n*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"XRANGE", "s", "(1-1", "+"}, "*2\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nd\r\n$1\r\n4\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"XREVRANGE", "s", "+", "-", "COUNT", "1"}, "*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"XREVRANGE", "s", "(3-0", "2"}, "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nd\r\n$1\r\n4\r\n"},
+		{[]string{"XRANGE", "s", "3", "1"}, "*0\r\n"},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "0"}, "*0\r\n"},
+		{[]string{"XRANGE", "s", "-", "+", "COUNT", "-5"}, "*0\r\n"},
+		{[]string{"XRANGE", "missing", "-", "+"}, "*0\r\n"},
+		{[]string{"XRANGE", "s", "x", "+"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"XRANGE", "s", "-", "+", "LIMIT", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"XRANGE", "s", "(18446744073709551615-18446744073709551615", "+"}, "-ERR invalid start ID for the interval\r\n"},
+		{[]string{"XRANGE", "s", "-", "(0-0"}, "-ERR invalid end ID for the interval\r\n"},
+
+		{[]string{"XDEL", "s", "1-1", "2-0", "9-9"}, ":2\r\n"},
+		{[]string{"XLEN", "s"}, ":2\r\n"},
+		{[]string{"XRANGE", "s", "-", "+"}, "*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"XDEL", "s", "bad"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+
+		// an emptied stream stays, and still remembers its last ID
+		{[]string{"XDEL", "s", "1-0", "3-0"}, ":2\r\n"},
+		{[]string{"XLEN", "s"}, ":0\r\n"},
+		{[]string{"XADD", "s", "3-0", "f", "v"}, "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+	});
+}
+
+func TestXRead(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"XADD", "a", "1-0", "f", "1"}, "$3\r\n1-0\r\n"},
+		{[]string{"XADD", "a", "2-0", "f", "2"}, "$3\r\n2-0\r\n"},
+		{[]string{"XADD", "b", "5-0", "g", "5"}, "$3\r\n5-0\r\n"},
+
+		{[]string{"XREAD", "STREAMS", "a", "b", "1-0", "0"}, "*2\r\n*2\r\n$1\r\na\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\n2\r\n*2\r\n$1\r\nb\r\n*1\r\n*2\r\n$3\r\n5-0\r\n*2\r\n$1\r\ng\r\n$1\r\n5\r\n"},
+		{[]string{"XREAD", "COUNT", "1", "STREAMS", "a", "0"}, "*1\r\n*2\r\n$1\r\na\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$1\r\n1\r\n"},
+		{[]string{"XREAD", "STREAMS", "a", "missing", "2-0", "0"}, "*-1\r\n"},
+		{[]string{"XREAD", "STREAMS", "a", "$"}, "*-1\r\n"},
+		{[]string{"XREAD", "BLOCK", "10", "STREAMS", "a", "$"}, "*-1\r\n"},
+
+		{[]string{"XREAD", "STREAMS", "a", "b", "0"}, "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n"},
+		{[]string{"XREAD", "COUNT", "1", "a", "0"}, "-ERR syntax error\r\n"},
+		{[]string{"XREAD", "BLOCK", "-1", "STREAMS", "a", "0"}, "-ERR timeout is negative\r\n"},
+		{[]string{"XREAD", "BLOCK", "x", "STREAMS", "a", "0"}, "-ERR timeout is not an integer or out of range\r\n"},
+		{[]string{"XREAD", "STREAMS", "a", "x"}, "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"XREAD", "STREAMS", "str", "0"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+
+	// RESP3 clients get a map from key to entries
+	client := NewClient(nil);
+	cache.ExecuteCommands(client, command("HELLO", "3"));
+	reply := cache.ExecuteCommands(client, command("XREAD", "STREAMS", "b", "0"));
+	if got := string(resp.Encode(reply, resp.RESP3)); got != "%1\r\n$1\r\nb\r\n*1\r\n*2\r\n$3\r\n5-0\r\n*2\r\n$1\r\ng\r\n$1\r\n5\r\n" {
+		t.Errorf("Expected a map in RESP3, but got %q", got);
+	};
+}
+
+// testing that XREAD BLOCK wakes up for an entry added by another client, and only sees entries newer than "$"
+func TestXReadBlock(t *testing.T) {
+	cache := NewRedisServer();
+	cache.XADD("s", XAddOptions{ID: StreamID{1, 0}}, []string{"old", "entry"});
+
+	replies := make(chan resp.Value);
+	go func() {
+		replies <- cache.ExecuteCommands(NewClient(nil), command("XREAD", "BLOCK", "0", "STREAMS", "other", "s", "0", "$"));
+	}();
+
+	// waiting until the reader is registered, so the XADD below happens while it blocks
+	for deadline := time.Now().Add(time.Second); ; {
+		cache.mu.Lock();
+		waiting := len(cache.waiters["s"]) > 0;
+		cache.mu.Unlock();
+		if waiting {
+			break;
+		};
+		if time.Now().After(deadline) {
+			t.Fatal("XREAD BLOCK never started waiting");
+		};
+		time.Sleep(time.Millisecond);
+	};
+
+	cache.XADD("unrelated", XAddOptions{AutoMs: true}, []string{"f", "v"});
+	cache.XADD("s", XAddOptions{ID: StreamID{2, 0}}, []string{"new", "entry"});
+
+	select {
+	case reply := <-replies:
+		got := string(resp.Encode(reply, resp.RESP2));
+		if !strings.Contains(got, "2-0") || strings.Contains(got, "1-0") {
+			t.Errorf("Expected only the new entry, but got %q", got);
+		};
+	case <-time.After(time.Second):
+		t.Fatal("XREAD BLOCK did not wake up after XADD");
+	};
+
+	cache.mu.Lock();
+	defer cache.mu.Unlock();
+	if len(cache.waiters) != 0 {
+		t.Errorf("Expected no waiters left, but got %v", cache.waiters);
+	};
+}
+
+// testing that blocking commands inside MULTI/EXEC return right away
+func TestXReadBlockInTransaction(t *testing.T) {
+	cache := NewRedisServer();
+	client := NewClient(nil);
+
+	client.inExec = true;
+	reply := cache.ExecuteCommands(client, command("XREAD", "BLOCK", "0", "STREAMS", "s", "$"));
+	if reply.Kind != resp.KindNullArray {
+		t.Errorf("Expected a null array, but got %#v", reply);
+	};
+}
@@ -0,0 +1,563 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commands needed to be implemented:
+// SET [NX|XX] [GET] [EX|PX|EXAT|PXAT|KEEPTTL]	--> Done
+// SETNX, SETEX, PSETEX					--> Done (SET with options)
+// GETSET								--> Done (SET ... GET)
+// GETDEL								--> Done
+// GETEX								--> Done
+// INCR, INCRBY, DECR, DECRBY				--> Done
+// INCRBYFLOAT							--> Done
+// APPEND, STRLEN						--> Done
+// GETRANGE (SUBSTR), SETRANGE				--> Done
+// MGET, MSET, MSETNX					--> Done
+
+// a string entry holds its value in one of two encodings, just like Redis' "embstr/raw" and "int":
+// []byte --> any sequence of bytes
+// int64  --> a value that is exactly the decimal form of a 64-bit integer ("42", "-7", but not "007" or "+1")
+// counters are kept as int64, so INCR does not parse and format the number on every call
+
+// newStringValue picks the encoding for a value that is about to be stored
+func newStringValue(value []byte) interface{} {
+	// 20 characters is the longest an int64 can be ("-9223372036854775808")
+	if len(value) <= 20 {
+		if n, ok := parseInteger(value); ok {
+			return n
+		}
+	}
+	return value
+}
+
+// stringBytes returns the bytes of a string entry's value, whatever its encoding
+// ok is false if the value does not belong to a string entry
+// the result is never nil for a string, so callers like MGET can use nil for "no value"
+// the bytes are the stored ones: APPEND, SETRANGE, SETBIT and BITFIELD change them in place,
+// so a value that is handed out and used after r.mu is released has to be copied first
+func stringBytes(value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case []byte:
+		if v == nil {
+			return []byte{}, true
+		}
+		return v, true
+	case int64:
+		return strconv.AppendInt(nil, v, 10), true
+	}
+	return nil, false
+}
+
+// parseInteger parses a 64-bit integer as strictly as Redis' string2ll:
+// no spaces, no "+" sign, no leading zeros and nothing that does not fit into an int64
+func parseInteger(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	}
+	if len(b) == 1 && b[0] == '0' {
+		return 0, true
+	}
+
+	digits := b
+	if b[0] == '-' {
+		digits = b[1:]
+	}
+	if len(digits) == 0 || digits[0] < '1' || digits[0] > '9' {
+		return 0, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	// the digits are valid, ParseInt only has to catch the values that overflow
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// SetOptions holds the flags of a SET command
+type SetOptions struct {
+	NX 			bool // only set the key if it does not exist yet
+	XX 			bool // only set the key if it already exists
+	Get 		bool // hand back the old value
+	KeepTTL 	bool // keep the TTL of the existing key instead of clearing it
+	ExpiryTime 	time.Time // when the new value expires, zero for never
+}
+
+// parseSetOptions reads everything after "SET key value"
+func parseSetOptions(args [][]byte) (SetOptions, error) {
+	var opts SetOptions
+	hasExpiry := false
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+
+		switch option {
+		case "NX":
+			if opts.XX {
+				return opts, ErrSyntax
+			}
+			opts.NX = true
+
+		case "XX":
+			if opts.NX {
+				return opts, ErrSyntax
+			}
+			opts.XX = true
+
+		case "GET":
+			opts.Get = true
+
+		case "KEEPTTL":
+			if hasExpiry {
+				return opts, ErrSyntax
+			}
+			opts.KeepTTL = true
+			hasExpiry = true
+
+		case "EX", "PX", "EXAT", "PXAT":
+			// only one way of setting the expiry is allowed, and it needs a value
+			if hasExpiry || i+1 == len(args) {
+				return opts, ErrSyntax
+			}
+
+			expiryTime, err := parseExpiry(option, args[i+1], "set")
+			if err != nil {
+				return opts, err
+			}
+			opts.ExpiryTime = expiryTime
+			hasExpiry = true
+			i++
+
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+// parseExpiry turns "EX 10", "PX 10000", "EXAT 1700000000" or "PXAT 1700000000000" into an absolute time
+// everything is computed in milliseconds since the epoch, which is how Redis stores expiry times,
+// so a TTL that does not fit (e.g. EX 9223372036854775807) is refused instead of overflowing into the past
+func parseExpiry(option string, value []byte, command string) (time.Time, error) {
+	n, ok := parseInteger(value)
+	if !ok {
+		return time.Time{}, ErrNotInteger
+	}
+	if n <= 0 {
+		return time.Time{}, errInvalidExpireTime(command)
+	}
+
+	// EX and EXAT are in seconds
+	if option == "EX" || option == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, errInvalidExpireTime(command)
+		}
+		n *= 1000
+	}
+
+	// EX and PX are relative to now
+	if option == "EX" || option == "PX" {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return time.Time{}, errInvalidExpireTime(command)
+		}
+		n += now
+	}
+
+	return time.UnixMilli(n), nil
+}
+
+func(r *RedisCache) GETDEL(key string) ([]byte, bool, error) {
+	// command syntax: GETDEL key
+	// same as GET, but the key is deleted once its value has been read
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return nil, false, ErrWrongType
+	}
+
+	r.deleteEntry(key)
+	return value, true, nil
+}
+
+// GetExOptions holds the flags of a GETEX command, with neither of them set GETEX is a plain GET
+type GetExOptions struct {
+	Persist 	bool // remove the TTL
+	ExpiryTime 	time.Time // set a new TTL, zero for leaving it as it is
+}
+
+// parseGetExOptions reads everything after "GETEX key": [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func parseGetExOptions(args [][]byte) (GetExOptions, error) {
+	var opts GetExOptions
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		hasOption := opts.Persist || !opts.ExpiryTime.IsZero()
+
+		switch option {
+		case "PERSIST":
+			if hasOption {
+				return opts, ErrSyntax
+			}
+			opts.Persist = true
+
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasOption || i+1 == len(args) {
+				return opts, ErrSyntax
+			}
+
+			expiryTime, err := parseExpiry(option, args[i+1], "getex")
+			if err != nil {
+				return opts, err
+			}
+			opts.ExpiryTime = expiryTime
+			i++
+
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+func(r *RedisCache) GETEX(key string, opts GetExOptions) ([]byte, bool, error) {
+	// command syntax: GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+	// returns the value like GET and changes the TTL of the key in the same step
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, false, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return nil, false, ErrWrongType
+	}
+
+	switch {
+	case opts.Persist:
+		entry.ExpiryTime = time.Time{}
+	case !opts.ExpiryTime.IsZero():
+		// an EXAT/PXAT in the past expires the key right away, the value is still returned
+		if !opts.ExpiryTime.After(time.Now()) {
+			r.deleteEntry(key)
+		} else {
+			entry.ExpiryTime = opts.ExpiryTime
+		}
+	}
+
+	// a copy, the stored bytes may be changed in place once the lock is released
+	return bytes.Clone(value), true, nil
+}
+
+func(r *RedisCache) INCRBY(key string, increment int64) (int64, error) {
+	// command syntax: INCRBY key increment (INCR, DECR and DECRBY are INCRBY with 1, -1 and -decrement)
+	// a missing key counts as 0, the TTL of an existing key is kept
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		r.setEntry(key, &Entry{Type: "string", Value: increment})
+		return increment, nil
+	}
+
+	var current int64
+	switch value := entry.Value.(type) {
+	case int64:
+		current = value
+	case []byte:
+		// "007" or "1.5" are strings, not integers, so they cannot be incremented
+		n, ok := parseInteger(value)
+		if !ok {
+			return 0, ErrNotInteger
+		}
+		current = n
+	default:
+		return 0, ErrWrongType
+	}
+
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, ErrOverflow
+	}
+
+	entry.Value = current + increment
+	return current + increment, nil
+}
+
+func(r *RedisCache) INCRBYFLOAT(key string, increment float64) ([]byte, error) {
+	// command syntax: INCRBYFLOAT key increment
+	// the result is stored (and returned) as a plain decimal string like "10.6", never in exponent notation
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+
+	current := 0.0
+	if exists {
+		value, isString := stringBytes(entry.Value)
+		if !isString {
+			return nil, ErrWrongType
+		}
+
+		n, ok := parseFloat(value)
+		if !ok {
+			return nil, ErrNotFloat
+		}
+		current = n
+	}
+
+	result := current + increment
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, ErrNaNOrInfinity
+	}
+
+	formatted := strconv.AppendFloat(nil, result, 'f', -1, 64)
+	if !exists {
+		r.setEntry(key, &Entry{Type: "string", Value: newStringValue(formatted)})
+	} else {
+		entry.Value = newStringValue(formatted)
+	}
+
+	return formatted, nil
+}
+
+// parseFloat parses a float the way Redis reads INCRBYFLOAT arguments and values:
+// no surrounding spaces and no NaN, anything strtold understands (like "1e3" or "inf") is fine
+func parseFloat(b []byte) (float64, bool) {
+	if len(b) == 0 || isSpace(b[0]) || isSpace(b[len(b)-1]) {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, false
+	}
+	if math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func(r *RedisCache) APPEND(key string, value []byte) (int, error) {
+	// command syntax: APPEND key value --> returns the length of the string after the append
+	// a missing key is created, just like SET would
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		r.setEntry(key, &Entry{Type: "string", Value: value})
+		return len(value), nil
+	}
+
+	current, isString := stringBytes(entry.Value)
+	if !isString {
+		return 0, ErrWrongType
+	}
+
+	if int64(len(current)+len(value)) > r.Config.ProtoMaxBulkLen {
+		return 0, ErrStringTooLong
+	}
+
+	// appending in place is safe for anyone still holding the old slice, it never sees past its own length
+	// repeated APPENDs on a growing string therefore only copy when the capacity runs out
+	current = append(current, value...)
+	entry.Value = current
+	return len(current), nil
+}
+
+func(r *RedisCache) STRLEN(key string) (int, error) {
+	// command syntax: STRLEN key --> 0 for a missing key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return 0, nil
+	}
+
+	if n, isInt := entry.Value.(int64); isInt {
+		return len(strconv.FormatInt(n, 10)), nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return 0, ErrWrongType
+	}
+	return len(value), nil
+}
+
+func(r *RedisCache) GETRANGE(key string, start int64, end int64) ([]byte, error) {
+	// command syntax: GETRANGE key start end (SUBSTR is the old name)
+	// both offsets are inclusive and negative ones count from the end, -1 being the last byte
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.lookup(key)
+	if !exists {
+		return []byte{}, nil
+	}
+
+	value, isString := stringBytes(entry.Value)
+	if !isString {
+		return nil, ErrWrongType
+	}
+
+	length := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return []byte{}, nil
+	}
+
+	if start < 0 {
+		start = length + start
+	}
+	if end < 0 {
+		end = length + end
+	}
+	start = max(start, 0)
+	end = max(end, 0)
+	end = min(end, length-1)
+
+	if start > end || length == 0 {
+		return []byte{}, nil
+	}
+
+	return bytes.Clone(value[start : end+1]), nil
+}
+
+func(r *RedisCache) SETRANGE(key string, offset int64, value []byte) (int, error) {
+	// command syntax: SETRANGE key offset value --> returns the length of the string afterwards
+	// writing past the end pads the string with zero bytes, e.g. SETRANGE empty 5 "x" gives "\x00\x00\x00\x00\x00x"
+	// the string is changed in place, so overwriting a few bytes of a big value does not copy all of it
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if offset < 0 {
+		return 0, ErrOffsetOutOfRange
+	}
+
+	entry, exists := r.lookup(key)
+
+	var current []byte
+	if exists {
+		var isString bool
+		current, isString = stringBytes(entry.Value)
+		if !isString {
+			return 0, ErrWrongType
+		}
+	}
+
+	// nothing to write: the key is left alone, and a missing key is not created
+	if len(value) == 0 {
+		return len(current), nil
+	}
+
+	// offset+len(value) could overflow for a huge offset, so the limit is moved to the other side
+	if offset > r.Config.ProtoMaxBulkLen-int64(len(value)) {
+		return 0, ErrStringTooLong
+	}
+
+	if !exists {
+		entry = &Entry{Type: "string", Value: []byte{}}
+		r.setEntry(key, entry)
+	}
+
+	current = stringForWrite(entry, int(offset)+len(value))
+	copy(current[offset:], value)
+	return len(current), nil
+}
+
+// stringForWrite prepares a string entry for being changed in place: the value is switched to the []byte
+// encoding and padded with zero bytes to at least length bytes, the caller must hold r.mu
+func stringForWrite(entry *Entry, length int) []byte {
+	value, _ := stringBytes(entry.Value)
+	if _, isInt := entry.Value.(int64); isInt {
+		// the int encoding has no bytes to change, stringBytes made a fresh copy of the digits
+		value = bytes.Clone(value)
+	}
+
+	if len(value) < length {
+		value = append(value, make([]byte, length-len(value))...)
+	}
+
+	entry.Value = value
+	return value
+}
+
+func(r *RedisCache) MGET(keys []string) [][]byte {
+	// command syntax: MGET key [key ...]
+	// missing keys and keys that do not hold a string are nil in the result, MGET never fails with WRONGTYPE
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		entry, exists := r.lookup(key)
+		if !exists {
+			continue
+		}
+
+		if value, isString := stringBytes(entry.Value); isString {
+			values[i] = bytes.Clone(value)
+		}
+	}
+	return values
+}
+
+func(r *RedisCache) MSET(keys []string, values [][]byte) {
+	// command syntax: MSET key value [key value ...]
+	// all keys are written under one lock, so no client ever sees only some of them
+	// like SET it overwrites keys of any type and clears their TTL
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, key := range keys {
+		r.setEntry(key, &Entry{Type: "string", Value: newStringValue(values[i])})
+	}
+}
+
+func(r *RedisCache) MSETNX(keys []string, values [][]byte) bool {
+	// command syntax: MSETNX key value [key value ...]
+	// either every key is set or, if at least one of them exists already, none of them
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		if _, exists := r.lookup(key); exists {
+			return false
+		}
+	}
+
+	for i, key := range keys {
+		r.setEntry(key, &Entry{Type: "string", Value: newStringValue(values[i])})
+	}
+	return true
+}
@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetOptions(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		// SET overwrites, it never refuses an existing key
+		{[]string{"SET", "k", "v1"}, "+OK\r\n"},
+		{[]string{"SET", "k", "v2"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$2\r\nv2\r\n"},
+
+		{[]string{"SET", "k", "v3", "NX"}, "$-1\r\n"},
+		{[]string{"SET", "new", "v", "XX"}, "$-1\r\n"},
+		{[]string{"GET", "new"}, "$-1\r\n"},
+		{[]string{"SET", "k", "v3", "xx"}, "+OK\r\n"},
+
+		{[]string{"SET", "k", "v4", "GET"}, "$2\r\nv3\r\n"},
+		{[]string{"SET", "missing", "v", "GET"}, "$-1\r\n"},
+		// NX together with GET replies with the old value, and does not write
+		{[]string{"SET", "k", "v5", "NX", "GET"}, "$2\r\nv4\r\n"},
+		{[]string{"GET", "k"}, "$2\r\nv4\r\n"},
+
+		// without a TTL option SET clears the TTL, KEEPTTL keeps it
+		{[]string{"SET", "k", "v", "EX", "100"}, "+OK\r\n"},
+		{[]string{"TTL", "k"}, ":99\r\n"},
+		{[]string{"SET", "k", "v", "KEEPTTL"}, "+OK\r\n"},
+		{[]string{"TTL", "k"}, ":99\r\n"},
+		{[]string{"SET", "k", "v"}, "+OK\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+
+		{[]string{"SET", "k", "v", "PX", "100000"}, "+OK\r\n"},
+		{[]string{"TTL", "k"}, ":99\r\n"},
+		{[]string{"SET", "k", "v", "EXAT", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)}, "+OK\r\n"},
+		{[]string{"SET", "k", "v", "PXAT", strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)}, "+OK\r\n"},
+		// an absolute time in the past deletes the key
+		{[]string{"SET", "k", "v", "EXAT", "1"}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+
+		{[]string{"SET", "k", "v", "NX", "XX"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "10", "PX", "100"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "10", "KEEPTTL"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "BOGUS"}, "-ERR syntax error\r\n"},
+		{[]string{"SET", "k", "v", "EX", "ten"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "PX", "-5"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k", "v", "EX", "9223372036854775807"}, "-ERR invalid expire time in 'set' command\r\n"},
+
+		// SET replaces keys of any type, but SET ... GET refuses to when it cannot return the old value
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"SET", "list", "v", "GET"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"LLEN", "list"}, ":1\r\n"},
+		{[]string{"SET", "list", "v"}, "+OK\r\n"},
+		{[]string{"GET", "list"}, "$1\r\nv\r\n"},
+	});
+}
+
+func TestLegacySetCommands(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SETNX", "k", "v1"}, ":1\r\n"},
+		{[]string{"SETNX", "k", "v2"}, ":0\r\n"},
+		{[]string{"GET", "k"}, "$2\r\nv1\r\n"},
+
+		{[]string{"SETEX", "k", "100", "v"}, "+OK\r\n"},
+		{[]string{"TTL", "k"}, ":99\r\n"},
+		{[]string{"PSETEX", "k", "100000", "v"}, "+OK\r\n"},
+		{[]string{"TTL", "k"}, ":99\r\n"},
+		{[]string{"SETEX", "k", "0", "v"}, "-ERR invalid expire time in 'setex' command\r\n"},
+		{[]string{"PSETEX", "k", "-1", "v"}, "-ERR invalid expire time in 'psetex' command\r\n"},
+		{[]string{"SETEX", "k", "v"}, "-ERR wrong number of arguments for 'setex' command\r\n"},
+
+		// GETSET clears the TTL just like SET does
+		{[]string{"GETSET", "k", "new"}, "$1\r\nv\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"GETSET", "fresh", "v"}, "$-1\r\n"},
+
+		{[]string{"GETDEL", "k"}, "$3\r\nnew\r\n"},
+		{[]string{"GETDEL", "k"}, "$-1\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"GETDEL", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"GETSET", "list", "v"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+
+		{[]string{"SET", "k", "v"}, "+OK\r\n"},
+		{[]string{"GETEX", "k"}, "$1\r\nv\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"GETEX", "k", "EX", "100"}, "$1\r\nv\r\n"},
+		{[]string{"TTL", "k"}, ":99\r\n"},
+		{[]string{"GETEX", "k", "PERSIST"}, "$1\r\nv\r\n"},
+		{[]string{"TTL", "k"}, ":-1\r\n"},
+		{[]string{"GETEX", "k", "EX", "10", "PERSIST"}, "-ERR syntax error\r\n"},
+		{[]string{"GETEX", "k", "PX", "0"}, "-ERR invalid expire time in 'getex' command\r\n"},
+		{[]string{"GETEX", "k", "PXAT", "1"}, "$1\r\nv\r\n"},
+		{[]string{"GET", "k"}, "$-1\r\n"},
+		{[]string{"GETEX", "missing", "EX", "10"}, "$-1\r\n"},
+	});
+}
+
+// an expired key must be gone for NX/XX even before the background cleaner runs
+func TestSetRespectsLazyExpiry(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"SET", "k", "old", "PX", "1"}, "+OK\r\n"},
+	});
+	time.Sleep(5 * time.Millisecond);
+
+	runSteps(t, cache, []step{
+		{[]string{"SET", "k", "v", "XX"}, "$-1\r\n"},
+		{[]string{"SET", "k", "v", "NX", "GET"}, "$-1\r\n"},
+		{[]string{"GET", "k"}, "$1\r\nv\r\n"},
+	});
+}
+
+func TestIncrCommands(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"INCR", "counter"}, ":1\r\n"},
+		{[]string{"INCRBY", "counter", "41"}, ":42\r\n"},
+		{[]string{"DECR", "counter"}, ":41\r\n"},
+		{[]string{"DECRBY", "counter", "-9"}, ":50\r\n"},
+		{[]string{"GET", "counter"}, "$2\r\n50\r\n"},
+
+		// the TTL survives an increment
+		{[]string{"SET", "limited", "10", "EX", "100"}, "+OK\r\n"},
+		{[]string{"INCR", "limited"}, ":11\r\n"},
+		{[]string{"TTL", "limited"}, ":99\r\n"},
+
+		{[]string{"SET", "max", "9223372036854775807"}, "+OK\r\n"},
+		{[]string{"INCR", "max"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"SET", "min", "-9223372036854775808"}, "+OK\r\n"},
+		{[]string{"DECR", "min"}, "-ERR increment or decrement would overflow\r\n"},
+		{[]string{"DECRBY", "counter", "-9223372036854775808"}, "-ERR decrement would overflow\r\n"},
+		{[]string{"GET", "max"}, "$19\r\n9223372036854775807\r\n"},
+
+		// only the exact decimal form of an integer counts
+		{[]string{"SET", "padded", "007"}, "+OK\r\n"},
+		{[]string{"INCR", "padded"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"SET", "text", "hello"}, "+OK\r\n"},
+		{[]string{"INCR", "text"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCRBY", "counter", "+1"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"INCRBY", "counter", "9223372036854775808"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"INCR", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+
+		{[]string{"SET", "price", "10.50"}, "+OK\r\n"},
+		{[]string{"INCRBYFLOAT", "price", "0.1"}, "$4\r\n10.6\r\n"},
+		{[]string{"INCRBYFLOAT", "price", "-5.6"}, "$1\r\n5\r\n"},
+		{[]string{"INCR", "price"}, ":6\r\n"},
+		{[]string{"INCRBYFLOAT", "price", "5.0e3"}, "$4\r\n5006\r\n"},
+		{[]string{"INCRBYFLOAT", "fresh", "1.5"}, "$3\r\n1.5\r\n"},
+		{[]string{"INCRBYFLOAT", "fresh", "abc"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"INCRBYFLOAT", "fresh", " 1"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"INCRBYFLOAT", "text", "1"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"INCRBYFLOAT", "fresh", "inf"}, "-ERR increment would produce NaN or Infinity\r\n"},
+		{[]string{"INCRBYFLOAT", "list", "1"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+// counters are stored as int64 and only formatted when somebody reads them
+func TestIntegerEncoding(t *testing.T) {
+	cache := NewRedisServer();
+
+	testCases := []struct {
+		value string
+		isInt bool
+	}{
+		{"42", true},
+		{"-9223372036854775808", true},
+		{"0", true},
+		{"007", false},
+		{"-0", false},
+		{"+1", false},
+		{"1.5", false},
+		{"9223372036854775808", false},
+		{"", false},
+	};
+
+	for _, tc := range testCases {
+		cache.SET("k", []byte(tc.value), SetOptions{});
+
+		_, isInt := cache.store["k"].Value.(int64);
+		if isInt != tc.isInt {
+			t.Errorf("%q: expected int encoding to be %t", tc.value, tc.isInt);
+		};
+
+		value, _, _ := cache.GET("k");
+		if string(value) != tc.value {
+			t.Errorf("%q: GET returned %q", tc.value, value);
+		};
+	};
+
+	cache.INCRBY("counter", 5);
+	if _, isInt := cache.store["counter"].Value.(int64); !isInt {
+		t.Errorf("Expected INCRBY to store an int64, but got %T", cache.store["counter"].Value);
+	};
+}
+
+// INCR has to be atomic, every one of the concurrent increments must count
+func TestConcurrentIncr(t *testing.T) {
+	cache := NewRedisServer();
+
+	var wg sync.WaitGroup;
+	for range 100 {
+		wg.Add(1);
+		go func() {
+			defer wg.Done();
+			cache.INCRBY("counter", 1);
+		}();
+	};
+	wg.Wait();
+
+	value, _, _ := cache.GET("counter");
+	if string(value) != "100" {
+		t.Errorf("Expected 100 after 100 concurrent increments, but got %q", value);
+	};
+}
+
+func TestStringRangeCommands(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"APPEND", "k", "Hello"}, ":5\r\n"},
+		{[]string{"APPEND", "k", " World"}, ":11\r\n"},
+		{[]string{"STRLEN", "k"}, ":11\r\n"},
+		{[]string{"STRLEN", "missing"}, ":0\r\n"},
+
+		{[]string{"GETRANGE", "k", "0", "4"}, "$5\r\nHello\r\n"},
+		{[]string{"GETRANGE", "k", "-5", "-1"}, "$5\r\nWorld\r\n"},
+		{[]string{"GETRANGE", "k", "0", "-1"}, "$11\r\nHello World\r\n"},
+		{[]string{"GETRANGE", "k", "5", "100"}, "$6\r\n World\r\n"},
+		{[]string{"GETRANGE", "k", "-100", "2"}, "$3\r\nHel\r\n"},
+		{[]string{"GETRANGE", "k", "-1", "-5"}, "$0\r\n\r\n"},
+		{[]string{"GETRANGE", "k", "6", "2"}, "$0\r\n\r\n"},
+		{[]string{"SUBSTR", "k", "6", "6"}, "$1\r\nW\r\n"},
+		{[]string{"GETRANGE", "missing", "0", "-1"}, "$0\r\n\r\n"},
+		{[]string{"GETRANGE", "k", "a", "1"}, "-ERR value is not an integer or out of range\r\n"},
+
+		{[]string{"SETRANGE", "k", "6", "Redis"}, ":11\r\n"},
+		{[]string{"GET", "k"}, "$11\r\nHello Redis\r\n"},
+		{[]string{"SETRANGE", "padded", "3", "x"}, ":4\r\n"},
+		{[]string{"GET", "padded"}, "$4\r\n\x00\x00\x00x\r\n"},
+		{[]string{"SETRANGE", "k", "0", ""}, ":11\r\n"},
+		{[]string{"SETRANGE", "nothing", "5", ""}, ":0\r\n"},
+		{[]string{"GET", "nothing"}, "$-1\r\n"},
+		{[]string{"SETRANGE", "k", "-1", "x"}, "-ERR offset is out of range\r\n"},
+		{[]string{"SETRANGE", "k", "536870911", "xx"}, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n"},
+		{[]string{"SETRANGE", "k", "9223372036854775807", "x"}, "-ERR string exceeds maximum allowed size (proto-max-bulk-len)\r\n"},
+
+		// integers work like their decimal text
+		{[]string{"SET", "n", "12345"}, "+OK\r\n"},
+		{[]string{"STRLEN", "n"}, ":5\r\n"},
+		{[]string{"GETRANGE", "n", "1", "2"}, "$2\r\n23\r\n"},
+		{[]string{"APPEND", "n", "6"}, ":6\r\n"},
+		{[]string{"INCR", "n"}, ":123457\r\n"},
+
+		{[]string{"RPUSH", "list", "a"}, ":1\r\n"},
+		{[]string{"APPEND", "list", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"STRLEN", "list"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"SETRANGE", "list", "0", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestMultiKeyStringCommands(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"MSET", "a", "1", "b", "2", "a", "3"}, "+OK\r\n"},
+		{[]string{"RPUSH", "list", "x"}, ":1\r\n"},
+		{[]string{"MGET", "a", "b", "missing", "list"}, "*4\r\n$1\r\n3\r\n$1\r\n2\r\n$-1\r\n$-1\r\n"},
+		{[]string{"MSET", "a"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{[]string{"MSET", "a", "1", "b"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+
+		// MSETNX is all or nothing
+		{[]string{"MSETNX", "c", "1", "a", "2"}, ":0\r\n"},
+		{[]string{"MGET", "c", "a"}, "*2\r\n$-1\r\n$1\r\n3\r\n"},
+		{[]string{"MSETNX", "c", "1", "d", "2"}, ":1\r\n"},
+		{[]string{"MGET", "c", "d"}, "*2\r\n$1\r\n1\r\n$1\r\n2\r\n"},
+
+		// MSET clears TTLs like SET does
+		{[]string{"SET", "e", "v", "EX", "100"}, "+OK\r\n"},
+		{[]string{"MSET", "e", "w"}, "+OK\r\n"},
+		{[]string{"TTL", "e"}, ":-1\r\n"},
+	});
+}
+
+// a reader holding on to a value must never see it change underneath it
+func TestStringValuesAreNotOverwritten(t *testing.T) {
+	cache := NewRedisServer();
+	cache.SET("k", []byte("hello"), SetOptions{});
+
+	before, _, _ := cache.GET("k");
+	cache.SETRANGE("k", 0, []byte("J"));
+	cache.APPEND("k", []byte(" world"));
+
+	if string(before) != "hello" {
+		t.Errorf("Expected the old value to stay 'hello', but it became %q", before);
+	};
+	if after, _, _ := cache.GET("k"); string(after) != "Jello world" {
+		t.Errorf("Expected 'Jello world', but got %q", after);
+	};
+}
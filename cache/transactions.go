@@ -5,8 +5,15 @@ package cache
 // EXEC --> after all the commands are queued, they are executed sequentially and returns all the results
 // DISCARD --> Clear queue, exits transaction mode
 
-func(r *RedisCache) queueCommands(client *Client, cmd []any) bool {
-	client.Transactions = append(client.Transactions, cmd)
+func(r *RedisCache) queueCommands(client *Client, cmd [][]byte) bool {
+	// the arguments point into the connection's read buffer, which gets reused for the next command
+	// so the queued copy needs its own memory
+	queued := make([][]byte, len(cmd))
+	for i, arg := range cmd {
+		queued[i] = append([]byte(nil), arg...)
+	}
+
+	client.Transactions = append(client.Transactions, queued)
 	return true
 }
 
@@ -22,7 +29,7 @@ func(r *RedisCache) MULTI(client *Client) (string, bool) {
 	// set the transaction mode to true
 	// transaction queue for commands is initialised
 	client.InTransaction = true
-	client.Transactions = make([][]interface{}, 0)
+	client.Transactions = make([][][]byte, 0)
 	return "MULTI command is active", true
 }
 
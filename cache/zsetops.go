@@ -0,0 +1,494 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// commands needed to be implemented:
+// ZUNION, ZINTER, ZDIFF [WEIGHTS] [AGGREGATE] [WITHSCORES]		--> Done
+// ZUNIONSTORE, ZINTERSTORE, ZDIFFSTORE						--> Done
+// ZINTERCARD [LIMIT]										--> Done
+// ZPOPMIN, ZPOPMAX, ZMPOP									--> Done
+// ZRANDMEMBER [count [WITHSCORES]]							--> Done
+// ZRANGESTORE												--> Done
+
+// how ZUNION and ZINTER combine the scores of a member that is in more than one input
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// ZStoreOptions holds the options of ZUNION, ZINTER and their STORE forms
+type ZStoreOptions struct {
+	Weights 	[]float64 // one per input key, nil means all 1
+	Aggregate 	int
+	WithScores 	bool // only for the commands that reply with the result
+}
+
+// parseNumKeys reads "numkeys key [key ...]" and returns the keys and whatever comes after them
+func parseNumKeys(args [][]byte, command string) ([]string, [][]byte, error) {
+	if len(args) == 0 {
+		return nil, nil, ErrSyntax
+	}
+
+	numKeys, ok := parseInteger(args[0])
+	if !ok {
+		return nil, nil, ErrNotInteger
+	}
+	if numKeys < 1 {
+		return nil, nil, errAtLeastOneKey(command)
+	}
+	if numKeys > int64(len(args)-1) {
+		return nil, nil, ErrSyntax
+	}
+
+	return stringArgs(args[1 : numKeys+1]), args[numKeys+1:], nil
+}
+
+// parseZStoreOptions reads the options after the keys, store rejects WITHSCORES and diff rejects WEIGHTS and AGGREGATE
+func parseZStoreOptions(args [][]byte, numKeys int, store bool, diff bool) (ZStoreOptions, error) {
+	var opts ZStoreOptions
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+
+		switch {
+		case option == "WEIGHTS" && !diff && i+numKeys < len(args):
+			opts.Weights = make([]float64, numKeys)
+			for j := range opts.Weights {
+				weight, ok := parseFloat(args[i+1+j])
+				if !ok {
+					return opts, ErrWeightNotFloat
+				}
+				opts.Weights[j] = weight
+			}
+			i += numKeys
+		case option == "AGGREGATE" && !diff && i+1 < len(args):
+			switch strings.ToUpper(string(args[i+1])) {
+			case "SUM":
+				opts.Aggregate = aggregateSum
+			case "MIN":
+				opts.Aggregate = aggregateMin
+			case "MAX":
+				opts.Aggregate = aggregateMax
+			default:
+				return opts, ErrSyntax
+			}
+			i++
+		case option == "WITHSCORES" && !store:
+			opts.WithScores = true
+		default:
+			return opts, ErrSyntax
+		}
+	}
+
+	return opts, nil
+}
+
+// zsetInputs returns the scores of every input key, plain sets count as sorted sets where every score is 1
+// missing keys are empty inputs, the caller must hold r.mu
+func(r *RedisCache) zsetInputs(keys []string) ([]map[string]float64, error) {
+	inputs := make([]map[string]float64, len(keys))
+
+	for i, key := range keys {
+		entry, exists := r.lookup(key)
+		if !exists {
+			inputs[i] = map[string]float64{}
+			continue
+		}
+
+		switch value := entry.Value.(type) {
+		case *sortedSet:
+			inputs[i] = value.scores()
+		case *redisSet:
+			scores := make(map[string]float64, value.len())
+			value.forEach(func(member string) bool {
+				scores[member] = 1
+				return true
+			})
+			inputs[i] = scores
+		default:
+			return nil, ErrWrongType
+		}
+	}
+
+	return inputs, nil
+}
+
+// weightedScore is score * weight, where inf * 0 counts as 0 instead of NaN
+func weightedScore(score float64, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+func aggregate(current float64, score float64, how int) float64 {
+	switch how {
+	case aggregateMin:
+		return math.Min(current, score)
+	case aggregateMax:
+		return math.Max(current, score)
+	}
+
+	// inf + -inf is NaN, Redis stores 0 then
+	sum := current + score
+	if math.IsNaN(sum) {
+		return 0
+	}
+	return sum
+}
+
+func(opts ZStoreOptions) weight(i int) float64 {
+	if opts.Weights == nil {
+		return 1
+	}
+	return opts.Weights[i]
+}
+
+// zunion, zinter and zdiff build the result of the set operation, the caller must hold r.mu
+func(r *RedisCache) zunion(keys []string, opts ZStoreOptions) (*sortedSet, error) {
+	inputs, err := r.zsetInputs(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := map[string]float64{}
+	for i, input := range inputs {
+		for member, score := range input {
+			score = weightedScore(score, opts.weight(i))
+			if current, exists := scores[member]; exists {
+				score = aggregate(current, score, opts.Aggregate)
+			}
+			scores[member] = score
+		}
+	}
+
+	return sortedSetFromScores(&r.Config, scores), nil
+}
+
+func(r *RedisCache) zinter(keys []string, opts ZStoreOptions) (*sortedSet, error) {
+	inputs, err := r.zsetInputs(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// walking the smallest input means the fewest lookups in the others
+	smallest := 0
+	for i, input := range inputs {
+		if len(input) < len(inputs[smallest]) {
+			smallest = i
+		}
+	}
+
+	scores := map[string]float64{}
+	for member := range inputs[smallest] {
+		first, inAll := inputs[0][member]
+		score := weightedScore(first, opts.weight(0))
+
+		for i := 1; i < len(inputs) && inAll; i++ {
+			other, exists := inputs[i][member]
+			if !exists {
+				inAll = false
+				break
+			}
+			score = aggregate(score, weightedScore(other, opts.weight(i)), opts.Aggregate)
+		}
+
+		if inAll {
+			scores[member] = score
+		}
+	}
+
+	return sortedSetFromScores(&r.Config, scores), nil
+}
+
+func(r *RedisCache) zdiff(keys []string) (*sortedSet, error) {
+	inputs, err := r.zsetInputs(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := map[string]float64{}
+	for member, score := range inputs[0] {
+		inOther := false
+		for _, other := range inputs[1:] {
+			if _, exists := other[member]; exists {
+				inOther = true
+				break
+			}
+		}
+
+		if !inOther {
+			scores[member] = score
+		}
+	}
+
+	return sortedSetFromScores(&r.Config, scores), nil
+}
+
+// sortedSetFromScores builds the result of a set operation, one too big for a listpack is a skiplist right away
+func sortedSetFromScores(cfg *Config, scores map[string]float64) *sortedSet {
+	if len(scores) > cfg.ZSetMaxListpackEntries {
+		cfg = nil
+	}
+
+	zset := newSortedSet(cfg)
+	for member, score := range scores {
+		zset.set(member, score)
+	}
+	return zset
+}
+
+// storeSortedSet replaces whatever dest holds with the result, an empty result deletes dest
+func(r *RedisCache) storeSortedSet(dest string, zset *sortedSet) int {
+	if zset.len() == 0 {
+		r.deleteEntry(dest)
+		return 0
+	}
+
+	r.setEntry(dest, &Entry{Type: "zset", Value: zset})
+	return zset.len()
+}
+
+func(r *RedisCache) ZUNION(keys []string, opts ZStoreOptions) ([]ZMember, error) {
+	// command syntax: ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.zunion(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+	return zset.members(), nil
+}
+
+func(r *RedisCache) ZINTER(keys []string, opts ZStoreOptions) ([]ZMember, error) {
+	// command syntax: ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.zinter(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+	return zset.members(), nil
+}
+
+func(r *RedisCache) ZDIFF(keys []string) ([]ZMember, error) {
+	// command syntax: ZDIFF numkeys key [key ...] [WITHSCORES]
+	// the members of the first key that are in none of the others, with their scores from the first key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.zdiff(keys)
+	if err != nil {
+		return nil, err
+	}
+	return zset.members(), nil
+}
+
+func(r *RedisCache) ZUNIONSTORE(dest string, keys []string, opts ZStoreOptions) (int, error) {
+	// command syntax: ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+	// returns the number of members in destination
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.zunion(keys, opts)
+	if err != nil {
+		return 0, err
+	}
+	return r.storeSortedSet(dest, zset), nil
+}
+
+func(r *RedisCache) ZINTERSTORE(dest string, keys []string, opts ZStoreOptions) (int, error) {
+	// command syntax: ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.zinter(keys, opts)
+	if err != nil {
+		return 0, err
+	}
+	return r.storeSortedSet(dest, zset), nil
+}
+
+func(r *RedisCache) ZDIFFSTORE(dest string, keys []string) (int, error) {
+	// command syntax: ZDIFFSTORE destination numkeys key [key ...]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.zdiff(keys)
+	if err != nil {
+		return 0, err
+	}
+	return r.storeSortedSet(dest, zset), nil
+}
+
+func(r *RedisCache) ZINTERCARD(keys []string, limit int64) (int, error) {
+	// command syntax: ZINTERCARD numkeys key [key ...] [LIMIT limit]
+	// only counts, so no result set is built, and the count stops at limit (0 means no limit)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inputs, err := r.zsetInputs(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	smallest := 0
+	for i, input := range inputs {
+		if len(input) < len(inputs[smallest]) {
+			smallest = i
+		}
+	}
+
+	count := 0
+	for member := range inputs[smallest] {
+		inAll := true
+		for _, other := range inputs {
+			if _, exists := other[member]; !exists {
+				inAll = false
+				break
+			}
+		}
+
+		if inAll {
+			count++
+			if int64(count) == limit {
+				break
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// pop removes up to count members from the low end of the set, or the high end for max
+func(z *sortedSet) pop(count int64, max bool) []ZMember {
+	popped := []ZMember{}
+
+	for ; count > 0 && z.len() > 0; count-- {
+		m := z.byRank(1)
+		if max {
+			m = z.byRank(z.len())
+		}
+
+		popped = append(popped, m)
+		z.remove(m.Member)
+	}
+	return popped
+}
+
+func(r *RedisCache) ZPOP(key string, count int64, max bool) ([]ZMember, error) {
+	// command syntax: ZPOPMIN key [count] / ZPOPMAX key [count]
+	// returns the popped members, lowest scores first for ZPOPMIN and highest first for ZPOPMAX
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return []ZMember{}, err
+	}
+
+	popped := zset.pop(count, max)
+	if zset.len() == 0 {
+		r.deleteEntry(key)
+	}
+	return popped, nil
+}
+
+func(r *RedisCache) ZMPOP(keys []string, count int64, max bool) (string, []ZMember, error) {
+	// command syntax: ZMPOP numkeys key [key ...] MIN | MAX [COUNT count]
+	// pops from the first key that holds a non-empty sorted set, the key is "" when none does
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range keys {
+		zset, err := r.sortedSetFor(key)
+		if err != nil {
+			return "", nil, err
+		}
+		if zset == nil {
+			continue
+		}
+
+		popped := zset.pop(count, max)
+		if zset.len() == 0 {
+			r.deleteEntry(key)
+		}
+		return key, popped, nil
+	}
+
+	return "", nil, nil
+}
+
+func(r *RedisCache) ZRANDMEMBER(key string, count int64) ([]ZMember, error) {
+	// command syntax: ZRANDMEMBER key [count [WITHSCORES]]
+	// a positive count returns distinct members (at most all of them), a negative count returns exactly -count
+	// members that may repeat
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil || count == 0 {
+		return []ZMember{}, err
+	}
+
+	length := zset.len()
+	result := []ZMember{}
+
+	if count < 0 {
+		for ; count < 0; count++ {
+			result = append(result, zset.byRank(rand.Intn(length) + 1))
+		}
+		return result, nil
+	}
+
+	if count >= int64(length) {
+		return zset.members(), nil
+	}
+
+	// a few members out of many are picked by random rank, otherwise it is cheaper to shuffle all of them
+	if count*3 < int64(length) {
+		picked := make(map[int]struct{}, count)
+		for int64(len(picked)) < count {
+			rank := rand.Intn(length) + 1
+			if _, seen := picked[rank]; seen {
+				continue
+			}
+			picked[rank] = struct{}{}
+
+			result = append(result, zset.byRank(rank))
+		}
+		return result, nil
+	}
+
+	members := zset.members()
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	return members[:count], nil
+}
+
+func(r *RedisCache) ZRANGESTORE(dest string, source string, q zrangeQuery) (int, error) {
+	// command syntax: ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+	// returns the number of members stored in dst
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(source)
+	if err != nil {
+		return 0, err
+	}
+
+	result := newSortedSet(&r.Config)
+	if zset != nil {
+		for _, m := range zset.rangeQuery(q) {
+			result.set(m.Member, m.Score)
+		}
+	}
+	return r.storeSortedSet(dest, result), nil
+}
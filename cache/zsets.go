@@ -0,0 +1,924 @@
+package cache
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// commands needed to be implemented:
+// ZADD [NX|XX] [GT|LT] [CH] [INCR]			--> Done
+// ZREM, ZSCORE, ZINCRBY, ZCARD				--> Done
+// ZRANK, ZREVRANK							--> Done
+// ZRANGE [BYSCORE|BYLEX] [REV] [LIMIT]		--> Done (ZREVRANGE, ZRANGEBYSCORE, ... are ZRANGE with fixed options)
+// ZCOUNT, ZLEXCOUNT						--> Done
+// ZREMRANGEBYRANK, ZREMRANGEBYSCORE, ZREMRANGEBYLEX	--> Done
+
+// a big sorted set is stored twice, just like in Redis:
+// the map answers "what is the score of member" in O(1) (ZSCORE, ZADD on an existing member),
+// the skiplist keeps the members ordered by score for everything that works on ranks or ranges
+// a small one (zset-max-listpack-entries members, none longer than zset-max-listpack-value bytes) is a listpack of
+// member, score, member, score, ... in the same order instead, which is walked for everything (see listpack.go)
+// a sorted set that outgrows the listpack becomes a skiplist and stays one
+type sortedSet struct {
+	dict 	map[string]float64
+	zsl 	*skiplist // nil while the listpack is used
+	index 	*scanIndex // the members of dict ordered for ZSCAN, see scanindex.go
+	lp 		listpack
+	cfg 	*Config // the encoding limits, a nil config means always a skiplist
+}
+
+// ZMember is a member of a sorted set together with its score
+type ZMember struct {
+	Member 	string
+	Score 	float64
+}
+
+func newSortedSet(cfg *Config) *sortedSet {
+	if cfg == nil {
+		return &sortedSet{dict: make(map[string]float64), zsl: newSkiplist(), index: newScanIndex()}
+	}
+	return &sortedSet{cfg: cfg}
+}
+
+func(z *sortedSet) encoding() string {
+	if z.zsl == nil {
+		return "listpack"
+	}
+	return "skiplist"
+}
+
+func(z *sortedSet) len() int {
+	if z.zsl == nil {
+		return z.lp.len() / 2
+	}
+	return len(z.dict)
+}
+
+// score returns the score of member, exists is false if the set does not have it
+func(z *sortedSet) score(member string) (score float64, exists bool) {
+	if z.zsl != nil {
+		score, exists = z.dict[member]
+		return score, exists
+	}
+
+	pos := z.lp.find(member, 2)
+	if pos < 0 {
+		return 0, false
+	}
+	_, next := z.lp.entry(pos)
+	packed, _ := z.lp.entry(next)
+	return unpackScore(packed), true
+}
+
+// set adds a member or moves it to a new score, added is true for new members
+func(z *sortedSet) set(member string, score float64) (added bool) {
+	if z.zsl == nil {
+		return z.packedSet(member, score)
+	}
+
+	current, exists := z.dict[member]
+	if exists {
+		if current != score {
+			z.zsl.updateScore(current, member, score)
+			z.dict[member] = score
+		}
+		return false
+	}
+
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	z.index.insert(member)
+	return true
+}
+
+// packedSet is set for the listpack: the member is taken out and put back in at the place of its new score
+func(z *sortedSet) packedSet(member string, score float64) bool {
+	pos := z.lp.find(member, 2)
+	if pos < 0 && (z.len() >= z.cfg.ZSetMaxListpackEntries || len(member) > z.cfg.ZSetMaxListpackValue) {
+		z.convertToSkiplist()
+		return z.set(member, score)
+	}
+
+	if pos >= 0 {
+		z.lp.remove(pos, 2)
+	}
+
+	// the first pair that sorts after the new one, or the end
+	at := len(z.lp.buf)
+	var current []byte
+	i := 0
+	z.lp.forEach(func(p int, entry []byte) bool {
+		i++
+		if i%2 == 1 {
+			current = entry
+			return true
+		}
+		if s := unpackScore(entry); s > score || (s == score && string(current) > member) {
+			at = p - len(current) - uvarintLen(len(current))
+			return false
+		}
+		return true
+	})
+
+	z.lp.insert(at, member, packScore(score))
+	return pos < 0
+}
+
+func(z *sortedSet) convertToSkiplist() {
+	members := z.members()
+	z.lp = listpack{}
+	z.dict, z.zsl, z.index = make(map[string]float64, len(members)), newSkiplist(), newScanIndex()
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+}
+
+func(z *sortedSet) remove(member string) bool {
+	if z.zsl == nil {
+		pos := z.lp.find(member, 2)
+		if pos < 0 {
+			return false
+		}
+		z.lp.remove(pos, 2)
+		return true
+	}
+
+	score, exists := z.dict[member]
+	if !exists {
+		return false
+	}
+
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	z.index.remove(member)
+	return true
+}
+
+// members returns every member in order, lowest score first
+func(z *sortedSet) members() []ZMember {
+	result := make([]ZMember, 0, z.len())
+	if z.zsl == nil {
+		var member []byte
+		i := 0
+		z.lp.forEach(func(_ int, entry []byte) bool {
+			i++
+			if i%2 == 1 {
+				member = entry
+			} else {
+				result = append(result, ZMember{Member: string(member), Score: unpackScore(entry)})
+			}
+			return true
+		})
+		return result
+	}
+
+	for x := z.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+	}
+	return result
+}
+
+// scores returns the score of every member, for a skiplist that is the map itself, which must not be changed
+func(z *sortedSet) scores() map[string]float64 {
+	if z.zsl != nil {
+		return z.dict
+	}
+
+	scores := make(map[string]float64, z.len())
+	for _, m := range z.members() {
+		scores[m.Member] = m.Score
+	}
+	return scores
+}
+
+// byRank returns the member at rank, 1 <= rank <= len
+func(z *sortedSet) byRank(rank int) ZMember {
+	if z.zsl == nil {
+		var m ZMember
+		i := 0
+		z.lp.forEach(func(_ int, entry []byte) bool {
+			switch i {
+			case 2*rank - 2:
+				m.Member = string(entry)
+			case 2*rank - 1:
+				m.Score = unpackScore(entry)
+				return false
+			}
+			i++
+			return true
+		})
+		return m
+	}
+	x := z.zsl.byRank(rank)
+	return ZMember{Member: x.member, Score: x.score}
+}
+
+// rank returns the rank of a member that is in the set, counting from 1
+func(z *sortedSet) rank(score float64, member string) int {
+	if z.zsl != nil {
+		return z.zsl.rank(score, member)
+	}
+
+	rank := 0
+	for i, m := range z.members() {
+		if m.Member == member {
+			rank = i + 1
+			break
+		}
+	}
+	return rank
+}
+
+// removeWhere takes the members fn picks out of a listpack, fn gets their rank (counting from 1) as well
+func(z *sortedSet) removeWhere(fn func(rank int, m ZMember) bool) []string {
+	removed := []string{}
+	kept := listpack{}
+	for i, m := range z.members() {
+		if fn(i+1, m) {
+			removed = append(removed, m.Member)
+			continue
+		}
+		kept.append(m.Member, packScore(m.Score))
+	}
+	z.lp = kept
+	return removed
+}
+
+// countWhere counts the members of a listpack fn picks
+func(z *sortedSet) countWhere(fn func(m ZMember) bool) int {
+	count := 0
+	for _, m := range z.members() {
+		if fn(m) {
+			count++
+		}
+	}
+	return count
+}
+
+// forEachInScoreRange calls fn for the members inside rng, lowest score first, until fn returns false
+func(z *sortedSet) forEachInScoreRange(rng scoreRange, fn func(m ZMember) bool) {
+	if z.zsl == nil {
+		for _, m := range z.members() {
+			if rng.contains(m.Score) && !fn(m) {
+				return
+			}
+		}
+		return
+	}
+
+	for x := z.zsl.firstInRange(rng); x != nil && rng.belowMax(x.score); x = x.level[0].forward {
+		if !fn(ZMember{Member: x.member, Score: x.score}) {
+			return
+		}
+	}
+}
+
+// sortedSetFor returns the sorted set stored under key, nil if there is none, the caller must hold r.mu
+func(r *RedisCache) sortedSetFor(key string) (*sortedSet, error) {
+	entry, exists := r.lookup(key)
+	if !exists {
+		return nil, nil
+	}
+
+	zset, isZSet := entry.Value.(*sortedSet)
+	if !isZSet {
+		return nil, ErrWrongType
+	}
+	return zset, nil
+}
+
+// parseScoreRange reads the min and max of ZRANGEBYSCORE and friends: a float, "(float" for an exclusive bound, "-inf" or "+inf"
+func parseScoreRange(min []byte, max []byte) (scoreRange, error) {
+	var rng scoreRange
+	var ok bool
+
+	rng.min, rng.minExclusive, ok = parseScoreBound(min)
+	if !ok {
+		return rng, ErrMinMaxNotFloat
+	}
+	rng.max, rng.maxExclusive, ok = parseScoreBound(max)
+	if !ok {
+		return rng, ErrMinMaxNotFloat
+	}
+	return rng, nil
+}
+
+func parseScoreBound(arg []byte) (float64, bool, bool) {
+	exclusive := len(arg) > 0 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+
+	score, ok := parseFloat(arg)
+	return score, exclusive, ok
+}
+
+// parseLexRange reads the min and max of ZRANGEBYLEX and friends: "[member", "(member", "-" or "+"
+func parseLexRange(min []byte, max []byte) (lexRange, error) {
+	var rng lexRange
+	var ok bool
+
+	rng.min, ok = parseLexBound(min)
+	if !ok {
+		return rng, ErrLexRange
+	}
+	rng.max, ok = parseLexBound(max)
+	if !ok {
+		return rng, ErrLexRange
+	}
+	return rng, nil
+}
+
+func parseLexBound(arg []byte) (lexBound, bool) {
+	if len(arg) == 0 {
+		return lexBound{}, false
+	}
+
+	switch arg[0] {
+	case '+', '-':
+		if len(arg) != 1 {
+			return lexBound{}, false
+		}
+		if arg[0] == '+' {
+			return lexBound{infinity: 1}, true
+		}
+		return lexBound{infinity: -1}, true
+	case '[':
+		return lexBound{value: string(arg[1:])}, true
+	case '(':
+		return lexBound{value: string(arg[1:]), exclusive: true}, true
+	}
+	return lexBound{}, false
+}
+
+// ZAddOptions holds the flags of a ZADD command
+type ZAddOptions struct {
+	NX 		bool // only add new members
+	XX 		bool // only update existing members
+	GT 		bool // only update a member if the new score is greater
+	LT 		bool // only update a member if the new score is less
+	CH 		bool // count changed members too, not only added ones
+	Incr 	bool // behave like ZINCRBY
+}
+
+// parseZAddArgs reads everything after "ZADD key": the flags and then the score member pairs
+func parseZAddArgs(args [][]byte) (ZAddOptions, []ZMember, error) {
+	var opts ZAddOptions
+
+	i := 0
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			opts.Incr = true
+		default:
+			break flags
+		}
+	}
+
+	elements := len(args) - i
+	if elements == 0 || elements%2 != 0 {
+		return opts, nil, ErrSyntax
+	}
+	if opts.Incr && elements > 2 {
+		return opts, nil, ErrIncrSinglePair
+	}
+	if opts.NX && opts.XX {
+		return opts, nil, ErrZAddXXAndNX
+	}
+	if (opts.GT && opts.NX) || (opts.LT && opts.NX) || (opts.GT && opts.LT) {
+		return opts, nil, ErrZAddGTLTAndNX
+	}
+
+	members := make([]ZMember, 0, elements/2)
+	for ; i < len(args); i += 2 {
+		score, ok := parseFloat(args[i])
+		if !ok {
+			return opts, nil, ErrNotFloat
+		}
+		members = append(members, ZMember{Member: string(args[i+1]), Score: score})
+	}
+
+	return opts, members, nil
+}
+
+// zadd applies one member of a ZADD, following NX/XX/GT/LT
+// applied is false when one of the flags kept the member from being added or updated
+func(z *sortedSet) zadd(member string, score float64, opts ZAddOptions) (newScore float64, added bool, updated bool, applied bool, err error) {
+	current, exists := z.score(member)
+
+	if !exists {
+		if opts.XX {
+			return 0, false, false, false, nil
+		}
+		z.set(member, score)
+		return score, true, false, true, nil
+	}
+
+	if opts.NX {
+		return current, false, false, false, nil
+	}
+
+	if opts.Incr {
+		score += current
+		if math.IsNaN(score) {
+			return 0, false, false, false, ErrScoreNaN
+		}
+	}
+
+	if (opts.GT && score <= current) || (opts.LT && score >= current) {
+		return current, false, false, false, nil
+	}
+
+	if score != current {
+		z.set(member, score)
+		return score, false, true, true, nil
+	}
+	return score, false, false, true, nil
+}
+
+func(r *RedisCache) ZADD(key string, opts ZAddOptions, members []ZMember) (int, error) {
+	// command syntax: ZADD key [NX | XX] [GT | LT] [CH] score member [score member ...]
+	// returns the number of added members, or added + updated ones with CH
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if zset == nil {
+		// XX only updates, so there is nothing to create
+		if opts.XX {
+			return 0, nil
+		}
+		zset = newSortedSet(&r.Config)
+		r.setEntry(key, &Entry{Type: "zset", Value: zset})
+	}
+
+	count := 0
+	for _, m := range members {
+		_, added, updated, _, err := zset.zadd(m.Member, m.Score, opts)
+		if err != nil {
+			return 0, err
+		}
+		if added || (opts.CH && updated) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func(r *RedisCache) ZINCRBY(key string, member string, increment float64, opts ZAddOptions) (float64, bool, error) {
+	// command syntax: ZINCRBY key increment member (and ZADD key [NX | XX] [GT | LT] INCR increment member)
+	// returns the new score, ok is false when NX/XX/GT/LT kept the increment from happening
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if zset == nil {
+		if opts.XX {
+			return 0, false, nil
+		}
+		zset = newSortedSet(&r.Config)
+		r.setEntry(key, &Entry{Type: "zset", Value: zset})
+	}
+
+	opts.Incr = true
+	score, _, _, applied, err := zset.zadd(member, increment, opts)
+	if err != nil || !applied {
+		return 0, false, err
+	}
+	return score, true, nil
+}
+
+func(r *RedisCache) ZREM(key string, members []string) (int, error) {
+	// command syntax: ZREM key member [member ...] --> the number of members removed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, member := range members {
+		if zset.remove(member) {
+			removed++
+		}
+	}
+
+	// an empty sorted set is not kept around, just like an empty list
+	if zset.len() == 0 {
+		r.deleteEntry(key)
+	}
+	return removed, nil
+}
+
+func(r *RedisCache) ZSCORE(key string, member string) (float64, bool, error) {
+	// command syntax: ZSCORE key member
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, false, err
+	}
+
+	score, exists := zset.score(member)
+	return score, exists, nil
+}
+
+func(r *RedisCache) ZCARD(key string) (int, error) {
+	// command syntax: ZCARD key
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+	return zset.len(), nil
+}
+
+func(r *RedisCache) ZRANK(key string, member string, reverse bool) (int, float64, bool, error) {
+	// command syntax: ZRANK key member [WITHSCORE] / ZREVRANK key member [WITHSCORE]
+	// ranks are 0-based, ZRANK counts from the lowest score and ZREVRANK from the highest
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, 0, false, err
+	}
+
+	score, exists := zset.score(member)
+	if !exists {
+		return 0, 0, false, nil
+	}
+
+	rank := zset.rank(score, member)
+	if reverse {
+		return zset.len() - rank, score, true, nil
+	}
+	return rank - 1, score, true, nil
+}
+
+// what ZRANGE selects by
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeQuery is a parsed ZRANGE, ZREVRANGE, ZRANGEBYSCORE, ... command
+type zrangeQuery struct {
+	by 			int
+	start 		int64 // by rank
+	stop 		int64
+	score 		scoreRange // by score
+	lex 		lexRange // by lex
+	rev 		bool
+	offset 		int64 // LIMIT offset count
+	count 		int64 // -1 for no limit
+	withScores 	bool
+}
+
+// parseZRangeArgs reads "start stop [options]" for ZRANGE
+// the older commands (ZREVRANGE, ZRANGEBYSCORE, ...) are the same query with by and rev fixed, legacy rejects the ZRANGE-only options
+func parseZRangeArgs(args [][]byte, by int, rev bool, legacy bool) (zrangeQuery, error) {
+	q := zrangeQuery{by: by, rev: rev, count: -1}
+	hasLimit := false
+
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+
+		switch {
+		case option == "WITHSCORES":
+			q.withScores = true
+		case option == "LIMIT" && i+2 < len(args):
+			offset, ok := parseInteger(args[i+1])
+			if !ok {
+				return q, ErrNotInteger
+			}
+			count, ok := parseInteger(args[i+2])
+			if !ok {
+				return q, ErrNotInteger
+			}
+			q.offset, q.count = offset, count
+			hasLimit = true
+			i += 2
+		case option == "BYSCORE" && !legacy && q.by == zrangeByRank:
+			q.by = zrangeByScore
+		case option == "BYLEX" && !legacy && q.by == zrangeByRank:
+			q.by = zrangeByLex
+		case option == "REV" && !legacy:
+			q.rev = true
+		default:
+			return q, ErrSyntax
+		}
+	}
+
+	if hasLimit && q.by == zrangeByRank {
+		return q, ErrLimitWithoutBy
+	}
+	if q.withScores && q.by == zrangeByLex {
+		return q, ErrWithScoresByLex
+	}
+
+	// reversed score and lex ranges are written "max min"
+	min, max := args[0], args[1]
+	if q.rev && q.by != zrangeByRank {
+		min, max = max, min
+	}
+
+	var err error
+	switch q.by {
+	case zrangeByRank:
+		var ok bool
+		if q.start, ok = parseInteger(min); !ok {
+			return q, ErrNotInteger
+		}
+		if q.stop, ok = parseInteger(max); !ok {
+			return q, ErrNotInteger
+		}
+	case zrangeByScore:
+		q.score, err = parseScoreRange(min, max)
+	case zrangeByLex:
+		q.lex, err = parseLexRange(min, max)
+	}
+	return q, err
+}
+
+func(r *RedisCache) ZRANGE(key string, q zrangeQuery) ([]ZMember, error) {
+	// command syntax: ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return []ZMember{}, err
+	}
+	return zset.rangeQuery(q), nil
+}
+
+// rangeQuery collects the members selected by q, in the order they are replied with
+func(z *sortedSet) rangeQuery(q zrangeQuery) []ZMember {
+	result := []ZMember{}
+	zsl := z.zsl
+
+	if q.by == zrangeByRank {
+		length := int64(z.len())
+		start, stop := q.start, q.stop
+		if start < 0 {
+			start += length
+		}
+		if stop < 0 {
+			stop += length
+		}
+		start = max(start, 0)
+
+		if start > stop || start >= length {
+			return result
+		}
+		stop = min(stop, length-1)
+
+		if zsl == nil {
+			members := z.members()
+			if q.rev {
+				slices.Reverse(members)
+			}
+			return append(result, members[start:stop+1]...)
+		}
+
+		// ranks are counted from the end for REV, so the walk goes backwards from the mirrored position
+		var x *skiplistNode
+		if q.rev {
+			x = zsl.byRank(int(length - start))
+		} else {
+			x = zsl.byRank(int(start + 1))
+		}
+
+		for n := stop - start + 1; n > 0 && x != nil; n-- {
+			result = append(result, ZMember{Member: x.member, Score: x.score})
+			if q.rev {
+				x = x.backward
+			} else {
+				x = x.level[0].forward
+			}
+		}
+		return result
+	}
+
+	// a negative offset selects nothing
+	if q.offset < 0 {
+		return result
+	}
+
+	if zsl == nil {
+		return z.packedRangeQuery(q)
+	}
+
+	// finding the first node of the range from the side the walk starts at, and the check for where it ends
+	var x *skiplistNode
+	var inRange func(*skiplistNode) bool
+	switch {
+	case q.by == zrangeByScore && !q.rev:
+		x = zsl.firstInRange(q.score)
+		inRange = func(n *skiplistNode) bool { return q.score.belowMax(n.score) }
+	case q.by == zrangeByScore:
+		x = zsl.lastInRange(q.score)
+		inRange = func(n *skiplistNode) bool { return q.score.aboveMin(n.score) }
+	case !q.rev:
+		x = zsl.firstInLexRange(q.lex)
+		inRange = func(n *skiplistNode) bool { return q.lex.belowMax(n.member) }
+	default:
+		x = zsl.lastInLexRange(q.lex)
+		inRange = func(n *skiplistNode) bool { return q.lex.aboveMin(n.member) }
+	}
+
+	next := func(n *skiplistNode) *skiplistNode {
+		if q.rev {
+			return n.backward
+		}
+		return n.level[0].forward
+	}
+
+	for offset := q.offset; x != nil && offset > 0; offset-- {
+		x = next(x)
+	}
+
+	for count := q.count; x != nil && count != 0 && inRange(x); count-- {
+		result = append(result, ZMember{Member: x.member, Score: x.score})
+		x = next(x)
+	}
+	return result
+}
+
+// packedRangeQuery is rangeQuery by score or lex for a listpack, which is simply walked from the right end
+func(z *sortedSet) packedRangeQuery(q zrangeQuery) []ZMember {
+	result := []ZMember{}
+
+	members := z.members()
+	if q.rev {
+		slices.Reverse(members)
+	}
+
+	offset, count := q.offset, q.count
+	for _, m := range members {
+		if count == 0 {
+			break
+		}
+		if (q.by == zrangeByScore && !q.score.contains(m.Score)) || (q.by == zrangeByLex && !q.lex.contains(m.Member)) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		result = append(result, m)
+		count--
+	}
+	return result
+}
+
+func(r *RedisCache) ZCOUNT(key string, rng scoreRange) (int, error) {
+	// command syntax: ZCOUNT key min max
+	// the count is the difference between the ranks of the first and the last member in the range, no walk needed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+
+	if zset.zsl == nil {
+		return zset.countWhere(func(m ZMember) bool { return rng.contains(m.Score) }), nil
+	}
+
+	first := zset.zsl.firstInRange(rng)
+	if first == nil {
+		return 0, nil
+	}
+	last := zset.zsl.lastInRange(rng)
+
+	return zset.zsl.rank(last.score, last.member) - zset.zsl.rank(first.score, first.member) + 1, nil
+}
+
+func(r *RedisCache) ZLEXCOUNT(key string, rng lexRange) (int, error) {
+	// command syntax: ZLEXCOUNT key min max
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+
+	if zset.zsl == nil {
+		return zset.countWhere(func(m ZMember) bool { return rng.contains(m.Member) }), nil
+	}
+
+	first := zset.zsl.firstInLexRange(rng)
+	if first == nil {
+		return 0, nil
+	}
+	last := zset.zsl.lastInLexRange(rng)
+
+	return zset.zsl.rank(last.score, last.member) - zset.zsl.rank(first.score, first.member) + 1, nil
+}
+
+// removeRange deletes the members the skiplist has already unlinked from the map and the SCAN index as well
+// (a listpack has no map, its members are gone already)
+func(r *RedisCache) removeRange(key string, zset *sortedSet, removed []string) int {
+	for _, member := range removed {
+		if zset.zsl != nil {
+			delete(zset.dict, member)
+			zset.index.remove(member)
+		}
+	}
+	if zset.len() == 0 {
+		r.deleteEntry(key)
+	}
+	return len(removed)
+}
+
+func(r *RedisCache) ZREMRANGEBYRANK(key string, start int64, stop int64) (int, error) {
+	// command syntax: ZREMRANGEBYRANK key start stop --> the number of members removed
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+
+	length := int64(zset.len())
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	start = max(start, 0)
+
+	if start > stop || start >= length {
+		return 0, nil
+	}
+	stop = min(stop, length-1)
+
+	if zset.zsl == nil {
+		removed := zset.removeWhere(func(rank int, _ ZMember) bool { return rank >= int(start+1) && rank <= int(stop+1) })
+		return r.removeRange(key, zset, removed), nil
+	}
+	return r.removeRange(key, zset, zset.zsl.deleteRangeByRank(int(start+1), int(stop+1))), nil
+}
+
+func(r *RedisCache) ZREMRANGEBYSCORE(key string, rng scoreRange) (int, error) {
+	// command syntax: ZREMRANGEBYSCORE key min max
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+	if zset.zsl == nil {
+		return r.removeRange(key, zset, zset.removeWhere(func(_ int, m ZMember) bool { return rng.contains(m.Score) })), nil
+	}
+	return r.removeRange(key, zset, zset.zsl.deleteRangeByScore(rng)), nil
+}
+
+func(r *RedisCache) ZREMRANGEBYLEX(key string, rng lexRange) (int, error) {
+	// command syntax: ZREMRANGEBYLEX key min max
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	zset, err := r.sortedSetFor(key)
+	if zset == nil {
+		return 0, err
+	}
+	if zset.zsl == nil {
+		return r.removeRange(key, zset, zset.removeWhere(func(_ int, m ZMember) bool { return rng.contains(m.Member) })), nil
+	}
+	return r.removeRange(key, zset, zset.zsl.deleteRangeByLex(rng)), nil
+}
@@ -0,0 +1,402 @@
+package cache
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"redis-clone/resp"
+)
+
+func TestZAdd(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "1", "one", "2", "two", "3", "three"}, ":3\r\n"},
+		{[]string{"ZADD", "z", "1", "one", "5", "two"}, ":0\r\n"},
+		{[]string{"ZSCORE", "z", "two"}, "$1\r\n5\r\n"},
+		{[]string{"ZADD", "z", "CH", "6", "two", "4", "four"}, ":2\r\n"},
+
+		{[]string{"ZADD", "z", "NX", "100", "one", "7", "seven"}, ":1\r\n"},
+		{[]string{"ZSCORE", "z", "one"}, "$1\r\n1\r\n"},
+		{[]string{"ZADD", "z", "XX", "CH", "10", "one", "8", "eight"}, ":1\r\n"},
+		{[]string{"ZSCORE", "z", "eight"}, "$-1\r\n"},
+
+		// GT/LT only limit updates, new members are still added
+		{[]string{"ZADD", "z", "GT", "CH", "5", "one", "11", "three", "9", "nine"}, ":2\r\n"},
+		{[]string{"ZSCORE", "z", "one"}, "$2\r\n10\r\n"},
+		{[]string{"ZSCORE", "z", "three"}, "$2\r\n11\r\n"},
+		{[]string{"ZADD", "z", "LT", "CH", "20", "one", "1", "three"}, ":1\r\n"},
+		{[]string{"ZSCORE", "z", "three"}, "$1\r\n1\r\n"},
+
+		{[]string{"ZADD", "z", "INCR", "2.5", "one"}, "$4\r\n12.5\r\n"},
+		{[]string{"ZADD", "z", "NX", "INCR", "1", "one"}, "$-1\r\n"},
+		{[]string{"ZADD", "z", "GT", "INCR", "-1", "one"}, "$-1\r\n"},
+		{[]string{"ZINCRBY", "z", "-0.5", "one"}, "$2\r\n12\r\n"},
+		{[]string{"ZINCRBY", "z", "+inf", "one"}, "$3\r\ninf\r\n"},
+		{[]string{"ZINCRBY", "z", "-inf", "one"}, "-ERR resulting score is not a number (NaN)\r\n"},
+		{[]string{"ZINCRBY", "new", "3", "member"}, "$1\r\n3\r\n"},
+
+		{[]string{"ZADD", "missing", "XX", "1", "a"}, ":0\r\n"},
+		{[]string{"ZCARD", "missing"}, ":0\r\n"},
+		{[]string{"ZADD", "z", "NX", "XX", "1", "a"}, "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "GT", "LT", "1", "a"}, "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "z", "INCR", "1", "a", "2", "b"}, "-ERR INCR option supports a single increment-element pair\r\n"},
+		{[]string{"ZADD", "z", "1", "a", "2"}, "-ERR syntax error\r\n"},
+		{[]string{"ZADD", "z", "one", "a"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"ZADD", "z", "nan", "a"}, "-ERR value is not a valid float\r\n"},
+		{[]string{"SET", "s", "v"}, "+OK\r\n"},
+		{[]string{"ZADD", "s", "1", "a"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestZRemRankAndCount(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c", "3", "d", "5", "e"}, ":5\r\n"},
+		{[]string{"ZCARD", "z"}, ":5\r\n"},
+		{[]string{"ZRANK", "z", "a"}, ":0\r\n"},
+		{[]string{"ZRANK", "z", "d"}, ":3\r\n"},
+		{[]string{"ZREVRANK", "z", "d"}, ":1\r\n"},
+		{[]string{"ZRANK", "z", "c", "WITHSCORE"}, "*2\r\n:2\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANK", "z", "nope"}, "$-1\r\n"},
+		{[]string{"ZRANK", "z", "nope", "WITHSCORE"}, "*-1\r\n"},
+
+		{[]string{"ZCOUNT", "z", "-inf", "+inf"}, ":5\r\n"},
+		{[]string{"ZCOUNT", "z", "(1", "3"}, ":3\r\n"},
+		{[]string{"ZCOUNT", "z", "(3", "(5"}, ":0\r\n"},
+		{[]string{"ZCOUNT", "z", "4", "2"}, ":0\r\n"},
+		{[]string{"ZCOUNT", "z", "x", "2"}, "-ERR min or max is not a float\r\n"},
+
+		{[]string{"ZREM", "z", "a", "nope", "b"}, ":2\r\n"},
+		{[]string{"ZRANK", "z", "c"}, ":0\r\n"},
+		{[]string{"ZREM", "z", "c", "d", "e"}, ":3\r\n"},
+		// the key is gone once the last member is
+		{[]string{"SET", "z", "v", "NX"}, "+OK\r\n"},
+	});
+}
+
+func TestZRange(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d"}, ":4\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "z", "1", "2", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANGE", "z", "-2", "100"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGE", "z", "3", "1"}, "*0\r\n"},
+		{[]string{"ZRANGE", "z", "0", "0", "REV"}, "*1\r\n$1\r\nd\r\n"},
+		{[]string{"ZREVRANGE", "z", "0", "1", "WITHSCORES"}, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+
+		{[]string{"ZRANGE", "z", "(1", "3", "BYSCORE"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGE", "z", "+inf", "-inf", "BYSCORE", "REV", "LIMIT", "1", "2"}, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "-inf", "+inf", "LIMIT", "1", "-1"}, "*3\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "-inf", "+inf", "LIMIT", "-1", "2"}, "*0\r\n"},
+		{[]string{"ZREVRANGEBYSCORE", "z", "3", "2", "WITHSCORES"}, "*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"ZRANGE", "missing", "0", "-1"}, "*0\r\n"},
+
+		{[]string{"ZRANGE", "z", "0", "-1", "LIMIT", "0", "1"}, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{[]string{"ZRANGE", "z", "-", "+", "BYLEX", "WITHSCORES"}, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX\r\n"},
+		{[]string{"ZRANGEBYSCORE", "z", "0", "1", "REV"}, "-ERR syntax error\r\n"},
+		{[]string{"ZRANGE", "z", "a", "1"}, "-ERR value is not an integer or out of range\r\n"},
+	});
+
+	// lex ranges, every member has the same score
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d", "0", "e"}, ":5\r\n"},
+		{[]string{"ZRANGE", "lex", "[b", "(d", "BYLEX"}, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{[]string{"ZRANGEBYLEX", "lex", "-", "[b"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]string{"ZREVRANGEBYLEX", "lex", "+", "(c", "LIMIT", "0", "1"}, "*1\r\n$1\r\ne\r\n"},
+		{[]string{"ZRANGE", "lex", "(d", "-", "BYLEX", "REV"}, "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n"},
+		{[]string{"ZLEXCOUNT", "lex", "-", "+"}, ":5\r\n"},
+		{[]string{"ZLEXCOUNT", "lex", "(a", "[c"}, ":2\r\n"},
+		{[]string{"ZLEXCOUNT", "lex", "+", "-"}, ":0\r\n"},
+		{[]string{"ZLEXCOUNT", "lex", "a", "+"}, "-ERR min or max not valid string range item\r\n"},
+	});
+
+	// RESP3 clients get [member, score] pairs
+	client := NewClient(nil);
+	cache.ExecuteCommands(client, command("HELLO", "3"));
+	reply := cache.ExecuteCommands(client, command("ZRANGE", "z", "0", "0", "WITHSCORES"));
+	if got := string(resp.Encode(reply, resp.RESP3)); got != "*1\r\n*2\r\n$1\r\na\r\n,1\r\n" {
+		t.Errorf("Expected a nested array in RESP3, but got %q", got);
+	};
+}
+
+func TestZRemRange(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e"}, ":5\r\n"},
+		{[]string{"ZREMRANGEBYRANK", "z", "0", "1"}, ":2\r\n"},
+		{[]string{"ZREMRANGEBYRANK", "z", "-1", "-1"}, ":1\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZREMRANGEBYSCORE", "z", "(3", "+inf"}, ":1\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*1\r\n$1\r\nc\r\n"},
+
+		{[]string{"ZADD", "lex", "0", "a", "0", "b", "0", "c"}, ":3\r\n"},
+		{[]string{"ZREMRANGEBYLEX", "lex", "[b", "+"}, ":2\r\n"},
+		{[]string{"ZRANGE", "lex", "0", "-1"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"ZREMRANGEBYLEX", "lex", "-", "+"}, ":1\r\n"},
+		{[]string{"ZCARD", "lex"}, ":0\r\n"},
+		{[]string{"ZREMRANGEBYSCORE", "missing", "0", "1"}, ":0\r\n"},
+	});
+}
+
+// the skiplist is checked against a plain sorted slice after every random change
+func TestSkiplistMatchesSortedSlice(t *testing.T) {
+	zset := newSortedSet(nil);
+	rng := rand.New(rand.NewSource(1));
+
+	for i := 0; i < 5000; i++ {
+		member := "m" + strconv.Itoa(rng.Intn(300));
+		if rng.Intn(4) == 0 {
+			zset.remove(member);
+		} else {
+			zset.set(member, float64(rng.Intn(50)));
+		};
+	};
+
+	expected := make([]ZMember, 0, len(zset.dict));
+	for member, score := range zset.dict {
+		expected = append(expected, ZMember{member, score});
+	};
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Score != expected[j].Score {
+			return expected[i].Score < expected[j].Score;
+		};
+		return expected[i].Member < expected[j].Member;
+	});
+
+	if zset.zsl.length != len(expected) {
+		t.Fatalf("Skiplist has %d nodes, but the map %d members", zset.zsl.length, len(expected));
+	};
+
+	for i, m := range expected {
+		node := zset.zsl.byRank(i + 1);
+		if node == nil || node.member != m.Member || node.score != m.Score {
+			t.Fatalf("Rank %d: expected %v, but got %+v", i+1, m, node);
+		};
+		if rank := zset.zsl.rank(m.Score, m.Member); rank != i+1 {
+			t.Fatalf("Member %v: expected rank %d, but got %d", m, i+1, rank);
+		};
+	};
+
+	// walking backwards has to give the same order
+	i := len(expected) - 1;
+	for x := zset.zsl.tail; x != nil; x = x.backward {
+		if x.member != expected[i].Member {
+			t.Fatalf("Backward walk: expected %q at %d, but got %q", expected[i].Member, i, x.member);
+		};
+		i--;
+	};
+}
+
+func TestZSetAlgebra(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z1", "1", "a", "2", "b", "3", "c"}, ":3\r\n"},
+		{[]string{"ZADD", "z2", "4", "b", "5", "c", "6", "d"}, ":3\r\n"},
+		{[]string{"SADD", "plain", "c", "d", "e"}, ":3\r\n"},
+
+		{[]string{"ZUNION", "2", "z1", "z2", "WITHSCORES"}, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n6\r\n$1\r\nd\r\n$1\r\n6\r\n$1\r\nc\r\n$1\r\n8\r\n"},
+		{[]string{"ZINTER", "2", "z1", "z2", "AGGREGATE", "MAX", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n5\r\n"},
+		{[]string{"ZINTER", "2", "z1", "z2", "WEIGHTS", "2", "0.5", "AGGREGATE", "MIN", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$3\r\n2.5\r\n"},
+		{[]string{"ZDIFF", "2", "z1", "z2", "WITHSCORES"}, "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZDIFF", "2", "z1", "missing"}, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+
+		// plain sets are sorted sets where every score is 1
+		{[]string{"ZINTER", "3", "z1", "z2", "plain", "WITHSCORES"}, "*2\r\n$1\r\nc\r\n$1\r\n9\r\n"},
+		{[]string{"ZUNIONSTORE", "out", "2", "z2", "plain", "AGGREGATE", "MIN"}, ":4\r\n"},
+		{[]string{"ZRANGE", "out", "0", "-1", "WITHSCORES"}, "*8\r\n$1\r\nc\r\n$1\r\n1\r\n$1\r\nd\r\n$1\r\n1\r\n$1\r\ne\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n4\r\n"},
+		{[]string{"ZINTERSTORE", "out", "2", "z1", "z2"}, ":2\r\n"},
+		{[]string{"ZCARD", "out"}, ":2\r\n"},
+		{[]string{"ZDIFFSTORE", "out", "2", "z1", "z1"}, ":0\r\n"},
+		{[]string{"ZCARD", "out"}, ":0\r\n"},
+
+		// the destination is replaced whatever it held before
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"ZUNIONSTORE", "str", "1", "z1"}, ":3\r\n"},
+		{[]string{"ZSCORE", "str", "a"}, "$1\r\n1\r\n"},
+
+		// inf * 0 and inf + -inf count as 0
+		{[]string{"ZADD", "inf", "inf", "x"}, ":1\r\n"},
+		{[]string{"ZADD", "neginf", "-inf", "x"}, ":1\r\n"},
+		{[]string{"ZUNION", "1", "inf", "WEIGHTS", "0", "WITHSCORES"}, "*2\r\n$1\r\nx\r\n$1\r\n0\r\n"},
+		{[]string{"ZUNION", "2", "inf", "neginf", "WITHSCORES"}, "*2\r\n$1\r\nx\r\n$1\r\n0\r\n"},
+
+		{[]string{"ZINTERCARD", "2", "z1", "z2"}, ":2\r\n"},
+		{[]string{"ZINTERCARD", "2", "z1", "z2", "LIMIT", "1"}, ":1\r\n"},
+		{[]string{"ZINTERCARD", "2", "z1", "missing"}, ":0\r\n"},
+		{[]string{"ZINTERCARD", "0", "z1"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"ZINTERCARD", "1", "z1", "LIMIT", "-1"}, "-ERR LIMIT can't be negative\r\n"},
+
+		{[]string{"ZUNION", "0", "z1"}, "-ERR at least 1 input key is needed for 'zunion' command\r\n"},
+		{[]string{"ZUNION", "3", "z1", "z2"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNION", "2", "z1", "z2", "WEIGHTS", "1"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNION", "2", "z1", "z2", "WEIGHTS", "1", "x"}, "-ERR weight value is not a float\r\n"},
+		{[]string{"ZUNION", "2", "z1", "z2", "AGGREGATE", "AVG"}, "-ERR syntax error\r\n"},
+		{[]string{"ZDIFF", "2", "z1", "z2", "AGGREGATE", "MIN"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNIONSTORE", "out", "1", "z1", "WITHSCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZUNION", "2", "z1", "str2", "WITHSCORES"}, "*6\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"SET", "str2", "v"}, "+OK\r\n"},
+		{[]string{"ZUNION", "2", "z1", "str2"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"ZINTERCARD", "2", "z1", "str2"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestZPop(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d"}, ":4\r\n"},
+		{[]string{"ZPOPMIN", "z"}, "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZPOPMAX", "z", "2"}, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"ZPOPMIN", "z", "0"}, "*0\r\n"},
+		{[]string{"ZPOPMIN", "z", "-1"}, "-ERR value is out of range, must be positive\r\n"},
+		{[]string{"ZPOPMIN", "z", "10"}, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"ZPOPMIN", "z"}, "*0\r\n"},
+		{[]string{"ZCARD", "z"}, ":0\r\n"},
+
+		{[]string{"ZADD", "z2", "1", "a", "2", "b", "3", "c"}, ":3\r\n"},
+		{[]string{"ZMPOP", "2", "missing", "z2", "MAX", "COUNT", "2"}, "*2\r\n$2\r\nz2\r\n*2\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"ZMPOP", "1", "z2", "MIN"}, "*2\r\n$2\r\nz2\r\n*1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{[]string{"ZMPOP", "1", "z2", "MIN"}, "*-1\r\n"},
+		{[]string{"ZMPOP", "0", "z2", "MIN"}, "-ERR numkeys should be greater than 0\r\n"},
+		{[]string{"ZMPOP", "1", "z2", "MIDDLE"}, "-ERR syntax error\r\n"},
+		{[]string{"ZMPOP", "1", "z2", "MIN", "COUNT", "0"}, "-ERR count should be greater than 0\r\n"},
+		{[]string{"SET", "str", "v"}, "+OK\r\n"},
+		{[]string{"ZMPOP", "2", "str", "z2", "MIN"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{[]string{"ZPOPMAX", "str"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	});
+}
+
+func TestZRandMemberAndRangeStore(t *testing.T) {
+	cache := NewRedisServer();
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e"}, ":5\r\n"},
+		{[]string{"ZRANDMEMBER", "missing"}, "$-1\r\n"},
+		{[]string{"ZRANDMEMBER", "missing", "3"}, "*0\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "0"}, "*0\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "10", "WITHSCORES"}, "*10\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\ne\r\n$1\r\n5\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "1", "SCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "-9223372036854775807", "WITHSCORES"}, "-ERR value is out of range\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "-9223372036854775808"}, "-ERR value is out of range\r\n"},
+		{[]string{"ZRANDMEMBER", "z", "-9223372036854775807"}, "-ERR value is out of range\r\n"},
+
+		{[]string{"ZRANGESTORE", "dst", "z", "1", "3", "BYSCORE", "REV"}, ":0\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "z", "(4", "1", "BYSCORE", "REV", "LIMIT", "0", "2"}, ":2\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "z", "0", "0"}, ":1\r\n"},
+		{[]string{"ZRANGE", "dst", "0", "-1"}, "*1\r\n$1\r\na\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "missing", "0", "-1"}, ":0\r\n"},
+		{[]string{"ZCARD", "dst"}, ":0\r\n"},
+		{[]string{"ZRANGESTORE", "dst", "z", "0", "-1", "WITHSCORES"}, "-ERR syntax error\r\n"},
+	});
+
+	client := NewClient(nil);
+	for _, count := range []string{"3", "-20"} {
+		reply := cache.ExecuteCommands(client, command("ZRANDMEMBER", "z", count));
+		want, _ := strconv.Atoi(count);
+		if want < 0 {
+			want = -want;
+		};
+		if len(reply.Elems) != want {
+			t.Fatalf("ZRANDMEMBER z %s: expected %d members, but got %d", count, want, len(reply.Elems));
+		};
+
+		seen := map[string]bool{};
+		for _, elem := range reply.Elems {
+			if elem.Str < "a" || elem.Str > "e" {
+				t.Errorf("ZRANDMEMBER returned %q, which is not a member", elem.Str);
+			};
+			if seen[elem.Str] && count == "3" {
+				t.Errorf("ZRANDMEMBER with a positive count returned %q twice", elem.Str);
+			};
+			seen[elem.Str] = true;
+		};
+	};
+}
+
+func TestZSetEncodings(t *testing.T) {
+	cache := NewRedisServer();
+	cache.Config.ZSetMaxListpackEntries = 3;
+	cache.Config.ZSetMaxListpackValue = 5;
+
+	runSteps(t, cache, []step{
+		{[]string{"ZADD", "z", "2", "b", "1", "a", "2", "a"}, ":2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "z"}, "$8\r\nlistpack\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, "*4\r\n$1\r\na\r\n$1\r\n2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{[]string{"ZADD", "z", "3", "c"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "z"}, "$8\r\nlistpack\r\n"},
+		{[]string{"ZADD", "z", "4", "d"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "z"}, "$8\r\nskiplist\r\n"},
+		{[]string{"ZRANGE", "z", "0", "-1"}, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{[]string{"ZADD", "long", "1", "abcdef"}, ":1\r\n"},
+		{[]string{"OBJECT", "ENCODING", "long"}, "$8\r\nskiplist\r\n"},
+		// the result of a store gets the encoding that fits it
+		{[]string{"ZRANGESTORE", "dst", "z", "0", "1"}, ":2\r\n"},
+		{[]string{"OBJECT", "ENCODING", "dst"}, "$8\r\nlistpack\r\n"},
+		{[]string{"ZUNIONSTORE", "dst", "2", "z", "long"}, ":5\r\n"},
+		{[]string{"OBJECT", "ENCODING", "dst"}, "$8\r\nskiplist\r\n"},
+	});
+}
+
+// a listpack and a skiplist must answer every command the same way, replies are compared for random commands
+func TestPackedZSetMatchesSkiplist(t *testing.T) {
+	packed, skiplist := NewRedisServer(), NewRedisServer();
+	packed.Config.ZSetMaxListpackEntries = 1000;
+	skiplist.Config.ZSetMaxListpackEntries = 0;
+	rng := rand.New(rand.NewSource(7));
+
+	member := func() string { return string(rune('a' + rng.Intn(20))); };
+	score := func() string { return strconv.Itoa(rng.Intn(10) - 5); };
+	// lex ranges only mean something when all scores are the same, they get a set of their own
+	commands := []func() []string{
+		func() []string { return []string{"ZADD", "z", score(), member(), score(), member()}; },
+		func() []string { return []string{"ZADD", "lex", "0", member(), "0", member()}; },
+		func() []string { return []string{"ZADD", "z", "GT", "CH", score(), member()}; },
+		func() []string { return []string{"ZINCRBY", "z", score(), member()}; },
+		func() []string { return []string{"ZREM", "z", member()}; },
+		func() []string { return []string{"ZSCORE", "z", member()}; },
+		func() []string { return []string{"ZRANK", "z", member(), "WITHSCORE"}; },
+		func() []string { return []string{"ZREVRANK", "z", member()}; },
+		func() []string { return []string{"ZRANGE", "z", score(), score(), "WITHSCORES"}; },
+		func() []string { return []string{"ZRANGE", "z", score(), score(), "REV"}; },
+		func() []string { return []string{"ZRANGE", "z", "(" + score(), score(), "BYSCORE", "LIMIT", "1", "3"}; },
+		func() []string { return []string{"ZRANGE", "z", "+inf", "(" + score(), "BYSCORE", "REV", "WITHSCORES"}; },
+		func() []string { return []string{"ZRANGE", "lex", "[" + member(), "(" + member(), "BYLEX"}; },
+		func() []string { return []string{"ZRANGE", "lex", "+", "[" + member(), "BYLEX", "REV", "LIMIT", "0", "2"}; },
+		func() []string { return []string{"ZCOUNT", "z", score(), "(" + score()}; },
+		func() []string { return []string{"ZLEXCOUNT", "lex", "-", "[" + member()}; },
+		func() []string { return []string{"ZREMRANGEBYRANK", "z", "0", "0"}; },
+		func() []string { return []string{"ZREMRANGEBYSCORE", "z", score(), score()}; },
+		func() []string { return []string{"ZREMRANGEBYLEX", "lex", "[" + member(), "[" + member()}; },
+		func() []string { return []string{"ZPOPMIN", "z"}; },
+		func() []string { return []string{"ZPOPMAX", "z", "2"}; },
+		func() []string { return []string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}; },
+		func() []string { return []string{"ZCARD", "z"}; },
+	};
+
+	for i := 0; i < 5000; i++ {
+		// more adds than removals, so the set keeps some members around
+		args := commands[rng.Intn(len(commands))]();
+		if rng.Intn(3) == 0 {
+			args = commands[rng.Intn(2)]();
+		};
+
+		want := string(resp.Encode(skiplist.ExecuteCommands(NewClient(nil), command(args...)), resp.RESP2));
+		got := string(resp.Encode(packed.ExecuteCommands(NewClient(nil), command(args...)), resp.RESP2));
+		if got != want {
+			t.Fatalf("step %d %q: the skiplist replied %q, but the listpack %q", i, args, want, got);
+		};
+	};
+
+	if encoding, _ := packed.OBJECTENCODING("z"); encoding != "listpack" {
+		t.Errorf("Expected the listpack to be used, but it is a %s", encoding);
+	};
+}
@@ -29,7 +29,25 @@ func HandleRESP(reader *bufio.Reader) (interface{}, error) {
 		return parseNulls(reader);
 	case '#':
 		return parseBooleans(reader);
+	case ',':
+		return parseDoubles(reader);
+	case '(':
+		return parseBigNumbers(reader);
+	case '=':
+		return parseVerbatimStrings(reader);
+	case '%':
+		return parseMaps(reader);
+	case '~', '>':
+		// sets and pushes are laid out exactly like arrays, only the type indicator differs
+		return parseArrays(reader);
+	case '|':
+		return parseAttributes(reader);
 	default:
-		return nil, fmt.Errorf("unknown RESP type indicator: %c", typeIndicator);
+		// anything that does not start with a type indicator is an inline command, e.g. "PING\r\n"
+		// putting the first byte back, it is the first character of the command name
+		if err := reader.UnreadByte(); err != nil {
+			return nil, err;
+		};
+		return parseInline(reader);
 	}
 }
\ No newline at end of file
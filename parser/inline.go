@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// inline commands are what telnet/nc users and health-check scripts send:
+// a plain line like "SET hello world\r\n" instead of a RESP array of bulk strings
+
+func parseInline(reader *bufio.Reader) ([]interface{}, error) {
+	for {
+		line, err := reader.ReadString('\n');
+		if err != nil {
+			return nil, err;
+		};
+
+		// both "\r\n" and a bare "\n" end an inline command
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r");
+
+		args, err := splitInlineArgs(line);
+		if err != nil {
+			return nil, err;
+		};
+
+		// empty lines (someone pressing enter in telnet) are skipped, just like Redis does
+		if len(args) == 0 {
+			continue;
+		};
+
+		result := make([]interface{}, len(args));
+		for i, arg := range args {
+			result[i] = arg;
+		};
+		return result, nil;
+	};
+}
+
+// splitInlineArgs splits an inline command the way Redis' sdssplitargs does:
+// arguments are separated by whitespace, "double quoted" arguments understand \n \r \t \b \a \\ \" and \xHH escapes,
+// 'single quoted' arguments only understand \' and a closing quote has to be followed by whitespace or the end of the line
+func splitInlineArgs(line string) ([]string, error) {
+	args := []string{};
+	i := 0;
+
+	for {
+		// skipping the blanks in front of the next argument
+		for i < len(line) && isInlineSpace(line[i]) {
+			i++;
+		};
+		if i == len(line) {
+			return args, nil;
+		};
+
+		var current strings.Builder;
+		inDoubleQuotes, inSingleQuotes := false, false;
+		done := false;
+
+		for !done {
+			if inDoubleQuotes {
+				if i == len(line) {
+					return nil, fmt.Errorf("Protocol error: unbalanced quotes in request");
+				};
+
+				switch {
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]):
+					current.WriteByte(hexDigitValue(line[i+2])*16 + hexDigitValue(line[i+3]));
+					i += 3;
+				case line[i] == '\\' && i+1 < len(line):
+					i++;
+					switch line[i] {
+					case 'n':
+						current.WriteByte('\n');
+					case 'r':
+						current.WriteByte('\r');
+					case 't':
+						current.WriteByte('\t');
+					case 'b':
+						current.WriteByte('\b');
+					case 'a':
+						current.WriteByte('\a');
+					default:
+						current.WriteByte(line[i]);
+					};
+				case line[i] == '"':
+					// the closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, fmt.Errorf("Protocol error: unbalanced quotes in request");
+					};
+					done = true;
+				default:
+					current.WriteByte(line[i]);
+				};
+			} else if inSingleQuotes {
+				if i == len(line) {
+					return nil, fmt.Errorf("Protocol error: unbalanced quotes in request");
+				};
+
+				switch {
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					current.WriteByte('\'');
+					i++;
+				case line[i] == '\'':
+					if i+1 < len(line) && !isInlineSpace(line[i+1]) {
+						return nil, fmt.Errorf("Protocol error: unbalanced quotes in request");
+					};
+					done = true;
+				default:
+					current.WriteByte(line[i]);
+				};
+			} else {
+				if i == len(line) {
+					break;
+				};
+
+				switch line[i] {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true;
+				case '"':
+					inDoubleQuotes = true;
+				case '\'':
+					inSingleQuotes = true;
+				default:
+					current.WriteByte(line[i]);
+				};
+			};
+
+			if i < len(line) {
+				i++;
+			};
+		};
+
+		args = append(args, current.String());
+	};
+}
+
+func isInlineSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == 0;
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F');
+}
+
+func hexDigitValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0';
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10;
+	default:
+		return c - 'A' + 10;
+	};
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -15,46 +17,45 @@ func parseSimpleStrings(reader *bufio.Reader) (string, error) {
 		return "Error parsing simple string", err
 	};
 
-	line = strings.TrimSpace(line)
-	if len(line) == 0 || line[0] != '+' {
-		// fmt.Printf("Expected simple string but received: %s", line)
-		return "", fmt.Errorf("expected simple string but received: %s", line)
-	}
+	// the '+' type indicator has already been consumed by HandleRESP
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// ErrorReply is what an error reply ("-ERR something\r\n") parses into
+// it is a separate type so that callers can tell "+OK" apart from "-OK"
+type ErrorReply string
 
-	return line[1:], nil
+func (e ErrorReply) Error() string {
+	return string(e)
 }
 
-func parseErrors(reader *bufio.Reader) (string, error) {
+func parseErrors(reader *bufio.Reader) (ErrorReply, error) {
 	line, err := reader.ReadString('\n');
 	if err != nil {
 		fmt.Println(err);
-		return "Error parsing", err;
+		return "", err;
 	};
 
-	line = strings.TrimSpace(line)
-	if len(line) == 0 || line[0] != '-' {
-		return "", fmt.Errorf("expected error but received: %s", line)
-	}
-
-	return line[1:], nil
+	return ErrorReply(strings.TrimSuffix(line, "\r\n")), nil
 }
 
-func parseIntegers(reader *bufio.Reader) (string, error) {
+func parseIntegers(reader *bufio.Reader) (int64, error) {
 	line, err := reader.ReadString('\n');
 	if err != nil {
 		fmt.Println(err);
-		return "", err;
+		return 0, err;
 	};
 
 	line = strings.TrimSpace(line);
-	if len(line) == 0 || line[0] != ':' {
-		return "", fmt.Errorf("expected integer but received: %s", line);
+	n, err := strconv.ParseInt(line, 10, 64);
+	if err != nil {
+		return 0, fmt.Errorf("expected integer but received: %s", line);
 	};
 
-	return line[1:], nil;
+	return n, nil;
 }
 
-func parseBulkStrings(reader *bufio.Reader) (string, error) {
+func parseBulkStrings(reader *bufio.Reader) (interface{}, error) {
 	// example of a bulk string: $3\r\nfoo\r\n
 	line, err := reader.ReadString('\n');
 	if err != nil {
@@ -73,8 +74,7 @@ func parseBulkStrings(reader *bufio.Reader) (string, error) {
 	// if the stringLength is -1, it means the bulk string is null
 	// it will return nil
 	if stringLength < 0 {
-		fmt.Println("Bulk string length is negative, suggesting it is a null bulk string, returning nil");
-		return "nil", nil;
+		return nil, nil;
 	};
 
 	buf := make([]byte, stringLength);
@@ -142,19 +142,19 @@ func parseArrays(reader *bufio.Reader) ([]any, error) {
 	return result, nil;
 };
 
-func parseNulls(reader *bufio.Reader) (string, error) {
+func parseNulls(reader *bufio.Reader) (interface{}, error) {
 	line, err := reader.ReadString('\n');
 	if err != nil {
 		fmt.Println("Error reading null value");
-		return "", err;
+		return nil, err;
 	};
 
-	line = strings.TrimSpace(line);
-	if len(line) == 0 || line[0] != '_' {
-		return "", fmt.Errorf("expected null value but received: %s", line);
+	// a null is just "_\r\n", there should be nothing between the type indicator and CRLF
+	if strings.TrimSpace(line) != "" {
+		return nil, fmt.Errorf("expected null value but received: %s", line);
 	};
 
-	return "", nil;
+	return nil, nil;
 };
 
 func parseBooleans(reader *bufio.Reader) (bool, error) {
@@ -165,15 +165,11 @@ func parseBooleans(reader *bufio.Reader) (bool, error) {
 	};
 
 	line = strings.TrimSpace(line);
-	if len(line) == 0 || line[0] != '#' {
-		return false, fmt.Errorf("expected boolean value but received: %s", line);
-	};
-
-	if len(line) < 2 {
-		return false, fmt.Errorf("incomplete boolean value: %s", line);
+	if len(line) != 1 {
+		return false, fmt.Errorf("invalid boolean value: %s", line);
 	}
 
-	switch line[1] {
+	switch line[0] {
 	case 't':
 		return true, nil;
 	case 'f':
@@ -181,4 +177,110 @@ func parseBooleans(reader *bufio.Reader) (bool, error) {
 	default:
 		return false, fmt.Errorf("invalid boolean value: %s", line)
 	}
-}
\ No newline at end of file
+}
+// RESP3 types
+// a client that switched to RESP3 with HELLO 3 receives these, so the parser has to understand them as well
+
+func parseDoubles(reader *bufio.Reader) (float64, error) {
+	// example of a double: ,3.14\r\n or ,inf\r\n or ,-inf\r\n or ,nan\r\n
+	line, err := reader.ReadString('\n');
+	if err != nil {
+		return 0, err;
+	};
+
+	line = strings.TrimSpace(line);
+	switch line {
+	case "inf":
+		return math.Inf(1), nil;
+	case "-inf":
+		return math.Inf(-1), nil;
+	case "nan":
+		return math.NaN(), nil;
+	};
+
+	f, err := strconv.ParseFloat(line, 64);
+	if err != nil {
+		return 0, fmt.Errorf("invalid double value: %s", line);
+	};
+
+	return f, nil;
+}
+
+func parseBigNumbers(reader *bufio.Reader) (*big.Int, error) {
+	// example of a big number: (3492890328409238509324850943850943825024385\r\n
+	line, err := reader.ReadString('\n');
+	if err != nil {
+		return nil, err;
+	};
+
+	line = strings.TrimSpace(line);
+	n, ok := new(big.Int).SetString(line, 10);
+	if !ok {
+		return nil, fmt.Errorf("invalid big number: %s", line);
+	};
+
+	return n, nil;
+}
+
+func parseVerbatimStrings(reader *bufio.Reader) (string, error) {
+	// example of a verbatim string: =15\r\ntxt:Some string\r\n
+	// the payload is read exactly like a bulk string, then the "txt:" format prefix is dropped
+	value, err := parseBulkStrings(reader);
+	if err != nil {
+		return "", err;
+	};
+
+	text, ok := value.(string);
+	if !ok || len(text) < 4 || text[3] != ':' {
+		return "", fmt.Errorf("invalid verbatim string: %v", value);
+	};
+
+	return text[4:], nil;
+}
+
+func parseMaps(reader *bufio.Reader) (map[string]interface{}, error) {
+	// example of a map: %2\r\n+first\r\n:1\r\n+second\r\n:2\r\n
+	// the length counts key-value pairs, so 2*length values follow
+	line, err := reader.ReadString('\n');
+	if err != nil {
+		return nil, err;
+	};
+
+	line = strings.TrimSpace(line);
+	pairs, err := strconv.Atoi(line);
+	if err != nil || pairs < 0 {
+		return nil, fmt.Errorf("invalid map length: %s", line);
+	};
+
+	result := make(map[string]interface{}, pairs);
+	for i := 0; i < pairs; i++ {
+		key, err := HandleRESP(reader);
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key %d in map: %w", i, err);
+		};
+
+		value, err := HandleRESP(reader);
+		if err != nil {
+			return nil, fmt.Errorf("error parsing value %d in map: %w", i, err);
+		};
+
+		// keys are almost always strings, scalar keys of other types are stored by their text form
+		switch key.(type) {
+		case []interface{}, map[string]interface{}:
+			return nil, fmt.Errorf("unsupported aggregate key %d in map", i);
+		};
+		result[fmt.Sprint(key)] = value;
+	};
+
+	return result, nil;
+}
+
+func parseAttributes(reader *bufio.Reader) (interface{}, error) {
+	// example of an attribute: |1\r\n+ttl\r\n:3600\r\n followed by the actual reply
+	// attributes are auxiliary data, they are read and skipped and the reply they decorate is returned
+	if _, err := parseMaps(reader); err != nil {
+		return nil, err;
+	};
+
+	return HandleRESP(reader);
+}
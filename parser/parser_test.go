@@ -66,4 +66,105 @@ func TestHandleRESP_Arrays(t *testing.T) {
 			};
 		});
 	};
-};
\ No newline at end of file
+};
+func TestHandleRESP_RESP3Types(t *testing.T) {
+	testCases := []struct {
+		name string
+		input string
+		expected interface{}
+		expectError bool
+	}{
+		{name: "Double", input: ",3.14\r\n", expected: 3.14},
+		{name: "Boolean", input: "#f\r\n", expected: false},
+		{name: "Null", input: "_\r\n", expected: nil},
+		{name: "Verbatim string", input: "=15\r\ntxt:Some string\r\n", expected: "Some string"},
+		{name: "Map", input: "%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n", expected: map[string]interface{}{"first": int64(1), "second": int64(2)}},
+		{name: "Set", input: "~2\r\n+a\r\n+b\r\n", expected: []interface{}{"a", "b"}},
+		{name: "Push", input: ">2\r\n+message\r\n+hi\r\n", expected: []interface{}{"message", "hi"}},
+		{name: "Attribute before a reply", input: "|1\r\n+key-popularity\r\n,0.19\r\n:42\r\n", expected: int64(42)},
+		{name: "Invalid double", input: ",abc\r\n", expectError: true},
+		{name: "Invalid big number", input: "(12a\r\n", expectError: true},
+		{name: "Verbatim string without format", input: "=2\r\nhi\r\n", expectError: true},
+	};
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tc.input));
+			result, err := HandleRESP(reader);
+
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected an error, but got nil");
+				}
+				return
+			};
+
+			if err != nil {
+				t.Fatalf("Did not expect an error, but got: %v", err);
+			};
+
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, but got %#v", tc.expected, result);
+			};
+		});
+	};
+};
+
+func TestHandleRESP_Inline(t *testing.T) {
+	testCases := []struct {
+		name string
+		input string
+		expected []interface{}
+		expectError bool
+	}{
+		{name: "PING", input: "PING\r\n", expected: []interface{}{"PING"}},
+		{name: "Bare newline", input: "PING\n", expected: []interface{}{"PING"}},
+		{name: "Arguments separated by several blanks", input: "SET  a \t b\r\n", expected: []interface{}{"SET", "a", "b"}},
+		{name: "Empty lines are skipped", input: "\r\n\r\nGET a\r\n", expected: []interface{}{"GET", "a"}},
+		{name: "Double quotes keep spaces", input: "SET greeting \"hello world\"\r\n", expected: []interface{}{"SET", "greeting", "hello world"}},
+		{name: "Escapes in double quotes", input: "SET k \"a\\r\\n\\x41\\\"\"\r\n", expected: []interface{}{"SET", "k", "a\r\nA\""}},
+		{name: "Single quotes are literal", input: "SET k 'it\\'s \\n'\r\n", expected: []interface{}{"SET", "k", "it's \\n"}},
+		{name: "Empty quoted argument", input: "SET k \"\"\r\n", expected: []interface{}{"SET", "k", ""}},
+		{name: "Unbalanced double quotes", input: "SET k \"abc\r\n", expectError: true},
+		{name: "Unbalanced single quotes", input: "SET k 'abc\r\n", expectError: true},
+		{name: "Closing quote followed by a character", input: "SET k \"a\"b\r\n", expectError: true},
+	};
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tc.input));
+			result, err := HandleRESP(reader);
+
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected an error, but got nil");
+				}
+				return
+			};
+
+			if err != nil {
+				t.Fatalf("Did not expect an error, but got: %v", err);
+			};
+
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, but got %#v", tc.expected, result);
+			};
+		});
+	};
+};
+
+// inline and RESP commands can be mixed on the same connection
+func TestHandleRESP_InlineAndArraysMixed(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("PING\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\nECHO hi\r\n"));
+	expected := [][]interface{}{{"PING"}, {"GET", "a"}, {"ECHO", "hi"}};
+
+	for i, want := range expected {
+		result, err := HandleRESP(reader);
+		if err != nil {
+			t.Fatalf("command %d: did not expect an error, but got: %v", i, err);
+		};
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("command %d: expected %#v, but got %#v", i, want, result);
+		};
+	};
+};
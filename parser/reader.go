@@ -0,0 +1,314 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+)
+
+// HandleRESP builds a fresh interface{} for every element it reads, which is fine for replies but not for the
+// request path: every argument of every command gets boxed, and the length headers are trusted blindly
+// Reader is the request side counterpart: it only understands what clients send (arrays of bulk strings and
+// inline commands), hands the arguments out as [][]byte backed by one reusable buffer and refuses lengths
+// above the configured limits before allocating anything for them
+
+const (
+	// proto-max-bulk-len in redis.conf, 512mb by default
+	DefaultMaxBulkLen = 512 * 1024 * 1024
+
+	// the largest "*N" a client may send, Redis refuses anything that does not fit into an int32
+	DefaultMaxMultibulkLen = math.MaxInt32
+
+	// inline commands and length headers are single lines, Redis gives up on lines longer than 64kb
+	maxInlineLen = 64 * 1024
+
+	// no matter what a header claims, never reserve more than this up front
+	// the buffers grow as the data actually arrives, so a lying "*2147483647" or "$999999999" costs nothing
+	maxPreallocArgs  = 1024
+	maxPreallocBytes = 64 * 1024
+)
+
+// ProtocolError is returned for malformed requests, its message matches the one Redis sends
+// before closing the connection, e.g. "Protocol error: invalid bulk length"
+type ProtocolError string
+
+func (e ProtocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+type Reader struct {
+	MaxBulkLen      int64
+	MaxMultibulkLen int64
+
+	// BeforeRead, when set, is called every time the reader is about to wait for more bytes from the connection,
+	// also in the middle of a command; the server flushes the replies it owes there, a client may well hold back
+	// the rest of a pipeline until it has read them
+	BeforeRead func()
+
+	r       *bufio.Reader
+	line    []byte   // scratch space for lines longer than the bufio buffer
+	data    []byte   // the bytes of every argument of the current command, back to back
+	offsets []int    // where each argument ends inside data
+	args    [][]byte // the slices handed out to the caller, reused between commands
+}
+
+func NewReader(rd io.Reader) *Reader {
+	r := &Reader{
+		MaxBulkLen:      DefaultMaxBulkLen,
+		MaxMultibulkLen: DefaultMaxMultibulkLen,
+	}
+	r.r = bufio.NewReader(hookedReader{rd: rd, owner: r})
+	return r
+}
+
+// hookedReader sits between the bufio buffer and the connection, it only gets called once the buffer has nothing
+// left to give, which is exactly when reading is going to block
+type hookedReader struct {
+	rd    io.Reader
+	owner *Reader
+}
+
+func (h hookedReader) Read(p []byte) (int, error) {
+	if h.owner.BeforeRead != nil {
+		h.owner.BeforeRead()
+	}
+	return h.rd.Read(p)
+}
+
+// Buffered returns how many bytes have been received but not consumed yet
+// a non-zero value means the client has already sent (part of) its next command
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// WaitInput blocks until the client sends more bytes or the connection fails, without consuming anything
+// blocked commands use it to notice a client that went away while they wait
+func (r *Reader) WaitInput() error {
+	_, err := r.r.Peek(1)
+	return err
+}
+
+// ReadCommand reads the next command, either "*2\r\n$3\r\nGET\r\n$1\r\na\r\n" or "GET a\r\n"
+// the returned slices are only valid until the next call, callers that keep an argument around have to copy it
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	for {
+		r.data = r.data[:0]
+		r.offsets = r.offsets[:0]
+
+		first, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if first == '*' {
+			err = r.readMultibulk()
+		} else {
+			r.r.UnreadByte()
+			err = r.readInline()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// "*0\r\n" and empty inline lines are not commands, Redis silently waits for the next one
+		if len(r.offsets) > 0 {
+			return r.collectArgs(), nil
+		}
+	}
+}
+
+func (r *Reader) readMultibulk() error {
+	line, err := r.readLine()
+	if err == errLineTooLong {
+		return ProtocolError("too big mbulk count string")
+	}
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	count, ok := parseLength(line)
+	if !ok || count > r.MaxMultibulkLen {
+		return ProtocolError("invalid multibulk length")
+	}
+
+	// "*-1\r\n" is a null array, there is nothing to execute
+	if count <= 0 {
+		return nil
+	}
+
+	if cap(r.offsets) < int(min(count, maxPreallocArgs)) {
+		r.offsets = make([]int, 0, min(count, maxPreallocArgs))
+	}
+
+	for i := int64(0); i < count; i++ {
+		indicator, err := r.r.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if indicator != '$' {
+			return ProtocolError("expected '$', got '" + string(indicator) + "'")
+		}
+
+		line, err := r.readLine()
+		if err == errLineTooLong {
+			return ProtocolError("too big bulk count string")
+		}
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+
+		length, ok := parseLength(line)
+		if !ok || length < 0 || length > r.MaxBulkLen {
+			return ProtocolError("invalid bulk length")
+		}
+
+		if err := r.readBulk(int(length)); err != nil {
+			return err
+		}
+		r.offsets = append(r.offsets, len(r.data))
+	}
+
+	return nil
+}
+
+// readBulk appends the next length bytes plus the trailing CRLF check to data
+func (r *Reader) readBulk(length int) error {
+	start := len(r.data)
+
+	// small arguments are read in one go, big ones in chunks so memory only grows with the bytes really received
+	for read := 0; read < length; {
+		chunk := min(length-read, maxPreallocBytes)
+		r.data = grow(r.data, chunk)
+		n, err := io.ReadFull(r.r, r.data[start+read:start+read+chunk])
+		read += n
+		if err != nil {
+			r.data = r.data[:start+read]
+			return unexpectedEOF(err)
+		}
+	}
+
+	cr, err := r.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	lf, err := r.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if cr != '\r' || lf != '\n' {
+		return ProtocolError("expected CRLF after bulk string")
+	}
+
+	return nil
+}
+
+func (r *Reader) readInline() error {
+	line, err := r.readLine()
+	if err == errLineTooLong {
+		return ProtocolError("too big inline request")
+	}
+	if err != nil {
+		return err
+	}
+
+	args, err := splitInlineArgs(string(line))
+	if err != nil {
+		return ProtocolError("unbalanced quotes in request")
+	}
+
+	for _, arg := range args {
+		r.data = append(r.data, arg...)
+		r.offsets = append(r.offsets, len(r.data))
+	}
+	return nil
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine returns the next line without its "\r\n" (or bare "\n")
+// lines that fit into the bufio buffer, which is nearly all of them, are not copied out of it
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// a long inline command, collecting the pieces until the newline shows up or the limit is hit
+		r.line = append(r.line[:0], line...)
+		for err == bufio.ErrBufferFull && len(r.line) <= maxInlineLen {
+			line, err = r.r.ReadSlice('\n')
+			r.line = append(r.line, line...)
+		}
+		line = r.line
+	}
+	if err == bufio.ErrBufferFull || (err == nil && len(line) > maxInlineLen) {
+		return nil, errLineTooLong
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+func (r *Reader) collectArgs() [][]byte {
+	r.args = r.args[:0]
+	start := 0
+	for _, end := range r.offsets {
+		// capping the capacity so an append on one argument can never overwrite the next one
+		r.args = append(r.args, r.data[start:end:end])
+		start = end
+	}
+	return r.args
+}
+
+// parseLength parses the number in a "*N" or "$N" header without going through a string
+func parseLength(line []byte) (int64, bool) {
+	if len(line) == 0 {
+		return 0, false
+	}
+
+	negative := line[0] == '-'
+	if negative {
+		line = line[1:]
+		if len(line) == 0 {
+			return 0, false
+		}
+	}
+
+	var n int64
+	for _, c := range line {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+		if n > 1<<40 {
+			return 0, false // way past any limit, no need to keep going
+		}
+	}
+
+	if negative {
+		return -n, true
+	}
+	return n, true
+}
+
+// grow makes room for n more bytes at the end of buf
+func grow(buf []byte, n int) []byte {
+	if cap(buf)-len(buf) < n {
+		bigger := make([]byte, len(buf), 2*cap(buf)+n)
+		copy(bigger, buf)
+		buf = bigger
+	}
+	return buf[:len(buf)+n]
+}
+
+// a connection closing in the middle of a command is not a clean disconnect
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReader_ReadCommand(t *testing.T) {
+	testCases := []struct {
+		name string
+		input string
+		expected [][]string
+	}{
+		{
+			name: "Array of bulk strings",
+			input: "*3\r\n$3\r\nSET\r\n$5\r\nhello\r\n$5\r\nworld\r\n",
+			expected: [][]string{{"SET", "hello", "world"}},
+		},
+		{
+			name: "Inline command",
+			input: "SET greeting \"hello world\"\r\n",
+			expected: [][]string{{"SET", "greeting", "hello world"}},
+		},
+		{
+			name: "Pipelined commands of both kinds",
+			input: "PING\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\n*1\r\n$4\r\nPING\r\n",
+			expected: [][]string{{"PING"}, {"GET", "a"}, {"PING"}},
+		},
+		{
+			name: "Empty arrays and empty lines are skipped",
+			input: "*0\r\n\r\n*-1\r\nPING\r\n",
+			expected: [][]string{{"PING"}},
+		},
+		{
+			name: "Binary safe arguments",
+			input: "*2\r\n$3\r\nSET\r\n$5\r\na\r\n\x00\xff\r\n",
+			expected: [][]string{{"SET", "a\r\n\x00\xff"}},
+		},
+		{
+			name: "Empty bulk string",
+			input: "*2\r\n$4\r\nECHO\r\n$0\r\n\r\n",
+			expected: [][]string{{"ECHO", ""}},
+		},
+	};
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(tc.input));
+
+			for i, want := range tc.expected {
+				args, err := reader.ReadCommand();
+				if err != nil {
+					t.Fatalf("command %d: did not expect an error, but got: %v", i, err);
+				};
+
+				got := make([]string, len(args));
+				for j, arg := range args {
+					got[j] = string(arg);
+				};
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("command %d: expected %q, but got %q", i, want, got);
+				};
+			};
+
+			if _, err := reader.ReadCommand(); err != io.EOF {
+				t.Errorf("Expected io.EOF after the last command, but got %v", err);
+			};
+		});
+	};
+};
+
+func TestReader_ProtocolErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		input string
+		maxBulkLen int64
+		maxMultibulkLen int64
+		expected string
+	}{
+		{name: "Huge multibulk length", input: "*2147483648\r\n", expected: "Protocol error: invalid multibulk length"},
+		{name: "Multibulk length above the configured limit", input: "*3\r\n", maxMultibulkLen: 2, expected: "Protocol error: invalid multibulk length"},
+		{name: "Non numeric multibulk length", input: "*abc\r\n", expected: "Protocol error: invalid multibulk length"},
+		{name: "Huge bulk length", input: "*1\r\n$999999999\r\n", expected: "Protocol error: invalid bulk length"},
+		{name: "Bulk length above the configured limit", input: "*1\r\n$11\r\nhello world\r\n", maxBulkLen: 10, expected: "Protocol error: invalid bulk length"},
+		{name: "Negative bulk length", input: "*1\r\n$-1\r\n", expected: "Protocol error: invalid bulk length"},
+		{name: "Element that is not a bulk string", input: "*1\r\n:1\r\n", expected: "Protocol error: expected '$', got ':'"},
+		{name: "Missing CRLF after bulk string", input: "*1\r\n$3\r\nfooXX", expected: "Protocol error: expected CRLF after bulk string"},
+		{name: "Unbalanced quotes", input: "SET a \"b\r\n", expected: "Protocol error: unbalanced quotes in request"},
+		{name: "Too big inline request", input: strings.Repeat("a", 70*1024), expected: "Protocol error: too big inline request"},
+	};
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := NewReader(strings.NewReader(tc.input));
+			if tc.maxBulkLen > 0 {
+				reader.MaxBulkLen = tc.maxBulkLen;
+			};
+			if tc.maxMultibulkLen > 0 {
+				reader.MaxMultibulkLen = tc.maxMultibulkLen;
+			};
+
+			_, err := reader.ReadCommand();
+			var protocolErr ProtocolError;
+			if !errors.As(err, &protocolErr) {
+				t.Fatalf("Expected a protocol error, but got %v", err);
+			};
+			if err.Error() != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, err.Error());
+			};
+		});
+	};
+};
+
+// a header that promises far more than the client sends must not make the reader reserve that memory
+func TestReader_LyingHeadersDoNotAllocate(t *testing.T) {
+	inputs := []string{
+		"*2147483647\r\n$3\r\nfoo\r\n",
+		"*1\r\n$536870912\r\nonly a few bytes",
+	};
+
+	for _, input := range inputs {
+		reader := NewReader(strings.NewReader(input));
+		_, err := reader.ReadCommand();
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected io.ErrUnexpectedEOF for %q, but got %v", input, err);
+		};
+
+		if cap(reader.data) > 1024*1024 || cap(reader.offsets) > maxPreallocArgs {
+			t.Errorf("Reader reserved %d bytes and %d argument slots for %q", cap(reader.data), cap(reader.offsets), input);
+		};
+	};
+};
+
+func TestReader_ReusesBuffers(t *testing.T) {
+	command := "*3\r\n$3\r\nSET\r\n$5\r\nhello\r\n$5\r\nworld\r\n";
+	reader := NewReader(bytes.NewReader([]byte(strings.Repeat(command, 1000))));
+
+	// the first command sizes the buffers, every command after that must be read without allocating
+	if _, err := reader.ReadCommand(); err != nil {
+		t.Fatal(err);
+	};
+
+	allocs := testing.AllocsPerRun(500, func() {
+		if _, err := reader.ReadCommand(); err != nil {
+			t.Fatal(err);
+		};
+	});
+	if allocs != 0 {
+		t.Errorf("Expected ReadCommand not to allocate, but it allocated %v times per command", allocs);
+	};
+};
+
+// chunkReader hands out one chunk per Read, like a connection that receives a pipeline in pieces
+type chunkReader struct {
+	chunks []string
+	log *[]string
+};
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF;
+	};
+	*c.log = append(*c.log, "read " + c.chunks[0]);
+	n := copy(p, c.chunks[0]);
+	c.chunks = c.chunks[1:];
+	return n, nil;
+};
+
+func TestReader_BeforeReadRunsBeforeEveryRefill(t *testing.T) {
+	var log []string;
+	reader := NewReader(&chunkReader{chunks: []string{"PING\r\n*1\r\n$4\r\nPI", "NG\r\n"}, log: &log});
+	reader.BeforeRead = func() {
+		log = append(log, "flush");
+	};
+
+	for i := 0; i < 2; i++ {
+		if _, err := reader.ReadCommand(); err != nil {
+			t.Fatalf("command %d: did not expect an error, but got: %v", i, err);
+		};
+	};
+
+	// the second chunk is only asked for after the hook ran, although half of the command was buffered already
+	expected := []string{"flush", "read PING\r\n*1\r\n$4\r\nPI", "flush", "read NG\r\n"};
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected %q, but got %q", expected, log);
+	};
+};
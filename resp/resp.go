@@ -0,0 +1,159 @@
+// package resp builds the replies the server sends back to its clients
+// commands return a typed Value instead of hand-formatting "$%d\r\n%s\r\n" strings,
+// and the Writer turns that Value into bytes on the wire
+package resp
+
+import "fmt"
+
+// Kind tells the encoder which RESP type a Value has to be written as
+type Kind int
+
+const (
+	KindSimpleString Kind = iota // +OK\r\n
+	KindError                    // -ERR message\r\n
+	KindInteger                  // :1\r\n
+	KindBulkString               // $5\r\nhello\r\n
+	KindNull                     // $-1\r\n, the "(nil)" reply of GET
+	KindNullArray                // *-1\r\n, the "(nil)" reply of an aborted EXEC
+	KindArray                    // *2\r\n...
+	KindMap                      // field-value pairs, e.g. HGETALL
+	KindSet                      // unordered members, e.g. SMEMBERS
+	KindDouble                   // floating point scores
+	KindPush                     // out-of-band data, e.g. pub/sub messages
+	KindBoolean                  // #t\r\n or #f\r\n
+	KindBigNumber                // integers that do not fit into 64 bits
+	KindVerbatim                 // text meant to be shown to a human as is, e.g. INFO
+	KindAttribute                // auxiliary key-value data that precedes the actual reply
+)
+
+// protocol versions a client can pick with HELLO
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// Value is one reply (or one element of an aggregate reply)
+// only the fields relevant for the Kind are used:
+// Str for strings, errors and big numbers, Int for integers and booleans, Float for doubles and Elems for aggregates
+// verbatim strings keep their three letter format ("txt", "mkd") in Str[:3] and the text in Str[4:]
+// attributes keep the attribute pairs in Elems[:len-1] and the reply they decorate in the last element
+type Value struct {
+	Kind  Kind
+	Str   string
+	Int   int64
+	Float float64
+	Elems []Value
+}
+
+// OK is the most common reply of all, so it is kept around instead of being rebuilt every time
+var OK = SimpleString("OK")
+
+func SimpleString(s string) Value {
+	return Value{Kind: KindSimpleString, Str: s}
+}
+
+// Error expects the message to start with the error code, just like Redis does
+// example: Error("ERR wrong number of arguments for 'get' command") or Error("WRONGTYPE ...")
+func Error(msg string) Value {
+	return Value{Kind: KindError, Str: msg}
+}
+
+func Errorf(format string, args ...any) Value {
+	return Error(fmt.Sprintf(format, args...))
+}
+
+func Integer(n int64) Value {
+	return Value{Kind: KindInteger, Int: n}
+}
+
+func BulkString(s string) Value {
+	return Value{Kind: KindBulkString, Str: s}
+}
+
+// BulkStrings is a shortcut for the very common "array of bulk strings" reply (LRANGE, SMEMBERS, ...)
+func BulkStrings(items []string) Value {
+	elems := make([]Value, len(items))
+	for i, item := range items {
+		elems[i] = BulkString(item)
+	}
+	return Array(elems...)
+}
+
+func Null() Value {
+	return Value{Kind: KindNull}
+}
+
+func NullArray() Value {
+	return Value{Kind: KindNullArray}
+}
+
+func Array(elems ...Value) Value {
+	if elems == nil {
+		elems = []Value{}
+	}
+	return Value{Kind: KindArray, Elems: elems}
+}
+
+// Map takes its elements as alternating keys and values: Map(k1, v1, k2, v2, ...)
+func Map(pairs ...Value) Value {
+	if len(pairs)%2 != 0 {
+		panic("resp: Map needs an even number of elements")
+	}
+	if pairs == nil {
+		pairs = []Value{}
+	}
+	return Value{Kind: KindMap, Elems: pairs}
+}
+
+func Set(elems ...Value) Value {
+	if elems == nil {
+		elems = []Value{}
+	}
+	return Value{Kind: KindSet, Elems: elems}
+}
+
+func Double(f float64) Value {
+	return Value{Kind: KindDouble, Float: f}
+}
+
+func Push(elems ...Value) Value {
+	if elems == nil {
+		elems = []Value{}
+	}
+	return Value{Kind: KindPush, Elems: elems}
+}
+
+func Boolean(b bool) Value {
+	v := Value{Kind: KindBoolean}
+	if b {
+		v.Int = 1
+	}
+	return v
+}
+
+// BigNumber takes the decimal digits of the number, e.g. BigNumber("3492890328409238509324850943850943825024385")
+func BigNumber(digits string) Value {
+	return Value{Kind: KindBigNumber, Str: digits}
+}
+
+// Verbatim takes a three letter format, "txt" for plain text and "mkd" for markdown
+func Verbatim(format string, text string) Value {
+	if len(format) != 3 {
+		panic("resp: verbatim string format must be exactly 3 characters")
+	}
+	return Value{Kind: KindVerbatim, Str: format + ":" + text}
+}
+
+// Attribute decorates a reply with extra key-value pairs, RESP2 clients only ever see the reply itself
+func Attribute(attrs Value, reply Value) Value {
+	if attrs.Kind != KindMap {
+		panic("resp: attributes must be a map")
+	}
+	elems := append(append([]Value{}, attrs.Elems...), reply)
+	return Value{Kind: KindAttribute, Elems: elems}
+}
+
+// IsError is handy for callers that need to know whether a command failed, e.g. inside EXEC
+func (v Value) IsError() bool {
+	return v.Kind == KindError
+}
@@ -0,0 +1,239 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"redis-clone/parser"
+)
+
+func TestEncode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{"Simple string", OK, "+OK\r\n"},
+		{"Error", Error("ERR unknown command"), "-ERR unknown command\r\n"},
+		{"Error with line breaks", Error("NOGROUP No such key 'k' or consumer group 'g\r\n+OK'"), "-NOGROUP No such key 'k' or consumer group 'g  +OK'\r\n"},
+		{"Simple string with line breaks", SimpleString("a\nb\rc"), "+a b c\r\n"},
+		{"Integer", Integer(-42), ":-42\r\n"},
+		{"Bulk string", BulkString("hello"), "$5\r\nhello\r\n"},
+		{"Empty bulk string", BulkString(""), "$0\r\n\r\n"},
+		{"Null", Null(), "$-1\r\n"},
+		{"Null array", NullArray(), "*-1\r\n"},
+		{"Empty array", Array(), "*0\r\n"},
+		{"Array", BulkStrings([]string{"a", "bc"}), "*2\r\n$1\r\na\r\n$2\r\nbc\r\n"},
+		{"Map is flattened", Map(BulkString("f"), BulkString("v")), "*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{"Set is an array", Set(BulkString("m")), "*1\r\n$1\r\nm\r\n"},
+		{"Double is a bulk string", Double(1.5), "$3\r\n1.5\r\n"},
+		{"Integral double", Double(1000000), "$7\r\n1000000\r\n"},
+		{"Infinite double", Double(math.Inf(1)), "$3\r\ninf\r\n"},
+		{"Push is an array", Push(BulkString("message")), "*1\r\n$7\r\nmessage\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(Encode(tc.value, RESP2))
+			if got != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEncodeRESP3(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{"Null", Null(), "_\r\n"},
+		{"Null array", NullArray(), "_\r\n"},
+		{"Map counts pairs", Map(BulkString("f"), Integer(1)), "%1\r\n$1\r\nf\r\n:1\r\n"},
+		{"Set", Set(BulkString("m")), "~1\r\n$1\r\nm\r\n"},
+		{"Double", Double(-2.5), ",-2.5\r\n"},
+		{"Negative infinity", Double(math.Inf(-1)), ",-inf\r\n"},
+		{"Push", Push(BulkString("message")), ">1\r\n$7\r\nmessage\r\n"},
+		{"Boolean", Boolean(true), "#t\r\n"},
+		{"Big number", BigNumber("12345678901234567890"), "(12345678901234567890\r\n"},
+		{"Verbatim", Verbatim("txt", "hi"), "=6\r\ntxt:hi\r\n"},
+		{
+			"Attribute",
+			Attribute(Map(BulkString("ttl"), Integer(5)), BulkString("v")),
+			"|1\r\n$3\r\nttl\r\n:5\r\n$1\r\nv\r\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(Encode(tc.value, RESP3))
+			if got != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// RESP3-only types still have to reach RESP2 clients in a form they understand
+func TestEncodeRESP3TypesForRESP2(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{"Boolean is an integer", Boolean(false), ":0\r\n"},
+		{"Big number is a bulk string", BigNumber("123"), "$3\r\n123\r\n"},
+		{"Verbatim drops the format", Verbatim("txt", "hi"), "$2\r\nhi\r\n"},
+		{"Attribute is dropped", Attribute(Map(BulkString("a"), Integer(1)), Integer(2)), ":2\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(Encode(tc.value, RESP2))
+			if got != tc.expected {
+				t.Errorf("Expected %q, but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// every encoded reply has to be readable by our own parser, which is what redis-cli does on the other end
+func TestEncodeRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    Value
+		expected interface{}
+	}{
+		{"Simple string", OK, "OK"},
+		{"Error", Error("WRONGTYPE nope"), parser.ErrorReply("WRONGTYPE nope")},
+		{"Integer", Integer(7), int64(7)},
+		{"Bulk string with CRLF inside", BulkString("a\r\nb"), "a\r\nb"},
+		{"Null", Null(), nil},
+		{
+			"Nested array",
+			Array(Integer(1), Array(BulkString("x")), Null()),
+			[]interface{}{int64(1), []interface{}{"x"}, nil},
+		},
+		{
+			"Map",
+			Map(BulkString("name"), BulkString("alice"), BulkString("age"), BulkString("30")),
+			[]interface{}{"name", "alice", "age", "30"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader(Encode(tc.value, RESP2)))
+			result, err := parser.HandleRESP(reader)
+			if err != nil {
+				t.Fatalf("Did not expect an error, but got: %v", err)
+			}
+
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, but got %#v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTripRESP3(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    Value
+		expected interface{}
+	}{
+		{"Null", Null(), nil},
+		{"Boolean", Boolean(true), true},
+		{"Double", Double(0.25), 0.25},
+		{"Big number", BigNumber("123456789012345678901234567890"), bigInt("123456789012345678901234567890")},
+		{"Verbatim", Verbatim("txt", "line one\r\nline two"), "line one\r\nline two"},
+		{
+			"Map",
+			Map(BulkString("name"), BulkString("alice"), BulkString("visits"), Integer(3)),
+			map[string]interface{}{"name": "alice", "visits": int64(3)},
+		},
+		{"Set", Set(BulkString("a"), BulkString("b")), []interface{}{"a", "b"}},
+		{"Push", Push(BulkString("message"), BulkString("news")), []interface{}{"message", "news"}},
+		{"Attribute", Attribute(Map(BulkString("ttl"), Integer(5)), BulkString("v")), "v"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader(Encode(tc.value, RESP3)))
+			result, err := parser.HandleRESP(reader)
+			if err != nil {
+				t.Fatalf("Did not expect an error, but got: %v", err)
+			}
+
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Expected %#v, but got %#v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func bigInt(digits string) *big.Int {
+	n, _ := new(big.Int).SetString(digits, 10)
+	return n
+}
+
+func TestMapNeedsPairs(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected Map with an odd number of elements to panic")
+		}
+	}()
+	Map(BulkString("lonely field"))
+}
+
+// countingWriter records every Write call separately
+type countingWriter struct {
+	writes []string
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, string(p))
+	return len(p), nil
+}
+
+func TestWriterBatchesUntilFlush(t *testing.T) {
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+
+	w.Buffer(OK)
+	w.Buffer(Integer(1))
+	if len(conn.writes) != 0 {
+		t.Fatalf("Expected nothing to be written before Flush, but got %q", conn.writes)
+	}
+	if w.Buffered() != len("+OK\r\n:1\r\n") {
+		t.Errorf("Expected %d buffered bytes, but got %d", len("+OK\r\n:1\r\n"), w.Buffered())
+	}
+
+	w.Flush()
+	w.Flush() // nothing left, must not produce an empty write
+
+	// WriteValue sends immediately but keeps the order with anything already buffered
+	w.Buffer(BulkString("a"))
+	w.WriteValue(Push(BulkString("message")))
+
+	expected := []string{"+OK\r\n:1\r\n", "$1\r\na\r\n*1\r\n$7\r\nmessage\r\n"}
+	if !reflect.DeepEqual(conn.writes, expected) {
+		t.Errorf("Expected writes %q, but got %q", expected, conn.writes)
+	}
+}
+
+func TestWriterFlushesLargeOutput(t *testing.T) {
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+
+	big := BulkString(string(make([]byte, maxPendingOutput)))
+	w.Buffer(big)
+	if len(conn.writes) != 1 || w.Buffered() != 0 {
+		t.Errorf("Expected output past %d bytes to be sent right away, got %d writes and %d buffered bytes", maxPendingOutput, len(conn.writes), w.Buffered())
+	}
+}
@@ -0,0 +1,242 @@
+package resp
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// Writer encodes replies onto the client's connection
+// replies are collected in an output buffer and sent with one Write call per Flush, so a client pipelining
+// thousands of commands gets all of their replies in a handful of syscalls instead of one per reply
+// the writer starts out speaking RESP2, HELLO 3 switches it to RESP3
+// it is safe for concurrent use: the connection's own goroutine and PUBLISH from other clients both write to it
+type Writer struct {
+	mu       sync.Mutex
+	w        io.Writer
+	buf      []byte
+	protocol int
+}
+
+const (
+	// once this much output is pending it is sent right away instead of waiting for the next Flush
+	maxPendingOutput = 64 * 1024
+
+	// a buffer that grew past this for one huge reply is dropped after flushing instead of being kept around
+	maxRetainedOutput = 1024 * 1024
+)
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, protocol: RESP2}
+}
+
+func (w *Writer) Protocol() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.protocol
+}
+
+func (w *Writer) SetProtocol(protocol int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.protocol = protocol
+}
+
+// Buffer adds v to the pending output without sending it
+func (w *Writer) Buffer(v Value) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = AppendValue(w.buf, v, w.protocol)
+	if len(w.buf) >= maxPendingOutput {
+		return w.flush()
+	}
+	return nil
+}
+
+// Flush sends everything buffered so far
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+// Buffered returns how many bytes are waiting for the next Flush
+func (w *Writer) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.buf)
+}
+
+// WriteValue sends v right away, together with anything that was already buffered so the order is kept
+func (w *Writer) WriteValue(v Value) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = AppendValue(w.buf, v, w.protocol)
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	_, err := w.w.Write(w.buf)
+	if cap(w.buf) > maxRetainedOutput {
+		w.buf = nil
+	} else {
+		w.buf = w.buf[:0]
+	}
+	return err
+}
+
+// Encode returns the wire representation of a single value in the given protocol version
+func Encode(v Value, protocol int) []byte {
+	return AppendValue(nil, v, protocol)
+}
+
+// AppendValue appends the encoding of v to dst and returns the extended buffer
+// RESP2 has none of the RESP3 types, so they are sent the way Redis sends them to RESP2 clients:
+// maps become flat [field, value, ...] arrays, sets and pushes become arrays, doubles, big numbers and
+// verbatim strings become bulk strings, booleans become 1/0 integers and attributes are dropped
+func AppendValue(dst []byte, v Value, protocol int) []byte {
+	resp3 := protocol >= RESP3
+
+	switch v.Kind {
+	case KindSimpleString:
+		return appendSimple(dst, '+', v.Str)
+
+	case KindError:
+		return appendSimple(dst, '-', v.Str)
+
+	case KindInteger:
+		return appendLine(dst, ':', v.Int)
+
+	case KindBulkString:
+		return appendBulk(dst, '$', v.Str)
+
+	case KindNull, KindNullArray:
+		if resp3 {
+			return append(dst, "_\r\n"...)
+		}
+		if v.Kind == KindNullArray {
+			return append(dst, "*-1\r\n"...)
+		}
+		return append(dst, "$-1\r\n"...)
+
+	case KindDouble:
+		if resp3 {
+			dst = append(dst, ',')
+			dst = append(dst, FormatDouble(v.Float)...)
+			return append(dst, '\r', '\n')
+		}
+		return appendBulk(dst, '$', FormatDouble(v.Float))
+
+	case KindBoolean:
+		if resp3 {
+			if v.Int != 0 {
+				return append(dst, "#t\r\n"...)
+			}
+			return append(dst, "#f\r\n"...)
+		}
+		return appendLine(dst, ':', v.Int)
+
+	case KindBigNumber:
+		if resp3 {
+			dst = append(dst, '(')
+			dst = append(dst, v.Str...)
+			return append(dst, '\r', '\n')
+		}
+		return appendBulk(dst, '$', v.Str)
+
+	case KindVerbatim:
+		if resp3 {
+			return appendBulk(dst, '=', v.Str)
+		}
+		// RESP2 clients get the text without the "txt:" format prefix
+		return appendBulk(dst, '$', v.Str[4:])
+
+	case KindAttribute:
+		reply := v.Elems[len(v.Elems)-1]
+		if resp3 {
+			pairs := v.Elems[:len(v.Elems)-1]
+			dst = appendLine(dst, '|', int64(len(pairs)/2))
+			for _, elem := range pairs {
+				dst = AppendValue(dst, elem, protocol)
+			}
+		}
+		return AppendValue(dst, reply, protocol)
+
+	case KindArray, KindMap, KindSet, KindPush:
+		indicator, length := byte('*'), len(v.Elems)
+		if resp3 {
+			switch v.Kind {
+			case KindMap:
+				// RESP3 maps count pairs, not elements
+				indicator, length = '%', len(v.Elems)/2
+			case KindSet:
+				indicator = '~'
+			case KindPush:
+				indicator = '>'
+			}
+		}
+
+		dst = appendLine(dst, indicator, int64(length))
+		for _, elem := range v.Elems {
+			dst = AppendValue(dst, elem, protocol)
+		}
+		return dst
+	}
+
+	// a Value built without one of the constructors, this is a programming error on our side
+	return append(dst, "-ERR internal error: unknown reply type\r\n"...)
+}
+
+// appendLine writes a type indicator followed by a number, e.g. ":42\r\n" or "*3\r\n"
+func appendLine(dst []byte, indicator byte, n int64) []byte {
+	dst = append(dst, indicator)
+	dst = strconv.AppendInt(dst, n, 10)
+	return append(dst, '\r', '\n')
+}
+
+// appendSimple writes a simple string or an error, e.g. "+OK\r\n"
+// these end at the first \r\n, so a line break in s (an error that echoes what the client sent, say) would end the
+// reply early and the rest would be read as another reply; like Redis, line breaks are written as spaces
+func appendSimple(dst []byte, indicator byte, s string) []byte {
+	dst = append(dst, indicator)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\r' || s[i] == '\n' {
+			dst = append(dst, ' ')
+		} else {
+			dst = append(dst, s[i])
+		}
+	}
+	return append(dst, '\r', '\n')
+}
+
+// appendBulk writes a length-prefixed string, e.g. "$5\r\nhello\r\n" or "=8\r\ntxt:text\r\n"
+func appendBulk(dst []byte, indicator byte, s string) []byte {
+	dst = appendLine(dst, indicator, int64(len(s)))
+	dst = append(dst, s...)
+	return append(dst, '\r', '\n')
+}
+
+// FormatDouble formats a float the way Redis prints scores: shortest representation, "inf" and "-inf" for infinities
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+
+	// plain notation for everyday numbers (1000000 rather than 1e+06), exponent notation for the extremes
+	if abs := math.Abs(f); abs == 0 || (abs >= 1e-4 && abs < 1e21) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}